@@ -3,9 +3,11 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"net/netip"
 	"net/url"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
@@ -29,8 +31,14 @@ type Config struct {
 	CookieKey                    string     `yaml:"cookie_key"`
 	Notifiers                    []Notifier `yaml:"notifiers"`
 	DisableMaintenanceToIncident bool       `yaml:"disable_maintenance_to_incident"`
-
-	Theme *Theme `yaml:"theme"`
+	// TrustedProxies are addresses (ip or cidr) of proxies allowed to tell who they act for in X-Actor header
+	TrustedProxies TrustedProxies `yaml:"trusted_proxies"`
+
+	Theme       *Theme       `yaml:"theme"`
+	Replication *Replication `yaml:"replication"`
+	Trash       *Trash       `yaml:"trash"`
+	Retention   *Retention   `yaml:"retention"`
+	Cache       *Cache       `yaml:"cache"`
 }
 
 type TlsConfig struct {
@@ -76,9 +84,24 @@ func (c *Config) Merge(other Config) {
 	if c.Log == nil {
 		c.Log = other.Log
 	}
+	if c.Replication == nil {
+		c.Replication = other.Replication
+	}
+	if c.Trash == nil {
+		c.Trash = other.Trash
+	}
+	if c.Retention == nil {
+		c.Retention = other.Retention
+	}
+	if c.Cache == nil {
+		c.Cache = other.Cache
+	}
 	if !c.DisableMaintenanceToIncident {
 		c.DisableMaintenanceToIncident = other.DisableMaintenanceToIncident
 	}
+	if len(c.TrustedProxies) == 0 {
+		c.TrustedProxies = other.TrustedProxies
+	}
 }
 
 func (c *Config) Validate() error {
@@ -136,6 +159,31 @@ func (c *Config) Validate() error {
 		return err
 	}
 
+	if c.Replication == nil {
+		c.Replication = &Replication{}
+	}
+
+	if c.Trash == nil {
+		c.Trash = &Trash{}
+	}
+	c.Trash.Validate()
+
+	if c.Retention == nil {
+		c.Retention = &Retention{}
+	}
+	if err := c.Retention.Validate(); err != nil {
+		return err
+	}
+
+	if c.Cache == nil {
+		c.Cache = &Cache{}
+	}
+	c.Cache.Validate()
+
+	if err := c.TrustedProxies.Validate(); err != nil {
+		return err
+	}
+
 	if len(c.Targets) == 0 {
 		return fmt.Errorf("at least one target must be define")
 	}
@@ -146,6 +194,42 @@ func (c *Config) Validate() error {
 	return nil
 }
 
+// TrustedProxies are ip addresses or cidr ranges.
+type TrustedProxies []string
+
+func (t TrustedProxies) Validate() error {
+	for _, proxy := range t {
+		if _, err := netip.ParsePrefix(proxy); err == nil {
+			continue
+		}
+		if _, err := netip.ParseAddr(proxy); err != nil {
+			return fmt.Errorf("invalid trusted proxy %s, it must be an ip address or a cidr", proxy)
+		}
+	}
+	return nil
+}
+
+// Trusts tells if remote address of a request (host:port or ip) is one of trusted proxies.
+func (t TrustedProxies) Trusts(remoteAddr string) bool {
+	addrPort, err := netip.ParseAddrPort(remoteAddr)
+	var addr netip.Addr
+	if err == nil {
+		addr = addrPort.Addr()
+	} else if addr, err = netip.ParseAddr(remoteAddr); err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, proxy := range t {
+		if prefix, err := netip.ParsePrefix(proxy); err == nil && prefix.Contains(addr) {
+			return true
+		}
+		if proxyAddr, err := netip.ParseAddr(proxy); err == nil && proxyAddr.Unmap() == addr {
+			return true
+		}
+	}
+	return false
+}
+
 type Target string
 
 func (t Target) Validate() (*url.URL, error) {
@@ -169,6 +253,103 @@ func (t Targets) Validate() error {
 	return nil
 }
 
+// Replication tunes how data are replicated when multiple targets are set.
+type Replication struct {
+	JournalPath string `yaml:"journal_path"`
+	// JournalEncryptionKeys and JournalEncryptionKeyFile encrypt journal as encryption_key and encryption_key_file do for a target
+	JournalEncryptionKeys    []string      `yaml:"journal_encryption_keys"`
+	JournalEncryptionKeyFile string        `yaml:"journal_encryption_key_file"`
+	ReconcileInterval        time.Duration `yaml:"reconcile_interval"`
+	ReconcileWindow          time.Duration `yaml:"reconcile_window"`
+	ReadStrategy             string        `yaml:"read_strategy"`
+	ReadTimeout              time.Duration `yaml:"read_timeout"`
+	ParallelWrites           bool          `yaml:"parallel_writes"`
+	WriteTimeout             time.Duration `yaml:"write_timeout"`
+	WriteAcks                int           `yaml:"write_acks"`
+}
+
+const (
+	DefaultTrashRetention     = 30 * 24 * time.Hour
+	DefaultTrashPurgeInterval = time.Hour
+)
+
+// Trash tunes how long deleted incidents are kept before being definitively removed.
+type Trash struct {
+	Retention     time.Duration `yaml:"retention"`
+	PurgeInterval time.Duration `yaml:"purge_interval"`
+}
+
+func (t *Trash) Validate() {
+	if t.Retention <= 0 {
+		t.Retention = DefaultTrashRetention
+	}
+	if t.PurgeInterval <= 0 {
+		t.PurgeInterval = DefaultTrashPurgeInterval
+	}
+}
+
+const DefaultCacheWindow = 31 * 24 * time.Hour
+
+// Cache tunes in memory cache of incidents, persistent incidents and subscribers read from targets.
+type Cache struct {
+	TTL    time.Duration `yaml:"ttl"`
+	Window time.Duration `yaml:"window"`
+}
+
+// Enabled tells if reads must be cached, cache is disabled when no ttl is set.
+func (c *Cache) Enabled() bool {
+	return c.TTL > 0
+}
+
+func (c *Cache) Validate() {
+	if c.Window <= 0 {
+		c.Window = DefaultCacheWindow
+	}
+}
+
+const DefaultRetentionInterval = 24 * time.Hour
+
+// Retention defines how long resolved incidents are kept and what is done with them afterward.
+type Retention struct {
+	MaxAge        time.Duration `yaml:"max_age"`
+	Action        string        `yaml:"action"`
+	ArchiveTarget Target        `yaml:"archive_target"`
+	ArchiveDir    string        `yaml:"archive_dir"`
+	Interval      time.Duration `yaml:"interval"`
+}
+
+// Enabled tells if expired incidents must be removed, retention is disabled when no max age is set.
+func (r *Retention) Enabled() bool {
+	return r.MaxAge > 0
+}
+
+func (r *Retention) Validate() error {
+	if !r.Enabled() {
+		return nil
+	}
+	if r.Action == "" {
+		r.Action = "archive"
+	}
+	if r.Action != "archive" && r.Action != "delete" {
+		return fmt.Errorf("retention action must be archive or delete")
+	}
+	if r.Action == "archive" && r.ArchiveTarget == "" && r.ArchiveDir == "" {
+		return fmt.Errorf("retention archive_target or archive_dir is required to archive incidents")
+	}
+	if r.ArchiveTarget != "" && r.ArchiveDir != "" {
+		return fmt.Errorf("retention archive_target and archive_dir can't be set together")
+	}
+	if r.ArchiveTarget != "" {
+		if _, err := r.ArchiveTarget.Validate(); err != nil {
+			return fmt.Errorf("invalid retention archive_target: %s", err.Error())
+		}
+	}
+	if r.Interval <= 0 {
+		r.Interval = DefaultRetentionInterval
+	}
+	return nil
+}
+
 type Log struct {
 	Level   string `yaml:"level"`
 	NoColor bool   `yaml:"no_color"`
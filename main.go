@@ -5,6 +5,7 @@ import (
 	"io/fs"
 	"net/http"
 	"net/url"
+	"os"
 	"strings"
 
 	"github.com/alecthomas/kingpin/v2"
@@ -36,6 +37,8 @@ var (
 	}, []string{"code", "method", "path"})
 
 	configFile = kingpin.Flag("config", "Path to Configuration File").Short('c').String()
+
+	serveCmd = kingpin.Command("serve", "Run statusetat server (default).").Default()
 )
 
 //go:embed serves/website/assets
@@ -44,8 +47,23 @@ var assetsContent embed.FS
 func main() {
 	kingpin.Version(version.Print("statusetat"))
 	kingpin.HelpFlag.Short('h')
-	kingpin.Parse()
+	switch kingpin.Parse() {
+	case migrateCmd.FullCommand():
+		migrate()
+	case reencryptCmd.FullCommand():
+		reencrypt()
+	case backupCmd.FullCommand():
+		backup()
+	case restoreCmd.FullCommand():
+		restore()
+	case retentionCmd.FullCommand():
+		retention()
+	case serveCmd.FullCommand():
+		serve()
+	}
+}
 
+func loadConfig() config.Config {
 	var (
 		err error
 		c   config.Config
@@ -59,7 +77,17 @@ func main() {
 	if err != nil {
 		log.Fatal(err.Error())
 	}
+	return c
+}
 
+// isFirstInstance tells if statusetat runs as first instance of a cloud foundry app or outside of cloud foundry,
+// jobs which must run only once for all instances sharing targets are only started on it.
+func isFirstInstance() bool {
+	index := os.Getenv("CF_INSTANCE_INDEX")
+	return index == "" || index == "0"
+}
+
+func storeFromConfig(c config.Config) storages.Store {
 	urls := make([]*url.URL, len(c.Targets))
 	for i, target := range c.Targets {
 		u, err := target.Validate()
@@ -68,10 +96,38 @@ func main() {
 		}
 		urls[i] = u
 	}
-	store, err := storages.Factory(urls)
+	reconcileInterval := c.Replication.ReconcileInterval
+	if reconcileInterval > 0 && !isFirstInstance() {
+		log.Info("Reconciliation between targets is only run by first instance")
+		reconcileInterval = 0
+	}
+	store, err := storages.FactoryWithOptions(urls, storages.ReplicateOptions{
+		JournalPath:              c.Replication.JournalPath,
+		JournalEncryptionKeys:    c.Replication.JournalEncryptionKeys,
+		JournalEncryptionKeyFile: c.Replication.JournalEncryptionKeyFile,
+		ReconcileInterval:        c.Replication.ReconcileInterval,
+		ReconcileWindow:          c.Replication.ReconcileWindow,
+		ReadStrategy:             storages.ReadStrategy(c.Replication.ReadStrategy),
+		ReadTimeout:              c.Replication.ReadTimeout,
+		ParallelWrites:           c.Replication.ParallelWrites,
+		WriteTimeout:             c.Replication.WriteTimeout,
+		WriteAcks:                c.Replication.WriteAcks,
+	})
 	if err != nil {
 		log.Fatal(err.Error())
 	}
+	return store
+}
+
+func serve() {
+	c := loadConfig()
+	store := storeFromConfig(c)
+	if c.Cache.Enabled() {
+		cache := storages.NewCache(store, c.Cache.TTL, c.Cache.Window)
+		go cache.Run()
+		store = cache
+	}
+
 	assetsFs, err := fs.Sub(assetsContent, "serves/website/assets")
 	if err != nil {
 		log.Fatal(err.Error())
@@ -121,6 +177,12 @@ func main() {
 	}
 
 	go notifiers.Notify(store)
+	go storages.PurgeTrashLoop(store, c.Trash.Retention, c.Trash.PurgeInterval)
+	if c.Retention.Enabled() && isFirstInstance() {
+		go storages.RetentionLoop(store, retentionPolicy(c), c.Retention.Interval)
+	} else if c.Retention.Enabled() {
+		log.Info("Retention job is only run by first instance")
+	}
 
 	protocol := "http://"
 	if c.TlsConfig != nil {
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"fmt"
 	"time"
 )
 
@@ -10,13 +11,15 @@ type Incident struct {
 	UpdatedAt      time.Time      `json:"updated_at"`
 	State          IncidentState  `json:"state"`
 	ComponentState ComponentState `json:"component_state"`
-	Components     *Components    `json:"components" gorm:"type:varchar(300)"`
+	Components     *Components    `json:"components" gorm:"-"`
 	Messages       []Message      `json:"messages" gorm:"ForeignKey:IncidentGUID;"`
 	Metadata       []Metadata     `json:"metadata" gorm:"ForeignKey:IncidentGUID;"`
 	IsScheduled    bool           `json:"is_scheduled"`
 	ScheduledEnd   time.Time      `json:"scheduled_end"`
 	Origin         string         `json:"origin"`
 	Persistent     bool           `json:"persistent"`
+	// Version is incremented on each change of incident, it is used as ETag to detect concurrent changes
+	Version int `json:"version"`
 }
 
 type IncidentUpdateRequest struct {
@@ -34,6 +37,11 @@ type IncidentUpdateRequest struct {
 	Persistent     *bool           `json:"persistent"`
 }
 
+// ETag gives strong entity tag of incident built from its version.
+func (i Incident) ETag() string {
+	return fmt.Sprintf(`"%d"`, i.Version)
+}
+
 func (i Incident) MainMessage() Message {
 	if len(i.Messages) == 0 {
 		return Message{}
@@ -8,7 +8,7 @@ type Message struct {
 	GUID         string    `json:"guid" gorm:"primary_key"`
 	IncidentGUID string    `json:"incident_guid"`
 	CreatedAt    time.Time `json:"created_at"`
-	Title        string    `json:"title"`
+	Title        string    `json:"title" gorm:"type:text"`
 	Content      string    `json:"content" gorm:"type:text"`
 }
 
@@ -8,7 +8,7 @@ import (
 type Metadata struct {
 	IncidentGUID string `json:"incident_guid"`
 	Key          string `json:"key"`
-	Value        string `json:"value"`
+	Value        string `json:"value" gorm:"type:text"`
 }
 
 type InputTypeMetadata int
@@ -0,0 +1,142 @@
+package models
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+)
+
+type RevisionAction string
+
+const (
+	RevisionCreated  RevisionAction = "created"
+	RevisionUpdated  RevisionAction = "updated"
+	RevisionDeleted  RevisionAction = "deleted"
+	RevisionRestored RevisionAction = "restored"
+)
+
+// Revision is an immutable record of a change made on an incident.
+type Revision struct {
+	GUID         string         `json:"guid"`
+	IncidentGUID string         `json:"incident_guid"`
+	CreatedAt    time.Time      `json:"created_at"`
+	Actor        string         `json:"actor"`
+	Action       RevisionAction `json:"action"`
+	Changes      []FieldChange  `json:"changes"`
+}
+
+// FieldChange is the change of value of a field, previous is not set when field was added
+// and current is not set when field was removed.
+type FieldChange struct {
+	Field    string          `json:"field"`
+	Previous json.RawMessage `json:"previous,omitempty"`
+	Current  json.RawMessage `json:"current,omitempty"`
+}
+
+// PreviousText gives previous value to be displayed, states are given by their names.
+func (c FieldChange) PreviousText() string {
+	return c.text(c.Previous)
+}
+
+// CurrentText gives current value to be displayed, states are given by their names.
+func (c FieldChange) CurrentText() string {
+	return c.text(c.Current)
+}
+
+func (c FieldChange) text(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	switch c.Field {
+	case "state":
+		var state IncidentState
+		if json.Unmarshal(raw, &state) == nil {
+			return TextIncidentState(state)
+		}
+	case "component_state":
+		var state ComponentState
+		if json.Unmarshal(raw, &state) == nil {
+			return TextState(state)
+		}
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	return string(raw)
+}
+
+type Revisions []Revision
+
+func (p Revisions) Len() int {
+	return len(p)
+}
+
+func (p Revisions) Less(i, j int) bool {
+	if p[i].CreatedAt.Equal(p[j].CreatedAt) {
+		return p[i].GUID < p[j].GUID
+	}
+	return p[i].CreatedAt.Before(p[j].CreatedAt)
+}
+
+func (p Revisions) Swap(i, j int) {
+	p[i], p[j] = p[j], p[i]
+}
+
+// IncidentFields gives values of fields of incident tracked by revisions,
+// messages and metadata are flattened as messages.<message guid>.<field> and metadata.<key>.
+func IncidentFields(incident Incident) map[string]json.RawMessage {
+	fields := make(map[string]json.RawMessage)
+	set := func(field string, value interface{}) {
+		b, _ := json.Marshal(value)
+		fields[field] = b
+	}
+	set("state", incident.State)
+	set("component_state", incident.ComponentState)
+	set("is_scheduled", incident.IsScheduled)
+	set("scheduled_end", incident.ScheduledEnd.UTC())
+	set("created_at", incident.CreatedAt.UTC())
+	set("persistent", incident.Persistent)
+	components := make([]string, 0)
+	if incident.Components != nil {
+		for _, component := range *incident.Components {
+			components = append(components, component.String())
+		}
+	}
+	set("components", components)
+	for _, msg := range incident.Messages {
+		prefix := "messages." + msg.GUID + "."
+		set(prefix+"title", msg.Title)
+		set(prefix+"content", msg.Content)
+		set(prefix+"created_at", msg.CreatedAt.UTC())
+	}
+	for _, metadata := range incident.Metadata {
+		set("metadata."+metadata.Key, metadata.Value)
+	}
+	return fields
+}
+
+// DiffFields gives changes between fields given by IncidentFields ordered by field name,
+// previous is nil on incident creation and current is nil on incident deletion.
+func DiffFields(previous, current map[string]json.RawMessage) []FieldChange {
+	names := make(map[string]bool)
+	for name := range previous {
+		names[name] = true
+	}
+	for name := range current {
+		names[name] = true
+	}
+	changes := make([]FieldChange, 0)
+	for name := range names {
+		before, after := previous[name], current[name]
+		if string(before) == string(after) {
+			continue
+		}
+		changes = append(changes, FieldChange{Field: name, Previous: before, Current: after})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return strings.Compare(changes[i].Field, changes[j].Field) < 0
+	})
+	return changes
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// TrashedIncident is an incident deleted without hard delete, it can be restored until it is purged from trash.
+type TrashedIncident struct {
+	Incident  Incident  `json:"incident"`
+	TrashedAt time.Time `json:"trashed_at"`
+	TrashedBy string    `json:"trashed_by"`
+}
+
+// ExpiresAt gives when incident will be purged from trash.
+func (t TrashedIncident) ExpiresAt(retention time.Duration) time.Time {
+	return t.TrashedAt.Add(retention)
+}
+
+// TrashedIncidents implements sort.Interface, most recently trashed first.
+type TrashedIncidents []TrashedIncident
+
+func (t TrashedIncidents) Len() int {
+	return len(t)
+}
+
+func (t TrashedIncidents) Less(i, j int) bool {
+	if t[i].TrashedAt.Equal(t[j].TrashedAt) {
+		return t[i].Incident.GUID < t[j].Incident.GUID
+	}
+	return t[i].TrashedAt.After(t[j].TrashedAt)
+}
+
+func (t TrashedIncidents) Swap(i, j int) {
+	t[i], t[j] = t[j], t[i]
+}
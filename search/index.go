@@ -0,0 +1,188 @@
+package search
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/emitter"
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+	"github.com/orange-cloudfoundry/statusetat/v2/storages"
+)
+
+// weights of terms by place where they are found in an incident
+const (
+	titleWeight     = 3
+	componentWeight = 2
+	contentWeight   = 1
+	metadataWeight  = 1
+)
+
+// Index is an in memory full-text index of incidents over titles and contents of their messages,
+// their components and their metadata values.
+type Index struct {
+	mu        *sync.RWMutex
+	incidents map[string]models.Incident
+	// postings gives for each term its weight in each incident containing it
+	postings map[string]map[string]float64
+	// terms gives terms of each incident to remove them when incident changes
+	terms map[string][]string
+}
+
+func NewIndex() *Index {
+	return &Index{
+		mu:        &sync.RWMutex{},
+		incidents: make(map[string]models.Incident),
+		postings:  make(map[string]map[string]float64),
+		terms:     make(map[string][]string),
+	}
+}
+
+// rebuildInterval is the time between two full rebuilds of index made to take in account changes
+// which are not sent through emitter (e.g. incidents removed by retention or made by another instance)
+const rebuildInterval = time.Hour
+
+// Run builds index from store and then keeps it current with incidents changes sent through emitter.
+func (i *Index) Run(store storages.Store) {
+	// listen before building index to not miss changes made meanwhile
+	events := emitter.On()
+	err := i.Rebuild(store)
+	if err != nil {
+		log.Errorf("Could not build search index: %s", err.Error())
+	}
+	ticker := time.NewTicker(rebuildInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			i.Refresh(store, emitter.ToNotifyRequest(event).Incident)
+		case <-ticker.C:
+			err := i.Rebuild(store)
+			if err != nil {
+				log.Errorf("Could not rebuild search index: %s", err.Error())
+			}
+		}
+	}
+}
+
+// Rebuild replaces content of index by all incidents, persistent ones included, of store.
+func (i *Index) Rebuild(store storages.Store) error {
+	incidents, err := store.ByDate(time.Unix(0, 0), time.Now().AddDate(100, 0, 0))
+	if err != nil {
+		return err
+	}
+	persistents, err := store.Persistents()
+	if err != nil {
+		return err
+	}
+
+	fresh := NewIndex()
+	for _, incident := range append(incidents, persistents...) {
+		fresh.put(incident)
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.incidents = fresh.incidents
+	i.postings = fresh.postings
+	i.terms = fresh.terms
+	log.Debugf("Search index built with %d incident(s)", len(i.incidents))
+	return nil
+}
+
+// Refresh reindexes incident from its state in store, it is removed from index when it does not exist anymore.
+func (i *Index) Refresh(store storages.Store, incident models.Incident) {
+	stored, err := store.Read(incident.GUID)
+	if err != nil {
+		if os.IsNotExist(err) {
+			i.Remove(incident.GUID)
+			return
+		}
+		log.WithField("guid", incident.GUID).Warningf("Could not read incident to index it, indexing received one: %s", err.Error())
+		stored = incident
+	}
+	i.Put(stored)
+}
+
+// Put adds or replaces incident in index.
+func (i *Index) Put(incident models.Incident) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.put(incident)
+}
+
+func (i *Index) put(incident models.Incident) {
+	i.remove(incident.GUID)
+
+	weights := make(map[string]float64)
+	add := func(text string, weight float64) {
+		for _, term := range tokenize(text) {
+			weights[term] += weight
+		}
+	}
+	for _, msg := range incident.Messages {
+		add(msg.Title, titleWeight)
+		add(msg.Content, contentWeight)
+	}
+	if incident.Components != nil {
+		for _, component := range *incident.Components {
+			add(component.String(), componentWeight)
+		}
+	}
+	for _, metadata := range incident.Metadata {
+		add(metadata.Value, metadataWeight)
+	}
+
+	terms := make([]string, 0, len(weights))
+	for term, weight := range weights {
+		if _, ok := i.postings[term]; !ok {
+			i.postings[term] = make(map[string]float64)
+		}
+		i.postings[term][incident.GUID] = weight
+		terms = append(terms, term)
+	}
+	i.terms[incident.GUID] = terms
+	i.incidents[incident.GUID] = incident
+}
+
+// Remove removes incident from index.
+func (i *Index) Remove(guid string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.remove(guid)
+}
+
+func (i *Index) remove(guid string) {
+	for _, term := range i.terms[guid] {
+		delete(i.postings[term], guid)
+		if len(i.postings[term]) == 0 {
+			delete(i.postings, term)
+		}
+	}
+	delete(i.terms, guid)
+	delete(i.incidents, guid)
+}
+
+// Len gives number of incidents in index.
+func (i *Index) Len() int {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return len(i.incidents)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// tokenize splits text in lower case words.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.Map(unicode.ToLower, text), func(r rune) bool {
+		return !isWordRune(r)
+	})
+}
@@ -0,0 +1,227 @@
+package search
+
+import (
+	"html"
+	"html/template"
+	"sort"
+	"strings"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+)
+
+const (
+	// snippetContext is the number of characters kept around first match in a snippet
+	snippetContext = 60
+	maxSnippets    = 3
+	// prefixFactor lowers weight of terms only matching a query term as prefix
+	prefixFactor = 0.5
+)
+
+// Query is a search in index, incidents must contain all words of text, last characters of words can be omitted.
+type Query struct {
+	Text string
+	// Period only keeps incidents created during a month, in form of 2006-01
+	Period string
+	// Limit is the maximum number of hits given, no limit when 0
+	Limit  int
+	Offset int
+}
+
+type Hit struct {
+	Incident models.Incident `json:"incident"`
+	Score    float64         `json:"score"`
+	// Snippets are html escaped extracts of incident with matching words wrapped in <mark>
+	Snippets []string `json:"snippets"`
+}
+
+// HTMLSnippets gives snippets to be used in html templates, they are already escaped.
+func (h Hit) HTMLSnippets() []template.HTML {
+	snippets := make([]template.HTML, len(h.Snippets))
+	for i, s := range h.Snippets {
+		snippets[i] = template.HTML(s) // #nosec G203 -- content is escaped when building snippet
+	}
+	return snippets
+}
+
+// Facet is the number of incidents matching a search created during a month.
+type Facet struct {
+	Period string `json:"period"`
+	Count  int    `json:"count"`
+}
+
+// Result of a search, facets are computed before filtering on period to let user choose another one.
+type Result struct {
+	Total  int     `json:"total"`
+	Hits   []Hit   `json:"hits"`
+	Facets []Facet `json:"facets"`
+}
+
+// Search gives incidents matching query, best matches first then most recent ones.
+func (i *Index) Search(q Query) Result {
+	result := Result{Hits: []Hit{}, Facets: []Facet{}}
+	terms := tokenize(q.Text)
+	if len(terms) == 0 {
+		return result
+	}
+
+	i.mu.RLock()
+	scores := i.scores(terms)
+	hits := make([]Hit, 0, len(scores))
+	for guid, score := range scores {
+		hits = append(hits, Hit{Incident: i.incidents[guid], Score: score})
+	}
+	i.mu.RUnlock()
+
+	facets := make(map[string]int)
+	filtered := make([]Hit, 0, len(hits))
+	for _, hit := range hits {
+		period := hit.Incident.CreatedAt.Format("2006-01")
+		facets[period]++
+		if q.Period != "" && q.Period != period {
+			continue
+		}
+		filtered = append(filtered, hit)
+	}
+	for period, count := range facets {
+		result.Facets = append(result.Facets, Facet{Period: period, Count: count})
+	}
+	sort.Slice(result.Facets, func(a, b int) bool {
+		return result.Facets[a].Period > result.Facets[b].Period
+	})
+
+	sort.Slice(filtered, func(a, b int) bool {
+		if filtered[a].Score == filtered[b].Score {
+			return filtered[a].Incident.CreatedAt.After(filtered[b].Incident.CreatedAt)
+		}
+		return filtered[a].Score > filtered[b].Score
+	})
+	result.Total = len(filtered)
+	if q.Offset >= len(filtered) {
+		return result
+	}
+	filtered = filtered[q.Offset:]
+	if q.Limit > 0 && len(filtered) > q.Limit {
+		filtered = filtered[:q.Limit]
+	}
+	for idx := range filtered {
+		sort.Sort(models.Messages(filtered[idx].Incident.Messages))
+		filtered[idx].Snippets = snippets(filtered[idx].Incident, terms)
+	}
+	result.Hits = filtered
+	return result
+}
+
+// scores gives score of each incident containing all terms, must be called with read lock held.
+func (i *Index) scores(terms []string) map[string]float64 {
+	var scores map[string]float64
+	for _, term := range terms {
+		termScores := make(map[string]float64)
+		for indexed, postings := range i.postings {
+			if !strings.HasPrefix(indexed, term) {
+				continue
+			}
+			factor := 1.0
+			if indexed != term {
+				factor = prefixFactor
+			}
+			for guid, weight := range postings {
+				termScores[guid] += weight * factor
+			}
+		}
+		if scores == nil {
+			scores = termScores
+			continue
+		}
+		for guid := range scores {
+			if _, ok := termScores[guid]; !ok {
+				delete(scores, guid)
+				continue
+			}
+			scores[guid] += termScores[guid]
+		}
+	}
+	return scores
+}
+
+func snippets(incident models.Incident, terms []string) []string {
+	texts := make([]string, 0)
+	for _, msg := range incident.Messages {
+		texts = append(texts, msg.Title, msg.Content)
+	}
+	if incident.Components != nil {
+		texts = append(texts, incident.Components.String())
+	}
+	for _, metadata := range incident.Metadata {
+		texts = append(texts, metadata.Value)
+	}
+
+	result := make([]string, 0)
+	for _, text := range texts {
+		s, ok := snippet(text, terms)
+		if !ok {
+			continue
+		}
+		result = append(result, s)
+		if len(result) == maxSnippets {
+			break
+		}
+	}
+	return result
+}
+
+type wordSpan struct {
+	start int
+	end   int
+}
+
+// snippet gives extract of text around its first word matching terms, all matching words in extract are highlighted.
+func snippet(text string, terms []string) (string, bool) {
+	runes := []rune(text)
+	matches := make([]wordSpan, 0)
+	start := -1
+	for idx := 0; idx <= len(runes); idx++ {
+		if idx < len(runes) && isWordRune(runes[idx]) {
+			if start < 0 {
+				start = idx
+			}
+			continue
+		}
+		if start < 0 {
+			continue
+		}
+		word := strings.ToLower(string(runes[start:idx]))
+		for _, term := range terms {
+			if strings.HasPrefix(word, term) {
+				matches = append(matches, wordSpan{start: start, end: idx})
+				break
+			}
+		}
+		start = -1
+	}
+	if len(matches) == 0 {
+		return "", false
+	}
+
+	from := max(0, matches[0].start-snippetContext)
+	to := min(len(runes), matches[0].end+snippetContext)
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	pos := from
+	for _, match := range matches {
+		if match.end > to {
+			break
+		}
+		b.WriteString(html.EscapeString(string(runes[pos:match.start])))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(string(runes[match.start:match.end])))
+		b.WriteString("</mark>")
+		pos = match.end
+	}
+	b.WriteString(html.EscapeString(string(runes[pos:to])))
+	if to < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String(), true
+}
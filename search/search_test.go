@@ -0,0 +1,180 @@
+package search_test
+
+import (
+	"net/url"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/emitter"
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+	"github.com/orange-cloudfoundry/statusetat/v2/search"
+	"github.com/orange-cloudfoundry/statusetat/v2/storages"
+)
+
+func incident(guid string, createdAt time.Time, title, content string, components ...models.Component) models.Incident {
+	inc := models.Incident{
+		GUID:      guid,
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+		Messages: []models.Message{
+			{GUID: guid + "-msg", IncidentGUID: guid, Title: title, Content: content, CreatedAt: createdAt},
+		},
+	}
+	if len(components) > 0 {
+		comps := models.Components(components)
+		inc.Components = &comps
+	}
+	return inc
+}
+
+func guids(result search.Result) []string {
+	g := make([]string, len(result.Hits))
+	for i, hit := range result.Hits {
+		g[i] = hit.Incident.GUID
+	}
+	return g
+}
+
+var _ = Describe("Index", func() {
+	var index *search.Index
+	march := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	april := time.Date(2024, 4, 10, 12, 0, 0, 0, time.UTC)
+	BeforeEach(func() {
+		index = search.NewIndex()
+		index.Put(incident("db", march, "Database outage", "Primary database is unreachable", models.Component{Name: "postgres", Group: "data"}))
+		index.Put(incident("net", april, "Network latency", "Latency on the database network link", models.Component{Name: "router", Group: "network"}))
+		index.Put(incident("dns", april.Add(time.Hour), "DNS resolution failures", "Some <script> names are not resolved"))
+	})
+	Context("Search", func() {
+		It("should find incidents by words of titles, contents and components", func() {
+			Expect(guids(index.Search(search.Query{Text: "outage"}))).To(Equal([]string{"db"}))
+			Expect(guids(index.Search(search.Query{Text: "unreachable"}))).To(Equal([]string{"db"}))
+			Expect(guids(index.Search(search.Query{Text: "router"}))).To(Equal([]string{"net"}))
+		})
+		It("should ignore case and match words by prefix", func() {
+			Expect(guids(index.Search(search.Query{Text: "DATAB"}))).To(ConsistOf("db", "net"))
+		})
+		It("should only give incidents containing all words", func() {
+			Expect(guids(index.Search(search.Query{Text: "database latency"}))).To(Equal([]string{"net"}))
+			Expect(index.Search(search.Query{Text: "database unknown"}).Hits).To(BeEmpty())
+		})
+		It("should rank incidents with words in title first", func() {
+			index.Put(incident("db2", march.AddDate(0, -1, 0), "Database down", "Replicas are unavailable"))
+			Expect(guids(index.Search(search.Query{Text: "database"}))).To(Equal([]string{"db", "db2", "net"}))
+		})
+		It("should give nothing on empty text", func() {
+			result := index.Search(search.Query{Text: "  , "})
+			Expect(result.Total).To(Equal(0))
+			Expect(result.Hits).To(BeEmpty())
+		})
+		It("should give date facets and filter on period", func() {
+			result := index.Search(search.Query{Text: "database"})
+			Expect(result.Facets).To(Equal([]search.Facet{
+				{Period: "2024-04", Count: 1},
+				{Period: "2024-03", Count: 1},
+			}))
+
+			result = index.Search(search.Query{Text: "database", Period: "2024-03"})
+			Expect(guids(result)).To(Equal([]string{"db"}))
+			Expect(result.Total).To(Equal(1))
+			Expect(result.Facets).To(HaveLen(2))
+		})
+		It("should paginate results", func() {
+			result := index.Search(search.Query{Text: "database", Limit: 1})
+			Expect(result.Total).To(Equal(2))
+			Expect(guids(result)).To(Equal([]string{"db"}))
+
+			result = index.Search(search.Query{Text: "database", Limit: 1, Offset: 1})
+			Expect(guids(result)).To(Equal([]string{"net"}))
+
+			result = index.Search(search.Query{Text: "database", Offset: 2})
+			Expect(result.Hits).To(BeEmpty())
+		})
+		It("should give escaped snippets with highlighted words", func() {
+			result := index.Search(search.Query{Text: "datab"})
+			Expect(result.Hits[0].Snippets).To(Equal([]string{
+				"<mark>Database</mark> outage",
+				"Primary <mark>database</mark> is unreachable",
+			}))
+
+			result = index.Search(search.Query{Text: "names"})
+			Expect(result.Hits[0].Snippets).To(Equal([]string{
+				"Some &lt;script&gt; <mark>names</mark> are not resolved",
+			}))
+		})
+		It("should cut long snippets around first match", func() {
+			long := incident("long", march, "Long", "lorem ipsum dolor sit amet consectetur adipiscing elit sed do eiusmod tempor incididunt "+
+				"storage failure "+
+				"ut labore et dolore magna aliqua ut enim ad minim veniam quis nostrud exercitation end")
+			index.Put(long)
+			snippets := index.Search(search.Query{Text: "storage"}).Hits[0].Snippets
+			Expect(snippets).To(HaveLen(1))
+			Expect(snippets[0]).To(HavePrefix("…"))
+			Expect(snippets[0]).To(HaveSuffix("…"))
+			Expect(snippets[0]).To(ContainSubstring("<mark>storage</mark> failure"))
+		})
+	})
+	Context("Put and Remove", func() {
+		It("should replace previous content of incident", func() {
+			index.Put(incident("db", march, "Storage outage", "Disks are full"))
+			Expect(index.Search(search.Query{Text: "unreachable"}).Hits).To(BeEmpty())
+			Expect(guids(index.Search(search.Query{Text: "disks"}))).To(Equal([]string{"db"}))
+			Expect(index.Len()).To(Equal(3))
+		})
+		It("should remove incident", func() {
+			index.Remove("db")
+			Expect(index.Search(search.Query{Text: "outage"}).Hits).To(BeEmpty())
+			Expect(index.Len()).To(Equal(2))
+		})
+	})
+	Context("With store", func() {
+		var store storages.Store
+		BeforeEach(func() {
+			var err error
+			u, _ := url.Parse("sqlite://:memory:")
+			store, err = (&storages.DB{}).Creator()(u)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = store.Create(incident("stored", march, "Stored outage", "Queue is stuck"))
+			Expect(err).ToNot(HaveOccurred())
+			persistent := incident("persistent", march, "Known issue", "Queue is slow")
+			persistent.Persistent = true
+			_, err = store.Create(persistent)
+			Expect(err).ToNot(HaveOccurred())
+		})
+		It("should rebuild index from incidents and persistent incidents of store", func() {
+			Expect(index.Rebuild(store)).To(Succeed())
+			Expect(index.Len()).To(Equal(2))
+			Expect(guids(index.Search(search.Query{Text: "queue"}))).To(ConsistOf("stored", "persistent"))
+			Expect(index.Search(search.Query{Text: "outage"}).Hits).To(HaveLen(1))
+		})
+		It("should refresh incident from store", func() {
+			index.Refresh(store, models.Incident{GUID: "stored"})
+			Expect(guids(index.Search(search.Query{Text: "stuck"}))).To(Equal([]string{"stored"}))
+
+			index.Refresh(store, models.Incident{GUID: "db"})
+			Expect(index.Search(search.Query{Text: "unreachable"}).Hits).To(BeEmpty())
+		})
+		It("should keep index current with emitted incidents", func() {
+			DeferCleanup(func() {
+				emitter.Off()
+			})
+			go index.Run(store)
+			Eventually(index.Len).Should(Equal(2))
+
+			created, err := store.Create(incident("emitted", april, "Emitted outage", "Cache is cold"))
+			Expect(err).ToNot(HaveOccurred())
+			emitter.Emit(models.NewNotifyRequest(created, false))
+			Eventually(func() []string {
+				return guids(index.Search(search.Query{Text: "cache"}))
+			}).Should(Equal([]string{"emitted"}))
+
+			Expect(store.Delete("emitted")).To(Succeed())
+			emitter.Emit(models.NewNotifyRequest(created, false))
+			Eventually(func() []search.Hit {
+				return index.Search(search.Query{Text: "cache"}).Hits
+			}).Should(BeEmpty())
+		})
+	})
+})
@@ -3,6 +3,7 @@ package serves
 import (
 	"net/http"
 	"net/url"
+	"sort"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -113,6 +114,7 @@ func (a *Serve) AdminAddEditIncident(w http.ResponseWriter, req *http.Request) {
 
 func (a *Serve) AdminAddEditIncidentByType(w http.ResponseWriter, req *http.Request, typ string) {
 	var incident models.Incident
+	revisions := make([]models.Revision, 0)
 	var err error
 	v := mux.Vars(req)
 	guid := v["guid"]
@@ -122,6 +124,13 @@ func (a *Serve) AdminAddEditIncidentByType(w http.ResponseWriter, req *http.Requ
 			HTMLError(w, err, http.StatusInternalServerError)
 			return
 		}
+		revisions, err = a.store.Revisions(guid)
+		if err != nil {
+			HTMLError(w, err, http.StatusInternalServerError)
+			return
+		}
+		// most recent changes are shown first
+		sort.Sort(sort.Reverse(models.Revisions(revisions)))
 	} else {
 		incident.ComponentState = models.MajorOutage
 		incident.CreatedAt = time.Now().In(a.Location(req))
@@ -146,6 +155,7 @@ func (a *Serve) AdminAddEditIncidentByType(w http.ResponseWriter, req *http.Requ
 		ComponentStates       []models.ComponentState
 		Incident              models.Incident
 		MetadataFields        models.MetadataFields
+		Revisions             []models.Revision
 		CheckPersistent       bool
 		PersistentDisplayName string
 	}{
@@ -162,6 +172,7 @@ func (a *Serve) AdminAddEditIncidentByType(w http.ResponseWriter, req *http.Requ
 		ComponentStates:       models.AllComponentState,
 		Incident:              incident,
 		MetadataFields:        notifiers.MetadataFields(),
+		Revisions:             revisions,
 		PersistentDisplayName: a.config.Theme.PersistentDisplayName,
 	})
 	if err != nil {
@@ -221,6 +232,38 @@ func (a *Serve) AdminMaintenance(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+func (a *Serve) AdminTrash(w http.ResponseWriter, req *http.Request) {
+	trashed, err := a.store.Trashed()
+	if err != nil {
+		HTMLError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	timezone := ""
+	if !a.IsDefaultLocation(req) {
+		timezone = a.Location(req).String()
+	}
+
+	err = a.xt.ExecuteTemplate(w, "admin/trash.gohtml", struct {
+		adminDefaultData
+		Trashed   []models.TrashedIncident
+		Retention time.Duration
+	}{
+		adminDefaultData: adminDefaultData{
+			BaseInfo:   a.BaseInfo(),
+			ActiveItem: "trash",
+			MenuItems:  a.adminMenuItems,
+			Timezone:   timezone,
+		},
+		Trashed:   trashed,
+		Retention: a.trashRetention(),
+	})
+	if err != nil {
+		HTMLError(w, err, http.StatusInternalServerError)
+		return
+	}
+}
+
 func (a *Serve) AdminInfo(w http.ResponseWriter, req *http.Request) {
 	timezone := ""
 	if !a.IsDefaultLocation(req) {
@@ -78,6 +78,7 @@ func (a *Serve) CreateIncident(w http.ResponseWriter, req *http.Request) {
 	}
 
 	incident.GUID = guid
+	incident.Version = 1
 	incident.Messages = a.messagesGuid(guid, incident.Messages, loc)
 
 	err = a.runPreCheck(&incident)
@@ -86,13 +87,15 @@ func (a *Serve) CreateIncident(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	incident, err = a.store.Create(incident)
+	incident, err = a.storeAs(req).Create(incident)
 	if err != nil {
-		JSONError(w, err, http.StatusInternalServerError)
+		WriteError(w, err, http.StatusInternalServerError)
 		return
 	}
+	a.recordRevision(req, incident.GUID, models.RevisionCreated, nil, models.IncidentFields(incident))
 
 	emitter.Emit(models.NewNotifyRequest(incident, false))
+	w.Header().Set("ETag", incident.ETag())
 	respond.NewResponse(w).Created(incident)
 }
 
@@ -136,13 +139,23 @@ func (a *Serve) ByDate(w http.ResponseWriter, req *http.Request) {
 		JSONError(w, err, http.StatusInternalServerError)
 		return
 	}
-	incidents, err := a.incidentsByParamsDate(from, to, a.isAllType(req))
+	query, err := a.incidentQueryFromReq(req, from, to)
+	if err != nil {
+		JSONError(w, err, http.StatusBadRequest)
+		return
+	}
+	if !a.isAllType(req) && query.Scheduled == nil {
+		a.shownAsIncident(&query, true)
+	}
+	page, err := a.store.Query(query)
 	if err != nil {
 		JSONError(w, err, http.StatusInternalServerError)
 		return
 	}
-
-	respond.NewResponse(w).Ok(incidents)
+	if page.NextCursor != "" {
+		w.Header().Set("X-Next-Cursor", page.NextCursor)
+	}
+	respond.NewResponse(w).Ok(page.Incidents)
 }
 
 func (a *Serve) Persistents(w http.ResponseWriter, req *http.Request) {
@@ -168,6 +181,7 @@ func (a *Serve) Incident(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	w.Header().Set("ETag", incident.ETag())
 	respond.NewResponse(w).Ok(incident)
 }
 
@@ -187,6 +201,8 @@ func (a *Serve) Update(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	unlock := a.incidentLocks.lock(guid)
+	defer unlock()
 	incident, err := a.store.Read(guid)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -196,6 +212,11 @@ func (a *Serve) Update(w http.ResponseWriter, req *http.Request) {
 		JSONError(w, err, http.StatusPreconditionRequired)
 		return
 	}
+	if err := checkIfMatch(req, incident); err != nil {
+		conflictError(w, err, incident)
+		return
+	}
+	previous := models.IncidentFields(incident)
 
 	if incidentUpdate.ComponentState != nil {
 		incident.ComponentState = *incidentUpdate.ComponentState
@@ -266,19 +287,22 @@ func (a *Serve) Update(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	incident, err = a.store.Update(guid, incident)
+	version := incident.Version
+	incident.Version++
+	incident, err = a.saveIncident(req, guid, version, incident)
 	if err != nil {
-		if os.IsNotExist(err) {
-			JSONError(w, err, http.StatusNotFound)
-			return
-		}
-		JSONError(w, err, http.StatusInternalServerError)
+		a.saveError(w, guid, err)
 		return
 	}
+	a.recordRevision(req, guid, models.RevisionUpdated, previous, models.IncidentFields(incident))
 
 	if !incidentUpdate.NoNotify {
 		emitter.Emit(models.NewNotifyRequest(incident, false))
+	} else {
+		// search index is kept current by emitted events, update it directly when not notifying
+		a.searchIndex.Put(incident)
 	}
+	w.Header().Set("ETag", incident.ETag())
 	respond.NewResponse(w).Ok(incident)
 }
 
@@ -315,6 +339,8 @@ func (a *Serve) Notify(w http.ResponseWriter, req *http.Request) {
 func (a *Serve) Delete(w http.ResponseWriter, req *http.Request) {
 	v := mux.Vars(req)
 	guid := v["guid"]
+	unlock := a.incidentLocks.lock(guid)
+	defer unlock()
 	incident, err := a.store.Read(guid)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -324,6 +350,13 @@ func (a *Serve) Delete(w http.ResponseWriter, req *http.Request) {
 		JSONError(w, err, http.StatusPreconditionRequired)
 		return
 	}
+	if err := checkIfMatch(req, incident); err != nil {
+		conflictError(w, err, incident)
+		return
+	}
+
+	previous := models.IncidentFields(incident)
+	toTrash := incident
 
 	// Using a "cancelled" state
 	incident.State = models.Cancelled
@@ -334,15 +367,20 @@ func (a *Serve) Delete(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	err = a.store.Delete(guid)
+	if req.URL.Query().Get("hard") == "true" {
+		err = a.storeAs(req).Delete(guid)
+	} else {
+		err = a.moveToTrash(req, toTrash)
+	}
 	if err != nil {
 		if os.IsNotExist(err) {
 			JSONError(w, err, http.StatusNotFound)
 			return
 		}
-		JSONError(w, err, http.StatusInternalServerError)
+		WriteError(w, err, http.StatusInternalServerError)
 		return
 	}
+	a.recordRevision(req, guid, models.RevisionDeleted, previous, nil)
 
 	emitter.Emit(models.NewNotifyRequest(incident, true))
 
@@ -353,6 +391,8 @@ func (a *Serve) AddMessage(w http.ResponseWriter, req *http.Request) {
 	v := mux.Vars(req)
 	incidentGuid := v["incident_guid"]
 
+	unlock := a.incidentLocks.lock(incidentGuid)
+	defer unlock()
 	incident, err := a.store.Read(incidentGuid)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -362,6 +402,11 @@ func (a *Serve) AddMessage(w http.ResponseWriter, req *http.Request) {
 		JSONError(w, err, http.StatusInternalServerError)
 		return
 	}
+	if err := checkIfMatch(req, incident); err != nil {
+		conflictError(w, err, incident)
+		return
+	}
+	previous := models.IncidentFields(incident)
 
 	b, err := io.ReadAll(req.Body)
 	if err != nil {
@@ -383,18 +428,19 @@ func (a *Serve) AddMessage(w http.ResponseWriter, req *http.Request) {
 
 	incident.Messages = append(incident.Messages, message)
 
-	incident, err = a.store.Update(incidentGuid, incident)
+	incident.UpdatedAt = time.Now()
+
+	version := incident.Version
+	incident.Version++
+	incident, err = a.saveIncident(req, incidentGuid, version, incident)
 	if err != nil {
-		if os.IsNotExist(err) {
-			JSONError(w, err, http.StatusNotFound)
-			return
-		}
-		JSONError(w, err, http.StatusInternalServerError)
+		a.saveError(w, incidentGuid, err)
 		return
 	}
-	incident.UpdatedAt = time.Now()
+	a.recordRevision(req, incidentGuid, models.RevisionUpdated, previous, models.IncidentFields(incident))
 
 	emitter.Emit(models.NewNotifyRequest(incident, false))
+	w.Header().Set("ETag", incident.ETag())
 	respond.NewResponse(w).Created(incident)
 }
 
@@ -403,6 +449,8 @@ func (a *Serve) DeleteMessage(w http.ResponseWriter, req *http.Request) {
 	incidentGuid := v["incident_guid"]
 	messageGuid := v["message_guid"]
 
+	unlock := a.incidentLocks.lock(incidentGuid)
+	defer unlock()
 	incident, err := a.store.Read(incidentGuid)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -412,6 +460,11 @@ func (a *Serve) DeleteMessage(w http.ResponseWriter, req *http.Request) {
 		JSONError(w, err, http.StatusInternalServerError)
 		return
 	}
+	if err := checkIfMatch(req, incident); err != nil {
+		conflictError(w, err, incident)
+		return
+	}
+	previous := models.IncidentFields(incident)
 
 	finalMessages := make(models.Messages, 0)
 	for _, msg := range incident.Messages {
@@ -425,17 +478,17 @@ func (a *Serve) DeleteMessage(w http.ResponseWriter, req *http.Request) {
 
 	incident.UpdatedAt = time.Now()
 
-	incident, err = a.store.Update(incidentGuid, incident)
+	version := incident.Version
+	incident.Version++
+	incident, err = a.saveIncident(req, incidentGuid, version, incident)
 	if err != nil {
-		if os.IsNotExist(err) {
-			JSONError(w, err, http.StatusNotFound)
-			return
-		}
-		JSONError(w, err, http.StatusInternalServerError)
+		a.saveError(w, incidentGuid, err)
 		return
 	}
+	a.recordRevision(req, incidentGuid, models.RevisionUpdated, previous, models.IncidentFields(incident))
 
 	emitter.Emit(models.NewNotifyRequest(incident, false))
+	w.Header().Set("ETag", incident.ETag())
 	respond.NewResponse(w).Ok(incident)
 }
 
@@ -485,6 +538,8 @@ func (a *Serve) UpdateMessage(w http.ResponseWriter, req *http.Request) {
 	incidentGuid := v["incident_guid"]
 	messageGuid := v["message_guid"]
 
+	unlock := a.incidentLocks.lock(incidentGuid)
+	defer unlock()
 	incident, err := a.store.Read(incidentGuid)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -494,6 +549,11 @@ func (a *Serve) UpdateMessage(w http.ResponseWriter, req *http.Request) {
 		JSONError(w, err, http.StatusInternalServerError)
 		return
 	}
+	if err := checkIfMatch(req, incident); err != nil {
+		conflictError(w, err, incident)
+		return
+	}
+	previous := models.IncidentFields(incident)
 
 	b, err := io.ReadAll(req.Body)
 	if err != nil {
@@ -515,19 +575,19 @@ func (a *Serve) UpdateMessage(w http.ResponseWriter, req *http.Request) {
 		}
 	}
 
-	incident, err = a.store.Update(incidentGuid, incident)
+	incident.UpdatedAt = time.Now()
+
+	version := incident.Version
+	incident.Version++
+	incident, err = a.saveIncident(req, incidentGuid, version, incident)
 	if err != nil {
-		if os.IsNotExist(err) {
-			JSONError(w, err, http.StatusNotFound)
-			return
-		}
-		JSONError(w, err, http.StatusInternalServerError)
+		a.saveError(w, incidentGuid, err)
 		return
 	}
-
-	incident.UpdatedAt = time.Now()
+	a.recordRevision(req, incidentGuid, models.RevisionUpdated, previous, models.IncidentFields(incident))
 
 	emitter.Emit(models.NewNotifyRequest(incident, false))
+	w.Header().Set("ETag", incident.ETag())
 	respond.NewResponse(w).Ok(incident)
 }
 
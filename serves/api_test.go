@@ -3,6 +3,7 @@ package serves_test
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/orange-cloudfoundry/statusetat/v2/models"
 	"github.com/orange-cloudfoundry/statusetat/v2/serves"
+	"github.com/orange-cloudfoundry/statusetat/v2/storages"
 )
 
 var _ = Describe("Api", func() {
@@ -65,6 +67,25 @@ var _ = Describe("Api", func() {
 			Expect(err).ToNot(HaveOccurred())
 			Expect(dbInc.GUID).ToNot(BeEmpty())
 		})
+		It("should answer accepted without emitting when write is still pending on targets", func() {
+			fakeStoreMem.CreateReturns(models.Incident{}, fmt.Errorf("%w: 0 acknowledgement(s) on 1 required", storages.ErrWritePending))
+			inc := models.Incident{
+				Components: &models.Components{{
+					Name:  Component1.Name,
+					Group: Component1.Group,
+				}},
+				Messages: models.Messages{
+					{
+						CreatedAt: time.Now().AddDate(0, 0, 1).UTC(),
+						Title:     "A title",
+						Content:   "a content",
+					},
+				},
+			}
+			rr := CallRequest(NewRequestIntAdmin(http.MethodPost, "/v1/incidents", inc))
+			Expect(rr.Code).To(Equal(http.StatusAccepted))
+			Expect(fakeEmitter.EmitCallCount()).To(Equal(0))
+		})
 		Context("is a scheduled task", func() {
 			It("should give an error if scheduled end not set", func() {
 
@@ -191,6 +212,79 @@ var _ = Describe("Api", func() {
 			})
 
 		})
+		Context("with filters and pagination", func() {
+			It("should only give incidents matching filters", func() {
+				from := time.Now().AddDate(0, 0, -10).UTC()
+				to := time.Now().AddDate(0, 0, 2).UTC()
+				target := fmt.Sprintf(
+					"/v1/incidents?from=%s&to=%s&scheduled=true&components=%s",
+					from.Format(time.RFC3339),
+					to.Format(time.RFC3339),
+					url.QueryEscape(Component1.String()),
+				)
+				rr := CallRequest(NewRequestInt(http.MethodGet, target, nil))
+				Expect(rr.CheckError()).ToNot(HaveOccurred())
+
+				finalIncidents, err := rr.UnmarshalToIncidents()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(finalIncidents).To(HaveLen(1))
+				Expect(finalIncidents[0].GUID).To(Equal("3"))
+			})
+			It("should give next page cursor in header", func() {
+				from := time.Now().AddDate(0, 0, -10).UTC()
+				to := time.Now().AddDate(0, 0, 2).UTC()
+				target := fmt.Sprintf(
+					"/v1/incidents?from=%s&to=%s&all_types=true&limit=3",
+					from.Format(time.RFC3339),
+					to.Format(time.RFC3339),
+				)
+				rr := CallRequest(NewRequestInt(http.MethodGet, target, nil))
+				Expect(rr.CheckError()).ToNot(HaveOccurred())
+				finalIncidents, err := rr.UnmarshalToIncidents()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(finalIncidents).To(HaveLen(3))
+				cursor := rr.Header().Get("X-Next-Cursor")
+				Expect(cursor).ToNot(BeEmpty())
+
+				rr = CallRequest(NewRequestInt(http.MethodGet, target+"&cursor="+cursor, nil))
+				Expect(rr.CheckError()).ToNot(HaveOccurred())
+				finalIncidents, err = rr.UnmarshalToIncidents()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(finalIncidents).To(HaveLen(1))
+				Expect(finalIncidents[0].GUID).To(Equal("4"))
+				Expect(rr.Header().Get("X-Next-Cursor")).To(BeEmpty())
+			})
+			It("should give full pages when maintenances are left out", func() {
+				from := time.Now().AddDate(0, 0, -10).UTC()
+				to := time.Now().AddDate(0, 0, 2).UTC()
+				target := fmt.Sprintf(
+					"/v1/incidents?from=%s&to=%s&limit=2",
+					from.Format(time.RFC3339),
+					to.Format(time.RFC3339),
+				)
+				rr := CallRequest(NewRequestInt(http.MethodGet, target, nil))
+				Expect(rr.CheckError()).ToNot(HaveOccurred())
+				finalIncidents, err := rr.UnmarshalToIncidents()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(finalIncidents).To(HaveLen(2))
+				Expect(finalIncidents[0].GUID).To(Equal("2"))
+				Expect(finalIncidents[1].GUID).To(Equal("1"))
+				cursor := rr.Header().Get("X-Next-Cursor")
+				Expect(cursor).ToNot(BeEmpty())
+
+				rr = CallRequest(NewRequestInt(http.MethodGet, target+"&cursor="+cursor, nil))
+				Expect(rr.CheckError()).ToNot(HaveOccurred())
+				finalIncidents, err = rr.UnmarshalToIncidents()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(finalIncidents).To(HaveLen(1))
+				Expect(finalIncidents[0].GUID).To(Equal("4"))
+				Expect(rr.Header().Get("X-Next-Cursor")).To(BeEmpty())
+			})
+			It("should refuse invalid parameters", func() {
+				rr := CallRequest(NewRequestInt(http.MethodGet, "/v1/incidents?states=unknown", nil))
+				Expect(rr.Code).To(Equal(http.StatusBadRequest))
+			})
+		})
 
 	})
 
@@ -287,6 +381,23 @@ var _ = Describe("Api", func() {
 			_, err = fakeStoreMem.Read("1")
 			Expect(err).To(HaveOccurred())
 		})
+		It("should answer accepted when deletion is still pending on targets", func() {
+			_, err := fakeStoreMem.Create(models.Incident{
+				GUID:      "1",
+				CreatedAt: time.Now().UTC(),
+				UpdatedAt: time.Now().UTC(),
+				Components: &models.Components{{
+					Name:  Component1.Name,
+					Group: Component1.Group,
+				}},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			fakeStoreMem.DeleteReturns(fmt.Errorf("%w: 0 acknowledgement(s) on 1 required", storages.ErrWritePending))
+
+			rr := CallRequest(NewRequestIntAdmin(http.MethodDelete, "/v1/incidents/1", nil))
+			Expect(rr.Code).To(Equal(http.StatusAccepted))
+			Expect(fakeStoreMem.DeleteTrashedCallCount()).To(Equal(0))
+		})
 
 	})
 	Context("Update", func() {
@@ -513,6 +624,7 @@ var _ = Describe("Api", func() {
 				Expect(lastMessage.GUID).ToNot(BeEmpty())
 				Expect(lastMessage.Title).To(Equal("a sub title"))
 				Expect(lastMessage.Content).To(Equal("a sub content"))
+				Expect(finalIncident.UpdatedAt).To(BeTemporally("~", time.Now(), time.Minute))
 			})
 		})
 		Context("DeleteMessage", func() {
@@ -581,6 +693,7 @@ var _ = Describe("Api", func() {
 				Expect(finalIncident.Messages[0].GUID).To(Equal("1"))
 				Expect(finalIncident.Messages[0].Title).To(Equal("a title changed"))
 				Expect(finalIncident.Messages[0].Content).To(Equal("a content changed"))
+				Expect(finalIncident.UpdatedAt).To(BeTemporally("~", time.Now(), time.Minute))
 			})
 		})
 		Context("Notify", func() {
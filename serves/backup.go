@@ -0,0 +1,57 @@
+package serves
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nicklaw5/go-respond"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/storages"
+)
+
+func (a *Serve) Export(w http.ResponseWriter, req *http.Request) {
+	// archive is built in memory to be able to send an error if export fails midway
+	buf := &bytes.Buffer{}
+	err := storages.Export(a.store, buf)
+	if err != nil {
+		JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(
+		`attachment; filename="statusetat-%s.json.gz"`, time.Now().UTC().Format("20060102-150405"),
+	))
+	w.WriteHeader(http.StatusOK)
+	//nolint:errcheck
+	w.Write(buf.Bytes())
+}
+
+// MaxImportSize is the maximum size of an archive sent to import
+const MaxImportSize = 64 << 20
+
+func (a *Serve) Import(w http.ResponseWriter, req *http.Request) {
+	archive, err := storages.ReadArchive(http.MaxBytesReader(w, req.Body, MaxImportSize))
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		JSONError(w, fmt.Errorf("archive is bigger than %d bytes", maxBytesErr.Limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		JSONError(w, err, http.StatusBadRequest)
+		return
+	}
+	report, err := storages.ImportArchive(a.store, archive)
+	// imported incidents are not emitted, index must be rebuilt even on partial import
+	if rebuildErr := a.searchIndex.Rebuild(a.store); rebuildErr != nil {
+		log.Errorf("Could not rebuild search index after import: %s", rebuildErr.Error())
+	}
+	if err != nil {
+		JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	respond.NewResponse(w).Ok(report)
+}
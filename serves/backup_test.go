@@ -0,0 +1,107 @@
+package serves_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+	"github.com/orange-cloudfoundry/statusetat/v2/serves"
+	"github.com/orange-cloudfoundry/statusetat/v2/storages"
+	"github.com/orange-cloudfoundry/statusetat/v2/storages/storagesfakes"
+)
+
+// spaces is a reader of json whitespaces without end
+type spaces struct{}
+
+func (spaces) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = ' '
+	}
+	return len(p), nil
+}
+
+var _ = Describe("Backup", func() {
+	Context("Export", func() {
+		It("should give unauthorized when user not set", func() {
+			rr := CallRequest(NewRequestInt(http.MethodGet, "/v1/admin/export", nil))
+			Expect(rr.Code).To(Equal(http.StatusUnauthorized))
+		})
+		It("should give a compressed archive of all data", func() {
+			_, err := fakeStoreMem.Create(models.Incident{
+				GUID:      "aguid",
+				CreatedAt: time.Now().AddDate(-1, 0, 0).UTC(),
+				UpdatedAt: time.Now().UTC(),
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fakeStoreMem.Subscribe("email@local")).To(Succeed())
+
+			rr := CallRequest(NewRequestIntAdmin(http.MethodGet, "/v1/admin/export", nil))
+			Expect(rr.CheckError()).ToNot(HaveOccurred())
+			Expect(rr.Header().Get("Content-Type")).To(Equal("application/gzip"))
+
+			archive, err := storages.ReadArchive(rr.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(archive.Incidents).To(HaveLen(1))
+			Expect(archive.Incidents[0].GUID).To(Equal("aguid"))
+			Expect(archive.Subscribers).To(ConsistOf("email@local"))
+		})
+	})
+	Context("Import", func() {
+		It("should give unauthorized when user not set", func() {
+			rr := CallRequest(NewRequestInt(http.MethodPost, "/v1/admin/import", nil))
+			Expect(rr.Code).To(Equal(http.StatusUnauthorized))
+		})
+		It("should refuse an invalid archive", func() {
+			req := httptest.NewRequest(http.MethodPost, "/v1/admin/import", bytes.NewBufferString("not an archive"))
+			req.SetBasicAuth("admin", "admin")
+			rr := CallRequest(req)
+			Expect(rr.Code).To(Equal(http.StatusBadRequest))
+		})
+		It("should refuse an archive too big", func() {
+			// archive is streamed to not keep it in memory
+			pr, pw := io.Pipe()
+			go func() {
+				defer GinkgoRecover()
+				gw, err := gzip.NewWriterLevel(pw, gzip.NoCompression)
+				Expect(err).ToNot(HaveOccurred())
+				// writing fails once server stopped reading
+				_, err = io.Copy(gw, io.LimitReader(spaces{}, serves.MaxImportSize+1))
+				pw.CloseWithError(err)
+			}()
+			DeferCleanup(pr.Close)
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/admin/import", pr)
+			req.SetBasicAuth("admin", "admin")
+			rr := CallRequest(req)
+			Expect(rr.Code).To(Equal(http.StatusRequestEntityTooLarge))
+		})
+		It("should load an archive", func() {
+			buf := &bytes.Buffer{}
+			archiveStore := &storagesfakes.FakeStore{}
+			archiveStore.QueryReturns(storages.IncidentPage{Incidents: []models.Incident{{GUID: "aguid", UpdatedAt: time.Now()}}}, nil)
+			archiveStore.SubscribersReturns([]string{"email@local"}, nil)
+			Expect(storages.Export(archiveStore, buf)).To(Succeed())
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/admin/import", buf)
+			req.SetBasicAuth("admin", "admin")
+			rr := CallRequest(req)
+			Expect(rr.CheckError()).ToNot(HaveOccurred())
+
+			var report storages.MigrateReport
+			Expect(rr.Unmarshal(&report)).To(Succeed())
+			Expect(report.Created).To(Equal(1))
+			Expect(report.SubscribersAdded).To(Equal(1))
+
+			inc, err := fakeStoreMem.Read("aguid")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(inc.GUID).To(Equal("aguid"))
+		})
+	})
+})
@@ -1,26 +1,33 @@
 package serves
 
 import (
+	"fmt"
 	"net/http"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/orange-cloudfoundry/statusetat/v2/config"
 	"github.com/orange-cloudfoundry/statusetat/v2/models"
+	"github.com/orange-cloudfoundry/statusetat/v2/storages"
 )
 
-func (a *Serve) scheduled(from, to time.Time) ([]models.Incident, error) {
-	scheduled := make([]models.Incident, 0)
+// shownAsIncident sets query to only match incidents shown as incidents when asIncident is true
+// or shown as maintenances otherwise, filter is done by store before pagination.
+func (a *Serve) shownAsIncident(query *storages.IncidentQuery, asIncident bool) {
+	query.ShownAsIncident = &asIncident
+	query.DisableMaintenanceToIncident = a.config.DisableMaintenanceToIncident
+}
 
-	incidents, err := a.store.ByDate(from, to)
+func (a *Serve) scheduled(from, to time.Time) ([]models.Incident, error) {
+	query := storages.IncidentQuery{From: from, To: to}
+	a.shownAsIncident(&query, false)
+	page, err := a.store.Query(query)
 	if err != nil {
-		return scheduled, err
-	}
-	for _, incident := range incidents {
-		if !incident.ShouldBeIncident(a.config.DisableMaintenanceToIncident) {
-			scheduled = append(scheduled, incident)
-		}
+		return []models.Incident{}, err
 	}
+	scheduled := page.Incidents
 	sort.Sort(models.Incidents(scheduled))
 	return scheduled, nil
 }
@@ -48,23 +55,82 @@ func (a *Serve) isAllType(req *http.Request) bool {
 }
 
 func (a *Serve) incidentsByParamsDate(from, to time.Time, allType bool) ([]models.Incident, error) {
-	incidents, err := a.store.ByDate(from, to)
+	query := storages.IncidentQuery{From: from, To: to}
+	if !allType {
+		a.shownAsIncident(&query, true)
+	}
+	page, err := a.store.Query(query)
 	if err != nil {
 		return []models.Incident{}, err
 	}
-	finalIncidents := make([]models.Incident, 0)
-	for _, incident := range incidents {
-		if allType {
-			finalIncidents = append(finalIncidents, incident)
-			continue
+	incidents := page.Incidents
+	sort.Sort(sort.Reverse(models.Incidents(incidents)))
+	return incidents, nil
+}
+
+// incidentQueryFromReq builds a store query from request parameters, multiple values can be given
+// by repeating parameter or separating them by comma.
+func (a *Serve) incidentQueryFromReq(req *http.Request, from, to time.Time) (storages.IncidentQuery, error) {
+	values := req.URL.Query()
+	query := storages.IncidentQuery{
+		From:       from,
+		To:         to,
+		Components: multiValues(values["components"]),
+		Groups:     multiValues(values["groups"]),
+		Text:       values.Get("text"),
+		Cursor:     values.Get("cursor"),
+	}
+	for _, state := range multiValues(values["states"]) {
+		i, err := strconv.Atoi(state)
+		if err != nil {
+			return query, fmt.Errorf("invalid incident state '%s'", state)
+		}
+		query.States = append(query.States, models.IncidentState(i))
+	}
+	for _, state := range multiValues(values["component_states"]) {
+		i, err := strconv.Atoi(state)
+		if err != nil {
+			return query, fmt.Errorf("invalid component state '%s'", state)
 		}
-		if !incident.ShouldBeIncident(a.config.DisableMaintenanceToIncident) {
-			continue
+		query.ComponentStates = append(query.ComponentStates, models.ComponentState(i))
+	}
+	if values.Get("scheduled") != "" {
+		scheduled, err := strconv.ParseBool(values.Get("scheduled"))
+		if err != nil {
+			return query, fmt.Errorf("invalid scheduled value '%s'", values.Get("scheduled"))
+		}
+		query.Scheduled = &scheduled
+	}
+	var err error
+	query.Limit, err = intParam(values.Get("limit"))
+	if err != nil {
+		return query, fmt.Errorf("invalid limit: %s", err.Error())
+	}
+	query.Offset, err = intParam(values.Get("offset"))
+	if err != nil {
+		return query, fmt.Errorf("invalid offset: %s", err.Error())
+	}
+	return query, query.Validate()
+}
+
+func multiValues(values []string) []string {
+	final := make([]string, 0)
+	for _, value := range values {
+		for _, v := range strings.Split(value, ",") {
+			v = strings.TrimSpace(v)
+			if v != "" {
+				final = append(final, v)
+			}
 		}
-		finalIncidents = append(finalIncidents, incident)
 	}
-	sort.Sort(sort.Reverse(models.Incidents(finalIncidents)))
-	return finalIncidents, nil
+	return final
+}
+
+func intParam(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
 }
 
 func (a *Serve) timelineFormat(t time.Time) string {
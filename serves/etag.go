@@ -0,0 +1,106 @@
+package serves
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+	"github.com/orange-cloudfoundry/statusetat/v2/storages"
+)
+
+// incidentLocks serializes changes made on a same incident by this instance, changes made by other instances
+// are detected by store when saving incident (see saveIncident).
+// A lock is forgotten as soon as nobody holds or waits for it.
+type incidentLocks struct {
+	mu    *sync.Mutex
+	locks map[string]*incidentLock
+}
+
+type incidentLock struct {
+	mu *sync.Mutex
+	// users is the number of requests holding or waiting for the lock
+	users int
+}
+
+func newIncidentLocks() *incidentLocks {
+	return &incidentLocks{
+		mu:    &sync.Mutex{},
+		locks: make(map[string]*incidentLock),
+	}
+}
+
+// lock locks incident and gives function to unlock it.
+func (l *incidentLocks) lock(guid string) func() {
+	l.mu.Lock()
+	lock, ok := l.locks[guid]
+	if !ok {
+		lock = &incidentLock{mu: &sync.Mutex{}}
+		l.locks[guid] = lock
+	}
+	lock.users++
+	l.mu.Unlock()
+
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		lock.users--
+		if lock.users == 0 {
+			delete(l.locks, guid)
+		}
+	}
+}
+
+// checkIfMatch gives an error when If-Match header is set and none of its entity tags match incident.
+func checkIfMatch(req *http.Request, incident models.Incident) error {
+	ifMatch := req.Header.Get("If-Match")
+	if ifMatch == "" {
+		return nil
+	}
+	for _, etag := range strings.Split(ifMatch, ",") {
+		etag = strings.TrimSpace(etag)
+		if etag == "*" || etag == incident.ETag() {
+			return nil
+		}
+	}
+	return fmt.Errorf("incident has been modified by someone else, current version is %d", incident.Version)
+}
+
+// conflictError answers 412 with current entity tag of incident to let client know it must reload it.
+func conflictError(w http.ResponseWriter, err error, incident models.Incident) {
+	w.Header().Set("ETag", incident.ETag())
+	JSONError(w, err, http.StatusPreconditionFailed)
+}
+
+// saveIncident writes incident changed by request, when request has an If-Match header incident is only written
+// if it is still at version it was read, this is checked by store to detect changes made by other instances.
+func (a *Serve) saveIncident(req *http.Request, guid string, version int, incident models.Incident) (models.Incident, error) {
+	ifMatch := strings.TrimSpace(req.Header.Get("If-Match"))
+	if ifMatch == "" || ifMatch == "*" {
+		return a.storeAs(req).Update(guid, incident)
+	}
+	return a.storeAs(req).UpdateIfVersion(guid, version, incident)
+}
+
+// saveError answers error given by saveIncident, a conflict is answered with current entity tag of incident.
+func (a *Serve) saveError(w http.ResponseWriter, guid string, err error) {
+	if errors.Is(err, storages.ErrVersionConflict) {
+		current, errRead := a.store.Read(guid)
+		if errRead != nil {
+			JSONError(w, err, http.StatusPreconditionFailed)
+			return
+		}
+		conflictError(w, fmt.Errorf("%s, current version is %d", err.Error(), current.Version), current)
+		return
+	}
+	if os.IsNotExist(err) {
+		JSONError(w, err, http.StatusNotFound)
+		return
+	}
+	WriteError(w, err, http.StatusInternalServerError)
+}
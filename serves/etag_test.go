@@ -0,0 +1,144 @@
+package serves_test
+
+import (
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+)
+
+var _ = Describe("ETag", func() {
+	var incident models.Incident
+	BeforeEach(func() {
+		rr := CallRequest(NewRequestIntAdmin(http.MethodPost, "/v1/incidents", models.Incident{
+			Components: &models.Components{{
+				Name:  Component1.Name,
+				Group: Component1.Group,
+			}},
+			State: models.Monitoring,
+			Messages: models.Messages{
+				{
+					CreatedAt: time.Now().UTC(),
+					Title:     "A title",
+					Content:   "a content",
+				},
+			},
+		}))
+		Expect(rr.CheckError()).ToNot(HaveOccurred())
+		Expect(rr.Header().Get("ETag")).To(Equal(`"1"`))
+		var err error
+		incident, err = rr.UnmarshalToIncident()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(incident.Version).To(Equal(1))
+	})
+	withIfMatch := func(req *http.Request, etag string) *http.Request {
+		req.Header.Set("If-Match", etag)
+		return req
+	}
+
+	It("should give etag of incident on read", func() {
+		rr := CallRequest(NewRequestInt(http.MethodGet, "/v1/incidents/"+incident.GUID, nil))
+		Expect(rr.CheckError()).ToNot(HaveOccurred())
+		Expect(rr.Header().Get("ETag")).To(Equal(`"1"`))
+	})
+	It("should increment version on each change", func() {
+		state := models.Resolved
+		rr := CallRequest(NewRequestIntAdmin(http.MethodPut, "/v1/incidents/"+incident.GUID, models.IncidentUpdateRequest{
+			State: &state,
+		}))
+		Expect(rr.CheckError()).ToNot(HaveOccurred())
+		Expect(rr.Header().Get("ETag")).To(Equal(`"2"`))
+
+		rr = CallRequest(NewRequestIntAdmin(http.MethodPost, "/v1/incidents/"+incident.GUID+"/messages", models.Message{
+			Title: "a sub title",
+		}))
+		Expect(rr.CheckError()).ToNot(HaveOccurred())
+		Expect(rr.Header().Get("ETag")).To(Equal(`"3"`))
+
+		stored, err := fakeStoreMem.Read(incident.GUID)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stored.Version).To(Equal(3))
+	})
+	It("should update incident when If-Match matches current etag", func() {
+		state := models.Resolved
+		rr := CallRequest(withIfMatch(NewRequestIntAdmin(http.MethodPut, "/v1/incidents/"+incident.GUID, models.IncidentUpdateRequest{
+			State: &state,
+		}), `"0", "1"`))
+		Expect(rr.CheckError()).ToNot(HaveOccurred())
+		Expect(rr.Header().Get("ETag")).To(Equal(`"2"`))
+	})
+	It("should accept any etag with wildcard", func() {
+		rr := CallRequest(withIfMatch(NewRequestIntAdmin(http.MethodPut, "/v1/incidents/"+incident.GUID+"/messages/"+incident.MainMessage().GUID, models.Message{
+			Title: "a title changed",
+		}), "*"))
+		Expect(rr.CheckError()).ToNot(HaveOccurred())
+	})
+	It("should refuse update with stale etag and give current one", func() {
+		state := models.Resolved
+		rr := CallRequest(NewRequestIntAdmin(http.MethodPut, "/v1/incidents/"+incident.GUID, models.IncidentUpdateRequest{
+			State: &state,
+		}))
+		Expect(rr.CheckError()).ToNot(HaveOccurred())
+
+		state = models.Idle
+		rr = CallRequest(withIfMatch(NewRequestIntAdmin(http.MethodPut, "/v1/incidents/"+incident.GUID, models.IncidentUpdateRequest{
+			State: &state,
+		}), `"1"`))
+		Expect(rr.Code).To(Equal(http.StatusPreconditionFailed))
+		Expect(rr.Header().Get("ETag")).To(Equal(`"2"`))
+
+		stored, err := fakeStoreMem.Read(incident.GUID)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stored.State).To(Equal(models.Resolved))
+		Expect(stored.Version).To(Equal(2))
+	})
+	It("should refuse update when incident is changed by another instance meanwhile", func() {
+		read := fakeStoreMem.ReadStub
+		fakeStoreMem.ReadCalls(func(guid string) (models.Incident, error) {
+			current, err := read(guid)
+			// another instance changes incident right after it has been read here
+			fakeStoreMem.ReadCalls(read)
+			changed := current
+			changed.State = models.Unresolved
+			changed.Version++
+			_, errUpdate := fakeStoreMem.Update(guid, changed)
+			Expect(errUpdate).ToNot(HaveOccurred())
+			return current, err
+		})
+
+		state := models.Resolved
+		rr := CallRequest(withIfMatch(NewRequestIntAdmin(http.MethodPut, "/v1/incidents/"+incident.GUID, models.IncidentUpdateRequest{
+			State: &state,
+		}), `"1"`))
+		Expect(rr.Code).To(Equal(http.StatusPreconditionFailed))
+		Expect(rr.Header().Get("ETag")).To(Equal(`"2"`))
+
+		stored, err := fakeStoreMem.Read(incident.GUID)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stored.State).To(Equal(models.Unresolved))
+		Expect(stored.Version).To(Equal(2))
+	})
+	It("should refuse changes on messages with stale etag", func() {
+		messageUrl := "/v1/incidents/" + incident.GUID + "/messages"
+		rr := CallRequest(withIfMatch(NewRequestIntAdmin(http.MethodPost, messageUrl, models.Message{
+			Title: "a sub title",
+		}), `"2"`))
+		Expect(rr.Code).To(Equal(http.StatusPreconditionFailed))
+
+		rr = CallRequest(withIfMatch(NewRequestIntAdmin(http.MethodPut, messageUrl+"/"+incident.MainMessage().GUID, models.Message{
+			Title: "a title changed",
+		}), `"2"`))
+		Expect(rr.Code).To(Equal(http.StatusPreconditionFailed))
+
+		rr = CallRequest(withIfMatch(NewRequestIntAdmin(http.MethodDelete, messageUrl+"/"+incident.MainMessage().GUID, nil), `"2"`))
+		Expect(rr.Code).To(Equal(http.StatusPreconditionFailed))
+
+		stored, err := fakeStoreMem.Read(incident.GUID)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stored.Messages).To(HaveLen(1))
+		Expect(stored.MainMessage().Title).To(Equal("A title"))
+	})
+})
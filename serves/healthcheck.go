@@ -3,12 +3,55 @@ package serves
 import (
 	"encoding/json"
 	"net/http"
+	"net/url"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/storages"
 )
 
+type healthStatus struct {
+	Status  string                  `json:"status"`
+	Detail  string                  `json:"detail,omitempty"`
+	Targets []storages.TargetHealth `json:"targets,omitempty"`
+}
+
+// HealthCheck answers ok when at least one store target answers.
 func (a *Serve) HealthCheck(w http.ResponseWriter, req *http.Request) {
-	response := map[string]string{"status": "ok"}
+	writeHealth(w, a.store.Ping(), nil)
+}
+
+// Readiness answers ok only when data can be written in at least one store target.
+func (a *Serve) Readiness(w http.ResponseWriter, req *http.Request) {
+	writeHealth(w, storages.Ready(a.store), nil)
+}
+
+// HealthDetails gives health of each store target, credentials in targets url are redacted.
+func (a *Serve) HealthDetails(w http.ResponseWriter, req *http.Request) {
+	targets, err := storages.CheckHealth(a.store, a.firstTarget())
+	writeHealth(w, err, targets)
+}
+
+func (a *Serve) firstTarget() *url.URL {
+	if len(a.config.Targets) == 0 {
+		return nil
+	}
+	u, err := a.config.Targets[0].Validate()
+	if err != nil {
+		return nil
+	}
+	return u
+}
+
+func writeHealth(w http.ResponseWriter, err error, targets []storages.TargetHealth) {
+	response := healthStatus{Status: "ok", Targets: targets}
+	code := http.StatusOK
+	if err != nil {
+		response.Status = "ko"
+		response.Detail = err.Error()
+		code = http.StatusServiceUnavailable
+		LogError(err, code)
+	}
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(code)
 	if err := json.NewEncoder(w).Encode(response); err != nil {
 		LogError(err, 500)
 	}
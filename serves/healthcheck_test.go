@@ -0,0 +1,55 @@
+package serves_test
+
+import (
+	"fmt"
+	"net/http"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Healthcheck", func() {
+	Context("HealthCheck", func() {
+		It("should answer ok when store answers", func() {
+			rr := CallRequest(NewRequestInt(http.MethodGet, "/healthy", nil))
+			Expect(rr.CheckError()).ToNot(HaveOccurred())
+			Expect(rr.Body.String()).To(ContainSubstring(`"status":"ok"`))
+		})
+		It("should answer service unavailable when store does not answer", func() {
+			fakeStoreMem.PingReturns(fmt.Errorf("store down"))
+
+			rr := CallRequest(NewRequestInt(http.MethodGet, "/healthy", nil))
+			Expect(rr.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(rr.Body.String()).To(ContainSubstring("store down"))
+
+			rr = CallRequest(NewRequestInt(http.MethodGet, "/ready", nil))
+			Expect(rr.Code).To(Equal(http.StatusServiceUnavailable))
+		})
+	})
+	Context("HealthDetails", func() {
+		It("should give unauthorized when user not set", func() {
+			rr := CallRequest(NewRequestInt(http.MethodGet, "/v1/health", nil))
+			Expect(rr.Code).To(Equal(http.StatusUnauthorized))
+		})
+		It("should give health of each target", func() {
+			fakeStoreMem.PingReturns(fmt.Errorf("store down"))
+
+			rr := CallRequest(NewRequestIntAdmin(http.MethodGet, "/v1/health", nil))
+			Expect(rr.Code).To(Equal(http.StatusServiceUnavailable))
+
+			var health map[string]interface{}
+			Expect(rr.Unmarshal(&health)).To(Succeed())
+			Expect(health["status"]).To(Equal("ko"))
+			Expect(health["targets"]).To(HaveLen(1))
+			target := health["targets"].([]interface{})[0].(map[string]interface{})
+			Expect(target["healthy"]).To(BeFalse())
+			Expect(target["last_error"]).To(Equal("store down"))
+		})
+		It("should ping store only once", func() {
+			pings := fakeStoreMem.PingCallCount()
+			rr := CallRequest(NewRequestIntAdmin(http.MethodGet, "/v1/health", nil))
+			Expect(rr.CheckError()).ToNot(HaveOccurred())
+			Expect(fakeStoreMem.PingCallCount() - pings).To(Equal(1))
+		})
+	})
+})
@@ -12,6 +12,7 @@ import (
 
 	"github.com/orange-cloudfoundry/statusetat/v2/config"
 	"github.com/orange-cloudfoundry/statusetat/v2/models"
+	"github.com/orange-cloudfoundry/statusetat/v2/search"
 )
 
 type IndexData struct {
@@ -346,7 +347,20 @@ func (a *Serve) ShowIncident(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// historySearch is a search made from history page
+type historySearch struct {
+	Query  search.Query
+	Result *search.Result
+	// PreviousOffset and NextOffset are offsets of other pages of results, -1 when there is none
+	PreviousOffset int
+	NextOffset     int
+}
+
 func (a *Serve) History(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Query().Get("q") != "" {
+		a.historySearch(w, req)
+		return
+	}
 	from, to, err := a.periodFromReq(req, -6, 0)
 	if err != nil {
 		HTMLError(w, err, http.StatusInternalServerError)
@@ -399,6 +413,7 @@ func (a *Serve) History(w http.ResponseWriter, req *http.Request) {
 		IndexData
 		Before time.Time
 		After  time.Time
+		Search historySearch
 	}{
 		IndexData: IndexData{
 			BaseInfo:      a.BaseInfo(),
@@ -415,3 +430,47 @@ func (a *Serve) History(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 }
+
+func (a *Serve) historySearch(w http.ResponseWriter, req *http.Request) {
+	query, err := searchQueryFromReq(req)
+	if err != nil {
+		HTMLError(w, err, http.StatusBadRequest)
+		return
+	}
+	query.Limit = historySearchLimit
+	result := a.searchIndex.Search(query)
+
+	previousOffset := -1
+	if query.Offset > 0 {
+		previousOffset = max(0, query.Offset-query.Limit)
+	}
+	nextOffset := -1
+	if query.Offset+query.Limit < result.Total {
+		nextOffset = query.Offset + query.Limit
+	}
+
+	timezone := ""
+	if !a.IsDefaultLocation(req) {
+		timezone = a.Location(req).String()
+	}
+	err = a.xt.ExecuteTemplate(w, "history.gohtml", struct {
+		IndexData
+		Search historySearch
+	}{
+		IndexData: IndexData{
+			BaseInfo: a.BaseInfo(),
+			Timezone: timezone,
+			Theme:    *a.config.Theme,
+		},
+		Search: historySearch{
+			Query:          query,
+			Result:         &result,
+			PreviousOffset: previousOffset,
+			NextOffset:     nextOffset,
+		},
+	})
+	if err != nil {
+		HTMLError(w, err, http.StatusInternalServerError)
+		return
+	}
+}
@@ -5,6 +5,7 @@ package serves
 import (
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -16,6 +17,7 @@ import (
 	"github.com/orange-cloudfoundry/statusetat/v2/extemplate"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/orange-cloudfoundry/statusetat/v2/search"
 	"github.com/orange-cloudfoundry/statusetat/v2/storages"
 )
 
@@ -28,6 +30,8 @@ type Serve struct {
 	xt             HtmlTemplater
 	config         config.Config
 	adminMenuItems []menuItem
+	searchIndex    *search.Index
+	incidentLocks  *incidentLocks
 }
 
 //go:embed website/templates/*
@@ -44,9 +48,13 @@ func Register(
 	if err != nil {
 		return err
 	}
-	return RegisterWithHtmlTemplater(store, router, userInfo, xt, config)
+	searchIndex := search.NewIndex()
+	go searchIndex.Run(store)
+	return register(store, router, userInfo, xt, config, searchIndex)
 }
 
+// RegisterWithHtmlTemplater registers routes with given templater,
+// search index is built once from store and is only updated by incidents changes made through these routes.
 func RegisterWithHtmlTemplater(
 	store storages.Store,
 	router *mux.Router,
@@ -54,10 +62,28 @@ func RegisterWithHtmlTemplater(
 	htmlTemplater HtmlTemplater,
 	config config.Config,
 ) error {
+	searchIndex := search.NewIndex()
+	err := searchIndex.Rebuild(store)
+	if err != nil {
+		log.Errorf("Could not build search index: %s", err.Error())
+	}
+	return register(store, router, userInfo, htmlTemplater, config, searchIndex)
+}
+
+func register(
+	store storages.Store,
+	router *mux.Router,
+	userInfo *url.Userinfo,
+	htmlTemplater HtmlTemplater,
+	config config.Config,
+	searchIndex *search.Index,
+) error {
 
 	api := &Serve{
-		store:  store,
-		config: config,
+		store:         store,
+		config:        config,
+		searchIndex:   searchIndex,
+		incidentLocks: newIncidentLocks(),
 		adminMenuItems: []menuItem{
 			{
 				ID:          "incident",
@@ -71,6 +97,10 @@ func RegisterWithHtmlTemplater(
 				ID:          "persistent_incident",
 				DisplayName: config.Theme.PersistentDisplayName,
 			},
+			{
+				ID:          "trash",
+				DisplayName: "trash",
+			},
 			{
 				ID:          "info",
 				DisplayName: "info",
@@ -88,6 +118,7 @@ func RegisterWithHtmlTemplater(
 	router.HandleFunc("/atom.xml", api.Atom)
 	router.HandleFunc("/cal.ics", api.Ical)
 	router.HandleFunc("/healthy", api.HealthCheck)
+	router.HandleFunc("/ready", api.Readiness)
 	subRouter := router.PathPrefix("/v1").Subrouter()
 
 	subRouter.HandleFunc("/subscribe", api.SubscribeEmail).Methods(http.MethodGet, http.MethodPatch, http.MethodPost, http.MethodPut)
@@ -100,15 +131,24 @@ func RegisterWithHtmlTemplater(
 	subRouter.HandleFunc("/incidents/{guid}", api.Incident).Methods(http.MethodGet)
 	subRouter.HandleFunc("/incidents", api.ByDate).Methods(http.MethodGet)
 	subRouter.HandleFunc("/persistent_incidents", api.Persistents).Methods(http.MethodGet)
+	subRouter.HandleFunc("/search", api.Search).Methods(http.MethodGet)
 	subRouter.HandleFunc("/incidents/{incident_guid}/messages", api.ReadMessages).Methods(http.MethodGet)
 	subRouter.HandleFunc("/incidents/{incident_guid}/messages/{message_guid}", api.ReadMessage).Methods(http.MethodGet)
 
 	pass, _ := userInfo.Password()
 	bauthHandler := httpauth.SimpleBasicAuth(userInfo.Username(), pass)
 	subRouter.Handle("/subscribers", bauthHandler(http.HandlerFunc(api.ListSubscribers))).Methods(http.MethodGet)
+	subRouter.Handle("/health", bauthHandler(http.HandlerFunc(api.HealthDetails))).Methods(http.MethodGet)
+	subRouter.Handle("/admin/export", bauthHandler(http.HandlerFunc(api.Export))).Methods(http.MethodGet)
+	subRouter.Handle("/admin/import", bauthHandler(http.HandlerFunc(api.Import))).Methods(http.MethodPost)
+	subRouter.Handle("/admin/search/rebuild", bauthHandler(http.HandlerFunc(api.RebuildSearchIndex))).Methods(http.MethodPost)
 	subRouter.Handle("/incidents", bauthHandler(http.HandlerFunc(api.CreateIncident))).Methods(http.MethodPost)
 	subRouter.Handle("/incidents/{guid}", bauthHandler(http.HandlerFunc(api.Update))).Methods(http.MethodPut)
 	subRouter.Handle("/incidents/{guid}", bauthHandler(http.HandlerFunc(api.Delete))).Methods(http.MethodDelete)
+	subRouter.Handle("/trash", bauthHandler(http.HandlerFunc(api.Trash))).Methods(http.MethodGet)
+	subRouter.Handle("/trash/{guid}/restore", bauthHandler(http.HandlerFunc(api.RestoreTrashed))).Methods(http.MethodPost)
+	subRouter.Handle("/trash/{guid}", bauthHandler(http.HandlerFunc(api.DeleteTrashed))).Methods(http.MethodDelete)
+	subRouter.Handle("/incidents/{guid}/revisions", bauthHandler(http.HandlerFunc(api.Revisions))).Methods(http.MethodGet)
 	subRouter.Handle("/incidents/{guid}/notify", bauthHandler(http.HandlerFunc(api.Notify))).Methods(http.MethodPut)
 	subRouter.Handle("/incidents/{incident_guid}/messages", bauthHandler(http.HandlerFunc(api.AddMessage))).Methods(http.MethodPost)
 	subRouter.Handle("/incidents/{incident_guid}/messages/{message_guid}", bauthHandler(http.HandlerFunc(api.UpdateMessage))).Methods(http.MethodPut)
@@ -120,6 +160,7 @@ func RegisterWithHtmlTemplater(
 	subrouterAdmin.HandleFunc("/incident", api.AdminIncidents)
 	subrouterAdmin.HandleFunc("/persistent_incident", api.AdminPersistentIncidents)
 	subrouterAdmin.HandleFunc("/maintenance", api.AdminMaintenance)
+	subrouterAdmin.HandleFunc("/trash", api.AdminTrash)
 	subrouterAdmin.HandleFunc("/info", api.AdminInfo)
 	subrouterAdmin.HandleFunc("/incident/add", api.AdminAddEditIncident)
 	subrouterAdmin.HandleFunc("/incident/edit/{guid}", api.AdminAddEditIncident)
@@ -154,6 +195,16 @@ func JSONError(w http.ResponseWriter, err error, code int) {
 	}
 }
 
+// WriteError answers error given by a write on store with code, a write not acknowledged by enough
+// targets in time is answered 202 as it continues in background and is not lost.
+func WriteError(w http.ResponseWriter, err error, code int) {
+	if errors.Is(err, storages.ErrWritePending) {
+		JSONError(w, err, http.StatusAccepted)
+		return
+	}
+	JSONError(w, err, code)
+}
+
 func LogError(err error, code int) {
 	log.WithField("code", code).WithField("status_text", http.StatusText(code)).Debug(err.Error())
 }
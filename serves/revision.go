@@ -0,0 +1,73 @@
+package serves
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/nicklaw5/go-respond"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+	"github.com/orange-cloudfoundry/statusetat/v2/storages"
+)
+
+// actorFromReq gives who is doing request, it is the basic auth user unless request comes from a trusted proxy
+// telling who it acts for with X-Actor header, any client could otherwise impersonate someone else.
+func (a *Serve) actorFromReq(req *http.Request) string {
+	if actor := req.Header.Get("X-Actor"); actor != "" && a.config.TrustedProxies.Trusts(req.RemoteAddr) {
+		return actor
+	}
+	user, _, _ := req.BasicAuth()
+	return user
+}
+
+// storeAs gives store making changes on behalf of actor of request, e.g. to author git commits.
+func (a *Serve) storeAs(req *http.Request) storages.Store {
+	return storages.AsActor(a.store, a.actorFromReq(req))
+}
+
+// recordRevision records fields changed on incident by request, failures are only logged as change is already done.
+func (a *Serve) recordRevision(req *http.Request, incidentGuid string, action models.RevisionAction, previous, current map[string]json.RawMessage) {
+	changes := models.DiffFields(previous, current)
+	if len(changes) == 0 {
+		return
+	}
+	err := a.storeAs(req).AddRevision(models.Revision{
+		GUID:         uuid.NewString(),
+		IncidentGUID: incidentGuid,
+		CreatedAt:    time.Now().UTC(),
+		Actor:        a.actorFromReq(req),
+		Action:       action,
+		Changes:      changes,
+	})
+	if err != nil {
+		log.WithField("guid", incidentGuid).Errorf("Could not record revision of incident: %s", err.Error())
+	}
+}
+
+func (a *Serve) Revisions(w http.ResponseWriter, req *http.Request) {
+	v := mux.Vars(req)
+	guid := v["guid"]
+	revisions, err := a.store.Revisions(guid)
+	if err != nil {
+		JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if len(revisions) == 0 {
+		// incident may exist without revisions when created before revisions were recorded
+		_, err := a.store.Read(guid)
+		if err != nil {
+			if os.IsNotExist(err) {
+				JSONError(w, err, http.StatusNotFound)
+				return
+			}
+			JSONError(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+	respond.NewResponse(w).Ok(revisions)
+}
@@ -0,0 +1,146 @@
+package serves_test
+
+import (
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+)
+
+var _ = Describe("Revisions", func() {
+	var incident models.Incident
+	BeforeEach(func() {
+		rr := CallRequest(NewRequestIntAdmin(http.MethodPost, "/v1/incidents", models.Incident{
+			Components: &models.Components{{
+				Name:  Component1.Name,
+				Group: Component1.Group,
+			}},
+			State: models.Monitoring,
+			Messages: models.Messages{
+				{
+					CreatedAt: time.Now().UTC(),
+					Title:     "A title",
+					Content:   "a content",
+				},
+			},
+		}))
+		Expect(rr.CheckError()).ToNot(HaveOccurred())
+		var err error
+		incident, err = rr.UnmarshalToIncident()
+		Expect(err).ToNot(HaveOccurred())
+	})
+	revisionsOf := func(guid string) []models.Revision {
+		rr := CallRequest(NewRequestIntAdmin(http.MethodGet, "/v1/incidents/"+guid+"/revisions", nil))
+		Expect(rr.CheckError()).ToNot(HaveOccurred())
+		revisions := make([]models.Revision, 0)
+		Expect(rr.Unmarshal(&revisions)).To(Succeed())
+		return revisions
+	}
+	findChange := func(revision models.Revision, field string) models.FieldChange {
+		for _, change := range revision.Changes {
+			if change.Field == field {
+				return change
+			}
+		}
+		Fail("no change on field " + field)
+		return models.FieldChange{}
+	}
+
+	It("should give unauthorized when user not set", func() {
+		rr := CallRequest(NewRequestInt(http.MethodGet, "/v1/incidents/"+incident.GUID+"/revisions", nil))
+		Expect(rr.Code).To(Equal(http.StatusUnauthorized))
+	})
+	It("should give not found on unknown incident", func() {
+		rr := CallRequest(NewRequestIntAdmin(http.MethodGet, "/v1/incidents/unknown/revisions", nil))
+		Expect(rr.Code).To(Equal(http.StatusNotFound))
+	})
+	It("should record creation of incident", func() {
+		revisions := revisionsOf(incident.GUID)
+		Expect(revisions).To(HaveLen(1))
+		Expect(revisions[0].Action).To(Equal(models.RevisionCreated))
+		Expect(revisions[0].Actor).To(Equal("admin"))
+		change := findChange(revisions[0], "messages."+incident.Messages[0].GUID+".title")
+		Expect(change.Previous).To(BeEmpty())
+		Expect(change.CurrentText()).To(Equal("A title"))
+	})
+	It("should record changed fields with previous values on update", func() {
+		state := models.Unresolved
+		req := NewRequestIntAdmin(http.MethodPut, "/v1/incidents/"+incident.GUID, models.IncidentUpdateRequest{
+			State: &state,
+		})
+		req.Header.Set("X-Actor", "jdoe")
+		Expect(CallRequest(req).CheckError()).ToNot(HaveOccurred())
+
+		revisions := revisionsOf(incident.GUID)
+		Expect(revisions).To(HaveLen(2))
+		Expect(revisions[1].Action).To(Equal(models.RevisionUpdated))
+		Expect(revisions[1].Actor).To(Equal("jdoe"))
+		Expect(revisions[1].Changes).To(HaveLen(1))
+		Expect(revisions[1].Changes[0].Field).To(Equal("state"))
+		Expect(revisions[1].Changes[0].Previous).To(BeEquivalentTo("2"))
+		Expect(revisions[1].Changes[0].Current).To(BeEquivalentTo("0"))
+		Expect(revisions[1].Changes[0].PreviousText()).To(Equal("monitoring"))
+		Expect(revisions[1].Changes[0].CurrentText()).To(Equal("unresolved"))
+	})
+	It("should ignore actor given by a client which is not a trusted proxy", func() {
+		state := models.Unresolved
+		req := NewRequestIntAdmin(http.MethodPut, "/v1/incidents/"+incident.GUID, models.IncidentUpdateRequest{
+			State: &state,
+		})
+		req.Header.Set("X-Actor", "jdoe")
+		req.RemoteAddr = "198.51.100.1:1234"
+		Expect(CallRequest(req).CheckError()).ToNot(HaveOccurred())
+
+		revisions := revisionsOf(incident.GUID)
+		Expect(revisions).To(HaveLen(2))
+		Expect(revisions[1].Actor).To(Equal("admin"))
+	})
+	It("should record edition of a message", func() {
+		msgGuid := incident.Messages[0].GUID
+		rr := CallRequest(NewRequestIntAdmin(http.MethodPut, "/v1/incidents/"+incident.GUID+"/messages/"+msgGuid, models.Message{
+			Title:   "A title",
+			Content: "an edited content",
+		}))
+		Expect(rr.CheckError()).ToNot(HaveOccurred())
+
+		revisions := revisionsOf(incident.GUID)
+		Expect(revisions).To(HaveLen(2))
+		Expect(revisions[1].Changes).To(HaveLen(1))
+		change := findChange(revisions[1], "messages."+msgGuid+".content")
+		Expect(change.PreviousText()).To(Equal("a content"))
+		Expect(change.CurrentText()).To(Equal("an edited content"))
+	})
+	It("should not record update without change", func() {
+		Expect(CallRequest(NewRequestIntAdmin(http.MethodPut, "/v1/incidents/"+incident.GUID, models.IncidentUpdateRequest{})).CheckError()).ToNot(HaveOccurred())
+		Expect(revisionsOf(incident.GUID)).To(HaveLen(1))
+	})
+	It("should keep revisions of a deleted incident", func() {
+		Expect(CallRequest(NewRequestIntAdmin(http.MethodDelete, "/v1/incidents/"+incident.GUID, nil)).CheckError()).ToNot(HaveOccurred())
+
+		revisions := revisionsOf(incident.GUID)
+		Expect(revisions).To(HaveLen(2))
+		Expect(revisions[1].Action).To(Equal(models.RevisionDeleted))
+		change := findChange(revisions[1], "state")
+		Expect(change.PreviousText()).To(Equal("monitoring"))
+		Expect(change.Current).To(BeEmpty())
+	})
+	It("should give revisions most recent first in admin edit page", func() {
+		state := models.Resolved
+		Expect(CallRequest(NewRequestIntAdmin(http.MethodPut, "/v1/incidents/"+incident.GUID, models.IncidentUpdateRequest{
+			State: &state,
+		})).CheckError()).ToNot(HaveOccurred())
+
+		dataRetrieve := struct {
+			Revisions []models.Revision
+		}{}
+		fakeHtmlTemplater.ExecuteTemplateStub = TemplateUnmarshalIn("admin/add_edit_incident.gohtml", &dataRetrieve)
+		rr := CallRequest(NewRequestIntAdmin(http.MethodGet, "/admin/incident/edit/"+incident.GUID, nil))
+		Expect(rr.CheckError()).ToNot(HaveOccurred())
+		Expect(dataRetrieve.Revisions).To(HaveLen(2))
+		Expect(dataRetrieve.Revisions[0].Action).To(Equal(models.RevisionUpdated))
+		Expect(dataRetrieve.Revisions[1].Action).To(Equal(models.RevisionCreated))
+	})
+})
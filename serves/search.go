@@ -0,0 +1,63 @@
+package serves
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nicklaw5/go-respond"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/search"
+)
+
+// historySearchLimit is the number of search results shown by page in history
+const historySearchLimit = 20
+
+func searchQueryFromReq(req *http.Request) (search.Query, error) {
+	values := req.URL.Query()
+	query := search.Query{
+		Text:   values.Get("q"),
+		Period: values.Get("period"),
+	}
+	if query.Period != "" {
+		if _, err := time.Parse("2006-01", query.Period); err != nil {
+			return query, fmt.Errorf("invalid period '%s', it must be in form of 2006-01", query.Period)
+		}
+	}
+	var err error
+	query.Limit, err = intParam(values.Get("limit"))
+	if err != nil || query.Limit < 0 {
+		return query, fmt.Errorf("invalid limit '%s'", values.Get("limit"))
+	}
+	query.Offset, err = intParam(values.Get("offset"))
+	if err != nil || query.Offset < 0 {
+		return query, fmt.Errorf("invalid offset '%s'", values.Get("offset"))
+	}
+	return query, nil
+}
+
+func (a *Serve) Search(w http.ResponseWriter, req *http.Request) {
+	query, err := searchQueryFromReq(req)
+	if err != nil {
+		JSONError(w, err, http.StatusBadRequest)
+		return
+	}
+	if query.Text == "" {
+		JSONError(w, fmt.Errorf("parameter q must be set"), http.StatusBadRequest)
+		return
+	}
+	respond.NewResponse(w).Ok(a.searchIndex.Search(query))
+}
+
+func (a *Serve) RebuildSearchIndex(w http.ResponseWriter, req *http.Request) {
+	err := a.searchIndex.Rebuild(a.store)
+	if err != nil {
+		JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	respond.NewResponse(w).Ok(struct {
+		Incidents int `json:"incidents"`
+	}{
+		Incidents: a.searchIndex.Len(),
+	})
+}
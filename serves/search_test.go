@@ -0,0 +1,126 @@
+package serves_test
+
+import (
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+	"github.com/orange-cloudfoundry/statusetat/v2/search"
+)
+
+var _ = Describe("Search", func() {
+	createdAt := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	BeforeEach(func() {
+		_, err := fakeStoreMem.Create(models.Incident{
+			GUID:       "1",
+			CreatedAt:  createdAt,
+			UpdatedAt:  createdAt,
+			Components: &models.Components{{Name: Component1.Name, Group: Component1.Group}},
+			Messages: []models.Message{
+				{GUID: "msg1", IncidentGUID: "1", Title: "Database outage", Content: "Primary database is down", CreatedAt: createdAt},
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = fakeStoreMem.Create(models.Incident{
+			GUID:      "2",
+			CreatedAt: createdAt.AddDate(0, 1, 0),
+			UpdatedAt: createdAt.AddDate(0, 1, 0),
+			Messages: []models.Message{
+				{GUID: "msg2", IncidentGUID: "2", Title: "Network latency", Content: "Slow database replication", CreatedAt: createdAt},
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+	})
+	Context("RebuildSearchIndex", func() {
+		It("should give unauthorized when user not set", func() {
+			rr := CallRequest(NewRequestInt(http.MethodPost, "/v1/admin/search/rebuild", nil))
+			Expect(rr.Code).To(Equal(http.StatusUnauthorized))
+		})
+		It("should index incidents of store", func() {
+			rr := CallRequest(NewRequestIntAdmin(http.MethodPost, "/v1/admin/search/rebuild", nil))
+			Expect(rr.CheckError()).ToNot(HaveOccurred())
+			Expect(rr.Body.String()).To(ContainSubstring(`"incidents":2`))
+		})
+	})
+	Context("Search api", func() {
+		BeforeEach(func() {
+			rr := CallRequest(NewRequestIntAdmin(http.MethodPost, "/v1/admin/search/rebuild", nil))
+			Expect(rr.CheckError()).ToNot(HaveOccurred())
+		})
+		It("should give matching incidents with snippets and facets", func() {
+			rr := CallRequest(NewRequestInt(http.MethodGet, "/v1/search?q=datab", nil))
+			Expect(rr.CheckError()).ToNot(HaveOccurred())
+
+			var result search.Result
+			Expect(rr.Unmarshal(&result)).To(Succeed())
+			Expect(result.Total).To(Equal(2))
+			Expect(result.Hits[0].Incident.GUID).To(Equal("1"))
+			Expect(result.Hits[0].Snippets).To(ContainElement("<mark>Database</mark> outage"))
+			Expect(result.Facets).To(Equal([]search.Facet{
+				{Period: "2024-04", Count: 1},
+				{Period: "2024-03", Count: 1},
+			}))
+		})
+		It("should filter on period and paginate", func() {
+			rr := CallRequest(NewRequestInt(http.MethodGet, "/v1/search?q=database&period=2024-04&limit=1", nil))
+			Expect(rr.CheckError()).ToNot(HaveOccurred())
+
+			var result search.Result
+			Expect(rr.Unmarshal(&result)).To(Succeed())
+			Expect(result.Total).To(Equal(1))
+			Expect(result.Hits).To(HaveLen(1))
+			Expect(result.Hits[0].Incident.GUID).To(Equal("2"))
+		})
+		It("should give bad request on invalid parameters", func() {
+			rr := CallRequest(NewRequestInt(http.MethodGet, "/v1/search", nil))
+			Expect(rr.Code).To(Equal(http.StatusBadRequest))
+
+			rr = CallRequest(NewRequestInt(http.MethodGet, "/v1/search?q=database&period=march", nil))
+			Expect(rr.Code).To(Equal(http.StatusBadRequest))
+
+			rr = CallRequest(NewRequestInt(http.MethodGet, "/v1/search?q=database&limit=-1", nil))
+			Expect(rr.Code).To(Equal(http.StatusBadRequest))
+		})
+		It("should index incidents updated without notification", func() {
+			rr := CallRequest(NewRequestIntAdmin(http.MethodPut, "/v1/incidents/1", models.IncidentUpdateRequest{
+				Messages: &[]models.Message{{Title: "Storage outage", Content: "Disks are full"}},
+				NoNotify: true,
+			}))
+			Expect(rr.CheckError()).ToNot(HaveOccurred())
+
+			rr = CallRequest(NewRequestInt(http.MethodGet, "/v1/search?q=disks", nil))
+			Expect(rr.CheckError()).ToNot(HaveOccurred())
+			var result search.Result
+			Expect(rr.Unmarshal(&result)).To(Succeed())
+			Expect(result.Hits).To(HaveLen(1))
+			Expect(result.Hits[0].Incident.GUID).To(Equal("1"))
+		})
+	})
+	Context("History", func() {
+		It("should give search results when q is set", func() {
+			CallRequest(NewRequestIntAdmin(http.MethodPost, "/v1/admin/search/rebuild", nil))
+			dataRetrieve := struct {
+				Search struct {
+					Query          search.Query
+					Result         *search.Result
+					PreviousOffset int
+					NextOffset     int
+				}
+			}{}
+			fakeHtmlTemplater.ExecuteTemplateStub = TemplateUnmarshalIn("history.gohtml", &dataRetrieve)
+
+			rr := CallRequest(NewRequestInt(http.MethodGet, "/history?q=database&period=2024-03", nil))
+			Expect(rr.CheckError()).ToNot(HaveOccurred())
+			Expect(dataRetrieve.Search.Query.Text).To(Equal("database"))
+			Expect(dataRetrieve.Search.Result).ToNot(BeNil())
+			Expect(dataRetrieve.Search.Result.Total).To(Equal(1))
+			Expect(dataRetrieve.Search.Result.Hits[0].Incident.GUID).To(Equal("1"))
+			Expect(dataRetrieve.Search.Result.Facets).To(HaveLen(2))
+			Expect(dataRetrieve.Search.PreviousOffset).To(Equal(-1))
+			Expect(dataRetrieve.Search.NextOffset).To(Equal(-1))
+		})
+	})
+})
@@ -86,9 +86,16 @@ var _ = BeforeEach(func() {
 
 	fakeStoreMem.CreateStub = dbStore.Create
 	fakeStoreMem.UpdateStub = dbStore.Update
+	fakeStoreMem.UpdateIfVersionStub = dbStore.UpdateIfVersion
 	fakeStoreMem.DeleteStub = dbStore.Delete
 	fakeStoreMem.ReadStub = dbStore.Read
 	fakeStoreMem.ByDateStub = dbStore.ByDate
+	fakeStoreMem.QueryStub = dbStore.Query
+	fakeStoreMem.AddRevisionStub = dbStore.AddRevision
+	fakeStoreMem.RevisionsStub = dbStore.Revisions
+	fakeStoreMem.AddTrashedStub = dbStore.AddTrashed
+	fakeStoreMem.TrashedStub = dbStore.Trashed
+	fakeStoreMem.DeleteTrashedStub = dbStore.DeleteTrashed
 
 	fakeStoreMem.SubscribeStub = dbStore.Subscribe
 	fakeStoreMem.UnsubscribeStub = dbStore.Unsubscribe
@@ -105,6 +112,8 @@ var _ = BeforeEach(func() {
 		CookieKey:  "",
 		Notifiers:  []config.Notifier{},
 		Theme:      &Theme,
+		// remote address of requests made by httptest
+		TrustedProxies: config.TrustedProxies{"192.0.2.0/24"},
 	})
 	Expect(err).ToNot(HaveOccurred())
 	emitter.SetEmitter(fakeEmitter)
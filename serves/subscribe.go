@@ -1,9 +1,12 @@
 package serves
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"net/mail"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/storages"
 )
 
 func (a *Serve) SubscribeEmail(w http.ResponseWriter, req *http.Request) {
@@ -19,7 +22,7 @@ func (a *Serve) SubscribeEmail(w http.ResponseWriter, req *http.Request) {
 	}
 	err = a.store.Subscribe(email)
 	if err != nil {
-		JSONError(w, err, http.StatusBadRequest)
+		WriteError(w, err, http.StatusBadRequest)
 		return
 	}
 	w.WriteHeader(http.StatusCreated)
@@ -32,6 +35,10 @@ func (a *Serve) UnsubscribeEmail(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 	err := a.store.Unsubscribe(email)
+	if errors.Is(err, storages.ErrWritePending) {
+		HTMLError(w, err, http.StatusAccepted)
+		return
+	}
 	if err != nil {
 		HTMLError(w, err, http.StatusBadRequest)
 		return
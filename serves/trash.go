@@ -0,0 +1,133 @@
+package serves
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nicklaw5/go-respond"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/config"
+	"github.com/orange-cloudfoundry/statusetat/v2/emitter"
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+	"github.com/orange-cloudfoundry/statusetat/v2/storages"
+)
+
+func (a *Serve) trashRetention() time.Duration {
+	if a.config.Trash == nil {
+		return config.DefaultTrashRetention
+	}
+	return a.config.Trash.Retention
+}
+
+// readTrashed gives incident in trash, os.ErrNotExist is given when incident is not in trash.
+func (a *Serve) readTrashed(guid string) (models.TrashedIncident, error) {
+	trashed, err := a.store.Trashed()
+	if err != nil {
+		return models.TrashedIncident{}, err
+	}
+	for _, t := range trashed {
+		if t.Incident.GUID == guid {
+			return t, nil
+		}
+	}
+	return models.TrashedIncident{}, os.ErrNotExist
+}
+
+// moveToTrash puts incident in trash before deleting it, incident is removed from trash if it can't be deleted.
+// A write still pending in background is not undone, storages.ErrWritePending is then given.
+func (a *Serve) moveToTrash(req *http.Request, incident models.Incident) error {
+	err := a.storeAs(req).AddTrashed(models.TrashedIncident{
+		Incident:  incident,
+		TrashedAt: time.Now().UTC(),
+		TrashedBy: a.actorFromReq(req),
+	})
+	if err != nil && !errors.Is(err, storages.ErrWritePending) {
+		return fmt.Errorf("could not move incident to trash: %s", err.Error())
+	}
+	pending := err
+	err = a.storeAs(req).Delete(incident.GUID)
+	if errors.Is(err, storages.ErrWritePending) {
+		return err
+	}
+	if err != nil {
+		if errTrash := a.storeAs(req).DeleteTrashed(incident.GUID); errTrash != nil {
+			log.WithField("guid", incident.GUID).Errorf("Could not remove incident from trash: %s", errTrash.Error())
+		}
+		return err
+	}
+	return pending
+}
+
+func (a *Serve) Trash(w http.ResponseWriter, req *http.Request) {
+	trashed, err := a.store.Trashed()
+	if err != nil {
+		JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	respond.NewResponse(w).Ok(trashed)
+}
+
+func (a *Serve) RestoreTrashed(w http.ResponseWriter, req *http.Request) {
+	v := mux.Vars(req)
+	guid := v["guid"]
+	unlock := a.incidentLocks.lock(guid)
+	defer unlock()
+
+	trashed, err := a.readTrashed(guid)
+	if err != nil {
+		if os.IsNotExist(err) {
+			JSONError(w, fmt.Errorf("incident %s is not in trash", guid), http.StatusNotFound)
+			return
+		}
+		JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	_, err = a.store.Read(guid)
+	if err == nil {
+		JSONError(w, fmt.Errorf("incident %s already exists", guid), http.StatusConflict)
+		return
+	}
+	if !os.IsNotExist(err) {
+		JSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	incident := trashed.Incident
+	incident.UpdatedAt = time.Now()
+	incident.Version++
+	incident, err = a.storeAs(req).Create(incident)
+	if err != nil {
+		WriteError(w, err, http.StatusInternalServerError)
+		return
+	}
+	err = a.storeAs(req).DeleteTrashed(guid)
+	if err != nil && !os.IsNotExist(err) {
+		// incident is restored, it will only stay in trash until purge
+		log.WithField("guid", guid).Errorf("Could not remove restored incident from trash: %s", err.Error())
+	}
+	a.recordRevision(req, guid, models.RevisionRestored, nil, models.IncidentFields(incident))
+
+	emitter.Emit(models.NewNotifyRequest(incident, false))
+	w.Header().Set("ETag", incident.ETag())
+	respond.NewResponse(w).Ok(incident)
+}
+
+func (a *Serve) DeleteTrashed(w http.ResponseWriter, req *http.Request) {
+	v := mux.Vars(req)
+	guid := v["guid"]
+	err := a.storeAs(req).DeleteTrashed(guid)
+	if err != nil {
+		if os.IsNotExist(err) {
+			JSONError(w, fmt.Errorf("incident %s is not in trash", guid), http.StatusNotFound)
+			return
+		}
+		WriteError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,116 @@
+package serves_test
+
+import (
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+)
+
+var _ = Describe("Trash", func() {
+	var incident models.Incident
+	BeforeEach(func() {
+		rr := CallRequest(NewRequestIntAdmin(http.MethodPost, "/v1/incidents", models.Incident{
+			Components: &models.Components{{
+				Name:  Component1.Name,
+				Group: Component1.Group,
+			}},
+			State: models.Monitoring,
+			Messages: models.Messages{
+				{
+					CreatedAt: time.Now().UTC(),
+					Title:     "A title",
+					Content:   "a content",
+				},
+			},
+		}))
+		Expect(rr.CheckError()).ToNot(HaveOccurred())
+		var err error
+		incident, err = rr.UnmarshalToIncident()
+		Expect(err).ToNot(HaveOccurred())
+	})
+	trashed := func() []models.TrashedIncident {
+		rr := CallRequest(NewRequestIntAdmin(http.MethodGet, "/v1/trash", nil))
+		Expect(rr.CheckError()).ToNot(HaveOccurred())
+		trashed := make([]models.TrashedIncident, 0)
+		Expect(rr.Unmarshal(&trashed)).To(Succeed())
+		return trashed
+	}
+
+	It("should give unauthorized when user not set", func() {
+		rr := CallRequest(NewRequestInt(http.MethodGet, "/v1/trash", nil))
+		Expect(rr.Code).To(Equal(http.StatusUnauthorized))
+		rr = CallRequest(NewRequestInt(http.MethodPost, "/v1/trash/"+incident.GUID+"/restore", nil))
+		Expect(rr.Code).To(Equal(http.StatusUnauthorized))
+	})
+	It("should move deleted incident to trash", func() {
+		rr := CallRequest(NewRequestIntAdmin(http.MethodDelete, "/v1/incidents/"+incident.GUID, nil))
+		Expect(rr.CheckError()).ToNot(HaveOccurred())
+
+		_, err := fakeStoreMem.Read(incident.GUID)
+		Expect(err).To(HaveOccurred())
+
+		trash := trashed()
+		Expect(trash).To(HaveLen(1))
+		Expect(trash[0].Incident.GUID).To(Equal(incident.GUID))
+		Expect(trash[0].Incident.State).To(Equal(models.Monitoring))
+		Expect(trash[0].TrashedBy).To(Equal("admin"))
+		Expect(trash[0].TrashedAt).ToNot(BeZero())
+	})
+	It("should not keep hard deleted incident in trash", func() {
+		rr := CallRequest(NewRequestIntAdmin(http.MethodDelete, "/v1/incidents/"+incident.GUID+"?hard=true", nil))
+		Expect(rr.CheckError()).ToNot(HaveOccurred())
+
+		_, err := fakeStoreMem.Read(incident.GUID)
+		Expect(err).To(HaveOccurred())
+		Expect(trashed()).To(BeEmpty())
+	})
+	It("should restore incident from trash", func() {
+		rr := CallRequest(NewRequestIntAdmin(http.MethodDelete, "/v1/incidents/"+incident.GUID, nil))
+		Expect(rr.CheckError()).ToNot(HaveOccurred())
+
+		rr = CallRequest(NewRequestIntAdmin(http.MethodPost, "/v1/trash/"+incident.GUID+"/restore", nil))
+		Expect(rr.CheckError()).ToNot(HaveOccurred())
+		restored, err := rr.UnmarshalToIncident()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(restored.Version).To(Equal(incident.Version + 1))
+		Expect(rr.Header().Get("ETag")).To(Equal(restored.ETag()))
+
+		stored, err := fakeStoreMem.Read(incident.GUID)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stored.State).To(Equal(models.Monitoring))
+		Expect(stored.MainMessage().Title).To(Equal("A title"))
+		Expect(trashed()).To(BeEmpty())
+
+		revisions, err := fakeStoreMem.Revisions(incident.GUID)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(revisions[len(revisions)-1].Action).To(Equal(models.RevisionRestored))
+	})
+	It("should give not found when restoring an incident not in trash", func() {
+		rr := CallRequest(NewRequestIntAdmin(http.MethodPost, "/v1/trash/unknown/restore", nil))
+		Expect(rr.Code).To(Equal(http.StatusNotFound))
+	})
+	It("should give conflict when restoring an incident which exists again", func() {
+		rr := CallRequest(NewRequestIntAdmin(http.MethodDelete, "/v1/incidents/"+incident.GUID, nil))
+		Expect(rr.CheckError()).ToNot(HaveOccurred())
+		_, err := fakeStoreMem.Create(incident)
+		Expect(err).ToNot(HaveOccurred())
+
+		rr = CallRequest(NewRequestIntAdmin(http.MethodPost, "/v1/trash/"+incident.GUID+"/restore", nil))
+		Expect(rr.Code).To(Equal(http.StatusConflict))
+	})
+	It("should permanently delete incident from trash", func() {
+		rr := CallRequest(NewRequestIntAdmin(http.MethodDelete, "/v1/incidents/"+incident.GUID, nil))
+		Expect(rr.CheckError()).ToNot(HaveOccurred())
+
+		rr = CallRequest(NewRequestIntAdmin(http.MethodDelete, "/v1/trash/"+incident.GUID, nil))
+		Expect(rr.CheckError()).ToNot(HaveOccurred())
+		Expect(trashed()).To(BeEmpty())
+
+		rr = CallRequest(NewRequestIntAdmin(http.MethodDelete, "/v1/trash/"+incident.GUID, nil))
+		Expect(rr.Code).To(Equal(http.StatusNotFound))
+	})
+})
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/config"
+	"github.com/orange-cloudfoundry/statusetat/v2/storages"
+	"github.com/orange-cloudfoundry/statusetat/v2/utils"
+)
+
+var (
+	storageCmd = kingpin.Command("storage", "Manage storage targets.")
+
+	migrateCmd    = storageCmd.Command("migrate", "Copy incidents, persistent incidents and subscribers from target(s) to other target(s), can be run multiple times safely.")
+	migrateFrom   = migrateCmd.Flag("from", "Source target url, repeat it to read from replicated targets.").Required().Strings()
+	migrateTo     = migrateCmd.Flag("to", "Destination target url, repeat it to write on replicated targets.").Required().Strings()
+	migrateSince  = migrateCmd.Flag("since", "Only migrate incidents created after this date (RFC3339), persistent incidents are always migrated.").Default("1970-01-01T00:00:00Z").String()
+	migrateDryRun = migrateCmd.Flag("dry-run", "Only show what would be done without writing in destination.").Bool()
+
+	reencryptCmd     = storageCmd.Command("reencrypt", "Write back incidents, trashed incidents and subscribers to seal them with current encryption key.")
+	reencryptTargets = reencryptCmd.Flag("target", "Target url to reencrypt, repeat it to write on replicated targets, targets from config are used if not set.").Strings()
+
+	backupCmd     = kingpin.Command("backup", "Dump incidents, persistent incidents and subscribers in a compressed json archive.")
+	backupFile    = backupCmd.Flag("file", "Path to archive to write, - for stdout.").Short('f').Default("-").String()
+	backupTargets = backupCmd.Flag("target", "Target url to backup, repeat it to read from replicated targets, targets from config are used if not set.").Strings()
+
+	restoreCmd     = kingpin.Command("restore", "Load an archive made by backup, can be run multiple times safely.")
+	restoreFile    = restoreCmd.Flag("file", "Path to archive to read, - for stdin.").Short('f').Default("-").String()
+	restoreTargets = restoreCmd.Flag("target", "Target url to restore in, repeat it to write on replicated targets, targets from config are used if not set.").Strings()
+
+	retentionCmd    = kingpin.Command("retention", "Archive or delete expired incidents now as defined by retention in config.")
+	retentionDryRun = retentionCmd.Flag("dry-run", "Only show what would be done without archiving or deleting anything.").Bool()
+)
+
+func migrate() {
+	since, err := time.Parse(time.RFC3339, *migrateSince)
+	if err != nil {
+		log.Fatalf("invalid since date: %s", err.Error())
+	}
+	src := storeFromTargets(*migrateFrom)
+	dst := storeFromTargets(*migrateTo)
+	opts := storages.MigrateOptions{
+		From:   since,
+		To:     time.Now().AddDate(100, 0, 0),
+		DryRun: *migrateDryRun,
+	}
+
+	report, err := storages.Migrate(src, dst, opts)
+	if err != nil {
+		log.Errorf("Migration finished with errors: %s", err.Error())
+	}
+	if opts.DryRun {
+		log.Infof("Dry run, would have migrated %s", report)
+		return
+	}
+	log.Infof("Migrated %s", report)
+
+	err = storages.VerifyMigration(src, dst, opts)
+	if err != nil {
+		log.Fatalf("Verification of migration failed: %s", err.Error())
+	}
+	log.Info("Verification of migration succeeded")
+	if report.Errors > 0 {
+		log.Fatal("Migration finished with errors, run it again to retry")
+	}
+}
+
+func storeFromTargets(targets []string) storages.Store {
+	urls := make([]*url.URL, len(targets))
+	for i, target := range targets {
+		u, err := url.Parse(target)
+		if err != nil {
+			log.Fatalf("unable to parse target url '%s': %s", target, err.Error())
+		}
+		urls[i] = u
+	}
+	store, err := storages.Factory(urls)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	return store
+}
+
+func reencrypt() {
+	report, err := storages.Reencrypt(storeFromTargetsOrConfig(*reencryptTargets))
+	if err != nil {
+		log.Errorf("Reencryption finished with errors: %s", err.Error())
+	}
+	log.Infof("Reencrypted %s", report)
+	if report.Errors > 0 {
+		log.Fatal("Reencryption finished with errors, run it again to retry")
+	}
+}
+
+func backup() {
+	err := writeBackup(storeFromTargetsOrConfig(*backupTargets), *backupFile)
+	if err != nil {
+		log.Fatalf("Backup failed: %s", err.Error())
+	}
+	log.Info("Backup done")
+}
+
+// writeBackup writes archive of store in file at path, or in stdout if path is -,
+// backup is only done once file has been flushed and closed without error.
+func writeBackup(store storages.Store, path string) error {
+	if path == "-" {
+		return storages.Export(store, os.Stdout)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = storages.Export(store, f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		utils.CloseAndLogError(f)
+		return err
+	}
+	return f.Close()
+}
+
+func restore() {
+	report, err := readBackup(storeFromTargetsOrConfig(*restoreTargets), *restoreFile)
+	if err != nil {
+		log.Fatalf("Restore finished with errors: %s", err.Error())
+	}
+	log.Infof("Restored %s", report)
+}
+
+// readBackup loads archive in file at path, or from stdin if path is -, in store.
+func readBackup(store storages.Store, path string) (storages.MigrateReport, error) {
+	if path == "-" {
+		return storages.Import(store, os.Stdin)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return storages.MigrateReport{}, err
+	}
+	defer utils.CloseAndLogError(f)
+	return storages.Import(store, f)
+}
+
+func storeFromTargetsOrConfig(targets []string) storages.Store {
+	if len(targets) > 0 {
+		return storeFromTargets(targets)
+	}
+	return storeFromConfig(loadConfig())
+}
+
+func retention() {
+	c := loadConfig()
+	if !c.Retention.Enabled() {
+		log.Fatal("retention is not set in config")
+	}
+	policy := retentionPolicy(c)
+	policy.DryRun = *retentionDryRun
+	report, err := storages.ApplyRetention(storeFromConfig(c), policy)
+	if err != nil {
+		log.Errorf("Retention finished with errors: %s", err.Error())
+	}
+	if policy.DryRun {
+		log.Infof("Dry run, would have handled %s", report)
+		return
+	}
+	log.Infof("Handled %s", report)
+	if report.Errors > 0 {
+		log.Fatal("Retention finished with errors, run it again to retry")
+	}
+}
+
+func retentionPolicy(c config.Config) storages.RetentionPolicy {
+	policy := storages.RetentionPolicy{
+		MaxAge:     c.Retention.MaxAge,
+		Action:     storages.RetentionAction(c.Retention.Action),
+		ArchiveDir: c.Retention.ArchiveDir,
+	}
+	if c.Retention.ArchiveTarget != "" && policy.Action == storages.RetentionArchive {
+		policy.ArchiveStore = storeFromTargets([]string{string(c.Retention.ArchiveTarget)})
+	}
+	return policy
+}
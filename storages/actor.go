@@ -0,0 +1,20 @@
+package storages
+
+// ActorStore is implemented by stores able to tell who made a change, e.g. as author of git commits,
+// stores wrapping another store implement it to pass actor to the store they wrap.
+type ActorStore interface {
+	// WithActor gives the same store where changes are made on behalf of actor.
+	WithActor(actor string) Store
+}
+
+// AsActor gives store making changes on behalf of actor, store is given as is when it
+// is not an ActorStore or when actor is empty.
+func AsActor(store Store, actor string) Store {
+	if actor == "" {
+		return store
+	}
+	if s, ok := store.(ActorStore); ok {
+		return s.WithActor(actor)
+	}
+	return store
+}
@@ -0,0 +1,111 @@
+package storages
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+	"github.com/orange-cloudfoundry/statusetat/v2/utils"
+)
+
+// ArchiveSchemaVersion is the version of archive format produced by Export,
+// it must be incremented with a new entry in archiveMigrations when models change in a way breaking older archives.
+const ArchiveSchemaVersion = 1
+
+// archiveMigrations upgrades raw content of an archive, archiveMigrations[i] upgrades from schema version i+1 to i+2.
+var archiveMigrations = []func(archive map[string]interface{}) error{}
+
+// Archive is the portable format of a full dataset of a store.
+type Archive struct {
+	SchemaVersion int               `json:"schema_version"`
+	CreatedAt     time.Time         `json:"created_at"`
+	Incidents     []models.Incident `json:"incidents"`
+	Subscribers   []string          `json:"subscribers"`
+}
+
+// Export writes all incidents, persistent incidents and subscribers of store in w as a gzip compressed json archive.
+func Export(store Store, w io.Writer) error {
+	incidents, err := migrationIncidents(store, allTimeOptions())
+	if err != nil {
+		return fmt.Errorf("could not read incidents: %s", err.Error())
+	}
+	subs, err := store.Subscribers()
+	if err != nil {
+		return fmt.Errorf("could not read subscribers: %s", err.Error())
+	}
+	return writeArchive(w, incidents, subs)
+}
+
+// writeArchive writes incidents and subscribers in w as a gzip compressed json archive of current schema version.
+func writeArchive(w io.Writer, incidents []models.Incident, subs []string) error {
+	gw := gzip.NewWriter(w)
+	err := json.NewEncoder(gw).Encode(Archive{
+		SchemaVersion: ArchiveSchemaVersion,
+		CreatedAt:     time.Now().UTC(),
+		Incidents:     incidents,
+		Subscribers:   subs,
+	})
+	if err != nil {
+		utils.CloseAndLogError(gw)
+		return err
+	}
+	return gw.Close()
+}
+
+// Import loads an archive made by Export from r in store, archives made with an older schema version are upgraded.
+// As migration, import can be run multiple times, incidents already in store are only updated when fresher in archive.
+func Import(store Store, r io.Reader) (MigrateReport, error) {
+	archive, err := ReadArchive(r)
+	if err != nil {
+		return MigrateReport{}, err
+	}
+	return ImportArchive(store, archive)
+}
+
+// ImportArchive loads an already decoded archive in store.
+func ImportArchive(store Store, archive Archive) (MigrateReport, error) {
+	return copyData(archive.Incidents, archive.Subscribers, store, false)
+}
+
+// ReadArchive decodes an archive made by Export and upgrades it to current schema version.
+func ReadArchive(r io.Reader) (Archive, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return Archive{}, fmt.Errorf("archive is not gzip compressed: %w", err)
+	}
+	defer utils.CloseAndLogError(gr)
+
+	raw := make(map[string]interface{})
+	err = json.NewDecoder(gr).Decode(&raw)
+	if err != nil {
+		return Archive{}, fmt.Errorf("invalid archive: %w", err)
+	}
+	version, ok := raw["schema_version"].(float64)
+	if !ok || version < 1 {
+		return Archive{}, fmt.Errorf("invalid archive: schema version is missing")
+	}
+	if int(version) > ArchiveSchemaVersion {
+		return Archive{}, fmt.Errorf("archive schema version %d is not supported, this version of statusetat supports up to %d", int(version), ArchiveSchemaVersion)
+	}
+	for v := int(version); v < ArchiveSchemaVersion; v++ {
+		err = archiveMigrations[v-1](raw)
+		if err != nil {
+			return Archive{}, fmt.Errorf("could not upgrade archive from schema version %d: %s", v, err.Error())
+		}
+	}
+	raw["schema_version"] = ArchiveSchemaVersion
+
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return Archive{}, err
+	}
+	var archive Archive
+	err = json.Unmarshal(b, &archive)
+	if err != nil {
+		return Archive{}, fmt.Errorf("invalid archive: %s", err.Error())
+	}
+	return archive, nil
+}
@@ -0,0 +1,101 @@
+package storages_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+	"github.com/orange-cloudfoundry/statusetat/v2/storages"
+	"github.com/orange-cloudfoundry/statusetat/v2/utils"
+)
+
+var _ = Describe("Archive", func() {
+	var src storages.Store
+	var dst storages.Store
+	tmpDirSrc := filepath.Join(os.TempDir(), "statusetat-test-archive")
+	now := time.Now().UTC().Truncate(time.Second)
+	gzipContent := func(content string) *bytes.Buffer {
+		buf := &bytes.Buffer{}
+		gw := gzip.NewWriter(buf)
+		_, err := gw.Write([]byte(content))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(gw.Close()).To(Succeed())
+		return buf
+	}
+	BeforeEach(func() {
+		var err error
+		u, _ := url.Parse("file://" + tmpDirSrc)
+		src, err = (&storages.Local{}).Creator()(u)
+		Expect(err).ToNot(HaveOccurred())
+		u, _ = url.Parse("sqlite://:memory:")
+		dst, err = (&storages.DB{}).Creator()(u)
+		Expect(err).ToNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		utils.RemoveDir(tmpDirSrc)
+	})
+	It("should restore what was exported", func() {
+		_, err := src.Create(models.Incident{
+			GUID:      "inc1",
+			CreatedAt: now.AddDate(-5, 0, 0),
+			UpdatedAt: now,
+			Messages: []models.Message{{
+				GUID:         "msg1",
+				IncidentGUID: "inc1",
+				CreatedAt:    now,
+				Title:        "a title",
+			}},
+			Metadata: []models.Metadata{{Key: "key", Value: "value", IncidentGUID: "inc1"}},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = src.Create(models.Incident{GUID: "persistent", CreatedAt: now, UpdatedAt: now, Persistent: true})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(src.Subscribe("email@local")).To(Succeed())
+
+		buf := &bytes.Buffer{}
+		Expect(storages.Export(src, buf)).To(Succeed())
+
+		archive, err := storages.ReadArchive(bytes.NewReader(buf.Bytes()))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(archive.SchemaVersion).To(Equal(storages.ArchiveSchemaVersion))
+		Expect(archive.Incidents).To(HaveLen(2))
+
+		report, err := storages.Import(dst, buf)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Created).To(Equal(2))
+		Expect(report.SubscribersAdded).To(Equal(1))
+
+		inc, err := dst.Read("inc1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inc.Messages).To(HaveLen(1))
+		Expect(inc.Messages[0].Title).To(Equal("a title"))
+		Expect(inc.Metadata).To(HaveLen(1))
+		Expect(inc.Metadata[0].Value).To(Equal("value"))
+		persistents, err := dst.Persistents()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(persistents).To(HaveLen(1))
+		subs, err := dst.Subscribers()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(subs).To(ConsistOf("email@local"))
+	})
+	It("should refuse archive made with a newer schema version", func() {
+		_, err := storages.ReadArchive(gzipContent(`{"schema_version": 1000, "incidents": []}`))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("not supported"))
+	})
+	It("should refuse archive without schema version", func() {
+		_, err := storages.ReadArchive(gzipContent(`{"incidents": []}`))
+		Expect(err).To(HaveOccurred())
+	})
+	It("should refuse archive not compressed", func() {
+		_, err := storages.ReadArchive(bytes.NewBufferString(`{"schema_version": 1}`))
+		Expect(err).To(HaveOccurred())
+	})
+})
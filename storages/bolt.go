@@ -0,0 +1,447 @@
+package storages
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+)
+
+var (
+	boltIncidentsBucket   = []byte("incidents")
+	boltCreatedAtBucket   = []byte("incidents_created_at")
+	boltPersistentsBucket = []byte("persistents")
+	boltSubscribersBucket = []byte("subscribers")
+	boltRevisionsBucket   = []byte("revisions")
+	boltTrashBucket       = []byte("trash")
+)
+
+// Bolt stores data in an embedded bbolt key/value database,
+// incidents are indexed by creation date to make ByDate a range scan.
+type Bolt struct {
+	db *bolt.DB
+}
+
+func (b *Bolt) Creator() func(u *url.URL) (Store, error) {
+	return func(u *url.URL) (Store, error) {
+		path := filepath.FromSlash(strings.TrimPrefix(u.String(), "bolt://"))
+		if err := os.MkdirAll(filepath.Dir(path), 0775); err != nil {
+			return nil, err
+		}
+		db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+		if err != nil {
+			return nil, err
+		}
+		err = db.Update(func(tx *bolt.Tx) error {
+			for _, bucket := range [][]byte{boltIncidentsBucket, boltCreatedAtBucket, boltPersistentsBucket, boltSubscribersBucket, boltRevisionsBucket, boltTrashBucket} {
+				if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &Bolt{db: db}, nil
+	}
+}
+
+func (b *Bolt) Detect(u *url.URL) bool {
+	return u.Scheme == "bolt"
+}
+
+// createdAtKey gives key in creation date index, guid is appended to have one key per incident.
+// Dates before epoch are all indexed at epoch to keep keys ordered.
+func createdAtKey(createdAt time.Time, guid string) []byte {
+	key := make([]byte, 8, 8+len(guid))
+	var nano uint64
+	if createdAt.After(time.Unix(0, 0)) {
+		nano = uint64(createdAt.UnixNano())
+	}
+	binary.BigEndian.PutUint64(key, nano)
+	return append(key, []byte(guid)...)
+}
+
+func (b *Bolt) putIncident(tx *bolt.Tx, incident models.Incident) error {
+	// incident may move between persistents and incidents or change of creation date
+	_, err := b.removeIncident(tx, incident.GUID)
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(incident)
+	if err != nil {
+		return err
+	}
+	if incident.Persistent {
+		return tx.Bucket(boltPersistentsBucket).Put([]byte(incident.GUID), content)
+	}
+	err = tx.Bucket(boltIncidentsBucket).Put([]byte(incident.GUID), content)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(boltCreatedAtBucket).Put(createdAtKey(incident.CreatedAt, incident.GUID), []byte(incident.GUID))
+}
+
+// removeIncident removes incident and its index entry, it gives false if incident did not exist.
+func (b *Bolt) removeIncident(tx *bolt.Tx, guid string) (bool, error) {
+	found := false
+	persistents := tx.Bucket(boltPersistentsBucket)
+	if persistents.Get([]byte(guid)) != nil {
+		found = true
+		if err := persistents.Delete([]byte(guid)); err != nil {
+			return found, err
+		}
+	}
+
+	incidents := tx.Bucket(boltIncidentsBucket)
+	content := incidents.Get([]byte(guid))
+	if content == nil {
+		return found, nil
+	}
+	var incident models.Incident
+	err := json.Unmarshal(content, &incident)
+	if err != nil {
+		return true, err
+	}
+	err = tx.Bucket(boltCreatedAtBucket).Delete(createdAtKey(incident.CreatedAt, guid))
+	if err != nil {
+		return true, err
+	}
+	return true, incidents.Delete([]byte(guid))
+}
+
+func (b *Bolt) Create(incident models.Incident) (models.Incident, error) {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		return b.putIncident(tx, incident)
+	})
+	return incident, err
+}
+
+func (b *Bolt) Update(guid string, incident models.Incident) (models.Incident, error) {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		return b.updateIncident(tx, guid, incident)
+	})
+	return incident, err
+}
+
+func (b *Bolt) updateIncident(tx *bolt.Tx, guid string, incident models.Incident) error {
+	if guid != incident.GUID {
+		if _, err := b.removeIncident(tx, guid); err != nil {
+			return err
+		}
+	}
+	return b.putIncident(tx, incident)
+}
+
+// UpdateIfVersion checks version in the same transaction as write, bolt transactions are serialized.
+func (b *Bolt) UpdateIfVersion(guid string, version int, incident models.Incident) (models.Incident, error) {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		current, err := b.getIncident(tx, guid)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(current, version); err != nil {
+			return err
+		}
+		return b.updateIncident(tx, guid, incident)
+	})
+	return incident, err
+}
+
+func (b *Bolt) Delete(guid string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		found, err := b.removeIncident(tx, guid)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return os.ErrNotExist
+		}
+		return nil
+	})
+}
+
+func (b *Bolt) Read(guid string) (models.Incident, error) {
+	var incident models.Incident
+	err := b.db.View(func(tx *bolt.Tx) error {
+		var err error
+		incident, err = b.getIncident(tx, guid)
+		return err
+	})
+	if err != nil {
+		return models.Incident{}, err
+	}
+	return incident, nil
+}
+
+// getIncident gives incident, persistent or not, os.ErrNotExist is given when it does not exist.
+func (b *Bolt) getIncident(tx *bolt.Tx, guid string) (models.Incident, error) {
+	var incident models.Incident
+	content := tx.Bucket(boltPersistentsBucket).Get([]byte(guid))
+	if content == nil {
+		content = tx.Bucket(boltIncidentsBucket).Get([]byte(guid))
+	}
+	if content == nil {
+		return incident, os.ErrNotExist
+	}
+	err := json.Unmarshal(content, &incident)
+	return incident, err
+}
+
+func (b *Bolt) ByDate(from, to time.Time) ([]models.Incident, error) {
+	incidents := make([]models.Incident, 0)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		content := tx.Bucket(boltIncidentsBucket)
+		cursor := tx.Bucket(boltCreatedAtBucket).Cursor()
+		max := createdAtKey(to, "")
+		for k, guid := cursor.Seek(createdAtKey(from, "")); k != nil; k, guid = cursor.Next() {
+			// keys are prefixed by date, only compare date part to include incidents created exactly at to
+			if bytes.Compare(k[:8], max) > 0 {
+				break
+			}
+			var incident models.Incident
+			err := json.Unmarshal(content.Get(guid), &incident)
+			if err != nil {
+				return err
+			}
+			sort.Sort(models.Messages(incident.Messages))
+			incidents = append(incidents, incident)
+		}
+		return nil
+	})
+	if err != nil {
+		return []models.Incident{}, err
+	}
+	return incidents, nil
+}
+
+// Query scans creation date index from most recent incident in range and stops as soon as page is full.
+func (b *Bolt) Query(query IncidentQuery) (IncidentPage, error) {
+	if err := query.Validate(); err != nil {
+		return IncidentPage{}, err
+	}
+	cursor, _ := decodeCursor(query.Cursor)
+	need := 0
+	if query.Limit > 0 {
+		// one more incident is read to know if there is a next page
+		need = query.Offset + query.Limit + 1
+	}
+	incidents := make([]models.Incident, 0)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		content := tx.Bucket(boltIncidentsBucket)
+		c := tx.Bucket(boltCreatedAtBucket).Cursor()
+		var k, guid []byte
+		if query.To.IsZero() {
+			k, guid = c.Last()
+		} else {
+			// seek after last possible key of to date then go back
+			k, _ = c.Seek(createdAtKey(query.To.Add(time.Nanosecond), ""))
+			if k == nil {
+				k, guid = c.Last()
+			} else {
+				k, guid = c.Prev()
+			}
+		}
+		var min []byte
+		if !query.From.IsZero() {
+			min = createdAtKey(query.From, "")
+		}
+		for ; k != nil; k, guid = c.Prev() {
+			if min != nil && bytes.Compare(k[:8], min) < 0 {
+				break
+			}
+			var incident models.Incident
+			err := json.Unmarshal(content.Get(guid), &incident)
+			if err != nil {
+				return err
+			}
+			if !query.Match(incident) || !cursor.after(incident) {
+				continue
+			}
+			sort.Sort(models.Messages(incident.Messages))
+			incidents = append(incidents, incident)
+			if need > 0 && len(incidents) >= need {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return IncidentPage{}, err
+	}
+	sortQueryOrder(incidents)
+	return paginate(incidents, query), nil
+}
+
+func (b *Bolt) Persistents() ([]models.Incident, error) {
+	incidents := make([]models.Incident, 0)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltPersistentsBucket).ForEach(func(k, v []byte) error {
+			var incident models.Incident
+			err := json.Unmarshal(v, &incident)
+			if err != nil {
+				return err
+			}
+			incidents = append(incidents, incident)
+			return nil
+		})
+	})
+	if err != nil {
+		return []models.Incident{}, err
+	}
+	return incidents, nil
+}
+
+// revisionsPrefix gives prefix of keys of revisions of an incident, keys end by creation date of revision.
+func revisionsPrefix(incidentGuid string) []byte {
+	return append([]byte(incidentGuid), 0)
+}
+
+func (b *Bolt) AddRevision(revision models.Revision) error {
+	content, err := json.Marshal(revision)
+	if err != nil {
+		return err
+	}
+	key := append(revisionsPrefix(revision.IncidentGUID), createdAtKey(revision.CreatedAt, revision.GUID)...)
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltRevisionsBucket).Put(key, content)
+	})
+}
+
+func (b *Bolt) Revisions(incidentGuid string) ([]models.Revision, error) {
+	revisions := make([]models.Revision, 0)
+	prefix := revisionsPrefix(incidentGuid)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltRevisionsBucket).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var revision models.Revision
+			err := json.Unmarshal(v, &revision)
+			if err != nil {
+				return err
+			}
+			revisions = append(revisions, revision)
+		}
+		return nil
+	})
+	if err != nil {
+		return []models.Revision{}, err
+	}
+	return revisions, nil
+}
+
+func (b *Bolt) ReplaceRevisions(change func(revision models.Revision) (models.Revision, error)) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltRevisionsBucket)
+		// bucket can't be changed while iterating on it
+		contents := make(map[string][]byte)
+		err := bucket.ForEach(func(k, v []byte) error {
+			contents[string(k)] = append([]byte{}, v...)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for key, content := range contents {
+			var revision models.Revision
+			err := json.Unmarshal(content, &revision)
+			if err != nil {
+				return err
+			}
+			revision, err = change(revision)
+			if err != nil {
+				return err
+			}
+			content, err = json.Marshal(revision)
+			if err != nil {
+				return err
+			}
+			err = bucket.Put([]byte(key), content)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *Bolt) AddTrashed(trashed models.TrashedIncident) error {
+	content, err := json.Marshal(trashed)
+	if err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltTrashBucket).Put([]byte(trashed.Incident.GUID), content)
+	})
+}
+
+func (b *Bolt) Trashed() ([]models.TrashedIncident, error) {
+	trashed := make([]models.TrashedIncident, 0)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltTrashBucket).ForEach(func(k, v []byte) error {
+			var t models.TrashedIncident
+			err := json.Unmarshal(v, &t)
+			if err != nil {
+				return err
+			}
+			trashed = append(trashed, t)
+			return nil
+		})
+	})
+	if err != nil {
+		return []models.TrashedIncident{}, err
+	}
+	sort.Sort(models.TrashedIncidents(trashed))
+	return trashed, nil
+}
+
+func (b *Bolt) DeleteTrashed(guid string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltTrashBucket)
+		if bucket.Get([]byte(guid)) == nil {
+			return os.ErrNotExist
+		}
+		return bucket.Delete([]byte(guid))
+	})
+}
+
+func (b *Bolt) Subscribe(email string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltSubscribersBucket).Put([]byte(email), []byte{})
+	})
+}
+
+func (b *Bolt) Unsubscribe(email string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltSubscribersBucket).Delete([]byte(email))
+	})
+}
+
+func (b *Bolt) Subscribers() ([]string, error) {
+	subs := make([]string, 0)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltSubscribersBucket).ForEach(func(k, v []byte) error {
+			subs = append(subs, string(k))
+			return nil
+		})
+	})
+	if err != nil {
+		return []string{}, err
+	}
+	return subs, nil
+}
+
+func (b *Bolt) Ping() error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		return nil
+	})
+}
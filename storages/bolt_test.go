@@ -0,0 +1,165 @@
+package storages_test
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+	"github.com/orange-cloudfoundry/statusetat/v2/storages"
+	"github.com/orange-cloudfoundry/statusetat/v2/utils"
+)
+
+var _ = Describe("Bolt", func() {
+	var boltStorage storages.Store
+	tmpDirBolt := filepath.Join(os.TempDir(), "statusetat-test-bolt")
+	nbDb := 0
+	BeforeEach(func() {
+		var err error
+		// each test has its own database as bolt lock database file until process ends
+		nbDb++
+		u, _ := url.Parse(fmt.Sprintf("bolt://%s/store-%d.db", tmpDirBolt, nbDb))
+		boltStorage, err = (&storages.Bolt{}).Creator()(u)
+		if err != nil {
+			panic(err)
+		}
+	})
+	AfterEach(func() {
+		utils.RemoveDir(tmpDirBolt)
+	})
+	Context("Detect", func() {
+		It("should only detect scheme bolt://", func() {
+			u, _ := url.Parse("bolt:///my/path.db")
+			Expect(boltStorage.Detect(u)).To(BeTrue())
+
+			u, _ = url.Parse("file:///my/path.db")
+			Expect(boltStorage.Detect(u)).To(BeFalse())
+		})
+	})
+	Context("Create", func() {
+		It("should store incident", func() {
+			inc := models.Incident{
+				GUID: "aguid",
+			}
+
+			newInc, err := boltStorage.Create(inc)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(newInc).To(BeEquivalentTo(inc))
+
+			newInc, err = boltStorage.Read(inc.GUID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(newInc.GUID).To(Equal(inc.GUID))
+		})
+	})
+	Context("Update", func() {
+		It("should reindex incident when creation date change", func() {
+			d2020 := time.Date(2020, 1, 1, 1, 1, 1, 0, time.UTC)
+			d2019 := time.Date(2019, 1, 1, 1, 1, 1, 0, time.UTC)
+			inc := models.Incident{
+				GUID:      "aguid",
+				CreatedAt: d2019,
+			}
+			_, err := boltStorage.Create(inc)
+			Expect(err).ToNot(HaveOccurred())
+
+			inc.CreatedAt = d2020
+			_, err = boltStorage.Update(inc.GUID, inc)
+			Expect(err).ToNot(HaveOccurred())
+
+			incidents, err := boltStorage.ByDate(d2019, d2019.Add(time.Hour))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(incidents).To(HaveLen(0))
+			incidents, err = boltStorage.ByDate(d2020, d2020)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(incidents).To(HaveLen(1))
+		})
+		It("should move incident in and out of persistents", func() {
+			inc := models.Incident{
+				GUID:      "aguid",
+				CreatedAt: time.Now(),
+			}
+			_, err := boltStorage.Create(inc)
+			Expect(err).ToNot(HaveOccurred())
+
+			inc.Persistent = true
+			_, err = boltStorage.Update(inc.GUID, inc)
+			Expect(err).ToNot(HaveOccurred())
+			persistents, err := boltStorage.Persistents()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(persistents).To(HaveLen(1))
+			incidents, err := boltStorage.ByDate(time.Now().Add(-time.Hour), time.Now())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(incidents).To(HaveLen(0))
+
+			inc.Persistent = false
+			_, err = boltStorage.Update(inc.GUID, inc)
+			Expect(err).ToNot(HaveOccurred())
+			persistents, err = boltStorage.Persistents()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(persistents).To(HaveLen(0))
+			incidents, err = boltStorage.ByDate(time.Now().Add(-time.Hour), time.Now())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(incidents).To(HaveLen(1))
+		})
+	})
+	Context("Delete", func() {
+		It("should delete incident", func() {
+			inc := models.Incident{
+				GUID: "aguid",
+			}
+			_, err := boltStorage.Create(inc)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = boltStorage.Delete(inc.GUID)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = boltStorage.Read(inc.GUID)
+			Expect(os.IsNotExist(err)).To(BeTrue())
+			Expect(os.IsNotExist(boltStorage.Delete(inc.GUID))).To(BeTrue())
+		})
+	})
+	Context("ByDate", func() {
+		It("Should give incidents in the datetime range without showing persistent", func() {
+			d2020 := time.Date(2020, 1, 1, 1, 1, 1, 1, time.Local).UTC()
+			d2019 := time.Date(2019, 1, 1, 1, 1, 1, 1, time.Local).UTC()
+			d2018 := time.Date(2018, 1, 1, 1, 1, 1, 1, time.Local).UTC()
+			for _, inc := range []models.Incident{
+				{GUID: "1", CreatedAt: d2020},
+				{GUID: "2", CreatedAt: d2019},
+				{GUID: "3", CreatedAt: d2018},
+				{GUID: "4", CreatedAt: d2019, Persistent: true},
+			} {
+				_, err := boltStorage.Create(inc)
+				Expect(err).ToNot(HaveOccurred())
+			}
+
+			incidents, err := boltStorage.ByDate(d2019, d2020)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(incidents).Should(HaveLen(2))
+			Expect(incidents[0].CreatedAt).Should(Equal(d2019))
+			Expect(incidents[1].CreatedAt).Should(Equal(d2020))
+		})
+	})
+	Context("Subscribers", func() {
+		It("should give all subscribers", func() {
+			Expect(boltStorage.Subscribe("auser1")).To(Succeed())
+			Expect(boltStorage.Subscribe("auser2")).To(Succeed())
+			Expect(boltStorage.Subscribe("auser3")).To(Succeed())
+			Expect(boltStorage.Unsubscribe("auser3")).To(Succeed())
+
+			allSubscribers, err := boltStorage.Subscribers()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(allSubscribers).Should(Equal([]string{"auser1", "auser2"}))
+		})
+	})
+	Context("Ping", func() {
+		It("should answer when database is opened", func() {
+			Expect(boltStorage.Ping()).To(Succeed())
+		})
+	})
+})
@@ -0,0 +1,343 @@
+package storages
+
+import (
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/emitter"
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+)
+
+// cacheEntry is a value read from next store, it is kept after expiration to be served when next store fails.
+type cacheEntry[T any] struct {
+	value     T
+	loaded    bool
+	expiresAt time.Time
+	// loading makes concurrent reads of an expired entry wait for a single read of next store
+	loading sync.Mutex
+}
+
+// incidentsSnapshot holds all incidents, except persistent ones, created since from.
+type incidentsSnapshot struct {
+	from      time.Time
+	incidents []models.Incident
+}
+
+// between gives copies of incidents of snapshot created between from and to (inclusive).
+func (s incidentsSnapshot) between(from, to time.Time) []models.Incident {
+	incidents := make([]models.Incident, 0)
+	for _, incident := range s.incidents {
+		if incident.CreatedAt.Before(from) || incident.CreatedAt.After(to) {
+			continue
+		}
+		incidents = append(incidents, copyIncident(incident))
+	}
+	return incidents
+}
+
+// Cache serves reads of incidents, persistent incidents and subscribers from memory for ttl.
+// Incidents created in window (and up to the oldest date asked since last load) are loaded at once
+// so that reads on ranges moving with current time are served from the same load.
+// Cache is invalidated on each write made through it and on each incident event received by Run.
+// When next store fails, expired data are served instead of the error.
+type Cache struct {
+	next   Store
+	ttl    time.Duration
+	window time.Duration
+
+	mu *sync.RWMutex
+	// generation is incremented on each invalidation to not keep values read before it
+	generation  *uint64
+	incidents   *cacheEntry[incidentsSnapshot]
+	persistents *cacheEntry[[]models.Incident]
+	subscribers *cacheEntry[[]string]
+}
+
+func NewCache(next Store, ttl, window time.Duration) *Cache {
+	return &Cache{
+		next:        next,
+		ttl:         ttl,
+		window:      window,
+		mu:          &sync.RWMutex{},
+		generation:  new(uint64),
+		incidents:   &cacheEntry[incidentsSnapshot]{},
+		persistents: &cacheEntry[[]models.Incident]{},
+		subscribers: &cacheEntry[[]string]{},
+	}
+}
+
+func (c *Cache) Creator() func(u *url.URL) (Store, error) {
+	return func(u *url.URL) (Store, error) {
+		store, err := c.next.Creator()(u)
+		if err != nil {
+			return nil, err
+		}
+		return NewCache(store, c.ttl, c.window), nil
+	}
+}
+
+// WithActor gives a cache making changes on behalf of actor, it shares its entries with c.
+func (c *Cache) WithActor(actor string) Store {
+	cache := *c
+	cache.next = AsActor(c.next, actor)
+	return &cache
+}
+
+func (c *Cache) Detect(u *url.URL) bool {
+	return c.next.Detect(u)
+}
+
+// Run invalidates cached incidents on each incident event sent through emitter,
+// it catches changes made without going through cache (e.g. by notifiers).
+func (c *Cache) Run() {
+	for range emitter.On() {
+		c.invalidateIncidents()
+	}
+}
+
+// Invalidate expires everything in cache, expired data are only kept to be served when next store fails.
+func (c *Cache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	*c.generation++
+	c.incidents.expiresAt = time.Time{}
+	c.persistents.expiresAt = time.Time{}
+	c.subscribers.expiresAt = time.Time{}
+}
+
+func (c *Cache) invalidateIncidents() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	*c.generation++
+	c.incidents.expiresAt = time.Time{}
+	c.persistents.expiresAt = time.Time{}
+}
+
+func (c *Cache) invalidateSubscribers() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	*c.generation++
+	c.subscribers.expiresAt = time.Time{}
+}
+
+// cached gives value of entry when it is fresh and covers the read, value is read with read otherwise.
+// Value is only kept if cache has not been invalidated while reading it.
+func cached[T any](c *Cache, entry *cacheEntry[T], covers func(T) bool, read func() (T, error)) (T, error) {
+	lookup := func() (T, bool, bool, uint64) {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		usable := entry.loaded && covers(entry.value)
+		return entry.value, usable, usable && time.Now().Before(entry.expiresAt), *c.generation
+	}
+	value, usable, fresh, _ := lookup()
+	if fresh {
+		return value, nil
+	}
+
+	entry.loading.Lock()
+	defer entry.loading.Unlock()
+	// another read may have loaded entry meanwhile
+	value, usable, fresh, generation := lookup()
+	if fresh {
+		return value, nil
+	}
+	loaded, err := read()
+	if err != nil {
+		if usable {
+			log.Warningf("Serving stale data from cache, store could not be read: %s", err.Error())
+			return value, nil
+		}
+		return loaded, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if *c.generation == generation {
+		entry.value = loaded
+		entry.loaded = true
+		entry.expiresAt = time.Now().Add(c.ttl)
+	}
+	return loaded, nil
+}
+
+// snapshot gives incidents snapshot including incidents created since from.
+func (c *Cache) snapshot(from time.Time) (incidentsSnapshot, error) {
+	covers := func(s incidentsSnapshot) bool {
+		return !from.Before(s.from)
+	}
+	return cached(c, c.incidents, covers, func() (incidentsSnapshot, error) {
+		snapshotFrom := time.Now().Add(-c.window)
+		if from.Before(snapshotFrom) {
+			snapshotFrom = from
+		}
+		incidents, err := c.next.ByDate(snapshotFrom, time.Now().AddDate(100, 0, 0))
+		if err != nil {
+			return incidentsSnapshot{}, err
+		}
+		return incidentsSnapshot{from: snapshotFrom, incidents: incidents}, nil
+	})
+}
+
+func (c *Cache) loadedPersistents() ([]models.Incident, error) {
+	return cached(c, c.persistents, func([]models.Incident) bool { return true }, c.next.Persistents)
+}
+
+func (c *Cache) Create(incident models.Incident) (models.Incident, error) {
+	defer c.invalidateIncidents()
+	return c.next.Create(incident)
+}
+
+func (c *Cache) Update(guid string, incident models.Incident) (models.Incident, error) {
+	defer c.invalidateIncidents()
+	return c.next.Update(guid, incident)
+}
+
+func (c *Cache) UpdateIfVersion(guid string, version int, incident models.Incident) (models.Incident, error) {
+	defer c.invalidateIncidents()
+	return c.next.UpdateIfVersion(guid, version, incident)
+}
+
+func (c *Cache) Delete(guid string) error {
+	defer c.invalidateIncidents()
+	return c.next.Delete(guid)
+}
+
+// Read gives incident from cache only when cache is fresh, next store is read otherwise
+// and expired cache is only used when next store fails.
+func (c *Cache) Read(guid string) (models.Incident, error) {
+	if incident, ok := c.find(guid, false); ok {
+		return incident, nil
+	}
+	incident, err := c.next.Read(guid)
+	if err == nil || os.IsNotExist(err) {
+		return incident, err
+	}
+	if stale, ok := c.find(guid, true); ok {
+		log.WithField("guid", guid).Warningf("Serving stale incident from cache, store could not be read: %s", err.Error())
+		return stale, nil
+	}
+	return incident, err
+}
+
+// find looks for incident in cached incidents and persistent incidents, expired ones are only used when stale is set.
+func (c *Cache) find(guid string, stale bool) (models.Incident, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	now := time.Now()
+	var candidates []models.Incident
+	if c.incidents.loaded && (stale || now.Before(c.incidents.expiresAt)) {
+		candidates = append(candidates, c.incidents.value.incidents...)
+	}
+	if c.persistents.loaded && (stale || now.Before(c.persistents.expiresAt)) {
+		candidates = append(candidates, c.persistents.value...)
+	}
+	for _, incident := range candidates {
+		if incident.GUID == guid {
+			return copyIncident(incident), true
+		}
+	}
+	return models.Incident{}, false
+}
+
+func (c *Cache) ByDate(from, to time.Time) ([]models.Incident, error) {
+	snapshot, err := c.snapshot(from)
+	if err != nil {
+		return []models.Incident{}, err
+	}
+	return snapshot.between(from, to), nil
+}
+
+func (c *Cache) Persistents() ([]models.Incident, error) {
+	incidents, err := c.loadedPersistents()
+	if err != nil {
+		return []models.Incident{}, err
+	}
+	persistents := make([]models.Incident, len(incidents))
+	for i, incident := range incidents {
+		persistents[i] = copyIncident(incident)
+	}
+	return persistents, nil
+}
+
+// Query is served from cached incidents when it has a start date, it is delegated to next store otherwise.
+func (c *Cache) Query(query IncidentQuery) (IncidentPage, error) {
+	if err := query.Validate(); err != nil {
+		return IncidentPage{}, err
+	}
+	if query.From.IsZero() {
+		return c.next.Query(query)
+	}
+	snapshot, err := c.snapshot(query.From)
+	if err != nil {
+		return IncidentPage{}, err
+	}
+	to := query.To
+	if to.IsZero() {
+		to = time.Now().AddDate(100, 0, 0)
+	}
+	return queryIncidents(snapshot.between(query.From, to), query)
+}
+
+func (c *Cache) AddRevision(revision models.Revision) error {
+	return c.next.AddRevision(revision)
+}
+
+func (c *Cache) Revisions(incidentGuid string) ([]models.Revision, error) {
+	return c.next.Revisions(incidentGuid)
+}
+
+func (c *Cache) ReplaceRevisions(change func(revision models.Revision) (models.Revision, error)) error {
+	return c.next.ReplaceRevisions(change)
+}
+
+func (c *Cache) AddTrashed(trashed models.TrashedIncident) error {
+	return c.next.AddTrashed(trashed)
+}
+
+func (c *Cache) Trashed() ([]models.TrashedIncident, error) {
+	return c.next.Trashed()
+}
+
+func (c *Cache) DeleteTrashed(guid string) error {
+	return c.next.DeleteTrashed(guid)
+}
+
+func (c *Cache) Subscribe(email string) error {
+	defer c.invalidateSubscribers()
+	return c.next.Subscribe(email)
+}
+
+func (c *Cache) Unsubscribe(email string) error {
+	defer c.invalidateSubscribers()
+	return c.next.Unsubscribe(email)
+}
+
+func (c *Cache) Subscribers() ([]string, error) {
+	subs, err := cached(c, c.subscribers, func([]string) bool { return true }, c.next.Subscribers)
+	if err != nil {
+		return []string{}, err
+	}
+	return append([]string{}, subs...), nil
+}
+
+func (c *Cache) Ping() error {
+	return c.next.Ping()
+}
+
+// copyIncident gives a copy of incident which does not share its slices, cached incidents can't be modified by callers.
+func copyIncident(incident models.Incident) models.Incident {
+	if incident.Messages != nil {
+		incident.Messages = append(make([]models.Message, 0, len(incident.Messages)), incident.Messages...)
+	}
+	if incident.Metadata != nil {
+		incident.Metadata = append(make([]models.Metadata, 0, len(incident.Metadata)), incident.Metadata...)
+	}
+	if incident.Components != nil {
+		components := append(make(models.Components, 0, len(*incident.Components)), *incident.Components...)
+		incident.Components = &components
+	}
+	return incident
+}
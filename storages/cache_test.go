@@ -0,0 +1,192 @@
+package storages_test
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/emitter"
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+	"github.com/orange-cloudfoundry/statusetat/v2/storages"
+	"github.com/orange-cloudfoundry/statusetat/v2/storages/storagesfakes"
+)
+
+var _ = Describe("Cache", func() {
+	var fakeStore *storagesfakes.FakeStore
+	var cache *storages.Cache
+	now := time.Now().UTC().Truncate(time.Second)
+	recent := models.Incident{
+		GUID:      "recent",
+		CreatedAt: now.Add(-time.Hour),
+		Messages:  []models.Message{{GUID: "msg", Title: "recent"}},
+	}
+	old := models.Incident{GUID: "old", CreatedAt: now.Add(-10 * 24 * time.Hour)}
+	persistent := models.Incident{GUID: "persistent", CreatedAt: now.Add(-100 * 24 * time.Hour), Persistent: true}
+
+	BeforeEach(func() {
+		fakeStore = &storagesfakes.FakeStore{}
+		fakeStore.ByDateStub = func(from, to time.Time) ([]models.Incident, error) {
+			incidents := make([]models.Incident, 0)
+			for _, incident := range []models.Incident{recent, old} {
+				if !incident.CreatedAt.Before(from) && !incident.CreatedAt.After(to) {
+					incidents = append(incidents, incident)
+				}
+			}
+			return incidents, nil
+		}
+		fakeStore.PersistentsReturns([]models.Incident{persistent}, nil)
+		fakeStore.SubscribersReturns([]string{"user@local.com"}, nil)
+		fakeStore.ReadReturns(models.Incident{}, os.ErrNotExist)
+		cache = storages.NewCache(fakeStore, time.Hour, 7*24*time.Hour)
+	})
+
+	Context("ByDate", func() {
+		It("should serve ranges in window from a single read", func() {
+			incidents, err := cache.ByDate(now.Add(-2*time.Hour), now)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(incidents).To(ConsistOf(recent))
+
+			incidents, err = cache.ByDate(now.Add(-2*time.Hour).Add(time.Minute), now.Add(time.Minute))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(incidents).To(ConsistOf(recent))
+			Expect(fakeStore.ByDateCallCount()).To(Equal(1))
+		})
+		It("should read again ranges older than window", func() {
+			_, err := cache.ByDate(now.Add(-2*time.Hour), now)
+			Expect(err).ToNot(HaveOccurred())
+
+			incidents, err := cache.ByDate(now.Add(-30*24*time.Hour), now)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(incidents).To(ConsistOf(recent, old))
+			Expect(fakeStore.ByDateCallCount()).To(Equal(2))
+
+			_, err = cache.ByDate(now.Add(-20*24*time.Hour), now)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fakeStore.ByDateCallCount()).To(Equal(2))
+		})
+		It("should read again after ttl", func() {
+			cache = storages.NewCache(fakeStore, time.Millisecond, 7*24*time.Hour)
+			_, err := cache.ByDate(now.Add(-2*time.Hour), now)
+			Expect(err).ToNot(HaveOccurred())
+			time.Sleep(5 * time.Millisecond)
+			_, err = cache.ByDate(now.Add(-2*time.Hour), now)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fakeStore.ByDateCallCount()).To(Equal(2))
+		})
+		It("should not let callers modify cached incidents", func() {
+			incidents, err := cache.ByDate(now.Add(-2*time.Hour), now)
+			Expect(err).ToNot(HaveOccurred())
+			incidents[0].Messages[0].Title = "modified"
+
+			incidents, err = cache.ByDate(now.Add(-2*time.Hour), now)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(incidents[0].Messages[0].Title).To(Equal("recent"))
+		})
+	})
+
+	Context("Invalidation", func() {
+		It("should read again after a write", func() {
+			_, err := cache.ByDate(now.Add(-2*time.Hour), now)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = cache.Persistents()
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = cache.Update("recent", recent)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = cache.ByDate(now.Add(-2*time.Hour), now)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = cache.Persistents()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fakeStore.ByDateCallCount()).To(Equal(2))
+			Expect(fakeStore.PersistentsCallCount()).To(Equal(2))
+		})
+		It("should read again subscribers after a subscription", func() {
+			_, err := cache.Subscribers()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = cache.Subscribers()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fakeStore.SubscribersCallCount()).To(Equal(1))
+
+			Expect(cache.Subscribe("other@local.com")).To(Succeed())
+			_, err = cache.Subscribers()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fakeStore.SubscribersCallCount()).To(Equal(2))
+		})
+		It("should read again after an incident event", func() {
+			DeferCleanup(func() {
+				emitter.Off()
+			})
+			go cache.Run()
+			Eventually(emitter.Listeners).Should(HaveLen(1))
+
+			_, err := cache.ByDate(now.Add(-2*time.Hour), now)
+			Expect(err).ToNot(HaveOccurred())
+			emitter.Emit(models.NewNotifyRequest(recent, false))
+			Eventually(func() int {
+				_, err := cache.ByDate(now.Add(-2*time.Hour), now)
+				Expect(err).ToNot(HaveOccurred())
+				return fakeStore.ByDateCallCount()
+			}).Should(Equal(2))
+		})
+	})
+
+	Context("Read", func() {
+		It("should give incident from fresh cache", func() {
+			_, err := cache.Persistents()
+			Expect(err).ToNot(HaveOccurred())
+
+			incident, err := cache.Read("persistent")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(incident.GUID).To(Equal("persistent"))
+			Expect(fakeStore.ReadCallCount()).To(Equal(0))
+
+			_, err = cache.Read("unknown")
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+	})
+
+	Context("Query", func() {
+		It("should be served from cached incidents", func() {
+			page, err := cache.Query(storages.IncidentQuery{From: now.Add(-2 * time.Hour), Text: "RECENT"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(page.Incidents).To(ConsistOf(recent))
+			Expect(fakeStore.QueryCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("When store fails", func() {
+		BeforeEach(func() {
+			_, err := cache.ByDate(now.Add(-2*time.Hour), now)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = cache.Subscribers()
+			Expect(err).ToNot(HaveOccurred())
+			cache.Invalidate()
+
+			fakeStore.ByDateStub = nil
+			fakeStore.ByDateReturns(nil, fmt.Errorf("unreachable"))
+			fakeStore.SubscribersReturns(nil, fmt.Errorf("unreachable"))
+			fakeStore.ReadReturns(models.Incident{}, fmt.Errorf("unreachable"))
+		})
+		It("should serve stale data", func() {
+			incidents, err := cache.ByDate(now.Add(-2*time.Hour), now)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(incidents).To(ConsistOf(recent))
+
+			subs, err := cache.Subscribers()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(subs).To(ConsistOf("user@local.com"))
+
+			incident, err := cache.Read("recent")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(incident.GUID).To(Equal("recent"))
+		})
+		It("should give error when stale data do not cover the read", func() {
+			_, err := cache.ByDate(now.Add(-30*24*time.Hour), now)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
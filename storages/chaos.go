@@ -0,0 +1,429 @@
+package storages
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+)
+
+const (
+	// chaosSchemePrefix is put in front of scheme of a target to inject faults on it, e.g. chaos+file:///a/path
+	chaosSchemePrefix = "chaos+"
+
+	chaosErrorRateParam   = "error_rate"
+	chaosLatencyParam     = "latency"
+	chaosTimeoutRateParam = "timeout_rate"
+	chaosTimeoutParam     = "timeout"
+	chaosOperationsParam  = "operations"
+	chaosSeedParam        = "seed"
+	// chaosUnderRetryParam injects faults under retries of target instead of above them when set to true
+	chaosUnderRetryParam = "under_retry"
+
+	// defaultChaosTimeout is the time an operation hangs before failing when a timeout is injected
+	defaultChaosTimeout = 30 * time.Second
+)
+
+var (
+	// ErrChaos is given by an operation where an error has been injected
+	ErrChaos = errors.New("chaos: injected error")
+	// ErrChaosTimeout is given by an operation where a timeout has been injected
+	ErrChaosTimeout = errors.New("chaos: injected timeout")
+)
+
+// ChaosOptions defines faults injected by a Chaos store.
+type ChaosOptions struct {
+	// ErrorRate is the probability, between 0 and 1, for an operation to fail with ErrChaos
+	ErrorRate float64
+	// Latency is added to each operation
+	Latency time.Duration
+	// TimeoutRate is the probability, between 0 and 1, for an operation to hang during Timeout and fail with ErrChaosTimeout
+	TimeoutRate float64
+	// Timeout is the time an operation hangs when a timeout is injected, default to 30s
+	Timeout time.Duration
+	// Operations are operations where faults are injected (see Op constants), all operations if empty
+	Operations []string
+	// Seed makes faults injected reproducible when set
+	Seed uint64
+	// Context interrupts operations hanging on an injected timeout when done, default to a context never done
+	Context context.Context
+}
+
+func (o ChaosOptions) Validate() error {
+	if o.ErrorRate < 0 || o.ErrorRate > 1 {
+		return fmt.Errorf("%s must be between 0 and 1", chaosErrorRateParam)
+	}
+	if o.TimeoutRate < 0 || o.TimeoutRate > 1 {
+		return fmt.Errorf("%s must be between 0 and 1", chaosTimeoutRateParam)
+	}
+	if o.Latency < 0 {
+		return fmt.Errorf("%s can't be negative", chaosLatencyParam)
+	}
+	if o.Timeout < 0 {
+		return fmt.Errorf("%s can't be negative", chaosTimeoutParam)
+	}
+	for _, op := range o.Operations {
+		if !isStoreOperation(op) {
+			return fmt.Errorf("unknown operation '%s' in %s, valid ones are: %s", op, chaosOperationsParam, strings.Join(storeOperations, ", "))
+		}
+	}
+	return nil
+}
+
+func isStoreOperation(op string) bool {
+	for _, o := range storeOperations {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+// Chaos injects errors, latency and timeouts on operations of next store to rehearse outages.
+// It is enabled by prefixing scheme of a target with chaos+, e.g. chaos+file:///a/path?error_rate=0.3&latency=2s,
+// targets without this prefix are created as is.
+// Faults are injected above retries of target to be seen by replication and api, or under them
+// when target has under_retry=true parameter to rehearse retries.
+type Chaos struct {
+	next Store
+	opts ChaosOptions
+	ops  map[string]bool
+	// underRetry tells that this store is placed under retries and only handles targets with under_retry=true
+	underRetry bool
+
+	mu     *sync.Mutex
+	rand   *rand.Rand
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewChaos gives a store which injects faults on next store when its url scheme starts with chaos+,
+// it must be placed above retries of target.
+func NewChaos(next Store) *Chaos {
+	return &Chaos{next: next}
+}
+
+// NewChaosUnderRetry works as NewChaos but must be placed under retries of target,
+// it only injects faults on targets with under_retry=true parameter.
+func NewChaosUnderRetry(next Store) *Chaos {
+	return &Chaos{next: next, underRetry: true}
+}
+
+// NewChaosWithOptions gives a store which injects faults defined by opts on next store.
+func NewChaosWithOptions(next Store, opts ChaosOptions) (*Chaos, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = defaultChaosTimeout
+	}
+	seed := opts.Seed
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	ops := make(map[string]bool)
+	for _, op := range opts.Operations {
+		ops[op] = true
+	}
+	parent := opts.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithCancel(parent)
+	return &Chaos{
+		next:   next,
+		opts:   opts,
+		ops:    ops,
+		mu:     &sync.Mutex{},
+		rand:   rand.New(rand.NewPCG(seed, seed)),
+		ctx:    ctx,
+		cancel: cancel,
+	}, nil
+}
+
+// Stop interrupts operations waiting on an injected latency or timeout, they fail with ErrChaosTimeout,
+// as well as all operations made after which would have waited.
+func (m *Chaos) Stop() {
+	if m.cancel != nil {
+		m.cancel()
+	}
+}
+
+func (m *Chaos) WithActor(actor string) Store {
+	store := *m
+	store.next = AsActor(m.next, actor)
+	return &store
+}
+
+func (m *Chaos) Creator() func(u *url.URL) (Store, error) {
+	return func(u *url.URL) (Store, error) {
+		if !m.handles(u) {
+			return m.next.Creator()(u)
+		}
+		opts, err := chaosOptionsFromQuery(u.Query())
+		if err != nil {
+			return nil, fmt.Errorf("invalid chaos parameters: %s", err.Error())
+		}
+		store, err := m.next.Creator()(chaosNextURL(u))
+		if err != nil {
+			return nil, err
+		}
+		log.WithField("url", RedactURL(u)).Warn("Faults are injected on this target, it must not be used in production")
+		return NewChaosWithOptions(store, opts)
+	}
+}
+
+func (m *Chaos) Detect(u *url.URL) bool {
+	if strings.HasPrefix(u.Scheme, chaosSchemePrefix) {
+		return m.next.Detect(chaosNextURL(u))
+	}
+	return m.next.Detect(u)
+}
+
+// handles tells if faults must be injected on target u by this store,
+// targets with faults under retries are given as is to next stores up to the one under retries.
+func (m *Chaos) handles(u *url.URL) bool {
+	if !strings.HasPrefix(u.Scheme, chaosSchemePrefix) {
+		return false
+	}
+	underRetry, _ := strconv.ParseBool(u.Query().Get(chaosUnderRetryParam))
+	return underRetry == m.underRetry
+}
+
+// chaosNextURL gives url of next store, chaos prefix and parameters are removed from a copy of u.
+func chaosNextURL(u *url.URL) *url.URL {
+	nextUrl := *u
+	nextUrl.Scheme = strings.TrimPrefix(u.Scheme, chaosSchemePrefix)
+	query := u.Query()
+	for _, param := range []string{
+		chaosErrorRateParam, chaosLatencyParam, chaosTimeoutRateParam,
+		chaosTimeoutParam, chaosOperationsParam, chaosSeedParam, chaosUnderRetryParam,
+	} {
+		query.Del(param)
+	}
+	nextUrl.RawQuery = query.Encode()
+	return &nextUrl
+}
+
+func chaosOptionsFromQuery(query url.Values) (ChaosOptions, error) {
+	var opts ChaosOptions
+	var err error
+	if v := query.Get(chaosErrorRateParam); v != "" {
+		opts.ErrorRate, err = strconv.ParseFloat(v, 64)
+		if err != nil {
+			return opts, fmt.Errorf("%s: %s", chaosErrorRateParam, err.Error())
+		}
+	}
+	if v := query.Get(chaosTimeoutRateParam); v != "" {
+		opts.TimeoutRate, err = strconv.ParseFloat(v, 64)
+		if err != nil {
+			return opts, fmt.Errorf("%s: %s", chaosTimeoutRateParam, err.Error())
+		}
+	}
+	if v := query.Get(chaosLatencyParam); v != "" {
+		opts.Latency, err = time.ParseDuration(v)
+		if err != nil {
+			return opts, fmt.Errorf("%s: %s", chaosLatencyParam, err.Error())
+		}
+	}
+	if v := query.Get(chaosTimeoutParam); v != "" {
+		opts.Timeout, err = time.ParseDuration(v)
+		if err != nil {
+			return opts, fmt.Errorf("%s: %s", chaosTimeoutParam, err.Error())
+		}
+	}
+	if v := query.Get(chaosSeedParam); v != "" {
+		opts.Seed, err = strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return opts, fmt.Errorf("%s: %s", chaosSeedParam, err.Error())
+		}
+	}
+	if v := query.Get(chaosUnderRetryParam); v != "" {
+		if _, err := strconv.ParseBool(v); err != nil {
+			return opts, fmt.Errorf("%s: %s", chaosUnderRetryParam, err.Error())
+		}
+	}
+	if v := query.Get(chaosOperationsParam); v != "" {
+		for _, op := range strings.Split(v, ",") {
+			opts.Operations = append(opts.Operations, strings.TrimSpace(op))
+		}
+	}
+	return opts, opts.Validate()
+}
+
+// inject applies faults on operation op, it gives an error when operation must fail without calling next store.
+func (m *Chaos) inject(op string) error {
+	if len(m.ops) > 0 && !m.ops[op] {
+		return nil
+	}
+	// draws are made even when a rate is 0 to keep sequence of faults reproducible whatever rates are
+	m.mu.Lock()
+	timeoutDraw := m.rand.Float64()
+	errorDraw := m.rand.Float64()
+	m.mu.Unlock()
+
+	if m.opts.Latency > 0 {
+		if err := m.wait(m.opts.Latency); err != nil {
+			return err
+		}
+	}
+	if timeoutDraw < m.opts.TimeoutRate {
+		log.WithField("operation", op).Debug("chaos: injecting timeout")
+		if err := m.wait(m.opts.Timeout); err != nil {
+			return err
+		}
+		return ErrChaosTimeout
+	}
+	if errorDraw < m.opts.ErrorRate {
+		log.WithField("operation", op).Debug("chaos: injecting error")
+		return ErrChaos
+	}
+	return nil
+}
+
+// wait waits during d, it gives an error wrapping ErrChaosTimeout when interrupted by context of store.
+func (m *Chaos) wait(d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-m.ctx.Done():
+		return fmt.Errorf("%w: %s", ErrChaosTimeout, m.ctx.Err().Error())
+	}
+}
+
+func (m *Chaos) Create(incident models.Incident) (models.Incident, error) {
+	if err := m.inject(OpCreate); err != nil {
+		return incident, err
+	}
+	return m.next.Create(incident)
+}
+
+func (m *Chaos) Update(guid string, incident models.Incident) (models.Incident, error) {
+	if err := m.inject(OpUpdate); err != nil {
+		return incident, err
+	}
+	return m.next.Update(guid, incident)
+}
+
+func (m *Chaos) UpdateIfVersion(guid string, version int, incident models.Incident) (models.Incident, error) {
+	if err := m.inject(OpUpdateIfVersion); err != nil {
+		return incident, err
+	}
+	return m.next.UpdateIfVersion(guid, version, incident)
+}
+
+func (m *Chaos) Delete(guid string) error {
+	if err := m.inject(OpDelete); err != nil {
+		return err
+	}
+	return m.next.Delete(guid)
+}
+
+func (m *Chaos) Read(guid string) (models.Incident, error) {
+	if err := m.inject(OpRead); err != nil {
+		return models.Incident{}, err
+	}
+	return m.next.Read(guid)
+}
+
+func (m *Chaos) ByDate(from, to time.Time) ([]models.Incident, error) {
+	if err := m.inject(OpByDate); err != nil {
+		return []models.Incident{}, err
+	}
+	return m.next.ByDate(from, to)
+}
+
+func (m *Chaos) Persistents() ([]models.Incident, error) {
+	if err := m.inject(OpPersistents); err != nil {
+		return []models.Incident{}, err
+	}
+	return m.next.Persistents()
+}
+
+func (m *Chaos) Query(query IncidentQuery) (IncidentPage, error) {
+	if err := m.inject(OpQuery); err != nil {
+		return IncidentPage{}, err
+	}
+	return m.next.Query(query)
+}
+
+func (m *Chaos) AddRevision(revision models.Revision) error {
+	if err := m.inject(OpAddRevision); err != nil {
+		return err
+	}
+	return m.next.AddRevision(revision)
+}
+
+func (m *Chaos) Revisions(incidentGuid string) ([]models.Revision, error) {
+	if err := m.inject(OpRevisions); err != nil {
+		return []models.Revision{}, err
+	}
+	return m.next.Revisions(incidentGuid)
+}
+
+func (m *Chaos) ReplaceRevisions(change func(revision models.Revision) (models.Revision, error)) error {
+	if err := m.inject(OpReplaceRevisions); err != nil {
+		return err
+	}
+	return m.next.ReplaceRevisions(change)
+}
+
+func (m *Chaos) AddTrashed(trashed models.TrashedIncident) error {
+	if err := m.inject(OpAddTrashed); err != nil {
+		return err
+	}
+	return m.next.AddTrashed(trashed)
+}
+
+func (m *Chaos) Trashed() ([]models.TrashedIncident, error) {
+	if err := m.inject(OpTrashed); err != nil {
+		return []models.TrashedIncident{}, err
+	}
+	return m.next.Trashed()
+}
+
+func (m *Chaos) DeleteTrashed(guid string) error {
+	if err := m.inject(OpDeleteTrashed); err != nil {
+		return err
+	}
+	return m.next.DeleteTrashed(guid)
+}
+
+func (m *Chaos) Subscribe(email string) error {
+	if err := m.inject(OpSubscribe); err != nil {
+		return err
+	}
+	return m.next.Subscribe(email)
+}
+
+func (m *Chaos) Unsubscribe(email string) error {
+	if err := m.inject(OpUnsubscribe); err != nil {
+		return err
+	}
+	return m.next.Unsubscribe(email)
+}
+
+func (m *Chaos) Subscribers() ([]string, error) {
+	if err := m.inject(OpSubscribers); err != nil {
+		return []string{}, err
+	}
+	return m.next.Subscribers()
+}
+
+func (m *Chaos) Ping() error {
+	if err := m.inject(OpPing); err != nil {
+		return err
+	}
+	return m.next.Ping()
+}
@@ -0,0 +1,155 @@
+package storages_test
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+	"github.com/orange-cloudfoundry/statusetat/v2/storages"
+)
+
+var _ = Describe("Chaos", func() {
+	newStore := func(target string) (storages.Store, error) {
+		u, err := url.Parse(target)
+		Expect(err).ToNot(HaveOccurred())
+		return storages.Factory([]*url.URL{u})
+	}
+	mustStore := func(target string) storages.Store {
+		store, err := newStore(target)
+		Expect(err).ToNot(HaveOccurred())
+		return store
+	}
+
+	Context("Creator", func() {
+		It("should create next store without chaos prefix and parameters", func() {
+			tmpDir := GinkgoT().TempDir()
+			store := mustStore("chaos+file://" + tmpDir + "?latency=1ms")
+			_, err := store.Create(models.Incident{GUID: "inc1", CreatedAt: time.Now()})
+			Expect(err).ToNot(HaveOccurred())
+
+			local := mustStore("file://" + tmpDir)
+			_, err = local.Read("inc1")
+			Expect(err).ToNot(HaveOccurred())
+		})
+		It("should refuse invalid parameters", func() {
+			_, err := newStore("chaos+memory://?error_rate=2")
+			Expect(err).To(HaveOccurred())
+			_, err = newStore("chaos+memory://?latency=notaduration")
+			Expect(err).To(HaveOccurred())
+			_, err = newStore("chaos+memory://?operations=create,unknown")
+			Expect(err).To(HaveOccurred())
+		})
+		It("should not detect unknown store", func() {
+			_, err := newStore("chaos+unknown://")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	It("should inject errors on every operations", func() {
+		store := mustStore("chaos+memory://?error_rate=1")
+		_, err := store.Create(models.Incident{GUID: "inc1"})
+		Expect(err).To(MatchError(storages.ErrChaos))
+		_, err = store.Read("inc1")
+		Expect(err).To(MatchError(storages.ErrChaos))
+		_, err = store.Subscribers()
+		Expect(err).To(MatchError(storages.ErrChaos))
+		Expect(store.Ping()).To(MatchError(storages.ErrChaos))
+	})
+
+	It("should inject errors only on operations given", func() {
+		store := mustStore("chaos+memory://?error_rate=1&operations=create,ping")
+		_, err := store.Create(models.Incident{GUID: "inc1"})
+		Expect(err).To(MatchError(storages.ErrChaos))
+		Expect(store.Ping()).To(MatchError(storages.ErrChaos))
+		Expect(store.Subscribe("user@local.com")).To(Succeed())
+		_, err = store.Read("inc1")
+		Expect(err).ToNot(MatchError(storages.ErrChaos))
+	})
+
+	It("should inject the same faults with the same seed", func() {
+		failures := func() []bool {
+			store := mustStore("chaos+memory://?error_rate=0.5&seed=42")
+			res := make([]bool, 50)
+			for i := range res {
+				res[i] = store.Ping() != nil
+			}
+			return res
+		}
+		first := failures()
+		Expect(first).To(ContainElement(true))
+		Expect(first).To(ContainElement(false))
+		Expect(failures()).To(Equal(first))
+	})
+
+	It("should add latency", func() {
+		store := mustStore("chaos+memory://?latency=50ms")
+		start := time.Now()
+		Expect(store.Ping()).To(Succeed())
+		Expect(time.Since(start)).To(BeNumerically(">=", 50*time.Millisecond))
+	})
+
+	It("should hang and fail on injected timeout", func() {
+		store := mustStore("chaos+memory://?timeout_rate=1&timeout=50ms")
+		start := time.Now()
+		Expect(store.Ping()).To(MatchError(storages.ErrChaosTimeout))
+		Expect(time.Since(start)).To(BeNumerically(">=", 50*time.Millisecond))
+	})
+
+	It("should inject faults above retries by default", func() {
+		u, _ := url.Parse("chaos+file://" + GinkgoT().TempDir() + "?error_rate=1&operations=ping")
+		store, err := storages.Factory([]*url.URL{u})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(store.Ping()).To(MatchError(storages.ErrChaos))
+
+		labels := map[string]string{"target": "chaos+" + (&url.URL{Scheme: "file", Path: u.Path}).String(), "operation": storages.OpPing}
+		Expect(gatheredMetric("statusetat_store_retries_total", labels)).To(BeNil())
+	})
+
+	It("should inject faults under retries when asked", func() {
+		u, _ := url.Parse("chaos+file://" + GinkgoT().TempDir() + "?error_rate=1&operations=ping&under_retry=true")
+		store, err := storages.Factory([]*url.URL{u})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(store.Ping()).To(MatchError(storages.ErrChaos))
+
+		labels := map[string]string{"target": "chaos+" + (&url.URL{Scheme: "file", Path: u.Path}).String(), "operation": storages.OpPing}
+		Expect(gatheredMetric("statusetat_store_retries_total", labels).GetCounter().GetValue()).To(BeEquivalentTo(2))
+	})
+
+	It("should interrupt injected timeout when stopped", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		store, err := storages.NewChaosWithOptions(storages.NewMemory(), storages.ChaosOptions{
+			TimeoutRate: 1,
+			Timeout:     time.Hour,
+			Context:     ctx,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			cancel()
+		}()
+		start := time.Now()
+		Expect(store.Ping()).To(MatchError(storages.ErrChaosTimeout))
+		Expect(time.Since(start)).To(BeNumerically("<", time.Minute))
+
+		store, err = storages.NewChaosWithOptions(storages.NewMemory(), storages.ChaosOptions{TimeoutRate: 1, Timeout: time.Hour})
+		Expect(err).ToNot(HaveOccurred())
+		store.Stop()
+		Expect(store.Ping()).To(MatchError(storages.ErrChaosTimeout))
+	})
+
+	It("should let replicate write when one target is failing", func() {
+		u1, _ := url.Parse("memory://")
+		u2, _ := url.Parse("chaos+memory://?error_rate=1")
+		store, err := storages.Factory([]*url.URL{u1, u2})
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = store.Create(models.Incident{GUID: "inc1", CreatedAt: time.Now()})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = store.Read("inc1")
+		Expect(err).ToNot(HaveOccurred())
+	})
+})
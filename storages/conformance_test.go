@@ -0,0 +1,79 @@
+package storages_test
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/storages"
+	"github.com/orange-cloudfoundry/statusetat/v2/storages/storetest"
+)
+
+// factoryBuilder gives a builder of store made by factory from targets,
+// %s in targets is replaced by a temporary folder removed after each spec.
+func factoryBuilder(targets ...string) storetest.Builder {
+	return func() storages.Store {
+		tmpDir := GinkgoT().TempDir()
+		urls := make([]*url.URL, len(targets))
+		for i, target := range targets {
+			u, err := url.Parse(strings.ReplaceAll(target, "%s", filepath.ToSlash(tmpDir)))
+			Expect(err).ToNot(HaveOccurred())
+			urls[i] = u
+		}
+		store, err := storages.Factory(urls)
+		Expect(err).ToNot(HaveOccurred())
+		return store
+	}
+}
+
+func s3Builder(params string) storetest.Builder {
+	return func() storages.Store {
+		if caBundle, ok := os.LookupEnv("AWS_CA_BUNDLE"); ok {
+			Expect(os.Unsetenv("AWS_CA_BUNDLE")).To(Succeed())
+			DeferCleanup(os.Setenv, "AWS_CA_BUNDLE", caBundle)
+		}
+		backend := s3mem.New()
+		Expect(backend.CreateBucket("statusetat")).To(Succeed())
+		server := httptest.NewTLSServer(gofakes3.New(backend).Server())
+		DeferCleanup(server.Close)
+		return factoryBuilder("s3://key:secret@" + strings.TrimPrefix(server.URL, "https://") + "/statusetat?insecure-skip-verify=true" + params)()
+	}
+}
+
+const conformanceKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+
+var _ = storetest.Describe("DB", factoryBuilder("sqlite://:memory:"))
+
+var _ = storetest.Describe("Local", factoryBuilder("file://%s"))
+
+var _ = storetest.Describe("Bolt", factoryBuilder("bolt://%s/statusetat.db"))
+
+var _ = storetest.Describe("Git", factoryBuilder("git://%s"))
+
+var _ = storetest.Describe("S3", s3Builder(""))
+
+var _ = storetest.Describe("Memory", factoryBuilder("memory://"))
+
+var _ = storetest.Describe("Encrypt on local", factoryBuilder("file://%s?encryption_key="+url.QueryEscape(conformanceKey)))
+
+var _ = storetest.Describe("Encrypt on s3", s3Builder("&encryption_key="+url.QueryEscape(conformanceKey)))
+
+var _ = storetest.Describe("Replicate", factoryBuilder("memory://", "file://%s"))
+
+var _ = storetest.Describe("Cache", func() storages.Store {
+	return storages.NewCache(factoryBuilder("memory://")(), time.Hour, 24*time.Hour)
+})
+
+var _ = storetest.Describe("Chaos without faults", factoryBuilder("chaos+file://%s?error_rate=0&latency=1ms"))
+
+var _ = storetest.Describe("Redis", redisBuilder(""))
+
+var _ = storetest.Describe("Redis with expiry", redisBuilder("?resolved_ttl=24h"))
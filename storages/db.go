@@ -1,8 +1,10 @@
 package storages
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/url"
+	"os"
 	"strings"
 	"time"
 
@@ -25,7 +27,33 @@ type DB struct {
 }
 
 type Subscriber struct {
-	Email string `gorm:"primary_key"`
+	Email string `gorm:"primary_key;type:varchar(512)"`
+}
+
+// IncidentComponent is a component affected by an incident, position keeps order of components in incident.
+type IncidentComponent struct {
+	IncidentGUID string `gorm:"primary_key"`
+	Position     int    `gorm:"primary_key;auto_increment:false"`
+	GroupName    string `gorm:"index"`
+	Name         string `gorm:"index"`
+}
+
+// IncidentRevision is a revision of an incident, its changes are stored as json.
+type IncidentRevision struct {
+	GUID         string `gorm:"primary_key"`
+	IncidentGUID string `gorm:"index"`
+	CreatedAt    time.Time
+	Actor        string
+	Action       string
+	Changes      string `gorm:"type:text"`
+}
+
+// TrashedIncident is an incident in trash, incident is stored as json to be restored as it was.
+type TrashedIncident struct {
+	GUID      string `gorm:"primary_key"`
+	TrashedAt time.Time
+	TrashedBy string
+	Incident  string `gorm:"type:text"`
 }
 
 func (s *DB) GetDb() *gorm.DB {
@@ -73,7 +101,10 @@ func (s *DB) Creator() func(u *url.URL) (Store, error) {
 		if log.IsLevelEnabled(log.DebugLevel) {
 			s.db = s.db.Debug()
 		}
-		s.db.AutoMigrate(&models.Message{}, &models.Incident{}, &models.Metadata{}, &Subscriber{})
+		err = migrateDb(s.db)
+		if err != nil {
+			return nil, err
+		}
 		return s, nil
 	}
 }
@@ -91,11 +122,68 @@ func (s *DB) Create(incident models.Incident) (models.Incident, error) {
 		}
 	}
 	err := s.db.Create(&incident).Error
+	if err != nil {
+		return incident, err
+	}
+	err = s.storeComponents(incident.GUID, incident.Components)
 	return incident, err
 }
 
+func (s *DB) storeComponents(guid string, components *models.Components) error {
+	err := s.db.Where("incident_guid = ?", guid).Delete(IncidentComponent{}).Error
+	if err != nil {
+		return err
+	}
+	if components == nil {
+		return nil
+	}
+	for i, component := range *components {
+		err := s.db.Create(&IncidentComponent{
+			IncidentGUID: guid,
+			Position:     i,
+			GroupName:    component.Group,
+			Name:         component.Name,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadComponents sets components of incidents from join table.
+func (s *DB) loadComponents(incidents []models.Incident) error {
+	if len(incidents) == 0 {
+		return nil
+	}
+	guids := make([]string, len(incidents))
+	for i, incident := range incidents {
+		guids[i] = incident.GUID
+	}
+	var incidentComponents []IncidentComponent
+	err := s.db.Where("incident_guid IN (?)", guids).Order("position").Find(&incidentComponents).Error
+	if err != nil {
+		return err
+	}
+	byGuid := make(map[string]models.Components)
+	for _, ic := range incidentComponents {
+		byGuid[ic.IncidentGUID] = append(byGuid[ic.IncidentGUID], models.Component{
+			Name:  ic.Name,
+			Group: ic.GroupName,
+		})
+	}
+	for i := range incidents {
+		components, ok := byGuid[incidents[i].GUID]
+		if !ok {
+			continue
+		}
+		incidents[i].Components = &components
+	}
+	return nil
+}
+
 func (s *DB) Subscribe(email string) error {
-	err := s.db.Create(&Subscriber{Email: email}).Error
+	err := s.db.FirstOrCreate(&Subscriber{}, Subscriber{Email: email}).Error
 	if err != nil {
 		return err
 	}
@@ -124,7 +212,16 @@ func (s *DB) Subscribers() ([]string, error) {
 }
 
 func (s *DB) Update(guid string, incident models.Incident) (models.Incident, error) {
-	err := s.db.Where("incident_guid = ?", guid).Delete(models.Message{}).Error
+	var count int
+	err := s.db.Table("incidents").Where("guid = ?", guid).Count(&count).Error
+	if err != nil {
+		return incident, err
+	}
+	if count == 0 {
+		incident.GUID = guid
+		return s.Create(incident)
+	}
+	err = s.db.Where("incident_guid = ?", guid).Delete(models.Message{}).Error
 	if err != nil {
 		return incident, err
 	}
@@ -140,31 +237,63 @@ func (s *DB) Update(guid string, incident models.Incident) (models.Incident, err
 		return incident, err
 	}
 	incident.GUID = guid
+	err = s.storeComponents(guid, incident.Components)
+	if err != nil {
+		return incident, err
+	}
 	var updatedIncident models.Incident
 	err = s.db.Model(&updatedIncident).Updates(incident).Error
 	if err != nil {
 		return updatedIncident, err
 	}
-	if incident.State == 0 {
-		err = s.db.Table("incidents").Where("guid = ?", guid).Update("state", 0).Error
-		if err != nil {
-			return updatedIncident, err
-		}
+	// gorm skips zero values when updating from struct, they are set explicitly
+	err = s.db.Table("incidents").Where("guid = ?", guid).Updates(map[string]interface{}{
+		"state":           incident.State,
+		"component_state": incident.ComponentState,
+		"is_scheduled":    incident.IsScheduled,
+		"scheduled_end":   incident.ScheduledEnd,
+		"origin":          incident.Origin,
+		"persistent":      incident.Persistent,
+		"version":         incident.Version,
+	}).Error
+	if err != nil {
+		return updatedIncident, err
 	}
-	if incident.ComponentState == 0 {
-		err = s.db.Table("incidents").Where("guid = ?", guid).Update("component_state", 0).Error
-		if err != nil {
-			return updatedIncident, err
-		}
+
+	return updatedIncident, err
+}
+
+// UpdateIfVersion first sets the new version only where incident still has version, the row stays locked
+// by this transaction until incident is written so a concurrent change waits then finds another version.
+func (s *DB) UpdateIfVersion(guid string, version int, incident models.Incident) (models.Incident, error) {
+	tx := s.db.Begin()
+	if tx.Error != nil {
+		return incident, tx.Error
+	}
+	res := tx.Table("incidents").Where("guid = ? AND version = ?", guid, version).
+		Update("version", incident.Version)
+	if res.Error != nil {
+		tx.Rollback()
+		return incident, res.Error
 	}
-	if !incident.Persistent {
-		err = s.db.Table("incidents").Where("guid = ?", guid).Update("persistent", false).Error
+	if res.RowsAffected == 0 {
+		tx.Rollback()
+		var count int
+		err := s.db.Table("incidents").Where("guid = ?", guid).Count(&count).Error
 		if err != nil {
-			return updatedIncident, err
+			return incident, err
 		}
+		if count == 0 {
+			return incident, os.ErrNotExist
+		}
+		return incident, ErrVersionConflict
 	}
-
-	return updatedIncident, err
+	updated, err := (&DB{db: tx}).Update(guid, incident)
+	if err != nil {
+		tx.Rollback()
+		return updated, err
+	}
+	return updated, tx.Commit().Error
 }
 
 func (s *DB) Delete(guid string) error {
@@ -176,11 +305,21 @@ func (s *DB) Delete(guid string) error {
 	if err != nil {
 		return err
 	}
+	err = s.db.Where("incident_guid = ?", guid).Delete(IncidentComponent{}).Error
+	if err != nil {
+		return err
+	}
 	incident := models.Incident{
 		GUID: guid,
 	}
-	err = s.db.Delete(incident).Error
-	return err
+	res := s.db.Delete(incident)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return os.ErrNotExist
+	}
+	return nil
 }
 
 func (s *DB) Read(guid string) (models.Incident, error) {
@@ -188,7 +327,15 @@ func (s *DB) Read(guid string) (models.Incident, error) {
 	err := s.db.Preload("Messages", func(db *gorm.DB) *gorm.DB {
 		return db.Order("messages.created_at DESC")
 	}).Preload("Metadata").First(&incident, "incidents.guid = ?", guid).Error
-	return incident, err
+	if gorm.IsRecordNotFoundError(err) {
+		return incident, os.ErrNotExist
+	}
+	if err != nil {
+		return incident, err
+	}
+	incidents := []models.Incident{incident}
+	err = s.loadComponents(incidents)
+	return incidents[0], err
 }
 
 func (s *DB) ByDate(from, to time.Time) ([]models.Incident, error) {
@@ -196,18 +343,234 @@ func (s *DB) ByDate(from, to time.Time) ([]models.Incident, error) {
 	err := s.db.Preload("Messages", func(db *gorm.DB) *gorm.DB {
 		return db.Order("messages.created_at DESC")
 	}).Preload("Metadata").Where("created_at BETWEEN ? AND ? AND persistent = ?", from, to, false).Find(&incidents).Error
+	if err != nil {
+		return incidents, err
+	}
+	err = s.loadComponents(incidents)
 	return incidents, err
 }
 
+func (s *DB) Query(query IncidentQuery) (IncidentPage, error) {
+	if err := query.Validate(); err != nil {
+		return IncidentPage{}, err
+	}
+	cursor, _ := decodeCursor(query.Cursor)
+	db := s.db.Model(&models.Incident{}).Where("persistent = ?", false)
+	if !query.From.IsZero() {
+		db = db.Where("created_at >= ?", query.From)
+	}
+	if !query.To.IsZero() {
+		db = db.Where("created_at <= ?", query.To)
+	}
+	if query.Scheduled != nil {
+		db = db.Where("is_scheduled = ?", *query.Scheduled)
+	}
+	if query.ShownAsIncident != nil {
+		cond, args := shownAsMaintenanceCond(query.DisableMaintenanceToIncident)
+		if *query.ShownAsIncident {
+			cond = "NOT (" + cond + ")"
+		}
+		db = db.Where(cond, args...)
+	}
+	if len(query.States) > 0 {
+		db = db.Where("state IN (?)", query.States)
+	}
+	if len(query.ComponentStates) > 0 {
+		db = db.Where("component_state IN (?)", query.ComponentStates)
+	}
+	if len(query.Components) > 0 {
+		conds := make([]string, 0)
+		args := make([]interface{}, 0)
+		for _, component := range query.componentsFilter() {
+			conds = append(conds, "(group_name = ? AND name = ?)")
+			args = append(args, component.Group, component.Name)
+		}
+		db = db.Where("guid IN (?)", s.db.Table("incident_components").
+			Select("incident_guid").Where(strings.Join(conds, " OR "), args...).SubQuery())
+	}
+	if len(query.Groups) > 0 {
+		db = db.Where("guid IN (?)", s.db.Table("incident_components").
+			Select("incident_guid").Where("group_name IN (?)", query.Groups).SubQuery())
+	}
+	if query.Text != "" {
+		like := "%" + likeEscaper.Replace(strings.ToLower(query.Text)) + "%"
+		db = db.Where("guid IN (?)", s.db.Table("messages").Select("incident_guid").
+			Where("LOWER(title) LIKE ? ESCAPE '!' OR LOWER(content) LIKE ? ESCAPE '!'", like, like).SubQuery())
+	}
+	if cursor != nil {
+		db = db.Where("created_at < ? OR (created_at = ? AND guid < ?)", cursor.createdAt, cursor.createdAt, cursor.guid)
+	}
+	db = db.Order("created_at DESC").Order("guid DESC")
+	if query.Limit > 0 {
+		// one more incident is read to know if there is a next page,
+		// offset is only given with a limit as some databases doesn't support offset alone
+		db = db.Limit(query.Limit + 1).Offset(query.Offset)
+	}
+
+	var incidents []models.Incident
+	err := db.Preload("Messages", func(db *gorm.DB) *gorm.DB {
+		return db.Order("messages.created_at DESC")
+	}).Preload("Metadata").Find(&incidents).Error
+	if err != nil {
+		return IncidentPage{}, err
+	}
+	err = s.loadComponents(incidents)
+	if err != nil {
+		return IncidentPage{}, err
+	}
+	if query.Limit > 0 {
+		query.Offset = 0
+	}
+	return paginate(incidents, query), nil
+}
+
+// shownAsMaintenanceCond gives sql condition matching incidents shown as maintenances,
+// this is the opposite of models.Incident.ShouldBeIncident.
+func shownAsMaintenanceCond(disableMaintenanceToIncident bool) (string, []interface{}) {
+	if disableMaintenanceToIncident {
+		return "scheduled_end > ?", []interface{}{time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)}
+	}
+	return "is_scheduled = ? AND (scheduled_end > ? OR state IN (?))",
+		[]interface{}{true, time.Now(), []models.IncidentState{models.Resolved, models.Idle}}
+}
+
+// likeEscaper escapes wildcards of a LIKE pattern using ! as escape character.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
 func (s *DB) Persistents() ([]models.Incident, error) {
 	var incidents []models.Incident
 	err := s.db.Preload("Messages", func(db *gorm.DB) *gorm.DB {
 		return db.Order("messages.created_at DESC")
 	}).Preload("Metadata").Where("persistent = ?", true).Find(&incidents).Error
-
+	if err != nil {
+		return incidents, err
+	}
+	err = s.loadComponents(incidents)
 	return incidents, err
 }
 
+func toDbRevision(revision models.Revision) (IncidentRevision, error) {
+	changes, err := json.Marshal(revision.Changes)
+	if err != nil {
+		return IncidentRevision{}, err
+	}
+	return IncidentRevision{
+		GUID:         revision.GUID,
+		IncidentGUID: revision.IncidentGUID,
+		CreatedAt:    revision.CreatedAt,
+		Actor:        revision.Actor,
+		Action:       string(revision.Action),
+		Changes:      string(changes),
+	}, nil
+}
+
+func fromDbRevision(dbRevision IncidentRevision) (models.Revision, error) {
+	revision := models.Revision{
+		GUID:         dbRevision.GUID,
+		IncidentGUID: dbRevision.IncidentGUID,
+		CreatedAt:    dbRevision.CreatedAt,
+		Actor:        dbRevision.Actor,
+		Action:       models.RevisionAction(dbRevision.Action),
+	}
+	err := json.Unmarshal([]byte(dbRevision.Changes), &revision.Changes)
+	return revision, err
+}
+
+func (s *DB) AddRevision(revision models.Revision) error {
+	dbRevision, err := toDbRevision(revision)
+	if err != nil {
+		return err
+	}
+	return s.db.Create(&dbRevision).Error
+}
+
+func (s *DB) Revisions(incidentGuid string) ([]models.Revision, error) {
+	var dbRevisions []IncidentRevision
+	err := s.db.Where("incident_guid = ?", incidentGuid).Order("created_at, guid").Find(&dbRevisions).Error
+	if err != nil {
+		return []models.Revision{}, err
+	}
+	revisions := make([]models.Revision, len(dbRevisions))
+	for i, dbRevision := range dbRevisions {
+		revisions[i], err = fromDbRevision(dbRevision)
+		if err != nil {
+			return []models.Revision{}, err
+		}
+	}
+	return revisions, nil
+}
+
+func (s *DB) ReplaceRevisions(change func(revision models.Revision) (models.Revision, error)) error {
+	var dbRevisions []IncidentRevision
+	err := s.db.Order("created_at, guid").Find(&dbRevisions).Error
+	if err != nil {
+		return err
+	}
+	for _, dbRevision := range dbRevisions {
+		revision, err := fromDbRevision(dbRevision)
+		if err != nil {
+			return err
+		}
+		revision, err = change(revision)
+		if err != nil {
+			return err
+		}
+		dbRevision, err = toDbRevision(revision)
+		if err != nil {
+			return err
+		}
+		err = s.db.Save(&dbRevision).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *DB) AddTrashed(trashed models.TrashedIncident) error {
+	incident, err := json.Marshal(trashed.Incident)
+	if err != nil {
+		return err
+	}
+	return s.db.Save(&TrashedIncident{
+		GUID:      trashed.Incident.GUID,
+		TrashedAt: trashed.TrashedAt,
+		TrashedBy: trashed.TrashedBy,
+		Incident:  string(incident),
+	}).Error
+}
+
+func (s *DB) Trashed() ([]models.TrashedIncident, error) {
+	var dbTrashed []TrashedIncident
+	err := s.db.Order("trashed_at DESC, guid").Find(&dbTrashed).Error
+	if err != nil {
+		return []models.TrashedIncident{}, err
+	}
+	trashed := make([]models.TrashedIncident, len(dbTrashed))
+	for i, t := range dbTrashed {
+		trashed[i] = models.TrashedIncident{
+			TrashedAt: t.TrashedAt,
+			TrashedBy: t.TrashedBy,
+		}
+		err := json.Unmarshal([]byte(t.Incident), &trashed[i].Incident)
+		if err != nil {
+			return []models.TrashedIncident{}, err
+		}
+	}
+	return trashed, nil
+}
+
+func (s *DB) DeleteTrashed(guid string) error {
+	res := s.db.Where("guid = ?", guid).Delete(&TrashedIncident{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return os.ErrNotExist
+	}
+	return nil
+}
+
 func (s *DB) Ping() error {
 	sdb := s.db.DB()
 	return sdb.Ping()
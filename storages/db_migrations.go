@@ -0,0 +1,377 @@
+package storages
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+)
+
+// dbMigration upgrades database schema to Version, migrations are run in order in a transaction
+// and must only use gorm helpers or sql supported by sqlite, mysql and postgres (use tx.Dialect().GetName() otherwise).
+// Migrations must never use structs from models as they change over time.
+// DDL is not transactional on mysql, a migration interrupted after a schema change is run again on next start:
+// each migration must be idempotent and succeed on a schema it has already partially changed.
+type dbMigration struct {
+	Version     int
+	Description string
+	Up          func(tx *gorm.DB) error
+}
+
+// dbSchemaVersion records each migration applied on database.
+type dbSchemaVersion struct {
+	Version     int `gorm:"primary_key;auto_increment:false"`
+	Description string
+	AppliedAt   time.Time
+}
+
+func (dbSchemaVersion) TableName() string {
+	return "schema_versions"
+}
+
+var dbMigrations = []dbMigration{
+	{
+		Version:     1,
+		Description: "initial schema",
+		Up:          migrateInitialSchema,
+	},
+	{
+		Version:     2,
+		Description: "move components of incidents in a join table",
+		Up:          migrateComponentsJoinTable,
+	},
+	{
+		Version:     3,
+		Description: "add revisions of incidents",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&dbIncidentRevisionV3{}).Error
+		},
+	},
+	{
+		Version:     4,
+		Description: "add version of incidents",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&dbIncidentV4{}).Error
+		},
+	},
+	{
+		Version:     5,
+		Description: "add trash of incidents",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&dbTrashedIncidentV5{}).Error
+		},
+	},
+	{
+		Version:     6,
+		Description: "widen columns holding encrypted values",
+		Up:          migrateEncryptedColumns,
+	},
+}
+
+// dbMigrationLockName is name of the lock taken on mysql by instances migrating database.
+const dbMigrationLockName = "statusetat_schema_migrations"
+
+// dbMigrationLockKey is key of the advisory lock taken on postgres by instances migrating database.
+const dbMigrationLockKey int64 = 0x5354415455534554
+
+// dbMigrationLockTimeout is how long an instance waits for another one to finish migrating database.
+var dbMigrationLockTimeout = 5 * time.Minute
+
+// lockDbMigrations takes a lock on database shared by all instances using it, so only one of them migrates database.
+// Lock is bound to a connection, it is kept out of pool until unlock is called.
+// Sqlite databases are a local file locked by sqlite during transactions, no lock is taken on them.
+func lockDbMigrations(db *gorm.DB) (unlock func(), err error) {
+	var lockQuery, unlockQuery string
+	var lockArgs []interface{}
+	switch db.Dialect().GetName() {
+	case "postgres":
+		lockQuery, unlockQuery = "SELECT pg_advisory_lock($1)", "SELECT pg_advisory_unlock($1)"
+		lockArgs = []interface{}{dbMigrationLockKey}
+	case "mysql":
+		lockQuery, unlockQuery = "SELECT GET_LOCK(?, ?)", "SELECT RELEASE_LOCK(?)"
+		lockArgs = []interface{}{dbMigrationLockName, int(dbMigrationLockTimeout.Seconds())}
+	default:
+		return func() {}, nil
+	}
+
+	ctx := context.Background()
+	conn, err := db.DB().Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not lock database migrations: %s", err.Error())
+	}
+	var locked sql.NullInt64
+	if db.Dialect().GetName() == "postgres" {
+		_, err = conn.ExecContext(ctx, lockQuery, lockArgs...)
+		locked = sql.NullInt64{Int64: 1, Valid: true}
+	} else {
+		err = conn.QueryRowContext(ctx, lockQuery, lockArgs...).Scan(&locked)
+	}
+	if err == nil && (!locked.Valid || locked.Int64 != 1) {
+		err = fmt.Errorf("timeout after %s waiting for another instance to migrate database", dbMigrationLockTimeout)
+	}
+	if err != nil {
+		_ = conn.Close() // nolint
+		return nil, fmt.Errorf("could not lock database migrations: %s", err.Error())
+	}
+	return func() {
+		_, err := conn.ExecContext(ctx, unlockQuery, lockArgs[0])
+		if err != nil {
+			// lock is released by database when session ends, connection must not go back to pool holding it
+			log.Warningf("Could not unlock database migrations: %s", err.Error())
+			_ = conn.Raw(func(interface{}) error { return driver.ErrBadConn }) // nolint
+		}
+		_ = conn.Close() // nolint
+	}, nil
+}
+
+// migrateDb applies migrations not already applied on database.
+// Instances sharing database wait for each other, the last ones only find migrations already applied.
+func migrateDb(db *gorm.DB) error {
+	unlock, err := lockDbMigrations(db)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	err = db.AutoMigrate(&dbSchemaVersion{}).Error
+	if err != nil {
+		return fmt.Errorf("could not create schema version table: %s", err.Error())
+	}
+	current, err := dbCurrentVersion(db)
+	if err != nil {
+		return err
+	}
+	latest := dbMigrations[len(dbMigrations)-1].Version
+	if current > latest {
+		return fmt.Errorf("database schema version %d is newer than version %d supported by this version of statusetat", current, latest)
+	}
+
+	for _, migration := range dbMigrations {
+		if migration.Version <= current {
+			continue
+		}
+		tx := db.Begin()
+		if tx.Error != nil {
+			return tx.Error
+		}
+		err := migration.Up(tx)
+		if err == nil {
+			err = tx.Create(&dbSchemaVersion{
+				Version:     migration.Version,
+				Description: migration.Description,
+				AppliedAt:   time.Now().UTC(),
+			}).Error
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("database migration %d (%s) failed: %s", migration.Version, migration.Description, err.Error())
+		}
+		err = tx.Commit().Error
+		if err != nil {
+			return err
+		}
+		log.Infof("Applied database migration %d: %s", migration.Version, migration.Description)
+	}
+	return nil
+}
+
+func dbCurrentVersion(db *gorm.DB) (int, error) {
+	var current int
+	err := db.Model(&dbSchemaVersion{}).Select("COALESCE(MAX(version), 0)").Row().Scan(&current)
+	if err != nil {
+		return 0, fmt.Errorf("could not read schema version: %s", err.Error())
+	}
+	return current, nil
+}
+
+type dbIncidentV1 struct {
+	GUID           string `gorm:"primary_key"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	State          int
+	ComponentState int
+	Components     string `gorm:"type:varchar(300)"`
+	IsScheduled    bool
+	ScheduledEnd   time.Time
+	Origin         string
+	Persistent     bool
+}
+
+func (dbIncidentV1) TableName() string {
+	return "incidents"
+}
+
+type dbMessageV1 struct {
+	GUID         string `gorm:"primary_key"`
+	IncidentGUID string
+	CreatedAt    time.Time
+	Title        string
+	Content      string `gorm:"type:text"`
+}
+
+func (dbMessageV1) TableName() string {
+	return "messages"
+}
+
+type dbMetadataV1 struct {
+	IncidentGUID string
+	Key          string
+	Value        string
+}
+
+func (dbMetadataV1) TableName() string {
+	return "metadata"
+}
+
+type dbSubscriberV1 struct {
+	Email string `gorm:"primary_key"`
+}
+
+func (dbSubscriberV1) TableName() string {
+	return "subscribers"
+}
+
+// migrateInitialSchema creates schema made by auto migration of previous versions,
+// it is a no-op on databases created by them.
+func migrateInitialSchema(tx *gorm.DB) error {
+	return tx.AutoMigrate(&dbMessageV1{}, &dbIncidentV1{}, &dbMetadataV1{}, &dbSubscriberV1{}).Error
+}
+
+type dbIncidentComponentV2 struct {
+	IncidentGUID string `gorm:"primary_key"`
+	Position     int    `gorm:"primary_key;auto_increment:false"`
+	GroupName    string `gorm:"index"`
+	Name         string `gorm:"index"`
+}
+
+func (dbIncidentComponentV2) TableName() string {
+	return "incident_components"
+}
+
+// migrateComponentsJoinTable moves components stored as json in incidents table to incident_components table.
+// Components which has been truncated by the previous column size can't be recovered, they are logged and skipped.
+// Components already moved by an interrupted run are replaced, nothing is left to move once json column is dropped.
+func migrateComponentsJoinTable(tx *gorm.DB) error {
+	err := tx.AutoMigrate(&dbIncidentComponentV2{}).Error
+	if err != nil {
+		return err
+	}
+	if !tx.Dialect().HasColumn("incidents", "components") {
+		return nil
+	}
+	rows, err := tx.Table("incidents").Select("guid, components").Rows()
+	if err != nil {
+		return err
+	}
+	incidentComponents := make(map[string]models.Components)
+	for rows.Next() {
+		var guid string
+		var raw *string
+		if err := rows.Scan(&guid, &raw); err != nil {
+			_ = rows.Close() // nolint
+			return err
+		}
+		if raw == nil || *raw == "" {
+			continue
+		}
+		var components models.Components
+		if err := components.Scan(*raw); err != nil {
+			log.WithField("guid", guid).Warningf("Could not migrate components of incident, they may have been truncated: %s", err.Error())
+			continue
+		}
+		incidentComponents[guid] = components
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for guid, components := range incidentComponents {
+		err := tx.Where("incident_guid = ?", guid).Delete(&dbIncidentComponentV2{}).Error
+		if err != nil {
+			return err
+		}
+		for i, component := range components {
+			err := tx.Create(&dbIncidentComponentV2{
+				IncidentGUID: guid,
+				Position:     i,
+				GroupName:    component.Group,
+				Name:         component.Name,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Model(&dbIncidentV1{}).DropColumn("components").Error
+}
+
+type dbIncidentRevisionV3 struct {
+	GUID         string `gorm:"primary_key"`
+	IncidentGUID string `gorm:"index"`
+	CreatedAt    time.Time
+	Actor        string
+	Action       string
+	Changes      string `gorm:"type:text"`
+}
+
+func (dbIncidentRevisionV3) TableName() string {
+	return "incident_revisions"
+}
+
+// dbIncidentV4 only holds column added to incidents table, AutoMigrate never removes columns.
+type dbIncidentV4 struct {
+	GUID    string `gorm:"primary_key"`
+	Version int    `gorm:"not null;default:0"`
+}
+
+func (dbIncidentV4) TableName() string {
+	return "incidents"
+}
+
+type dbTrashedIncidentV5 struct {
+	GUID      string `gorm:"primary_key"`
+	TrashedAt time.Time
+	TrashedBy string
+	Incident  string `gorm:"type:text"`
+}
+
+func (dbTrashedIncidentV5) TableName() string {
+	return "trashed_incidents"
+}
+
+// migrateEncryptedColumns widens columns which could hold values sealed by Encrypt,
+// sealed values are much longer than their plain values and exceed varchar(255).
+// Sqlite doesn't enforce size of columns and can't change their type, its columns are left as they are.
+func migrateEncryptedColumns(tx *gorm.DB) error {
+	emailType := "varchar(512)"
+	switch tx.Dialect().GetName() {
+	case "sqlite3":
+		return nil
+	case "mysql":
+		// mysql drops constraints not given again when modifying a column
+		emailType += " NOT NULL"
+	}
+	columns := []struct {
+		table, column, typ string
+	}{
+		{"messages", "title", "text"},
+		{"metadata", "value", "text"},
+		{"subscribers", "email", emailType},
+	}
+	for _, c := range columns {
+		err := tx.Table(c.table).ModifyColumn(c.column, c.typ).Error
+		if err != nil {
+			return fmt.Errorf("could not change type of %s.%s: %s", c.table, c.column, err.Error())
+		}
+	}
+	return nil
+}
@@ -1,7 +1,11 @@
 package storages_test
 
 import (
+	"fmt"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/jinzhu/gorm"
@@ -10,6 +14,7 @@ import (
 
 	"github.com/orange-cloudfoundry/statusetat/v2/models"
 	"github.com/orange-cloudfoundry/statusetat/v2/storages"
+	"github.com/orange-cloudfoundry/statusetat/v2/utils"
 )
 
 var _ = Describe("Db", func() {
@@ -260,4 +265,127 @@ var _ = Describe("Db", func() {
 			Expect(store.Ping()).To(BeNil())
 		})
 	})
+	Context("Components", func() {
+		It("should keep all components in order whatever their number", func() {
+			components := make(models.Components, 0)
+			for i := 0; i < 50; i++ {
+				components = append(components, models.Component{Group: "a group", Name: fmt.Sprintf("component %d", 50-i)})
+			}
+			inc := models.Incident{
+				GUID:       "aguid",
+				Components: &components,
+			}
+			_, err := store.Create(inc)
+			Expect(err).To(BeNil())
+
+			newInc, err := store.Read(inc.GUID)
+			Expect(err).To(BeNil())
+			Expect(*newInc.Components).To(Equal(components))
+
+			components = components[:2]
+			_, err = store.Update(inc.GUID, inc)
+			Expect(err).To(BeNil())
+			newInc, err = store.Read(inc.GUID)
+			Expect(err).To(BeNil())
+			Expect(*newInc.Components).To(Equal(components))
+
+			var incidentComponents []storages.IncidentComponent
+			db.Where("name = ?", "component 50").Find(&incidentComponents)
+			Expect(incidentComponents).To(HaveLen(1))
+		})
+	})
+	Context("Migrations", func() {
+		tmpDirDb := filepath.Join(os.TempDir(), "statusetat-test-db")
+		var dbUrl *url.URL
+		BeforeEach(func() {
+			Expect(os.MkdirAll(tmpDirDb, 0775)).To(Succeed())
+			dbUrl, _ = url.Parse("sqlite://" + filepath.Join(tmpDirDb, "store.db"))
+		})
+		AfterEach(func() {
+			utils.RemoveDir(tmpDirDb)
+		})
+		It("should move components of a database made with auto migration in join table", func() {
+			legacyDb, err := gorm.Open("sqlite3", strings.TrimPrefix(dbUrl.String(), "sqlite://"))
+			Expect(err).To(BeNil())
+			Expect(legacyDb.Exec("CREATE TABLE incidents (guid varchar(255), created_at datetime, updated_at datetime, " +
+				"state integer, component_state integer, components varchar(300), is_scheduled bool, scheduled_end datetime, " +
+				"origin varchar(255), persistent bool, PRIMARY KEY (guid))").Error).To(Succeed())
+			Expect(legacyDb.Exec(`INSERT INTO incidents (guid, components) VALUES ('aguid', '["group - comp1","comp2"]'), ('truncated', '["group - co')`).Error).To(Succeed())
+			Expect(legacyDb.Close()).To(Succeed())
+
+			migratedStore, err := (&storages.DB{}).Creator()(dbUrl)
+			Expect(err).To(BeNil())
+
+			inc, err := migratedStore.Read("aguid")
+			Expect(err).To(BeNil())
+			Expect(*inc.Components).To(Equal(models.Components{
+				{Group: "group", Name: "comp1"},
+				{Name: "comp2"},
+			}))
+			inc, err = migratedStore.Read("truncated")
+			Expect(err).To(BeNil())
+			Expect(inc.Components).To(BeNil())
+
+			migratedDb := migratedStore.(*storages.DB).GetDb()
+			Expect(migratedDb.Dialect().HasColumn("incidents", "components")).To(BeFalse())
+			var versions []int
+			Expect(migratedDb.Table("schema_versions").Pluck("version", &versions).Error).To(Succeed())
+			Expect(versions).To(Equal([]int{1, 2, 3, 4, 5, 6}))
+		})
+		It("should apply again migrations interrupted before being recorded", func() {
+			legacyDb, err := gorm.Open("sqlite3", strings.TrimPrefix(dbUrl.String(), "sqlite://"))
+			Expect(err).To(BeNil())
+			Expect(legacyDb.Exec("CREATE TABLE incidents (guid varchar(255), created_at datetime, updated_at datetime, " +
+				"state integer, component_state integer, components varchar(300), is_scheduled bool, scheduled_end datetime, " +
+				"origin varchar(255), persistent bool, PRIMARY KEY (guid))").Error).To(Succeed())
+			Expect(legacyDb.Exec(`INSERT INTO incidents (guid, components) VALUES ('aguid', '["group - comp1","comp2"]')`).Error).To(Succeed())
+			Expect(legacyDb.Exec("CREATE TABLE incident_components (incident_guid varchar(255), position integer, " +
+				"group_name varchar(255), name varchar(255), PRIMARY KEY (incident_guid, position))").Error).To(Succeed())
+			Expect(legacyDb.Exec(`INSERT INTO incident_components (incident_guid, position, group_name, name) VALUES ('aguid', 0, 'group', 'comp1')`).Error).To(Succeed())
+			Expect(legacyDb.Close()).To(Succeed())
+
+			migratedStore, err := (&storages.DB{}).Creator()(dbUrl)
+			Expect(err).To(BeNil())
+			migratedDb := migratedStore.(*storages.DB).GetDb()
+			Expect(migratedDb.Exec("DELETE FROM schema_versions WHERE version > 1").Error).To(Succeed())
+
+			migratedStore, err = (&storages.DB{}).Creator()(dbUrl)
+			Expect(err).To(BeNil())
+			inc, err := migratedStore.Read("aguid")
+			Expect(err).To(BeNil())
+			Expect(*inc.Components).To(Equal(models.Components{
+				{Group: "group", Name: "comp1"},
+				{Name: "comp2"},
+			}))
+
+			var versions []int
+			Expect(migratedStore.(*storages.DB).GetDb().Table("schema_versions").Pluck("version", &versions).Error).To(Succeed())
+			Expect(versions).To(Equal([]int{1, 2, 3, 4, 5, 6}))
+		})
+		It("should only apply migrations once", func() {
+			firstStore, err := (&storages.DB{}).Creator()(dbUrl)
+			Expect(err).To(BeNil())
+			_, err = firstStore.Create(models.Incident{GUID: "aguid", Components: &models.Components{{Name: "comp1"}}})
+			Expect(err).To(BeNil())
+
+			secondStore, err := (&storages.DB{}).Creator()(dbUrl)
+			Expect(err).To(BeNil())
+			inc, err := secondStore.Read("aguid")
+			Expect(err).To(BeNil())
+			Expect(*inc.Components).To(HaveLen(1))
+
+			var versions []int
+			Expect(secondStore.(*storages.DB).GetDb().Table("schema_versions").Pluck("version", &versions).Error).To(Succeed())
+			Expect(versions).To(Equal([]int{1, 2, 3, 4, 5, 6}))
+		})
+		It("should refuse a database with a newer schema", func() {
+			firstStore, err := (&storages.DB{}).Creator()(dbUrl)
+			Expect(err).To(BeNil())
+			Expect(firstStore.(*storages.DB).GetDb().Exec("INSERT INTO schema_versions (version, description) VALUES (99, 'from the future')").Error).To(Succeed())
+
+			_, err = (&storages.DB{}).Creator()(dbUrl)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("newer"))
+		})
+	})
 })
@@ -0,0 +1,667 @@
+package storages
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+	"github.com/orange-cloudfoundry/statusetat/v2/utils"
+)
+
+const (
+	// encryptionKeyParam holds a base64 encoded 256 bits key, it can be repeated to keep older keys for reading
+	encryptionKeyParam = "encryption_key"
+	// encryptionKeyFileParam is the path to a file with one base64 encoded 256 bits key per line
+	encryptionKeyFileParam = "encryption_key_file"
+
+	// encryptedPrefix starts every sealed value, values without it are read as they are
+	encryptedPrefix = "enc:v1:"
+)
+
+type encryptionKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// keyring holds keys of encryption, first one is the current key used to seal values,
+// others are only used to open values sealed before a rotation.
+type keyring []encryptionKey
+
+// Encrypt seals sensitive fields (messages titles and contents, metadata values, revisions changes
+// and subscribers emails) before writing them in next store and opens them on read.
+// It uses envelope encryption: each value is encrypted with its own random data key which is itself
+// encrypted with the current key of encryption, older keys are only used to read values sealed before a rotation.
+// Values which have not been sealed (i.e. written before encryption was enabled) are read as they are.
+type Encrypt struct {
+	next Store
+	keys keyring
+}
+
+// NewEncrypt gives a store which encrypts data of next store when its url has
+// an encryption_key or encryption_key_file parameter, next store is created as is otherwise.
+func NewEncrypt(next Store) *Encrypt {
+	return &Encrypt{next: next}
+}
+
+func (m *Encrypt) Creator() func(u *url.URL) (Store, error) {
+	return func(u *url.URL) (Store, error) {
+		query := u.Query()
+		if query.Get(encryptionKeyParam) == "" && query.Get(encryptionKeyFileParam) == "" {
+			return m.next.Creator()(u)
+		}
+		keys, err := loadEncryptionKeys(query)
+		if err != nil {
+			return nil, err
+		}
+		// encryption parameters are not meant for next store, url is copied to keep given one as is
+		nextUrl := *u
+		query.Del(encryptionKeyParam)
+		query.Del(encryptionKeyFileParam)
+		nextUrl.RawQuery = query.Encode()
+		store, err := m.next.Creator()(&nextUrl)
+		if err != nil {
+			return nil, err
+		}
+		return &Encrypt{next: store, keys: keys}, nil
+	}
+}
+
+func (m *Encrypt) WithActor(actor string) Store {
+	store := *m
+	store.next = AsActor(m.next, actor)
+	return &store
+}
+
+func (m *Encrypt) Detect(u *url.URL) bool {
+	return m.next.Detect(u)
+}
+
+// loadEncryptionKeys gives keys set in url parameters or in key file, first one is the current key.
+func loadEncryptionKeys(query url.Values) (keyring, error) {
+	encodedKeys := query[encryptionKeyParam]
+	if path := query.Get(encryptionKeyFileParam); path != "" {
+		if len(encodedKeys) > 0 {
+			return nil, fmt.Errorf("%s and %s can't be set together", encryptionKeyParam, encryptionKeyFileParam)
+		}
+		var err error
+		encodedKeys, err = readEncryptionKeyFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read encryption key file: %s", err.Error())
+		}
+	}
+	keys := make(keyring, 0, len(encodedKeys))
+	for i, encoded := range encodedKeys {
+		key, err := newEncryptionKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key #%d: %s", i+1, err.Error())
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no encryption key found")
+	}
+	return keys, nil
+}
+
+// readEncryptionKeyFile gives keys of file, empty lines and lines starting with # are skipped.
+func readEncryptionKeyFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer utils.CloseAndLogError(f)
+	keys := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keys = append(keys, line)
+	}
+	return keys, scanner.Err()
+}
+
+// newEncryptionKey decodes a base64 encoded key, key id is derived from key to not have to manage it.
+func newEncryptionKey(encoded string) (encryptionKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return encryptionKey{}, err
+	}
+	if len(raw) != 32 {
+		return encryptionKey{}, fmt.Errorf("key must be 32 bytes long, got %d", len(raw))
+	}
+	aead, err := newAEAD(raw)
+	if err != nil {
+		return encryptionKey{}, err
+	}
+	sum := sha256.Sum256(raw)
+	return encryptionKey{id: hex.EncodeToString(sum[:4]), aead: aead}, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func sealWith(aead cipher.AEAD, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func openWith(aead cipher.AEAD, sealed []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("sealed value is too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
+
+// seal gives value encrypted in form of enc:v1:<key id>:<encrypted data key>:<encrypted value>, empty value is kept empty.
+func (k keyring) seal(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return "", err
+	}
+	current := k[0]
+	wrappedKey, err := sealWith(current.aead, dataKey)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := sealWith(aead, []byte(value))
+	if err != nil {
+		return "", err
+	}
+	return encryptedPrefix + current.id + ":" +
+		base64.RawURLEncoding.EncodeToString(wrappedKey) + ":" +
+		base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// open gives value decrypted, value which has not been sealed is given as is.
+func (k keyring) open(value string) (string, error) {
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return value, nil
+	}
+	parts := strings.Split(strings.TrimPrefix(value, encryptedPrefix), ":")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("invalid encrypted value")
+	}
+	var key *encryptionKey
+	for i := range k {
+		if k[i].id == parts[0] {
+			key = &k[i]
+			break
+		}
+	}
+	if key == nil {
+		return "", fmt.Errorf("value has been encrypted with unknown key %s", parts[0])
+	}
+	wrappedKey, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted value: %s", err.Error())
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted value: %s", err.Error())
+	}
+	dataKey, err := openWith(key.aead, wrappedKey)
+	if err != nil {
+		return "", fmt.Errorf("could not decrypt data key with key %s: %s", key.id, err.Error())
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := openWith(aead, sealed)
+	if err != nil {
+		return "", fmt.Errorf("could not decrypt value: %s", err.Error())
+	}
+	return string(plaintext), nil
+}
+
+// sealedWithCurrentKey tells if value has been sealed with current key.
+func (k keyring) sealedWithCurrentKey(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix+k[0].id+":")
+}
+
+// transformIncident gives a copy of incident with sensitive fields transformed by f, incident given is never modified.
+func transformIncident(incident models.Incident, f func(string) (string, error)) (models.Incident, error) {
+	var err error
+	if incident.Messages != nil {
+		messages := make([]models.Message, len(incident.Messages))
+		for i, msg := range incident.Messages {
+			if msg.Title, err = f(msg.Title); err != nil {
+				return incident, err
+			}
+			if msg.Content, err = f(msg.Content); err != nil {
+				return incident, err
+			}
+			messages[i] = msg
+		}
+		incident.Messages = messages
+	}
+	if incident.Metadata != nil {
+		metadata := make([]models.Metadata, len(incident.Metadata))
+		for i, meta := range incident.Metadata {
+			if meta.Value, err = f(meta.Value); err != nil {
+				return incident, err
+			}
+			metadata[i] = meta
+		}
+		incident.Metadata = metadata
+	}
+	return incident, nil
+}
+
+func (m *Encrypt) sealIncident(incident models.Incident) (models.Incident, error) {
+	return transformIncident(incident, m.keys.seal)
+}
+
+func (m *Encrypt) openIncident(incident models.Incident) (models.Incident, error) {
+	incident, err := transformIncident(incident, m.keys.open)
+	if err != nil {
+		return incident, fmt.Errorf("incident %s: %s", incident.GUID, err.Error())
+	}
+	return incident, nil
+}
+
+func (m *Encrypt) openIncidents(incidents []models.Incident) ([]models.Incident, error) {
+	opened := make([]models.Incident, len(incidents))
+	for i, incident := range incidents {
+		var err error
+		opened[i], err = m.openIncident(incident)
+		if err != nil {
+			return []models.Incident{}, err
+		}
+	}
+	return opened, nil
+}
+
+// sealRaw gives raw json value sealed as a json string.
+func (m *Encrypt) sealRaw(raw json.RawMessage) (json.RawMessage, error) {
+	if len(raw) == 0 {
+		return raw, nil
+	}
+	sealed, err := m.keys.seal(string(raw))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(sealed)
+}
+
+// openRaw gives raw json value sealed by sealRaw decrypted, raw value which has not been sealed is given as is.
+func (m *Encrypt) openRaw(raw json.RawMessage) (json.RawMessage, error) {
+	var sealed string
+	if json.Unmarshal(raw, &sealed) != nil || !strings.HasPrefix(sealed, encryptedPrefix) {
+		return raw, nil
+	}
+	opened, err := m.keys.open(sealed)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(opened), nil
+}
+
+// transformRevision gives a copy of revision with previous and current values of changes transformed by f.
+func transformRevision(revision models.Revision, f func(json.RawMessage) (json.RawMessage, error)) (models.Revision, error) {
+	if revision.Changes == nil {
+		return revision, nil
+	}
+	changes := make([]models.FieldChange, len(revision.Changes))
+	var err error
+	for i, change := range revision.Changes {
+		if change.Previous, err = f(change.Previous); err != nil {
+			return revision, err
+		}
+		if change.Current, err = f(change.Current); err != nil {
+			return revision, err
+		}
+		changes[i] = change
+	}
+	revision.Changes = changes
+	return revision, nil
+}
+
+func (m *Encrypt) Create(incident models.Incident) (models.Incident, error) {
+	sealed, err := m.sealIncident(incident)
+	if err != nil {
+		return incident, err
+	}
+	_, err = m.next.Create(sealed)
+	return incident, err
+}
+
+func (m *Encrypt) Update(guid string, incident models.Incident) (models.Incident, error) {
+	sealed, err := m.sealIncident(incident)
+	if err != nil {
+		return incident, err
+	}
+	_, err = m.next.Update(guid, sealed)
+	return incident, err
+}
+
+func (m *Encrypt) UpdateIfVersion(guid string, version int, incident models.Incident) (models.Incident, error) {
+	sealed, err := m.sealIncident(incident)
+	if err != nil {
+		return incident, err
+	}
+	_, err = m.next.UpdateIfVersion(guid, version, sealed)
+	return incident, err
+}
+
+func (m *Encrypt) Delete(guid string) error {
+	return m.next.Delete(guid)
+}
+
+func (m *Encrypt) Read(guid string) (models.Incident, error) {
+	incident, err := m.next.Read(guid)
+	if err != nil {
+		return incident, err
+	}
+	return m.openIncident(incident)
+}
+
+func (m *Encrypt) ByDate(from, to time.Time) ([]models.Incident, error) {
+	incidents, err := m.next.ByDate(from, to)
+	if err != nil {
+		return incidents, err
+	}
+	return m.openIncidents(incidents)
+}
+
+func (m *Encrypt) Persistents() ([]models.Incident, error) {
+	incidents, err := m.next.Persistents()
+	if err != nil {
+		return incidents, err
+	}
+	return m.openIncidents(incidents)
+}
+
+// Query is delegated to next store, except text matching which can only be done
+// on decrypted messages, in this case all incidents matching other criteria are read.
+func (m *Encrypt) Query(query IncidentQuery) (IncidentPage, error) {
+	if err := query.Validate(); err != nil {
+		return IncidentPage{}, err
+	}
+	if query.Text == "" {
+		page, err := m.next.Query(query)
+		if err != nil {
+			return page, err
+		}
+		page.Incidents, err = m.openIncidents(page.Incidents)
+		return page, err
+	}
+	nextQuery := query
+	nextQuery.Text = ""
+	nextQuery.Limit = 0
+	nextQuery.Offset = 0
+	page, err := m.next.Query(nextQuery)
+	if err != nil {
+		return page, err
+	}
+	incidents, err := m.openIncidents(page.Incidents)
+	if err != nil {
+		return IncidentPage{}, err
+	}
+	return queryIncidents(incidents, query)
+}
+
+func (m *Encrypt) AddRevision(revision models.Revision) error {
+	sealed, err := transformRevision(revision, m.sealRaw)
+	if err != nil {
+		return err
+	}
+	return m.next.AddRevision(sealed)
+}
+
+func (m *Encrypt) Revisions(incidentGuid string) ([]models.Revision, error) {
+	revisions, err := m.next.Revisions(incidentGuid)
+	if err != nil {
+		return revisions, err
+	}
+	opened := make([]models.Revision, len(revisions))
+	for i, revision := range revisions {
+		opened[i], err = transformRevision(revision, m.openRaw)
+		if err != nil {
+			return []models.Revision{}, fmt.Errorf("revision %s: %s", revision.GUID, err.Error())
+		}
+	}
+	return opened, nil
+}
+
+// ReplaceRevisions gives decrypted revisions to change, revisions it gives back are sealed with current key.
+func (m *Encrypt) ReplaceRevisions(change func(revision models.Revision) (models.Revision, error)) error {
+	return m.next.ReplaceRevisions(func(revision models.Revision) (models.Revision, error) {
+		opened, err := transformRevision(revision, m.openRaw)
+		if err != nil {
+			return revision, fmt.Errorf("revision %s: %s", revision.GUID, err.Error())
+		}
+		changed, err := change(opened)
+		if err != nil {
+			return revision, err
+		}
+		return transformRevision(changed, m.sealRaw)
+	})
+}
+
+func (m *Encrypt) AddTrashed(trashed models.TrashedIncident) error {
+	var err error
+	trashed.Incident, err = m.sealIncident(trashed.Incident)
+	if err != nil {
+		return err
+	}
+	return m.next.AddTrashed(trashed)
+}
+
+func (m *Encrypt) Trashed() ([]models.TrashedIncident, error) {
+	trashed, err := m.next.Trashed()
+	if err != nil {
+		return trashed, err
+	}
+	opened := make([]models.TrashedIncident, len(trashed))
+	for i, t := range trashed {
+		t.Incident, err = m.openIncident(t.Incident)
+		if err != nil {
+			return []models.TrashedIncident{}, err
+		}
+		opened[i] = t
+	}
+	return opened, nil
+}
+
+func (m *Encrypt) DeleteTrashed(guid string) error {
+	return m.next.DeleteTrashed(guid)
+}
+
+// Subscribe adds email sealed, as sealed values of the same email differ, email is only added when not already
+// sealed with current key and entries of email sealed with an older key or not sealed are removed afterward.
+func (m *Encrypt) Subscribe(email string) error {
+	raws, err := m.next.Subscribers()
+	if err != nil {
+		return err
+	}
+	found := false
+	stale := make([]string, 0)
+	for _, raw := range raws {
+		sub, err := m.keys.open(raw)
+		if err != nil {
+			return err
+		}
+		if sub != email {
+			continue
+		}
+		if m.keys.sealedWithCurrentKey(raw) && !found {
+			found = true
+			continue
+		}
+		stale = append(stale, raw)
+	}
+	if !found {
+		sealed, err := m.keys.seal(email)
+		if err != nil {
+			return err
+		}
+		if err := m.next.Subscribe(sealed); err != nil {
+			return err
+		}
+	}
+	for _, raw := range stale {
+		if err := m.next.Unsubscribe(raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Unsubscribe removes every entry of email whatever the key used to seal it.
+func (m *Encrypt) Unsubscribe(email string) error {
+	raws, err := m.next.Subscribers()
+	if err != nil {
+		return err
+	}
+	for _, raw := range raws {
+		sub, err := m.keys.open(raw)
+		if err != nil {
+			return err
+		}
+		if sub != email {
+			continue
+		}
+		if err := m.next.Unsubscribe(raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Encrypt) Subscribers() ([]string, error) {
+	raws, err := m.next.Subscribers()
+	if err != nil {
+		return raws, err
+	}
+	seen := make(map[string]bool)
+	subs := make([]string, 0, len(raws))
+	for _, raw := range raws {
+		sub, err := m.keys.open(raw)
+		if err != nil {
+			return []string{}, err
+		}
+		if seen[sub] {
+			continue
+		}
+		seen[sub] = true
+		subs = append(subs, sub)
+	}
+	return subs, nil
+}
+
+func (m *Encrypt) Ping() error {
+	return m.next.Ping()
+}
+
+// ReencryptReport sums up what has been written back by Reencrypt.
+type ReencryptReport struct {
+	Incidents   int `json:"incidents"`
+	Trashed     int `json:"trashed"`
+	Revisions   int `json:"revisions"`
+	Subscribers int `json:"subscribers"`
+	Errors      int `json:"errors"`
+}
+
+func (r ReencryptReport) String() string {
+	return fmt.Sprintf(
+		"%d incident(s), %d trashed incident(s), %d revision(s), %d subscriber(s); %d error(s)",
+		r.Incidents, r.Trashed, r.Revisions, r.Subscribers, r.Errors,
+	)
+}
+
+// Reencrypt writes back incidents, trashed incidents, revisions and subscribers of store.
+// On encrypted targets they are sealed again with current key, this must be done after a key rotation
+// before removing the older key and it also encrypts data written before encryption was enabled.
+func Reencrypt(store Store) (ReencryptReport, error) {
+	var report ReencryptReport
+	var result error
+
+	incidents, err := migrationIncidents(store, allTimeOptions())
+	if err != nil {
+		return report, fmt.Errorf("could not read incidents: %s", err.Error())
+	}
+	for _, incident := range incidents {
+		_, err := store.Update(incident.GUID, incident)
+		if err != nil {
+			report.Errors++
+			result = multierror.Append(result, fmt.Errorf("incident %s: %s", incident.GUID, err.Error()))
+			continue
+		}
+		report.Incidents++
+	}
+
+	trashed, err := store.Trashed()
+	if err != nil {
+		return report, multierror.Append(result, fmt.Errorf("could not read trash: %s", err.Error()))
+	}
+	for _, t := range trashed {
+		err := store.AddTrashed(t)
+		if err != nil {
+			report.Errors++
+			result = multierror.Append(result, fmt.Errorf("trashed incident %s: %s", t.Incident.GUID, err.Error()))
+			continue
+		}
+		report.Trashed++
+	}
+
+	// revisions are replaced as they are, encrypted targets seal them again when they are written back
+	revisions := 0
+	err = store.ReplaceRevisions(func(revision models.Revision) (models.Revision, error) {
+		revisions++
+		return revision, nil
+	})
+	if err != nil {
+		report.Errors++
+		result = multierror.Append(result, fmt.Errorf("revisions: %s", err.Error()))
+	} else {
+		report.Revisions = revisions
+	}
+
+	subs, err := store.Subscribers()
+	if err != nil {
+		return report, multierror.Append(result, fmt.Errorf("could not read subscribers: %s", err.Error()))
+	}
+	for _, sub := range subs {
+		err := store.Subscribe(sub)
+		if err != nil {
+			report.Errors++
+			result = multierror.Append(result, fmt.Errorf("subscriber: %s", err.Error()))
+			continue
+		}
+		report.Subscribers++
+	}
+	return report, result
+}
@@ -0,0 +1,256 @@
+package storages_test
+
+import (
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+	"github.com/orange-cloudfoundry/statusetat/v2/storages"
+	"github.com/orange-cloudfoundry/statusetat/v2/utils"
+)
+
+var _ = Describe("Encrypt", func() {
+	tmpDirEncrypt := filepath.Join(os.TempDir(), "statusetat-test-encrypt")
+	const key1 = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+	const key2 = "ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA="
+	now := time.Now().UTC().Truncate(time.Second)
+
+	newStore := func(rawUrl string) (storages.Store, error) {
+		u, err := url.Parse(rawUrl)
+		Expect(err).ToNot(HaveOccurred())
+		return storages.Factory([]*url.URL{u})
+	}
+	mustStore := func(rawUrl string) storages.Store {
+		store, err := newStore(rawUrl)
+		Expect(err).ToNot(HaveOccurred())
+		return store
+	}
+	localUrl := func(params string) string {
+		if params == "" {
+			return "file://" + tmpDirEncrypt
+		}
+		return "file://" + tmpDirEncrypt + "?" + params
+	}
+	// rawContent gives content of all files written by local store
+	rawContent := func() string {
+		var content bytes.Buffer
+		err := filepath.Walk(tmpDirEncrypt, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			b, err := os.ReadFile(path)
+			content.Write(b)
+			return err
+		})
+		Expect(err).ToNot(HaveOccurred())
+		return content.String()
+	}
+	incident := func(guid string) models.Incident {
+		return models.Incident{
+			GUID:      guid,
+			CreatedAt: now,
+			UpdatedAt: now,
+			Messages: []models.Message{
+				{GUID: guid + "-msg", IncidentGUID: guid, CreatedAt: now, Title: "database is down", Content: "secret details"},
+			},
+			Metadata: []models.Metadata{
+				{Key: "ticket", Value: "INC-1234", IncidentGUID: guid},
+			},
+		}
+	}
+
+	AfterEach(func() {
+		utils.RemoveDir(tmpDirEncrypt)
+	})
+
+	It("should encrypt data on disk and decrypt them on read", func() {
+		store := mustStore(localUrl("encryption_key=" + url.QueryEscape(key1)))
+		inc := incident("inc1")
+		_, err := store.Create(inc)
+		Expect(err).ToNot(HaveOccurred())
+		persistent := incident("persistent")
+		persistent.Persistent = true
+		_, err = store.Create(persistent)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(store.Subscribe("user@local.com")).To(Succeed())
+		Expect(store.Subscribe("user@local.com")).To(Succeed())
+
+		content := rawContent()
+		for _, plain := range []string{"database is down", "secret details", "INC-1234", "user@local.com"} {
+			Expect(content).ToNot(ContainSubstring(plain))
+		}
+		Expect(content).To(ContainSubstring("enc:v1:"))
+
+		read, err := store.Read("inc1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(read.Messages[0].Title).To(Equal("database is down"))
+		Expect(read.Messages[0].Content).To(Equal("secret details"))
+		Expect(read.Metadata[0].Value).To(Equal("INC-1234"))
+
+		incidents, err := store.ByDate(now.Add(-time.Hour), now.Add(time.Hour))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(incidents).To(HaveLen(1))
+		Expect(incidents[0].Messages[0].Title).To(Equal("database is down"))
+
+		persistents, err := store.Persistents()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(persistents).To(HaveLen(1))
+		Expect(persistents[0].Metadata[0].Value).To(Equal("INC-1234"))
+
+		page, err := store.Query(storages.IncidentQuery{Text: "DATABASE"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(page.Incidents).To(HaveLen(1))
+		page, err = store.Query(storages.IncidentQuery{Text: "enc:v1"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(page.Incidents).To(BeEmpty())
+
+		subs, err := store.Subscribers()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(subs).To(ConsistOf("user@local.com"))
+		Expect(store.Unsubscribe("user@local.com")).To(Succeed())
+		subs, err = store.Subscribers()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(subs).To(BeEmpty())
+	})
+
+	It("should encrypt revisions and trashed incidents", func() {
+		store := mustStore(localUrl("encryption_key=" + url.QueryEscape(key1)))
+		inc := incident("inc1")
+		changes := models.DiffFields(nil, models.IncidentFields(inc))
+		Expect(store.AddRevision(models.Revision{GUID: "rev1", IncidentGUID: "inc1", CreatedAt: now, Changes: changes})).To(Succeed())
+		Expect(store.AddTrashed(models.TrashedIncident{Incident: inc, TrashedAt: now, TrashedBy: "admin"})).To(Succeed())
+
+		content := rawContent()
+		Expect(content).ToNot(ContainSubstring("database is down"))
+		Expect(content).ToNot(ContainSubstring("INC-1234"))
+
+		revisions, err := store.Revisions("inc1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(revisions).To(HaveLen(1))
+		Expect(revisions[0].Changes).To(Equal(changes))
+
+		trashed, err := store.Trashed()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(trashed).To(HaveLen(1))
+		Expect(trashed[0].Incident.Messages[0].Content).To(Equal("secret details"))
+		Expect(trashed[0].TrashedBy).To(Equal("admin"))
+	})
+
+	It("should read data written before encryption and encrypt them on reencrypt", func() {
+		plainStore := mustStore(localUrl(""))
+		_, err := plainStore.Create(incident("inc1"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(plainStore.Subscribe("user@local.com")).To(Succeed())
+
+		store := mustStore(localUrl("encryption_key=" + url.QueryEscape(key1)))
+		read, err := store.Read("inc1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(read.Messages[0].Title).To(Equal("database is down"))
+		subs, err := store.Subscribers()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(subs).To(ConsistOf("user@local.com"))
+
+		report, err := storages.Reencrypt(store)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Incidents).To(Equal(1))
+		Expect(report.Subscribers).To(Equal(1))
+
+		content := rawContent()
+		Expect(content).ToNot(ContainSubstring("database is down"))
+		Expect(content).ToNot(ContainSubstring("user@local.com"))
+		subs, err = store.Subscribers()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(subs).To(ConsistOf("user@local.com"))
+	})
+
+	It("should rotate keys", func() {
+		oldStore := mustStore(localUrl("encryption_key=" + url.QueryEscape(key1)))
+		_, err := oldStore.Create(incident("inc1"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(oldStore.Subscribe("user@local.com")).To(Succeed())
+		// revisions are kept after incident is deleted
+		changes := models.DiffFields(nil, models.IncidentFields(incident("deleted")))
+		Expect(oldStore.AddRevision(models.Revision{GUID: "rev1", IncidentGUID: "deleted", CreatedAt: now, Changes: changes})).To(Succeed())
+
+		newOnly := mustStore(localUrl("encryption_key=" + url.QueryEscape(key2)))
+		_, err = newOnly.Read("inc1")
+		Expect(err).To(HaveOccurred())
+
+		keyFile := filepath.Join(tmpDirEncrypt+"-keys", "keys")
+		Expect(os.MkdirAll(filepath.Dir(keyFile), 0700)).To(Succeed())
+		DeferCleanup(utils.RemoveDir, filepath.Dir(keyFile))
+		Expect(os.WriteFile(keyFile, []byte("# current key\n"+key2+"\n\n"+key1+"\n"), 0600)).To(Succeed())
+		store := mustStore(localUrl("encryption_key_file=" + url.QueryEscape(keyFile)))
+		read, err := store.Read("inc1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(read.Messages[0].Title).To(Equal("database is down"))
+
+		report, err := storages.Reencrypt(store)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Revisions).To(Equal(1))
+
+		read, err = newOnly.Read("inc1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(read.Messages[0].Content).To(Equal("secret details"))
+		subs, err := newOnly.Subscribers()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(subs).To(Equal([]string{"user@local.com"}))
+		revisions, err := newOnly.Revisions("deleted")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(revisions).To(HaveLen(1))
+		Expect(revisions[0].Changes).To(Equal(changes))
+	})
+
+	It("should refuse invalid keys", func() {
+		_, err := newStore(localUrl("encryption_key=tooshort"))
+		Expect(err).To(HaveOccurred())
+		_, err = newStore(localUrl("encryption_key_file=/does/not/exist"))
+		Expect(err).To(HaveOccurred())
+		_, err = newStore(localUrl("encryption_key=" + url.QueryEscape(key1) + "&encryption_key_file=/etc/keys"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should encrypt objects of s3 target", func() {
+		if caBundle, ok := os.LookupEnv("AWS_CA_BUNDLE"); ok {
+			Expect(os.Unsetenv("AWS_CA_BUNDLE")).To(Succeed())
+			DeferCleanup(os.Setenv, "AWS_CA_BUNDLE", caBundle)
+		}
+		backend := s3mem.New()
+		Expect(backend.CreateBucket("statusetat")).To(Succeed())
+		server := httptest.NewTLSServer(gofakes3.New(backend).Server())
+		defer server.Close()
+
+		store := mustStore("s3://key:secret@" + strings.TrimPrefix(server.URL, "https://") +
+			"/statusetat?insecure-skip-verify=true&encryption_key=" + url.QueryEscape(key1))
+		_, err := store.Create(incident("inc1"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(store.Subscribe("user@local.com")).To(Succeed())
+
+		result, err := backend.ListBucket("statusetat", nil, gofakes3.ListBucketPage{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Contents).ToNot(BeEmpty())
+		for _, obj := range result.Contents {
+			object, err := backend.GetObject("statusetat", obj.Key, nil)
+			Expect(err).ToNot(HaveOccurred())
+			content, err := io.ReadAll(object.Contents)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(content)).ToNot(ContainSubstring("database is down"))
+			Expect(string(content)).ToNot(ContainSubstring("user@local.com"))
+		}
+
+		read, err := store.Read("inc1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(read.Messages[0].Title).To(Equal("database is down"))
+	})
+})
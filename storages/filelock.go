@@ -0,0 +1,83 @@
+package storages
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/utils"
+)
+
+// fileLockMutexes holds a mutex per lock file, advisory locks are held by process
+// and so do not prevent goroutines of a same process to take the same lock.
+var fileLockMutexes sync.Map
+
+// fileLock is an exclusive lock shared between goroutines and processes (even on different hosts sharing an NFS folder).
+// Lock is an advisory lock on a dedicated file which is never removed.
+type fileLock struct {
+	path string
+}
+
+func newFileLock(path string) *fileLock {
+	return &fileLock{path: path}
+}
+
+// withLock runs fn while holding the lock.
+func (fl *fileLock) withLock(fn func() error) error {
+	mu, _ := fileLockMutexes.LoadOrStore(fl.path, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	defer mu.(*sync.Mutex).Unlock()
+
+	f, err := os.OpenFile(fl.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	// closing file releases the lock as well
+	defer utils.CloseAndLogError(f)
+	err = lockFile(f)
+	if err != nil {
+		return fmt.Errorf("could not lock %s: %s", fl.path, err.Error())
+	}
+	defer func() {
+		if err := unlockFile(f); err != nil {
+			log.Warningf("Could not unlock %s: %s", fl.path, err.Error())
+		}
+	}()
+	return fn()
+}
+
+// writeFileAtomic writes data in a temporary file of the same folder then renames it to path,
+// readers never see a partially written file and a crash never leaves a truncated one.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	cleanup := func(err error) error {
+		utils.CloseAndLogError(f)
+		_ = os.Remove(tmpPath) // nolint
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		return cleanup(err)
+	}
+	if err := f.Sync(); err != nil {
+		return cleanup(err)
+	}
+	if err := f.Chmod(perm); err != nil {
+		return cleanup(err)
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(tmpPath) // nolint
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath) // nolint
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+//go:build !windows
+
+package storages
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// lockFile waits for an exclusive lock on f, fcntl locks are used as, unlike flock, they are honored on NFS.
+func lockFile(f *os.File) error {
+	for {
+		err := unix.FcntlFlock(f.Fd(), unix.F_SETLKW, &unix.Flock_t{
+			Type:   unix.F_WRLCK,
+			Whence: io.SeekStart,
+		})
+		if !errors.Is(err, unix.EINTR) {
+			return err
+		}
+	}
+}
+
+func unlockFile(f *os.File) error {
+	return unix.FcntlFlock(f.Fd(), unix.F_SETLK, &unix.Flock_t{
+		Type:   unix.F_UNLCK,
+		Whence: io.SeekStart,
+	})
+}
@@ -0,0 +1,220 @@
+package storages_test
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+	"github.com/orange-cloudfoundry/statusetat/v2/storages"
+	"github.com/orange-cloudfoundry/statusetat/v2/utils"
+)
+
+var _ = Describe("Git", func() {
+	var gitStorage storages.Store
+	tmpDirGit := filepath.Join(os.TempDir(), "statusetat-test-git")
+	repoPath := filepath.Join(tmpDirGit, "repo")
+	commitMessages := func(path string) []string {
+		repo, err := git.PlainOpen(path)
+		Expect(err).ToNot(HaveOccurred())
+		logs, err := repo.Log(&git.LogOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		messages := make([]string, 0)
+		err = logs.ForEach(func(c *object.Commit) error {
+			messages = append(messages, c.Message)
+			return nil
+		})
+		Expect(err).ToNot(HaveOccurred())
+		return messages
+	}
+	remoteCommits := func(path string) int {
+		repo, err := git.PlainOpen(path)
+		Expect(err).ToNot(HaveOccurred())
+		ref, err := repo.Reference(plumbing.NewBranchReferenceName("main"), true)
+		Expect(err).ToNot(HaveOccurred())
+		logs, err := repo.Log(&git.LogOptions{From: ref.Hash()})
+		Expect(err).ToNot(HaveOccurred())
+		count := 0
+		Expect(logs.ForEach(func(*object.Commit) error {
+			count++
+			return nil
+		})).To(Succeed())
+		return count
+	}
+	BeforeEach(func() {
+		var err error
+		u, _ := url.Parse("git://" + repoPath + "?author_name=admin&author_email=admin@local")
+		gitStorage, err = (&storages.Git{}).Creator()(u)
+		if err != nil {
+			panic(err)
+		}
+	})
+	AfterEach(func() {
+		utils.RemoveDir(tmpDirGit)
+	})
+	Context("Detect", func() {
+		It("should only detect scheme git://", func() {
+			u, _ := url.Parse("git:///my/repo")
+			Expect(gitStorage.Detect(u)).To(BeTrue())
+
+			u, _ = url.Parse("file:///my/repo")
+			Expect(gitStorage.Detect(u)).To(BeFalse())
+		})
+	})
+	It("should commit each change", func() {
+		inc := models.Incident{
+			GUID: "aguid",
+			Messages: []models.Message{{
+				Title: "a title",
+			}},
+		}
+		_, err := gitStorage.Create(inc)
+		Expect(err).ToNot(HaveOccurred())
+		inc.State = models.Resolved
+		_, err = gitStorage.Update(inc.GUID, inc)
+		Expect(err).ToNot(HaveOccurred())
+		// nothing changed, no commit
+		_, err = gitStorage.Update(inc.GUID, inc)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(gitStorage.Subscribe("email@local")).To(Succeed())
+		Expect(gitStorage.Delete(inc.GUID)).To(Succeed())
+
+		Expect(commitMessages(repoPath)).To(Equal([]string{
+			"Delete incident aguid",
+			"Add a subscriber",
+			"Update incident a title (aguid)",
+			"Create incident a title (aguid)",
+		}))
+
+		repo, err := git.PlainOpen(repoPath)
+		Expect(err).ToNot(HaveOccurred())
+		head, err := repo.Head()
+		Expect(err).ToNot(HaveOccurred())
+		commit, err := repo.CommitObject(head.Hash())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(commit.Author.Name).To(Equal("admin"))
+		Expect(commit.Author.Email).To(Equal("admin@local"))
+
+		_, err = gitStorage.Read(inc.GUID)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+		subs, err := gitStorage.Subscribers()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(subs).To(ConsistOf("email@local"))
+	})
+	It("should author commits with actor making the change through replicated targets", func() {
+		repl := storages.NewReplicate([]storages.Store{storages.NewMetrics(storages.NewRetry(&storages.Git{}, 1))})
+		DeferCleanup(repl.Stop)
+		u, _ := url.Parse("git://" + repoPath + "?author_name=admin&author_email=admin@local")
+		_, err := repl.Creator()(u)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = storages.AsActor(repl, "alice").Create(models.Incident{GUID: "aguid"})
+		Expect(err).ToNot(HaveOccurred())
+
+		repo, err := git.PlainOpen(repoPath)
+		Expect(err).ToNot(HaveOccurred())
+		head, err := repo.Head()
+		Expect(err).ToNot(HaveOccurred())
+		commit, err := repo.CommitObject(head.Hash())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(commit.Author.Name).To(Equal("alice"))
+		Expect(commit.Committer.Name).To(Equal("admin"))
+		Expect(commit.Committer.Email).To(Equal("admin@local"))
+
+		// store as is is not changed
+		Expect(repl.Subscribe("email@local")).To(Succeed())
+		head, err = repo.Head()
+		Expect(err).ToNot(HaveOccurred())
+		commit, err = repo.CommitObject(head.Hash())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(commit.Author.Name).To(Equal("admin"))
+	})
+	It("should push changes to remote and restore data from it", func() {
+		remotePath := filepath.Join(tmpDirGit, "remote.git")
+		_, err := git.PlainInit(remotePath, true)
+		Expect(err).ToNot(HaveOccurred())
+
+		u, _ := url.Parse(fmt.Sprintf("git://%s/pushed?remote=%s&branch=main", tmpDirGit, url.QueryEscape("file://"+remotePath)))
+		pushed, err := (&storages.Git{}).Creator()(u)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = pushed.Create(models.Incident{GUID: "aguid"})
+		Expect(err).ToNot(HaveOccurred())
+
+		u, _ = url.Parse(fmt.Sprintf("git://%s/cloned?remote=%s&branch=main", tmpDirGit, url.QueryEscape("file://"+remotePath)))
+		cloned, err := (&storages.Git{}).Creator()(u)
+		Expect(err).ToNot(HaveOccurred())
+		inc, err := cloned.Read("aguid")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inc.GUID).To(Equal("aguid"))
+	})
+	It("should make change again on top of commits pushed meanwhile by another instance", func() {
+		remotePath := filepath.Join(tmpDirGit, "remote.git")
+		_, err := git.PlainInit(remotePath, true)
+		Expect(err).ToNot(HaveOccurred())
+		newStore := func(name string) storages.Store {
+			u, _ := url.Parse(fmt.Sprintf("git://%s/%s?remote=%s&branch=main", tmpDirGit, name, url.QueryEscape("file://"+remotePath)))
+			store, err := (&storages.Git{}).Creator()(u)
+			Expect(err).ToNot(HaveOccurred())
+			return store
+		}
+		first := newStore("first")
+		_, err = first.Create(models.Incident{GUID: "first"})
+		Expect(err).ToNot(HaveOccurred())
+		second := newStore("second")
+		_, err = first.Create(models.Incident{GUID: "other"})
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = second.Create(models.Incident{GUID: "second"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(second.Ping()).To(Succeed())
+		for _, guid := range []string{"first", "other", "second"} {
+			_, err := second.Read(guid)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		Expect(remoteCommits(remotePath)).To(Equal(3))
+	})
+	It("should undo a change which could not be pushed and report it in ping", func() {
+		remotePath := filepath.Join(tmpDirGit, "remote.git")
+		_, err := git.PlainInit(remotePath, true)
+		Expect(err).ToNot(HaveOccurred())
+		u, _ := url.Parse(fmt.Sprintf("git://%s/pushed?remote=%s&branch=main", tmpDirGit, url.QueryEscape("file://"+remotePath)))
+		store, err := (&storages.Git{}).Creator()(u)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = store.Create(models.Incident{GUID: "pushed"})
+		Expect(err).ToNot(HaveOccurred())
+
+		utils.RemoveDir(remotePath)
+		_, err = store.Create(models.Incident{GUID: "unpushed"})
+		Expect(err).To(HaveOccurred())
+		Expect(store.Ping()).ToNot(Succeed())
+		_, err = store.Read("unpushed")
+		Expect(os.IsNotExist(err)).To(BeTrue())
+		Expect(commitMessages(filepath.Join(tmpDirGit, "pushed"))).To(HaveLen(1))
+
+		_, err = git.PlainInit(remotePath, true)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = store.Create(models.Incident{GUID: "unpushed"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(store.Ping()).To(Succeed())
+		Expect(remoteCommits(remotePath)).To(Equal(2))
+	})
+	It("should reset worktree when a change fails", func() {
+		_, err := gitStorage.Create(models.Incident{GUID: "aguid", Version: 1})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(os.WriteFile(filepath.Join(repoPath, "data", "partial"), []byte("{}"), 0644)).To(Succeed())
+
+		_, err = gitStorage.UpdateIfVersion("aguid", 2, models.Incident{GUID: "aguid", Version: 3})
+		Expect(err).To(MatchError(storages.ErrVersionConflict))
+		_, err = os.Stat(filepath.Join(repoPath, "data", "partial"))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+		_, err = os.Stat(filepath.Join(repoPath, "data", ".gitignore"))
+		Expect(err).ToNot(HaveOccurred())
+	})
+})
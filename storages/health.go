@@ -0,0 +1,198 @@
+package storages
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TargetHealth describes health of a store target as seen by statusetat.
+type TargetHealth struct {
+	// Url of the target, credentials are redacted
+	Url string `json:"url"`
+	// Healthy is false when last ping on target failed
+	Healthy bool `json:"healthy"`
+	// Writable is false when last write on target failed and was not replayed yet
+	Writable    bool       `json:"writable"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+	// Latency is the time taken by last ping on target
+	Latency        string `json:"latency"`
+	PendingRecords int    `json:"pending_records"`
+}
+
+// HealthReporter is implemented by stores which are able to give health of each of their targets.
+type HealthReporter interface {
+	Health() []TargetHealth
+}
+
+// Health pings store and gives health of each of its targets, storeUrl is only used
+// to describe store when it is not a HealthReporter.
+func Health(store Store, storeUrl *url.URL) []TargetHealth {
+	healths, _ := CheckHealth(store, storeUrl)
+	return healths
+}
+
+// Ready checks that data can be written in store, i.e. store answers and, for a HealthReporter,
+// at least one of its targets is both healthy and writable.
+func Ready(store Store) error {
+	_, err := CheckHealth(store, nil)
+	return err
+}
+
+// CheckHealth pings store only once to give both health of each of its targets and
+// readiness of store as given by Ready.
+func CheckHealth(store Store, storeUrl *url.URL) ([]TargetHealth, error) {
+	start := time.Now()
+	err := store.Ping()
+	latency := time.Since(start)
+	if reporter, ok := store.(HealthReporter); ok {
+		healths := reporter.Health()
+		if err != nil {
+			return healths, err
+		}
+		for _, health := range healths {
+			if health.Healthy && health.Writable {
+				return healths, nil
+			}
+		}
+		return healths, fmt.Errorf("no writable store")
+	}
+
+	health := TargetHealth{
+		Healthy:  err == nil,
+		Writable: err == nil,
+		Latency:  latency.String(),
+	}
+	if storeUrl != nil {
+		health.Url = RedactURL(storeUrl)
+	}
+	if err != nil {
+		now := time.Now()
+		health.LastError = err.Error()
+		health.LastErrorAt = &now
+	}
+	return []TargetHealth{health}, err
+}
+
+var sensitiveParams = []string{"password", "secret", "token", "key"}
+
+// RedactURL gives string form of u with password and sensitive query parameters (e.g. secret_key) redacted.
+func RedactURL(u *url.URL) string {
+	ru := *u
+	query := ru.Query()
+	changed := false
+	for param, values := range query {
+		for _, sensitive := range sensitiveParams {
+			if strings.Contains(strings.ToLower(param), sensitive) {
+				query.Set(param, "xxxxx")
+				changed = true
+				break
+			}
+		}
+		// parameter may be an url with credentials, e.g. remote of git target
+		for i, value := range values {
+			pu, err := url.Parse(value)
+			if err != nil || pu.User == nil {
+				continue
+			}
+			values[i] = RedactURL(pu)
+			changed = true
+		}
+	}
+	if changed {
+		ru.RawQuery = query.Encode()
+	}
+	return ru.Redacted()
+}
+
+type targetState struct {
+	healthy     bool
+	writable    bool
+	lastError   error
+	lastErrorAt time.Time
+	latency     time.Duration
+}
+
+// targetsState keeps what has been seen from each target of a Replicate store, targets are known by their key.
+type targetsState struct {
+	states map[string]*targetState
+	mu     *sync.Mutex
+}
+
+func newTargetsState() *targetsState {
+	return &targetsState{
+		states: make(map[string]*targetState),
+		mu:     &sync.Mutex{},
+	}
+}
+
+// get must be called with lock held
+func (t *targetsState) get(storeUrl string) *targetState {
+	state, ok := t.states[storeUrl]
+	if !ok {
+		state = &targetState{healthy: true, writable: true}
+		t.states[storeUrl] = state
+	}
+	return state
+}
+
+func (s *targetState) setError(err error) {
+	if err == nil {
+		return
+	}
+	s.lastError = err
+	s.lastErrorAt = time.Now()
+}
+
+func (t *targetsState) ping(storeUrl string, latency time.Duration, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state := t.get(storeUrl)
+	state.healthy = err == nil
+	state.latency = latency
+	state.setError(err)
+}
+
+func (t *targetsState) write(storeUrl string, err error) {
+	if os.IsNotExist(err) {
+		// data not found is an expected answer
+		err = nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state := t.get(storeUrl)
+	state.writable = err == nil
+	state.setError(err)
+}
+
+func (t *targetsState) read(storeUrl string, err error) {
+	if os.IsNotExist(err) {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.get(storeUrl).setError(err)
+}
+
+func (t *targetsState) health(storeKey, storeUrl string, pending int) TargetHealth {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state := t.get(storeKey)
+	health := TargetHealth{
+		Url:            storeUrl,
+		Healthy:        state.healthy,
+		Writable:       state.writable,
+		Latency:        state.latency.String(),
+		PendingRecords: pending,
+	}
+	if state.lastError != nil {
+		lastErrorAt := state.lastErrorAt
+		health.LastError = state.lastError.Error()
+		health.LastErrorAt = &lastErrorAt
+	}
+	return health
+}
@@ -11,6 +11,12 @@ import (
 const subscriberFilename = "subscribers.json"
 const persistentFilename = "persistents.json"
 
+// revisionsFolder is the folder (or prefix) where file based stores keep revisions of incidents
+const revisionsFolder = "revisions"
+
+// trashFolder is the folder (or prefix) where file based stores keep trashed incidents
+const trashFolder = "trash"
+
 func makeHttpClient(u *url.URL) *http.Client {
 	transport := makeHttpTransport(u)
 	client := &http.Client{
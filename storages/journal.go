@@ -0,0 +1,293 @@
+package storages
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+	"github.com/orange-cloudfoundry/statusetat/v2/utils"
+)
+
+// journalEntry is one line of the replay journal, a record is added with all its data
+// and is marked as done by appending a new entry with the same id and done set to true.
+// A tombstone entry records a deletion of data (its action), or forgets it with a write action.
+// When journal is encrypted, data, incident and actor are only written sealed in Sealed.
+type journalEntry struct {
+	ID        string           `json:"id,omitempty"`
+	Done      bool             `json:"done,omitempty"`
+	StoreKey  string           `json:"store_key,omitempty"`
+	StoreUrl  string           `json:"store_url,omitempty"`
+	Action    recordAction     `json:"action"`
+	Data      string           `json:"data,omitempty"`
+	Incident  *models.Incident `json:"incident,omitempty"`
+	Actor     string           `json:"actor,omitempty"`
+	Tombstone bool             `json:"tombstone,omitempty"`
+	At        *time.Time       `json:"at,omitempty"`
+	Sealed    string           `json:"sealed,omitempty"`
+}
+
+// journalPayload is the part of a journal entry sealed when journal is encrypted.
+type journalPayload struct {
+	Data     string           `json:"data,omitempty"`
+	Incident *models.Incident `json:"incident,omitempty"`
+	Actor    string           `json:"actor,omitempty"`
+}
+
+// seal gives entry with its payload sealed with keys, entry is given as is without keys.
+func (e journalEntry) seal(keys keyring) (journalEntry, error) {
+	if len(keys) == 0 || e.Done {
+		return e, nil
+	}
+	b, err := json.Marshal(journalPayload{Data: e.Data, Incident: e.Incident, Actor: e.Actor})
+	if err != nil {
+		return e, err
+	}
+	e.Sealed, err = keys.seal(string(b))
+	if err != nil {
+		return e, err
+	}
+	e.Data, e.Incident, e.Actor = "", nil, ""
+	return e, nil
+}
+
+// open gives entry with its payload opened, entry which has not been sealed is given as is.
+func (e journalEntry) open(keys keyring) (journalEntry, error) {
+	if e.Sealed == "" {
+		return e, nil
+	}
+	if len(keys) == 0 {
+		return e, fmt.Errorf("journal is encrypted but no journal encryption key is set")
+	}
+	opened, err := keys.open(e.Sealed)
+	if err != nil {
+		return e, err
+	}
+	var payload journalPayload
+	err = json.Unmarshal([]byte(opened), &payload)
+	if err != nil {
+		return e, err
+	}
+	e.Data, e.Incident, e.Actor, e.Sealed = payload.Data, payload.Incident, payload.Actor, ""
+	return e, nil
+}
+
+type journal struct {
+	path string
+	file *os.File
+	mu   *sync.Mutex
+	// keys seal entries payloads when set
+	keys keyring
+}
+
+// openJournal opens (or creates) the write-ahead journal at path and returns records not yet replayed
+// and tombstones not expired yet. Entries are sealed with keys when set, entries written before are
+// read as they are and sealed by compaction made on open.
+func openJournal(path string, tombstoneTTL time.Duration, keys keyring) (*journal, []*record, *tombstones, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0775); err != nil {
+		return nil, nil, nil, err
+	}
+	tombs := newTombstones(tombstoneTTL)
+	records, err := loadJournal(path, tombs, keys)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	tombs.expire(time.Now())
+	j := &journal{
+		path: path,
+		mu:   &sync.Mutex{},
+		keys: keys,
+	}
+	// rewrite journal to get rid of records already done in a previous run
+	err = j.compact(records, tombs)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return j, records, tombs, nil
+}
+
+func loadJournal(path string, tombs *tombstones, keys keyring) ([]*record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*record{}, nil
+		}
+		return nil, err
+	}
+	defer utils.CloseAndLogError(f)
+
+	records := make([]*record, 0)
+	byId := make(map[string]*record)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var entry journalEntry
+		err := json.Unmarshal(line, &entry)
+		if err != nil {
+			// this can happen when process crashed while writing last entry
+			log.WithField("journal", path).Warningf("Skipping invalid journal entry: %s", err.Error())
+			continue
+		}
+		entry, err = entry.open(keys)
+		if err != nil {
+			return nil, err
+		}
+		if entry.Tombstone {
+			at := time.Now()
+			if entry.At != nil {
+				at = *entry.At
+			}
+			tombs.set(entry.Action, entry.Data, at)
+			continue
+		}
+		if entry.Done {
+			if rec, ok := byId[entry.ID]; ok {
+				rec.deleted = true
+			}
+			continue
+		}
+		rec := &record{
+			id:       entry.ID,
+			storeKey: entry.StoreKey,
+			storeUrl: entry.StoreUrl,
+			action:   entry.Action,
+			data:     entry.Data,
+			actor:    entry.Actor,
+		}
+		if entry.Incident != nil {
+			rec.incident = *entry.Incident
+		}
+		byId[entry.ID] = rec
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	pending := make([]*record, 0, len(records))
+	for _, rec := range records {
+		if rec.deleted {
+			continue
+		}
+		pending = append(pending, rec)
+	}
+	return pending, nil
+}
+
+func entryFromRecord(rec *record) journalEntry {
+	incident := rec.incident
+	return journalEntry{
+		ID:       rec.id,
+		StoreKey: rec.storeKey,
+		StoreUrl: rec.storeUrl,
+		Action:   rec.action,
+		Data:     rec.data,
+		Incident: &incident,
+		Actor:    rec.actor,
+	}
+}
+
+func (j *journal) add(rec *record) error {
+	return j.write(entryFromRecord(rec))
+}
+
+func (j *journal) tombstone(action recordAction, key string, at time.Time) error {
+	return j.write(tombstoneEntry(action, key, at))
+}
+
+func (j *journal) done(rec *record) error {
+	return j.write(journalEntry{
+		ID:   rec.id,
+		Done: true,
+	})
+}
+
+func (j *journal) write(entry journalEntry) error {
+	b, err := j.marshal(entry)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_, err = j.file.Write(append(b, '\n'))
+	if err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+func (j *journal) marshal(entry journalEntry) ([]byte, error) {
+	entry, err := entry.seal(j.keys)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(entry)
+}
+
+// compact rewrites the journal with only given records and tombstones, they are written in a temporary file
+// which replace the journal afterward to never lose pending records.
+func (j *journal) compact(records []*record, tombs *tombstones) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	// temporary file is unique to never mix two compactions, e.g. of two instances sharing a directory
+	tmp, err := os.CreateTemp(filepath.Dir(j.path), filepath.Base(j.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	entries := tombs.entries()
+	for _, rec := range records {
+		if !rec.deleted {
+			entries = append(entries, entryFromRecord(rec))
+		}
+	}
+	w := bufio.NewWriter(tmp)
+	for _, entry := range entries {
+		b, err := j.marshal(entry)
+		if err != nil {
+			utils.CloseAndLogError(tmp)
+			return err
+		}
+		_, err = w.Write(append(b, '\n'))
+		if err != nil {
+			utils.CloseAndLogError(tmp)
+			return err
+		}
+	}
+	err = w.Flush()
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err != nil {
+		utils.CloseAndLogError(tmp)
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	err = os.Rename(tmpPath, j.path)
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	if j.file != nil {
+		utils.CloseAndLogError(j.file)
+	}
+	j.file, err = os.OpenFile(j.path, os.O_APPEND|os.O_WRONLY, 0600)
+	return err
+}
@@ -7,17 +7,33 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/orange-cloudfoundry/statusetat/v2/common"
 	"github.com/orange-cloudfoundry/statusetat/v2/models"
 )
 
+// Local stores data as json files in a folder, files are written atomically and shared files
+// (subscribers and persistent incidents) are locked during updates, folder can so be shared between instances.
+// Lock of persistent incidents is held by all updates and deletions of incidents as they may move an incident
+// between its own file and persistent incidents.
 type Local struct {
-	dir             string
-	mutexSubscriber *sync.Mutex
-	mutexPersistent *sync.Mutex
+	dir            string
+	lockSubscriber *fileLock
+	lockPersistent *fileLock
+}
+
+func newLocal(dir string) *Local {
+	return &Local{
+		dir:            dir,
+		lockSubscriber: newFileLock(filepath.Join(dir, lockFileName(subscriberFilename))),
+		lockPersistent: newFileLock(filepath.Join(dir, lockFileName(persistentFilename))),
+	}
+}
+
+// lockFileName gives name of lock file of a shared file, it is hidden to be ignored as an incident.
+func lockFileName(fileName string) string {
+	return "." + fileName + ".lock"
 }
 
 func (l *Local) Creator() func(u *url.URL) (Store, error) {
@@ -27,11 +43,7 @@ func (l *Local) Creator() func(u *url.URL) (Store, error) {
 			return nil, err
 		}
 
-		return &Local{
-			dir:             filepath.FromSlash(strings.TrimSuffix(path, "/")),
-			mutexSubscriber: &sync.Mutex{},
-			mutexPersistent: &sync.Mutex{},
-		}, nil
+		return newLocal(filepath.FromSlash(strings.TrimSuffix(path, "/"))), nil
 	}
 }
 
@@ -45,7 +57,7 @@ func (l *Local) Create(incident models.Incident) (models.Incident, error) {
 		return incident, err
 	}
 	b, _ := json.Marshal(incident)
-	err := os.WriteFile(l.path(incident.GUID), b, 0644)
+	err := writeFileAtomic(l.path(incident.GUID), b, 0644)
 	return incident, err
 }
 
@@ -82,22 +94,29 @@ func (l *Local) Persistents() ([]models.Incident, error) {
 }
 
 func (l *Local) addPersistent(incident models.Incident) error {
-	incidents, err := l.Persistents()
-	if err != nil {
-		return err
-	}
-	incidents = models.Incidents(incidents).Filter(incident.GUID)
-	incidents = append(incidents, incident)
-	return l.storePersistents(incidents)
+	return l.lockPersistent.withLock(func() error {
+		incidents, err := l.Persistents()
+		if err != nil {
+			return err
+		}
+		incidents = models.Incidents(incidents).Filter(incident.GUID)
+		incidents = append(incidents, incident)
+		return l.storePersistents(incidents)
+	})
 }
 
-func (l *Local) removePersistent(guid string) error {
+// removePersistent removes persistent incident, it gives false if incident was not a persistent one.
+// It must be called with persistent lock held.
+func (l *Local) removePersistent(guid string) (bool, error) {
 	incidents, err := l.Persistents()
 	if err != nil {
-		return err
+		return false, err
+	}
+	filtered := models.Incidents(incidents).Filter(guid)
+	if len(filtered) == len(incidents) {
+		return false, nil
 	}
-	incidents = models.Incidents(incidents).Filter(guid)
-	return l.storePersistents(incidents)
+	return true, l.storePersistents(filtered)
 }
 
 func (l *Local) readPersistent(guid string) (models.Incident, error) {
@@ -108,42 +127,42 @@ func (l *Local) readPersistent(guid string) (models.Incident, error) {
 	return models.Incidents(incidents).Find(guid), nil
 }
 
+// storePersistents must be called with persistent lock held.
 func (l *Local) storePersistents(incidents []models.Incident) error {
 	sort.Sort(models.Incidents(incidents))
 	b, _ := json.Marshal(incidents)
-	l.mutexPersistent.Lock()
-	defer l.mutexPersistent.Unlock()
-	err := os.WriteFile(l.path(persistentFilename), b, 0644)
-	return err
+	return writeFileAtomic(l.path(persistentFilename), b, 0644)
 }
 
+// storeSubscribers must be called with subscriber lock held.
 func (l *Local) storeSubscribers(subscribers []string) error {
 	b, _ := json.Marshal(subscribers)
-	l.mutexSubscriber.Lock()
-	defer l.mutexSubscriber.Unlock()
-	err := os.WriteFile(l.path(subscriberFilename), b, 0644)
-	return err
+	return writeFileAtomic(l.path(subscriberFilename), b, 0644)
 }
 
 func (l *Local) Subscribe(email string) error {
-	subs, err := l.retrieveSubscribers()
-	if err != nil {
-		return err
-	}
-	if common.InStrSlice(email, subs) {
-		return nil
-	}
-	subs = append(subs, email)
-	return l.storeSubscribers(subs)
+	return l.lockSubscriber.withLock(func() error {
+		subs, err := l.retrieveSubscribers()
+		if err != nil {
+			return err
+		}
+		if common.InStrSlice(email, subs) {
+			return nil
+		}
+		subs = append(subs, email)
+		return l.storeSubscribers(subs)
+	})
 }
 
 func (l *Local) Unsubscribe(email string) error {
-	subs, err := l.retrieveSubscribers()
-	if err != nil {
-		return err
-	}
-	subs = common.FilterStrSlice(email, subs)
-	return l.storeSubscribers(subs)
+	return l.lockSubscriber.withLock(func() error {
+		subs, err := l.retrieveSubscribers()
+		if err != nil {
+			return err
+		}
+		subs = common.FilterStrSlice(email, subs)
+		return l.storeSubscribers(subs)
+	})
 }
 
 func (l *Local) Subscribers() ([]string, error) {
@@ -151,24 +170,63 @@ func (l *Local) Subscribers() ([]string, error) {
 }
 
 func (l *Local) Update(guid string, incident models.Incident) (models.Incident, error) {
+	err := l.lockPersistent.withLock(func() error {
+		return l.update(guid, incident)
+	})
+	return incident, err
+}
+
+// update writes incident where it belongs before removing it from where it was to never lose it.
+// It must be called with persistent lock held.
+func (l *Local) update(guid string, incident models.Incident) error {
+	incidents, err := l.Persistents()
+	if err != nil {
+		return err
+	}
+	filtered := models.Incidents(incidents).Filter(guid)
 	if incident.Persistent {
-		_ = l.Delete(guid) // nolint
-		err := l.addPersistent(incident)
-		return incident, err
+		err := l.storePersistents(append(filtered, incident))
+		if err != nil {
+			return err
+		}
+		err = os.Remove(l.path(guid))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
 	}
 
-	_ = l.removePersistent(guid) // nolint
 	b, _ := json.Marshal(incident)
-	err := os.WriteFile(l.path(guid), b, 0644)
+	err = writeFileAtomic(l.path(guid), b, 0644)
+	if err != nil || len(filtered) == len(incidents) {
+		return err
+	}
+	return l.storePersistents(filtered)
+}
+
+// UpdateIfVersion holds persistent lock while checking version of incident and writing it.
+func (l *Local) UpdateIfVersion(guid string, version int, incident models.Incident) (models.Incident, error) {
+	err := l.lockPersistent.withLock(func() error {
+		current, err := l.Read(guid)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(current, version); err != nil {
+			return err
+		}
+		return l.update(guid, incident)
+	})
 	return incident, err
 }
 
 func (l *Local) Delete(guid string) error {
-	err := l.removePersistent(guid)
-	if err != nil {
-		return err
-	}
-	return os.Remove(l.path(guid))
+	return l.lockPersistent.withLock(func() error {
+		found, err := l.removePersistent(guid)
+		if err != nil || found {
+			return err
+		}
+		return os.Remove(l.path(guid))
+	})
 }
 
 func (l *Local) path(fileName string) string {
@@ -198,15 +256,48 @@ func (l *Local) Read(guid string) (models.Incident, error) {
 
 func (l *Local) ByDate(from, to time.Time) ([]models.Incident, error) {
 	incidents := make([]models.Incident, 0)
-	err := filepath.Walk(l.dir, func(path string, info os.FileInfo, err error) error {
+	err := l.walkIncidents(func(incident models.Incident) {
+		if incident.CreatedAt.Before(from) || incident.CreatedAt.After(to) {
+			return
+		}
+		incidents = append(incidents, incident)
+	})
+	return incidents, err
+}
+
+// Query only keeps incidents matching query while walking folder.
+func (l *Local) Query(query IncidentQuery) (IncidentPage, error) {
+	if err := query.Validate(); err != nil {
+		return IncidentPage{}, err
+	}
+	incidents := make([]models.Incident, 0)
+	err := l.walkIncidents(func(incident models.Incident) {
+		if query.Match(incident) {
+			incidents = append(incidents, incident)
+		}
+	})
+	if err != nil {
+		return IncidentPage{}, err
+	}
+	return queryIncidents(incidents, query)
+}
+
+// walkIncidents calls fn with each incident stored in folder, persistent incidents excepted.
+func (l *Local) walkIncidents(fn func(incident models.Incident)) error {
+	return filepath.Walk(l.dir, func(path string, info os.FileInfo, err error) error {
+		// hidden files are lock and temporary files
 		if filepath.Base(path) == subscriberFilename ||
-			filepath.Base(path) == persistentFilename {
+			filepath.Base(path) == persistentFilename ||
+			strings.HasPrefix(filepath.Base(path), ".") {
 			return nil
 		}
 		if err != nil {
 			return nil
 		}
 		if info.IsDir() {
+			if path == l.path(revisionsFolder) || path == l.path(trashFolder) {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 		var incident models.Incident
@@ -220,14 +311,131 @@ func (l *Local) ByDate(from, to time.Time) ([]models.Incident, error) {
 		if err != nil {
 			return err
 		}
-		if incident.CreatedAt.Before(from) || incident.CreatedAt.After(to) {
+		fn(incident)
+		return nil
+	})
+}
+
+// revisionsPath gives path of file holding all revisions of an incident.
+func (l *Local) revisionsPath(incidentGuid string) string {
+	return filepath.Join(l.dir, revisionsFolder, incidentGuid+".json")
+}
+
+func (l *Local) AddRevision(revision models.Revision) error {
+	path := l.revisionsPath(revision.IncidentGUID)
+	if err := os.MkdirAll(filepath.Dir(path), 0775); err != nil {
+		return err
+	}
+	lock := newFileLock(filepath.Join(filepath.Dir(path), lockFileName(filepath.Base(path))))
+	return lock.withLock(func() error {
+		revisions, err := l.Revisions(revision.IncidentGUID)
+		if err != nil {
+			return err
+		}
+		revisions = append(revisions, revision)
+		sort.Sort(models.Revisions(revisions))
+		b, _ := json.Marshal(revisions)
+		return writeFileAtomic(path, b, 0644)
+	})
+}
+
+func (l *Local) Revisions(incidentGuid string) ([]models.Revision, error) {
+	b, err := os.ReadFile(l.revisionsPath(incidentGuid))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []models.Revision{}, nil
+		}
+		return []models.Revision{}, err
+	}
+	revisions := make([]models.Revision, 0)
+	err = json.Unmarshal(b, &revisions)
+	if err != nil {
+		return []models.Revision{}, err
+	}
+	return revisions, nil
+}
+
+func (l *Local) ReplaceRevisions(change func(revision models.Revision) (models.Revision, error)) error {
+	entries, err := os.ReadDir(l.path(revisionsFolder))
+	if err != nil {
+		if os.IsNotExist(err) {
 			return nil
 		}
+		return err
+	}
+	for _, entry := range entries {
+		// hidden files are temporary files and locks
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		incidentGuid := strings.TrimSuffix(entry.Name(), ".json")
+		path := l.revisionsPath(incidentGuid)
+		lock := newFileLock(filepath.Join(filepath.Dir(path), lockFileName(filepath.Base(path))))
+		err := lock.withLock(func() error {
+			revisions, err := l.Revisions(incidentGuid)
+			if err != nil {
+				return err
+			}
+			for i, revision := range revisions {
+				revisions[i], err = change(revision)
+				if err != nil {
+					return err
+				}
+			}
+			b, _ := json.Marshal(revisions)
+			return writeFileAtomic(path, b, 0644)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-		incidents = append(incidents, incident)
-		return nil
-	})
-	return incidents, err
+func (l *Local) trashPath(guid string) string {
+	return filepath.Join(l.dir, trashFolder, guid+".json")
+}
+
+func (l *Local) AddTrashed(trashed models.TrashedIncident) error {
+	path := l.trashPath(trashed.Incident.GUID)
+	if err := os.MkdirAll(filepath.Dir(path), 0775); err != nil {
+		return err
+	}
+	b, _ := json.Marshal(trashed)
+	return writeFileAtomic(path, b, 0644)
+}
+
+func (l *Local) Trashed() ([]models.TrashedIncident, error) {
+	entries, err := os.ReadDir(l.path(trashFolder))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []models.TrashedIncident{}, nil
+		}
+		return []models.TrashedIncident{}, err
+	}
+	trashed := make([]models.TrashedIncident, 0, len(entries))
+	for _, entry := range entries {
+		// hidden files are temporary files
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(l.path(trashFolder), entry.Name()))
+		if err != nil {
+			return []models.TrashedIncident{}, err
+		}
+		var t models.TrashedIncident
+		err = json.Unmarshal(b, &t)
+		if err != nil {
+			return []models.TrashedIncident{}, err
+		}
+		trashed = append(trashed, t)
+	}
+	sort.Sort(models.TrashedIncidents(trashed))
+	return trashed, nil
+}
+
+func (l *Local) DeleteTrashed(guid string) error {
+	return os.Remove(l.trashPath(guid))
 }
 
 func (l *Local) Ping() error {
@@ -5,6 +5,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -288,6 +289,101 @@ var _ = Describe("Local", func() {
 			Expect(allSubscribers[1]).Should(Equal("auser2"))
 		})
 	})
+	Context("Concurrent writes", func() {
+		It("should not lose any subscriber when instances share the same folder", func() {
+			u, _ := url.Parse("file://" + tmpDirLocal)
+			otherStorage, err := (&storages.Local{}).Creator()(u)
+			Expect(err).To(BeNil())
+
+			var wg sync.WaitGroup
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer GinkgoRecover()
+					defer wg.Done()
+					store := localStorage
+					if i%2 == 0 {
+						store = otherStorage
+					}
+					Expect(store.Subscribe(fmt.Sprintf("auser%d", i))).To(Succeed())
+				}(i)
+			}
+			wg.Wait()
+
+			allSubscribers, err := localStorage.Subscribers()
+			Expect(err).To(BeNil())
+			Expect(allSubscribers).Should(HaveLen(20))
+		})
+		It("should not lose any persistent incident and leave no temporary file", func() {
+			var wg sync.WaitGroup
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer GinkgoRecover()
+					defer wg.Done()
+					_, err := localStorage.Create(models.Incident{
+						GUID:       fmt.Sprintf("aguid%d", i),
+						Persistent: i%2 == 0,
+					})
+					Expect(err).To(BeNil())
+				}(i)
+			}
+			wg.Wait()
+
+			persistents, err := localStorage.Persistents()
+			Expect(err).To(BeNil())
+			Expect(persistents).Should(HaveLen(10))
+
+			tmpFiles, err := filepath.Glob(filepath.Join(tmpDirLocal, "*.tmp-*"))
+			Expect(err).To(BeNil())
+			Expect(tmpFiles).To(BeEmpty())
+
+			incidents, err := localStorage.ByDate(time.Time{}, time.Now())
+			Expect(err).To(BeNil())
+			Expect(incidents).Should(HaveLen(10))
+		})
+	})
+	Context("Concurrent moves", func() {
+		It("should keep incident moved between persistent and not persistent incidents in one place only", func() {
+			_, err := localStorage.Create(models.Incident{GUID: "aguid", Version: 1})
+			Expect(err).To(BeNil())
+			u, _ := url.Parse("file://" + tmpDirLocal)
+			otherStorage, err := (&storages.Local{}).Creator()(u)
+			Expect(err).To(BeNil())
+
+			var wg sync.WaitGroup
+			for i := 0; i < 40; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer GinkgoRecover()
+					defer wg.Done()
+					store := localStorage
+					if i%2 == 0 {
+						store = otherStorage
+					}
+					_, err := store.Update("aguid", models.Incident{GUID: "aguid", Persistent: i%3 == 0})
+					Expect(err).To(BeNil())
+				}(i)
+			}
+			wg.Wait()
+
+			persistents, err := localStorage.Persistents()
+			Expect(err).To(BeNil())
+			_, errFile := os.Stat(filepath.Join(tmpDirLocal, "aguid"))
+			Expect(len(persistents) == 1).ToNot(Equal(errFile == nil), "incident must be either persistent or not")
+		})
+		It("should leave no lock file of incident after a versioned update", func() {
+			_, err := localStorage.Create(models.Incident{GUID: "aguid", Version: 1})
+			Expect(err).To(BeNil())
+			_, err = localStorage.UpdateIfVersion("aguid", 1, models.Incident{GUID: "aguid", Version: 2})
+			Expect(err).To(BeNil())
+			Expect(localStorage.Delete("aguid")).To(Succeed())
+
+			lockFiles, err := filepath.Glob(filepath.Join(tmpDirLocal, ".aguid*"))
+			Expect(err).To(BeNil())
+			Expect(lockFiles).To(BeEmpty())
+		})
+	})
 	Context("Ping", func() {
 		It("should always return nil", func() {
 			Expect(localStorage.Ping()).To(BeNil())
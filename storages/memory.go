@@ -0,0 +1,283 @@
+package storages
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/common"
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+)
+
+// memoryFixtureParam is the path to a json file used to seed a memory store
+const memoryFixtureParam = "fixture"
+
+// MemoryFixture is the content of a json file seeding a memory store,
+// it has the same format as an archive made by backup once decompressed.
+type MemoryFixture struct {
+	Incidents   []models.Incident `json:"incidents"`
+	Subscribers []string          `json:"subscribers"`
+}
+
+// Memory keeps data in memory only, they are lost when statusetat stops.
+// It is meant for development and tests, url is in form of memory://[?fixture=/path/to/fixture.json].
+type Memory struct {
+	mu          *sync.RWMutex
+	incidents   map[string]models.Incident
+	revisions   map[string][]models.Revision
+	trash       map[string]models.TrashedIncident
+	subscribers []string
+}
+
+// NewMemory gives an empty memory store.
+func NewMemory() *Memory {
+	return &Memory{
+		mu:          &sync.RWMutex{},
+		incidents:   make(map[string]models.Incident),
+		revisions:   make(map[string][]models.Revision),
+		trash:       make(map[string]models.TrashedIncident),
+		subscribers: make([]string, 0),
+	}
+}
+
+func (m *Memory) Creator() func(u *url.URL) (Store, error) {
+	return func(u *url.URL) (Store, error) {
+		store := NewMemory()
+		path := u.Query().Get(memoryFixtureParam)
+		if path == "" {
+			return store, nil
+		}
+		err := store.seed(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not seed memory store from fixture %s: %s", path, err.Error())
+		}
+		return store, nil
+	}
+}
+
+func (m *Memory) Detect(u *url.URL) bool {
+	return u.Scheme == "memory"
+}
+
+func (m *Memory) seed(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var fixture MemoryFixture
+	err = json.Unmarshal(b, &fixture)
+	if err != nil {
+		return err
+	}
+	for _, incident := range fixture.Incidents {
+		if incident.GUID == "" {
+			return fmt.Errorf("incident without guid")
+		}
+		if _, err := m.Create(incident); err != nil {
+			return err
+		}
+	}
+	for _, sub := range fixture.Subscribers {
+		if err := m.Subscribe(sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readIncident gives a copy of incident with its messages sorted as other stores do.
+func (m *Memory) readIncident(incident models.Incident) models.Incident {
+	incident = copyIncident(incident)
+	sort.Sort(models.Messages(incident.Messages))
+	return incident
+}
+
+func (m *Memory) Create(incident models.Incident) (models.Incident, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.incidents[incident.GUID] = copyIncident(incident)
+	return incident, nil
+}
+
+func (m *Memory) Update(guid string, incident models.Incident) (models.Incident, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	incident.GUID = guid
+	m.incidents[guid] = copyIncident(incident)
+	return incident, nil
+}
+
+func (m *Memory) UpdateIfVersion(guid string, version int, incident models.Incident) (models.Incident, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current, ok := m.incidents[guid]
+	if !ok {
+		return incident, os.ErrNotExist
+	}
+	if err := checkVersion(current, version); err != nil {
+		return incident, err
+	}
+	incident.GUID = guid
+	m.incidents[guid] = copyIncident(incident)
+	return incident, nil
+}
+
+func (m *Memory) Delete(guid string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.incidents[guid]; !ok {
+		return os.ErrNotExist
+	}
+	delete(m.incidents, guid)
+	return nil
+}
+
+func (m *Memory) Read(guid string) (models.Incident, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	incident, ok := m.incidents[guid]
+	if !ok {
+		return models.Incident{}, os.ErrNotExist
+	}
+	return m.readIncident(incident), nil
+}
+
+func (m *Memory) ByDate(from, to time.Time) ([]models.Incident, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	incidents := make([]models.Incident, 0)
+	for _, incident := range m.incidents {
+		if incident.Persistent || incident.CreatedAt.Before(from) || incident.CreatedAt.After(to) {
+			continue
+		}
+		incidents = append(incidents, m.readIncident(incident))
+	}
+	sort.Sort(models.Incidents(incidents))
+	return incidents, nil
+}
+
+func (m *Memory) Persistents() ([]models.Incident, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	incidents := make([]models.Incident, 0)
+	for _, incident := range m.incidents {
+		if !incident.Persistent {
+			continue
+		}
+		incidents = append(incidents, m.readIncident(incident))
+	}
+	sort.Sort(models.Incidents(incidents))
+	return incidents, nil
+}
+
+func (m *Memory) Query(query IncidentQuery) (IncidentPage, error) {
+	if err := query.Validate(); err != nil {
+		return IncidentPage{}, err
+	}
+	m.mu.RLock()
+	incidents := make([]models.Incident, 0, len(m.incidents))
+	for _, incident := range m.incidents {
+		incidents = append(incidents, copyIncident(incident))
+	}
+	m.mu.RUnlock()
+	return queryIncidents(incidents, query)
+}
+
+func (m *Memory) AddRevision(revision models.Revision) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	revision.Changes = append([]models.FieldChange{}, revision.Changes...)
+	revisions := append(m.revisions[revision.IncidentGUID], revision)
+	sort.Sort(models.Revisions(revisions))
+	m.revisions[revision.IncidentGUID] = revisions
+	return nil
+}
+
+func (m *Memory) Revisions(incidentGuid string) ([]models.Revision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	revisions := make([]models.Revision, len(m.revisions[incidentGuid]))
+	for i, revision := range m.revisions[incidentGuid] {
+		revision.Changes = append([]models.FieldChange{}, revision.Changes...)
+		revisions[i] = revision
+	}
+	return revisions, nil
+}
+
+func (m *Memory) ReplaceRevisions(change func(revision models.Revision) (models.Revision, error)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, revisions := range m.revisions {
+		for i, revision := range revisions {
+			revision.Changes = append([]models.FieldChange{}, revision.Changes...)
+			changed, err := change(revision)
+			if err != nil {
+				return err
+			}
+			changed.Changes = append([]models.FieldChange{}, changed.Changes...)
+			revisions[i] = changed
+		}
+	}
+	return nil
+}
+
+func (m *Memory) AddTrashed(trashed models.TrashedIncident) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	trashed.Incident = copyIncident(trashed.Incident)
+	m.trash[trashed.Incident.GUID] = trashed
+	return nil
+}
+
+func (m *Memory) Trashed() ([]models.TrashedIncident, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	trashed := make([]models.TrashedIncident, 0, len(m.trash))
+	for _, t := range m.trash {
+		t.Incident = m.readIncident(t.Incident)
+		trashed = append(trashed, t)
+	}
+	sort.Sort(models.TrashedIncidents(trashed))
+	return trashed, nil
+}
+
+func (m *Memory) DeleteTrashed(guid string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.trash[guid]; !ok {
+		return os.ErrNotExist
+	}
+	delete(m.trash, guid)
+	return nil
+}
+
+func (m *Memory) Subscribe(email string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if common.InStrSlice(email, m.subscribers) {
+		return nil
+	}
+	m.subscribers = append(m.subscribers, email)
+	return nil
+}
+
+func (m *Memory) Unsubscribe(email string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subscribers = common.FilterStrSlice(email, m.subscribers)
+	return nil
+}
+
+func (m *Memory) Subscribers() ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]string{}, m.subscribers...), nil
+}
+
+func (m *Memory) Ping() error {
+	return nil
+}
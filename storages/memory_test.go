@@ -0,0 +1,136 @@
+package storages_test
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+	"github.com/orange-cloudfoundry/statusetat/v2/storages"
+)
+
+var _ = Describe("Memory", func() {
+	var store storages.Store
+	now := time.Now().UTC().Truncate(time.Second)
+	BeforeEach(func() {
+		u, _ := url.Parse("memory://")
+		var err error
+		store, err = storages.Factory([]*url.URL{u})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should store incidents and persistent incidents", func() {
+		_, err := store.Create(models.Incident{GUID: "inc1", CreatedAt: now})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = store.Create(models.Incident{GUID: "inc2", CreatedAt: now.Add(-48 * time.Hour)})
+		Expect(err).ToNot(HaveOccurred())
+
+		incidents, err := store.ByDate(now.Add(-time.Hour), now)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(incidents).To(HaveLen(1))
+		Expect(incidents[0].GUID).To(Equal("inc1"))
+
+		_, err = store.Update("inc1", models.Incident{GUID: "inc1", CreatedAt: now, Persistent: true})
+		Expect(err).ToNot(HaveOccurred())
+		incidents, err = store.ByDate(now.Add(-time.Hour), now)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(incidents).To(BeEmpty())
+		persistents, err := store.Persistents()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(persistents).To(HaveLen(1))
+
+		Expect(store.Delete("inc1")).To(Succeed())
+		_, err = store.Read("inc1")
+		Expect(os.IsNotExist(err)).To(BeTrue())
+		Expect(os.IsNotExist(store.Delete("inc1"))).To(BeTrue())
+	})
+
+	It("should update incident under its guid only", func() {
+		_, err := store.Create(models.Incident{GUID: "inc1", CreatedAt: now})
+		Expect(err).ToNot(HaveOccurred())
+
+		updated, err := store.Update("inc1", models.Incident{GUID: "other", CreatedAt: now, Origin: "updated"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(updated.GUID).To(Equal("inc1"))
+		incident, err := store.Read("inc1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(incident.Origin).To(Equal("updated"))
+		_, err = store.Read("other")
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("should not share data with callers", func() {
+		inc := models.Incident{GUID: "inc1", CreatedAt: now, Messages: []models.Message{{GUID: "msg", Title: "title"}}}
+		_, err := store.Create(inc)
+		Expect(err).ToNot(HaveOccurred())
+		inc.Messages[0].Title = "modified"
+
+		read, err := store.Read("inc1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(read.Messages[0].Title).To(Equal("title"))
+	})
+
+	It("should be safe for concurrent use", func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+				guid := fmt.Sprintf("inc%d", i)
+				_, err := store.Create(models.Incident{GUID: guid, CreatedAt: now})
+				Expect(err).ToNot(HaveOccurred())
+				_, err = store.Read(guid)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(store.Subscribe(fmt.Sprintf("user%d@local.com", i%5))).To(Succeed())
+				_, err = store.ByDate(now.Add(-time.Hour), now)
+				Expect(err).ToNot(HaveOccurred())
+			}(i)
+		}
+		wg.Wait()
+		incidents, err := store.ByDate(now.Add(-time.Hour), now)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(incidents).To(HaveLen(20))
+		subs, err := store.Subscribers()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(subs).To(HaveLen(5))
+	})
+
+	It("should be seeded from a fixture", func() {
+		fixture := filepath.Join(GinkgoT().TempDir(), "fixture.json")
+		content := fmt.Sprintf(`{
+  "incidents": [
+    {"guid": "inc1", "created_at": %q, "messages": [{"guid": "msg", "title": "seeded"}]},
+    {"guid": "persistent", "created_at": %q, "persistent": true}
+  ],
+  "subscribers": ["user@local.com"]
+}`, now.Format(time.RFC3339), now.Format(time.RFC3339))
+		Expect(os.WriteFile(fixture, []byte(content), 0644)).To(Succeed())
+
+		u, _ := url.Parse("memory://?fixture=" + url.QueryEscape(fixture))
+		store, err := storages.Factory([]*url.URL{u})
+		Expect(err).ToNot(HaveOccurred())
+
+		incident, err := store.Read("inc1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(incident.Messages[0].Title).To(Equal("seeded"))
+		persistents, err := store.Persistents()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(persistents).To(HaveLen(1))
+		subs, err := store.Subscribers()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(subs).To(ConsistOf("user@local.com"))
+	})
+
+	It("should fail on invalid fixture", func() {
+		u, _ := url.Parse("memory://?fixture=/does/not/exist.json")
+		_, err := storages.Factory([]*url.URL{u})
+		Expect(err).To(HaveOccurred())
+	})
+})
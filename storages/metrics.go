@@ -0,0 +1,209 @@
+package storages
+
+import (
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+)
+
+var (
+	storeOperationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "statusetat_store_operation_duration_seconds",
+		Help:    "Duration of operations made on targets.",
+		Buckets: []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"target", "operation"})
+	storeOperationErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "statusetat_store_operation_errors_total",
+		Help: "Number of operations on targets which failed, not found errors are not counted.",
+	}, []string{"target", "operation"})
+	storeRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "statusetat_store_retries_total",
+		Help: "Number of operations on targets retried after a failure.",
+	}, []string{"target", "operation"})
+	replicatePendingRecords = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "statusetat_replicate_pending_records",
+		Help: "Number of writes waiting to be replayed on a replicated target.",
+	}, []string{"target"})
+)
+
+// targetLabel gives the label of a target in metrics from its redacted url, query is removed to keep
+// the same label whatever the parameters seen by a store are and password is redacted if still there.
+func targetLabel(redactedUrl string) string {
+	u, err := url.Parse(redactedUrl)
+	if err != nil {
+		return redactedUrl
+	}
+	u.RawQuery = ""
+	return u.Redacted()
+}
+
+// Metrics records duration and errors of each operation made on next store.
+type Metrics struct {
+	next   Store
+	target string
+}
+
+// NewMetrics gives a store which records metrics of stores created by next, target label is the url of the store
+// with credentials and parameters removed.
+func NewMetrics(next Store) *Metrics {
+	return &Metrics{next: next}
+}
+
+func (m *Metrics) Creator() func(u *url.URL) (Store, error) {
+	return func(u *url.URL) (Store, error) {
+		store, err := m.next.Creator()(u)
+		if err != nil {
+			return nil, err
+		}
+		return &Metrics{next: store, target: targetLabel(RedactURL(u))}, nil
+	}
+}
+
+func (m *Metrics) WithActor(actor string) Store {
+	store := *m
+	store.next = AsActor(m.next, actor)
+	return &store
+}
+
+func (m *Metrics) Detect(u *url.URL) bool {
+	return m.next.Detect(u)
+}
+
+// observe records duration of an operation since start and counts err if any.
+func (m *Metrics) observe(op string, start time.Time, err error) {
+	storeOperationDuration.WithLabelValues(m.target, op).Observe(time.Since(start).Seconds())
+	if err != nil && !os.IsNotExist(err) {
+		storeOperationErrors.WithLabelValues(m.target, op).Inc()
+	}
+}
+
+func (m *Metrics) Create(incident models.Incident) (models.Incident, error) {
+	start := time.Now()
+	ret, err := m.next.Create(incident)
+	m.observe(OpCreate, start, err)
+	return ret, err
+}
+
+func (m *Metrics) Update(guid string, incident models.Incident) (models.Incident, error) {
+	start := time.Now()
+	ret, err := m.next.Update(guid, incident)
+	m.observe(OpUpdate, start, err)
+	return ret, err
+}
+
+func (m *Metrics) UpdateIfVersion(guid string, version int, incident models.Incident) (models.Incident, error) {
+	start := time.Now()
+	ret, err := m.next.UpdateIfVersion(guid, version, incident)
+	m.observe(OpUpdateIfVersion, start, err)
+	return ret, err
+}
+
+func (m *Metrics) Delete(guid string) error {
+	start := time.Now()
+	err := m.next.Delete(guid)
+	m.observe(OpDelete, start, err)
+	return err
+}
+
+func (m *Metrics) Read(guid string) (models.Incident, error) {
+	start := time.Now()
+	ret, err := m.next.Read(guid)
+	m.observe(OpRead, start, err)
+	return ret, err
+}
+
+func (m *Metrics) ByDate(from, to time.Time) ([]models.Incident, error) {
+	start := time.Now()
+	ret, err := m.next.ByDate(from, to)
+	m.observe(OpByDate, start, err)
+	return ret, err
+}
+
+func (m *Metrics) Persistents() ([]models.Incident, error) {
+	start := time.Now()
+	ret, err := m.next.Persistents()
+	m.observe(OpPersistents, start, err)
+	return ret, err
+}
+
+func (m *Metrics) Query(query IncidentQuery) (IncidentPage, error) {
+	start := time.Now()
+	ret, err := m.next.Query(query)
+	m.observe(OpQuery, start, err)
+	return ret, err
+}
+
+func (m *Metrics) AddRevision(revision models.Revision) error {
+	start := time.Now()
+	err := m.next.AddRevision(revision)
+	m.observe(OpAddRevision, start, err)
+	return err
+}
+
+func (m *Metrics) Revisions(incidentGuid string) ([]models.Revision, error) {
+	start := time.Now()
+	ret, err := m.next.Revisions(incidentGuid)
+	m.observe(OpRevisions, start, err)
+	return ret, err
+}
+
+func (m *Metrics) ReplaceRevisions(change func(revision models.Revision) (models.Revision, error)) error {
+	start := time.Now()
+	err := m.next.ReplaceRevisions(change)
+	m.observe(OpReplaceRevisions, start, err)
+	return err
+}
+
+func (m *Metrics) AddTrashed(trashed models.TrashedIncident) error {
+	start := time.Now()
+	err := m.next.AddTrashed(trashed)
+	m.observe(OpAddTrashed, start, err)
+	return err
+}
+
+func (m *Metrics) Trashed() ([]models.TrashedIncident, error) {
+	start := time.Now()
+	ret, err := m.next.Trashed()
+	m.observe(OpTrashed, start, err)
+	return ret, err
+}
+
+func (m *Metrics) DeleteTrashed(guid string) error {
+	start := time.Now()
+	err := m.next.DeleteTrashed(guid)
+	m.observe(OpDeleteTrashed, start, err)
+	return err
+}
+
+func (m *Metrics) Subscribe(email string) error {
+	start := time.Now()
+	err := m.next.Subscribe(email)
+	m.observe(OpSubscribe, start, err)
+	return err
+}
+
+func (m *Metrics) Unsubscribe(email string) error {
+	start := time.Now()
+	err := m.next.Unsubscribe(email)
+	m.observe(OpUnsubscribe, start, err)
+	return err
+}
+
+func (m *Metrics) Subscribers() ([]string, error) {
+	start := time.Now()
+	ret, err := m.next.Subscribers()
+	m.observe(OpSubscribers, start, err)
+	return ret, err
+}
+
+func (m *Metrics) Ping() error {
+	start := time.Now()
+	err := m.next.Ping()
+	m.observe(OpPing, start, err)
+	return err
+}
@@ -0,0 +1,249 @@
+package storages
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/common"
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+)
+
+// MigrateOptions tunes a migration of data from a store to another.
+type MigrateOptions struct {
+	// From and To delimit creation date of incidents to migrate, persistent incidents are always migrated
+	From time.Time
+	To   time.Time
+	// DryRun only reports what would be done without writing in destination
+	DryRun bool
+}
+
+// MigrateReport sums up what has been (or would be in dry run) done by a migration.
+type MigrateReport struct {
+	Incidents        int `json:"incidents"`
+	Created          int `json:"created"`
+	Updated          int `json:"updated"`
+	UpToDate         int `json:"up_to_date"`
+	Subscribers      int `json:"subscribers"`
+	SubscribersAdded int `json:"subscribers_added"`
+	Errors           int `json:"errors"`
+}
+
+func (r MigrateReport) String() string {
+	return fmt.Sprintf(
+		"%d incident(s): %d created, %d updated, %d already up to date; %d subscriber(s): %d added; %d error(s)",
+		r.Incidents, r.Created, r.Updated, r.UpToDate, r.Subscribers, r.SubscribersAdded, r.Errors,
+	)
+}
+
+// migratePageSize is the number of incidents read at once from source during a migration.
+const migratePageSize = 100
+
+// Migrate copies incidents, persistent incidents and subscribers from src to dst.
+// Migration can be run multiple times, incidents already in dst are only updated when fresher in src
+// and subscribers already in dst are left untouched.
+// Incidents are read and written page by page to never load all incidents of src in memory.
+func Migrate(src, dst Store, opts MigrateOptions) (MigrateReport, error) {
+	var report MigrateReport
+	var result error
+	err := eachMigrationIncident(src, opts, func(incident models.Incident) {
+		result = migrateIncident(incident, dst, opts.DryRun, &report, result)
+	})
+	if err != nil {
+		return report, multierror.Append(result, fmt.Errorf("could not read incidents from source: %s", err.Error()))
+	}
+	subs, err := src.Subscribers()
+	if err != nil {
+		return report, multierror.Append(result, fmt.Errorf("could not read subscribers from source: %s", err.Error()))
+	}
+	return report, migrateSubscribers(subs, dst, opts.DryRun, &report, result)
+}
+
+// copyData writes incidents and subscribers in dst, incidents already in dst are only updated when fresher.
+func copyData(incidents []models.Incident, subs []string, dst Store, dryRun bool) (MigrateReport, error) {
+	var report MigrateReport
+	var result error
+	for _, incident := range incidents {
+		result = migrateIncident(incident, dst, dryRun, &report, result)
+	}
+	return report, migrateSubscribers(subs, dst, dryRun, &report, result)
+}
+
+// migrateIncident writes incident in dst if missing or stale there, report is updated
+// and error, if any, is appended to result.
+func migrateIncident(incident models.Incident, dst Store, dryRun bool, report *MigrateReport, result error) error {
+	report.Incidents++
+	entry := log.WithField("guid", incident.GUID)
+	stored, found, err := readIfExists(dst, incident.GUID)
+	if err != nil {
+		report.Errors++
+		return multierror.Append(result, fmt.Errorf("incident %s: %s", incident.GUID, err.Error()))
+	}
+	if found && !isFresher(incident, stored) {
+		report.UpToDate++
+		entry.Debug("Incident already up to date in destination")
+		return result
+	}
+	if found {
+		report.Updated++
+		entry.Info("Updating incident in destination")
+	} else {
+		report.Created++
+		entry.Info("Creating incident in destination")
+	}
+	if dryRun {
+		return result
+	}
+	if found {
+		_, err = dst.Update(incident.GUID, incident)
+	} else {
+		_, err = dst.Create(incident)
+	}
+	if err != nil {
+		report.Errors++
+		return multierror.Append(result, fmt.Errorf("incident %s: %s", incident.GUID, err.Error()))
+	}
+	return result
+}
+
+// migrateSubscribers adds in dst subscribers missing there, report is updated and errors are appended to result.
+func migrateSubscribers(subs []string, dst Store, dryRun bool, report *MigrateReport, result error) error {
+	dstSubs, err := dst.Subscribers()
+	if err != nil {
+		return multierror.Append(result, fmt.Errorf("could not read subscribers from destination: %s", err.Error()))
+	}
+	for _, sub := range subs {
+		report.Subscribers++
+		if common.InStrSlice(sub, dstSubs) {
+			continue
+		}
+		report.SubscribersAdded++
+		log.Debug("Adding subscriber in destination")
+		if dryRun {
+			continue
+		}
+		err = dst.Subscribe(sub)
+		if err != nil {
+			report.Errors++
+			result = multierror.Append(result, fmt.Errorf("subscriber: %s", err.Error()))
+		}
+	}
+	return result
+}
+
+// VerifyMigration checks that every incident and subscriber of src migrated with opts is in dst
+// with at least the same freshness.
+func VerifyMigration(src, dst Store, opts MigrateOptions) error {
+	var result error
+	err := eachMigrationIncident(src, opts, func(incident models.Incident) {
+		stored, found, err := readIfExists(dst, incident.GUID)
+		if err != nil {
+			result = multierror.Append(result, fmt.Errorf("incident %s: %s", incident.GUID, err.Error()))
+			return
+		}
+		if !found {
+			result = multierror.Append(result, fmt.Errorf("incident %s: missing in destination", incident.GUID))
+			return
+		}
+		if isFresher(incident, stored) {
+			result = multierror.Append(result, fmt.Errorf("incident %s: stale in destination", incident.GUID))
+		}
+	})
+	if err != nil {
+		return multierror.Append(result, fmt.Errorf("could not read incidents from source: %s", err.Error()))
+	}
+
+	subs, err := src.Subscribers()
+	if err != nil {
+		return multierror.Append(result, fmt.Errorf("could not read subscribers from source: %s", err.Error()))
+	}
+	dstSubs, err := dst.Subscribers()
+	if err != nil {
+		return multierror.Append(result, fmt.Errorf("could not read subscribers from destination: %s", err.Error()))
+	}
+	missing := 0
+	for _, sub := range subs {
+		if !common.InStrSlice(sub, dstSubs) {
+			missing++
+		}
+	}
+	if missing > 0 {
+		result = multierror.Append(result, fmt.Errorf("%d subscriber(s) missing in destination", missing))
+	}
+	return result
+}
+
+// allTimeOptions gives options to migrate incidents whatever their creation date.
+func allTimeOptions() MigrateOptions {
+	return MigrateOptions{
+		From: time.Unix(0, 0),
+		To:   time.Now().AddDate(100, 0, 0),
+	}
+}
+
+// migrationIncidents gives incidents and persistent incidents of store, each incident only once.
+func migrationIncidents(store Store, opts MigrateOptions) ([]models.Incident, error) {
+	final := make([]models.Incident, 0)
+	err := eachMigrationIncident(store, opts, func(incident models.Incident) {
+		final = append(final, incident)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return final, nil
+}
+
+// eachMigrationIncident calls fn on each incident created between opts.From and opts.To and on each
+// persistent incident of store, each incident only once.
+// Incidents are read page by page with Query, only persistent incidents are read at once.
+func eachMigrationIncident(store Store, opts MigrateOptions, fn func(incident models.Incident)) error {
+	seen := make(map[string]bool)
+	query := IncidentQuery{
+		From:  opts.From,
+		To:    opts.To,
+		Limit: migratePageSize,
+	}
+	for {
+		page, err := store.Query(query)
+		if err != nil {
+			return err
+		}
+		for _, incident := range page.Incidents {
+			if seen[incident.GUID] {
+				continue
+			}
+			seen[incident.GUID] = true
+			fn(incident)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+	persistents, err := store.Persistents()
+	if err != nil {
+		return err
+	}
+	for _, incident := range persistents {
+		if seen[incident.GUID] {
+			continue
+		}
+		seen[incident.GUID] = true
+		fn(incident)
+	}
+	return nil
+}
+
+func readIfExists(store Store, guid string) (models.Incident, bool, error) {
+	incident, err := store.Read(guid)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return models.Incident{}, false, nil
+		}
+		return models.Incident{}, false, err
+	}
+	return incident, incident.GUID == guid, nil
+}
@@ -0,0 +1,135 @@
+package storages_test
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+	"github.com/orange-cloudfoundry/statusetat/v2/storages"
+	"github.com/orange-cloudfoundry/statusetat/v2/storages/storagesfakes"
+	"github.com/orange-cloudfoundry/statusetat/v2/utils"
+)
+
+var _ = Describe("Migrate", func() {
+	var src storages.Store
+	var dst storages.Store
+	var opts storages.MigrateOptions
+	tmpDirSrc := filepath.Join(os.TempDir(), "statusetat-test-migrate")
+	now := time.Now().UTC().Truncate(time.Second)
+	BeforeEach(func() {
+		var err error
+		u, _ := url.Parse("file://" + tmpDirSrc)
+		src, err = (&storages.Local{}).Creator()(u)
+		Expect(err).ToNot(HaveOccurred())
+		u, _ = url.Parse("sqlite://:memory:")
+		dst, err = (&storages.DB{}).Creator()(u)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = src.Create(models.Incident{GUID: "inc1", CreatedAt: now.Add(-time.Hour), UpdatedAt: now})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = src.Create(models.Incident{GUID: "inc2", CreatedAt: now.Add(-2 * time.Hour), UpdatedAt: now})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = src.Create(models.Incident{GUID: "persistent", CreatedAt: now.Add(-48 * time.Hour), UpdatedAt: now, Persistent: true})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(src.Subscribe("email@local")).To(Succeed())
+
+		opts = storages.MigrateOptions{
+			From: now.Add(-24 * time.Hour),
+			To:   now.Add(24 * time.Hour),
+		}
+	})
+	AfterEach(func() {
+		utils.RemoveDir(tmpDirSrc)
+	})
+	It("should read incidents from source page by page", func() {
+		memory := storages.NewMemory()
+		for i := 0; i < 250; i++ {
+			_, err := memory.Create(models.Incident{GUID: fmt.Sprintf("inc%d", i), CreatedAt: now.Add(-time.Duration(i) * time.Minute), UpdatedAt: now})
+			Expect(err).ToNot(HaveOccurred())
+		}
+		pagedSrc := &storagesfakes.FakeStore{}
+		pagedSrc.QueryStub = memory.Query
+		pagedSrc.PersistentsStub = memory.Persistents
+		pagedSrc.SubscribersStub = memory.Subscribers
+
+		report, err := storages.Migrate(pagedSrc, dst, opts)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Created).To(Equal(250))
+		Expect(pagedSrc.QueryCallCount()).To(Equal(3))
+		Expect(pagedSrc.QueryArgsForCall(0).Limit).To(Equal(100))
+		Expect(pagedSrc.ByDateCallCount()).To(Equal(0))
+	})
+	It("should copy incidents, persistent incidents and subscribers", func() {
+		report, err := storages.Migrate(src, dst, opts)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Incidents).To(Equal(3))
+		Expect(report.Created).To(Equal(3))
+		Expect(report.SubscribersAdded).To(Equal(1))
+
+		incidents, err := dst.ByDate(opts.From, opts.To)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(incidents).To(HaveLen(2))
+		persistents, err := dst.Persistents()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(persistents).To(HaveLen(1))
+		subs, err := dst.Subscribers()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(subs).To(ConsistOf("email@local"))
+
+		Expect(storages.VerifyMigration(src, dst, opts)).To(Succeed())
+	})
+	It("should only update stale incidents when run again", func() {
+		_, err := storages.Migrate(src, dst, opts)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = src.Update("inc1", models.Incident{GUID: "inc1", CreatedAt: now.Add(-time.Hour), UpdatedAt: now.Add(time.Minute)})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(storages.VerifyMigration(src, dst, opts)).ToNot(Succeed())
+
+		report, err := storages.Migrate(src, dst, opts)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Created).To(Equal(0))
+		Expect(report.Updated).To(Equal(1))
+		Expect(report.UpToDate).To(Equal(2))
+		Expect(report.SubscribersAdded).To(Equal(0))
+
+		Expect(storages.VerifyMigration(src, dst, opts)).To(Succeed())
+	})
+	It("should update incidents changed within the same second", func() {
+		_, err := storages.Migrate(src, dst, opts)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = src.Update("inc1", models.Incident{
+			GUID: "inc1", CreatedAt: now.Add(-time.Hour), UpdatedAt: now, Version: 1,
+			Messages: []models.Message{{GUID: "msg", Title: "a message", CreatedAt: now}},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(storages.VerifyMigration(src, dst, opts)).ToNot(Succeed())
+
+		report, err := storages.Migrate(src, dst, opts)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Updated).To(Equal(1))
+		inc, err := dst.Read("inc1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inc.Messages).To(HaveLen(1))
+		Expect(storages.VerifyMigration(src, dst, opts)).To(Succeed())
+	})
+	It("should not write anything on dry run", func() {
+		opts.DryRun = true
+		report, err := storages.Migrate(src, dst, opts)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Created).To(Equal(3))
+		Expect(report.SubscribersAdded).To(Equal(1))
+
+		incidents, err := dst.ByDate(opts.From, opts.To)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(incidents).To(BeEmpty())
+		Expect(storages.VerifyMigration(src, dst, opts)).ToNot(Succeed())
+	})
+})
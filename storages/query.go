@@ -0,0 +1,246 @@
+package storages
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/common"
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+)
+
+// IncidentQuery filters and paginates incidents given by Store.Query, zero values mean no filter.
+// As ByDate, persistent incidents are never given.
+// Incidents are ordered by creation date, most recent first, then by guid.
+type IncidentQuery struct {
+	// From and To delimit creation date of incidents (inclusive), no bound when zero
+	From time.Time
+	To   time.Time
+	// Components matches incidents affecting any of these components, in form of "group - name" or "name"
+	Components []string
+	// Groups matches incidents affecting any component of these groups
+	Groups          []string
+	States          []models.IncidentState
+	ComponentStates []models.ComponentState
+	// Scheduled only matches scheduled maintenances when true or only incidents when false
+	Scheduled *bool
+	// ShownAsIncident only matches incidents shown as incidents when true or shown as maintenances when false,
+	// it is computed by models.Incident.ShouldBeIncident with DisableMaintenanceToIncident
+	ShownAsIncident              *bool
+	DisableMaintenanceToIncident bool
+	// Text matches incidents having text in title or content of one of their messages, case is ignored
+	Text string
+	// Limit is the maximum number of incidents in a page, no limit when 0
+	Limit int
+	// Offset skips first incidents, it can't be used with Cursor
+	Offset int
+	// Cursor is the NextCursor of the previous page
+	Cursor string
+}
+
+// IncidentPage is a page of incidents matching an IncidentQuery,
+// NextCursor is only set when there is more incidents to read.
+type IncidentPage struct {
+	Incidents  []models.Incident `json:"incidents"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+}
+
+type queryCursor struct {
+	createdAt time.Time
+	guid      string
+}
+
+func encodeCursor(incident models.Incident) string {
+	raw := fmt.Sprintf("%d/%s", incident.CreatedAt.UnixNano(), incident.GUID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (*queryCursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	split := strings.SplitN(string(raw), "/", 2)
+	if len(split) != 2 {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	nano, err := strconv.ParseInt(split[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &queryCursor{createdAt: time.Unix(0, nano), guid: split[1]}, nil
+}
+
+// after tells if incident comes after cursor in query order.
+func (c *queryCursor) after(incident models.Incident) bool {
+	if c == nil {
+		return true
+	}
+	if incident.CreatedAt.Equal(c.createdAt) {
+		return incident.GUID < c.guid
+	}
+	return incident.CreatedAt.Before(c.createdAt)
+}
+
+func (q IncidentQuery) Validate() error {
+	if q.Limit < 0 || q.Offset < 0 {
+		return fmt.Errorf("limit and offset can't be negative")
+	}
+	if q.Offset > 0 && q.Cursor != "" {
+		return fmt.Errorf("offset and cursor can't be used together")
+	}
+	_, err := decodeCursor(q.Cursor)
+	return err
+}
+
+// componentsFilter gives components of query parsed in groups and names.
+func (q IncidentQuery) componentsFilter() models.Components {
+	components := make(models.Components, len(q.Components))
+	for i, c := range q.Components {
+		split := strings.SplitN(c, " - ", 2)
+		if len(split) == 1 {
+			components[i] = models.Component{Name: split[0]}
+			continue
+		}
+		components[i] = models.Component{Group: split[0], Name: split[1]}
+	}
+	return components
+}
+
+// Match tells if incident matches all filters of query, pagination is not taken in account.
+func (q IncidentQuery) Match(incident models.Incident) bool {
+	if incident.Persistent {
+		return false
+	}
+	if !q.From.IsZero() && incident.CreatedAt.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && incident.CreatedAt.After(q.To) {
+		return false
+	}
+	if q.Scheduled != nil && incident.IsScheduled != *q.Scheduled {
+		return false
+	}
+	if q.ShownAsIncident != nil && incident.ShouldBeIncident(q.DisableMaintenanceToIncident) != *q.ShownAsIncident {
+		return false
+	}
+	if len(q.States) > 0 && !incidentStateIn(incident.State, q.States) {
+		return false
+	}
+	if len(q.ComponentStates) > 0 && !componentStateIn(incident.ComponentState, q.ComponentStates) {
+		return false
+	}
+	if len(q.Components) > 0 && !q.matchComponents(incident) {
+		return false
+	}
+	if len(q.Groups) > 0 && !q.matchGroups(incident) {
+		return false
+	}
+	if q.Text != "" && !q.matchText(incident) {
+		return false
+	}
+	return true
+}
+
+func (q IncidentQuery) matchComponents(incident models.Incident) bool {
+	if incident.Components == nil {
+		return false
+	}
+	filter := q.componentsFilter()
+	for _, component := range *incident.Components {
+		for _, wanted := range filter {
+			if component.Group == wanted.Group && component.Name == wanted.Name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (q IncidentQuery) matchGroups(incident models.Incident) bool {
+	if incident.Components == nil {
+		return false
+	}
+	for _, component := range *incident.Components {
+		if common.InStrSlice(component.Group, q.Groups) {
+			return true
+		}
+	}
+	return false
+}
+
+func (q IncidentQuery) matchText(incident models.Incident) bool {
+	text := strings.ToLower(q.Text)
+	for _, msg := range incident.Messages {
+		if strings.Contains(strings.ToLower(msg.Title), text) || strings.Contains(strings.ToLower(msg.Content), text) {
+			return true
+		}
+	}
+	return false
+}
+
+func incidentStateIn(state models.IncidentState, states []models.IncidentState) bool {
+	for _, s := range states {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+func componentStateIn(state models.ComponentState, states []models.ComponentState) bool {
+	for _, s := range states {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+// sortQueryOrder sorts incidents in query order, most recent first then by guid descending.
+func sortQueryOrder(incidents []models.Incident) {
+	sort.SliceStable(incidents, func(i, j int) bool {
+		if incidents[i].CreatedAt.Equal(incidents[j].CreatedAt) {
+			return incidents[i].GUID > incidents[j].GUID
+		}
+		return incidents[i].CreatedAt.After(incidents[j].CreatedAt)
+	})
+}
+
+// queryIncidents applies query on incidents already loaded, it is used by stores which can't filter natively.
+func queryIncidents(incidents []models.Incident, q IncidentQuery) (IncidentPage, error) {
+	cursor, err := decodeCursor(q.Cursor)
+	if err != nil {
+		return IncidentPage{}, err
+	}
+	matched := make([]models.Incident, 0)
+	for _, incident := range incidents {
+		if q.Match(incident) && cursor.after(incident) {
+			sort.Sort(models.Messages(incident.Messages))
+			matched = append(matched, incident)
+		}
+	}
+	sortQueryOrder(matched)
+	return paginate(matched, q), nil
+}
+
+// paginate gives page of already filtered and sorted incidents.
+func paginate(incidents []models.Incident, q IncidentQuery) IncidentPage {
+	if q.Offset >= len(incidents) {
+		return IncidentPage{Incidents: []models.Incident{}}
+	}
+	incidents = incidents[q.Offset:]
+	if q.Limit == 0 || len(incidents) <= q.Limit {
+		return IncidentPage{Incidents: incidents}
+	}
+	return IncidentPage{
+		Incidents:  incidents[:q.Limit],
+		NextCursor: encodeCursor(incidents[q.Limit-1]),
+	}
+}
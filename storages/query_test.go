@@ -0,0 +1,211 @@
+package storages_test
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+	"github.com/orange-cloudfoundry/statusetat/v2/storages"
+	"github.com/orange-cloudfoundry/statusetat/v2/utils"
+)
+
+var _ = Describe("Query", func() {
+	tmpDirQuery := filepath.Join(os.TempDir(), "statusetat-test-query")
+	base := time.Date(2024, time.March, 10, 10, 0, 0, 0, time.UTC)
+	scheduled := true
+	notScheduled := false
+	nbDb := 0
+
+	storeBuilders := map[string]func() storages.Store{
+		"sqlite": func() storages.Store {
+			u, _ := url.Parse("sqlite://:memory:")
+			store, err := (&storages.DB{}).Creator()(u)
+			Expect(err).ToNot(HaveOccurred())
+			return store
+		},
+		"local": func() storages.Store {
+			u, _ := url.Parse("file://" + filepath.Join(tmpDirQuery, "local"))
+			store, err := (&storages.Local{}).Creator()(u)
+			Expect(err).ToNot(HaveOccurred())
+			return store
+		},
+		"bolt": func() storages.Store {
+			// each test has its own database as bolt lock database file until process ends
+			nbDb++
+			u, _ := url.Parse(fmt.Sprintf("bolt://%s/store-%d.db", tmpDirQuery, nbDb))
+			store, err := (&storages.Bolt{}).Creator()(u)
+			Expect(err).ToNot(HaveOccurred())
+			return store
+		},
+		"s3": func() storages.Store {
+			if caBundle, ok := os.LookupEnv("AWS_CA_BUNDLE"); ok {
+				Expect(os.Unsetenv("AWS_CA_BUNDLE")).To(Succeed())
+				DeferCleanup(os.Setenv, "AWS_CA_BUNDLE", caBundle)
+			}
+			backend := s3mem.New()
+			Expect(backend.CreateBucket("statusetat")).To(Succeed())
+			server := httptest.NewTLSServer(gofakes3.New(backend).Server())
+			DeferCleanup(server.Close)
+			store, err := newS3Store("s3://key:secret@" + strings.TrimPrefix(server.URL, "https://") + "/statusetat?insecure-skip-verify=true")
+			Expect(err).ToNot(HaveOccurred())
+			return store
+		},
+	}
+
+	for name, builder := range storeBuilders {
+		name, builder := name, builder
+		Context(fmt.Sprintf("with %s store", name), func() {
+			var store storages.Store
+			BeforeEach(func() {
+				store = builder()
+				for i, inc := range []models.Incident{
+					{GUID: "inc0", State: models.Resolved, ComponentState: models.MajorOutage,
+						Components: &models.Components{{Group: "paas", Name: "api"}},
+						Messages:   []models.Message{{GUID: "msg0", Title: "Api is down", Content: "we are investigating"}}},
+					{GUID: "inc1", State: models.Unresolved, ComponentState: models.PartialOutage,
+						Components: &models.Components{{Group: "paas", Name: "router"}},
+						Messages:   []models.Message{{GUID: "msg1", Title: "Router errors", Content: "some 502 answers"}}},
+					{GUID: "inc2", State: models.Unresolved, ComponentState: models.UnderMaintenance, IsScheduled: true,
+						Components: &models.Components{{Group: "iaas", Name: "network"}},
+						Messages:   []models.Message{{GUID: "msg2", Title: "Network upgrade", Content: "api may be slow"}}},
+					{GUID: "inc3", State: models.Monitoring, ComponentState: models.DegradedPerformance,
+						Components: &models.Components{{Name: "dns"}},
+						Messages:   []models.Message{{GUID: "msg3", Title: "Slow dns", Content: "resolution is slow"}}},
+					{GUID: "persistent", Persistent: true,
+						Components: &models.Components{{Group: "paas", Name: "api"}}},
+				} {
+					inc.CreatedAt = base.AddDate(0, i, 0)
+					inc.UpdatedAt = inc.CreatedAt
+					_, err := store.Create(inc)
+					Expect(err).ToNot(HaveOccurred())
+				}
+			})
+			AfterEach(func() {
+				utils.RemoveDir(tmpDirQuery)
+			})
+			guids := func(page storages.IncidentPage) []string {
+				result := make([]string, len(page.Incidents))
+				for i, incident := range page.Incidents {
+					result[i] = incident.GUID
+				}
+				return result
+			}
+
+			It("should give all incidents most recent first without persistent ones", func() {
+				page, err := store.Query(storages.IncidentQuery{})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(guids(page)).To(Equal([]string{"inc3", "inc2", "inc1", "inc0"}))
+				Expect(page.NextCursor).To(BeEmpty())
+			})
+			It("should filter by date", func() {
+				page, err := store.Query(storages.IncidentQuery{From: base.AddDate(0, 1, 0), To: base.AddDate(0, 2, 0)})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(guids(page)).To(Equal([]string{"inc2", "inc1"}))
+			})
+			It("should filter by components and groups", func() {
+				page, err := store.Query(storages.IncidentQuery{Components: []string{"paas - api", "dns"}})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(guids(page)).To(Equal([]string{"inc3", "inc0"}))
+
+				page, err = store.Query(storages.IncidentQuery{Groups: []string{"paas"}})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(guids(page)).To(Equal([]string{"inc1", "inc0"}))
+			})
+			It("should filter by states", func() {
+				page, err := store.Query(storages.IncidentQuery{States: []models.IncidentState{models.Unresolved}})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(guids(page)).To(Equal([]string{"inc2", "inc1"}))
+
+				page, err = store.Query(storages.IncidentQuery{
+					States:          []models.IncidentState{models.Unresolved},
+					ComponentStates: []models.ComponentState{models.PartialOutage, models.MajorOutage},
+				})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(guids(page)).To(Equal([]string{"inc1"}))
+			})
+			It("should filter by scheduled flag", func() {
+				page, err := store.Query(storages.IncidentQuery{Scheduled: &scheduled})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(guids(page)).To(Equal([]string{"inc2"}))
+
+				page, err = store.Query(storages.IncidentQuery{Scheduled: &notScheduled})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(guids(page)).To(Equal([]string{"inc3", "inc1", "inc0"}))
+			})
+			It("should filter incidents shown as maintenances before paginating", func() {
+				_, err := store.Create(models.Incident{
+					GUID: "maintenance", State: models.Unresolved, IsScheduled: true,
+					ScheduledEnd: time.Now().Add(24 * time.Hour),
+					CreatedAt:    base.AddDate(0, 2, 1),
+					UpdatedAt:    base.AddDate(0, 2, 1),
+				})
+				Expect(err).ToNot(HaveOccurred())
+				shownAsIncident := true
+				shownAsMaintenance := false
+
+				page, err := store.Query(storages.IncidentQuery{ShownAsIncident: &shownAsIncident, Limit: 2})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(guids(page)).To(Equal([]string{"inc3", "inc2"}))
+				page, err = store.Query(storages.IncidentQuery{ShownAsIncident: &shownAsIncident, Limit: 2, Cursor: page.NextCursor})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(guids(page)).To(Equal([]string{"inc1", "inc0"}))
+
+				page, err = store.Query(storages.IncidentQuery{ShownAsIncident: &shownAsMaintenance})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(guids(page)).To(Equal([]string{"maintenance"}))
+
+				page, err = store.Query(storages.IncidentQuery{ShownAsIncident: &shownAsMaintenance, DisableMaintenanceToIncident: true})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(guids(page)).To(Equal([]string{"maintenance"}))
+				page, err = store.Query(storages.IncidentQuery{ShownAsIncident: &shownAsIncident, DisableMaintenanceToIncident: true})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(guids(page)).To(Equal([]string{"inc3", "inc2", "inc1", "inc0"}))
+			})
+			It("should filter by text in messages ignoring case", func() {
+				page, err := store.Query(storages.IncidentQuery{Text: "API"})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(guids(page)).To(Equal([]string{"inc2", "inc0"}))
+
+				page, err = store.Query(storages.IncidentQuery{Text: "100%"})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(page.Incidents).To(BeEmpty())
+			})
+			It("should paginate with offset", func() {
+				page, err := store.Query(storages.IncidentQuery{Limit: 3, Offset: 2})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(guids(page)).To(Equal([]string{"inc1", "inc0"}))
+				Expect(page.NextCursor).To(BeEmpty())
+			})
+			It("should paginate with cursor", func() {
+				query := storages.IncidentQuery{Limit: 3}
+				page, err := store.Query(query)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(guids(page)).To(Equal([]string{"inc3", "inc2", "inc1"}))
+				Expect(page.NextCursor).ToNot(BeEmpty())
+
+				query.Cursor = page.NextCursor
+				page, err = store.Query(query)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(guids(page)).To(Equal([]string{"inc0"}))
+				Expect(page.NextCursor).To(BeEmpty())
+			})
+			It("should refuse invalid pagination", func() {
+				_, err := store.Query(storages.IncidentQuery{Cursor: "not a cursor"})
+				Expect(err).To(HaveOccurred())
+
+				_, err = store.Query(storages.IncidentQuery{Limit: 1, Offset: 1, Cursor: "MS9pbmMx"})
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	}
+})
@@ -0,0 +1,234 @@
+package storages
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/common"
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+)
+
+// ReadStrategy defines how Replicate reads data from its stores.
+type ReadStrategy string
+
+const (
+	// ReadFirstSuccess reads stores one after another, in targets order, and returns the first successful answer
+	ReadFirstSuccess ReadStrategy = "first-success"
+	// ReadFreshest reads all stores concurrently and merges answers, keeping the freshest copy of each incident
+	ReadFreshest ReadStrategy = "freshest"
+	// ReadQuorum works as ReadFreshest but only needs answers from a majority of stores
+	ReadQuorum ReadStrategy = "quorum"
+)
+
+func (r ReadStrategy) Validate() error {
+	switch r {
+	case "", ReadFirstSuccess, ReadFreshest, ReadQuorum:
+		return nil
+	}
+	return fmt.Errorf("unknown read strategy '%s', must be one of %s, %s or %s", r, ReadFirstSuccess, ReadFreshest, ReadQuorum)
+}
+
+type readResult[T any] struct {
+	// index is position of store in targets order
+	index    int
+	storeUrl string
+	value    T
+	err      error
+}
+
+// replicateRead reads from stores of m according to its read strategy,
+// merge is used to build a single answer from all answers received, they are given in targets order.
+func replicateRead[T any](m *Replicate, read func(s Store) (T, error), merge func(values []T) T) (T, error) {
+	stores := m.orderedStores()
+	var zero T
+	if len(stores) == 0 {
+		return zero, fmt.Errorf("no store available")
+	}
+
+	if m.readStrategy != ReadFreshest && m.readStrategy != ReadQuorum {
+		var err error
+		for _, s := range stores {
+			var value T
+			value, err = callWithTimeout(m.readTimeout, func() (T, error) {
+				return read(s.store)
+			})
+			m.targets.read(s.key, err)
+			if err != nil {
+				continue
+			}
+			return value, nil
+		}
+		return zero, err
+	}
+
+	need := len(stores)
+	if m.readStrategy == ReadQuorum {
+		need = len(stores)/2 + 1
+	}
+	results := make(chan readResult[T], len(stores))
+	for i, s := range stores {
+		go func(i int, s namedStore) {
+			value, err := callWithTimeout(m.readTimeout, func() (T, error) {
+				return read(s.store)
+			})
+			m.targets.read(s.key, err)
+			results <- readResult[T]{index: i, storeUrl: s.url, value: value, err: err}
+		}(i, s)
+	}
+
+	// data not found in a store is an answer of this store
+	answers := make([]readResult[T], 0, len(stores))
+	notFound := 0
+	var err error
+	for range stores {
+		result := <-results
+		if os.IsNotExist(result.err) {
+			notFound++
+		} else if result.err != nil {
+			log.WithField("url", result.storeUrl).Debugf("Could not read from store: %s", result.err.Error())
+			err = result.err
+			continue
+		} else {
+			answers = append(answers, result)
+		}
+		if m.readStrategy == ReadQuorum && len(answers)+notFound >= need {
+			break
+		}
+	}
+	sort.Slice(answers, func(i, j int) bool {
+		return answers[i].index < answers[j].index
+	})
+	values := make([]T, len(answers))
+	for i, answer := range answers {
+		values[i] = answer.value
+	}
+	if m.readStrategy == ReadQuorum && len(values)+notFound < need {
+		return zero, fmt.Errorf("read quorum not reached, %d store(s) answered on %d needed: %w", len(values)+notFound, need, err)
+	}
+	if len(values) == 0 {
+		if notFound > 0 {
+			return zero, os.ErrNotExist
+		}
+		return zero, err
+	}
+	return merge(values), nil
+}
+
+// callWithTimeout runs call and gives up waiting after timeout, call is not interrupted
+// and its result is discarded when it ends after timeout.
+func callWithTimeout[T any](timeout time.Duration, call func() (T, error)) (T, error) {
+	if timeout <= 0 {
+		return call()
+	}
+	results := make(chan readResult[T], 1)
+	go func() {
+		value, err := call()
+		results <- readResult[T]{value: value, err: err}
+	}()
+	select {
+	case result := <-results:
+		return result.value, result.err
+	case <-time.After(timeout):
+		var zero T
+		return zero, fmt.Errorf("store did not answer after %s", timeout)
+	}
+}
+
+// mergeFreshestIncident gives newest copy of incident, copy of first store in targets order wins ties.
+func mergeFreshestIncident(incidents []models.Incident) models.Incident {
+	freshest := incidents[0]
+	for _, incident := range incidents[1:] {
+		if isFresher(incident, freshest) {
+			freshest = incident
+		}
+	}
+	return freshest
+}
+
+func mergeFreshestIncidents(incidentsList [][]models.Incident) []models.Incident {
+	byGuid := make(map[string]models.Incident)
+	for _, incidents := range incidentsList {
+		for _, incident := range incidents {
+			current, ok := byGuid[incident.GUID]
+			if !ok || isFresher(incident, current) {
+				byGuid[incident.GUID] = incident
+			}
+		}
+	}
+	merged := make([]models.Incident, 0, len(byGuid))
+	for _, incident := range byGuid {
+		merged = append(merged, incident)
+	}
+	sort.Sort(models.Incidents(merged))
+	return merged
+}
+
+// mergeQueryPages merges pages answered by stores for query, stores have already applied offset and cursor.
+func mergeQueryPages(query IncidentQuery) func(pages []IncidentPage) IncidentPage {
+	return func(pages []IncidentPage) IncidentPage {
+		incidentsList := make([][]models.Incident, len(pages))
+		hasNext := false
+		for i, page := range pages {
+			incidentsList[i] = page.Incidents
+			hasNext = hasNext || page.NextCursor != ""
+		}
+		merged := mergeFreshestIncidents(incidentsList)
+		sortQueryOrder(merged)
+		query.Offset = 0
+		page := paginate(merged, query)
+		if page.NextCursor == "" && hasNext && len(page.Incidents) > 0 {
+			page.NextCursor = encodeCursor(page.Incidents[len(page.Incidents)-1])
+		}
+		return page
+	}
+}
+
+func mergeSubscribers(subsList [][]string) []string {
+	merged := make([]string, 0)
+	for _, subs := range subsList {
+		for _, sub := range subs {
+			if !common.InStrSlice(sub, merged) {
+				merged = append(merged, sub)
+			}
+		}
+	}
+	return merged
+}
+
+func mergeRevisions(revisionsList [][]models.Revision) []models.Revision {
+	byGuid := make(map[string]models.Revision)
+	for _, revisions := range revisionsList {
+		for _, revision := range revisions {
+			byGuid[revision.GUID] = revision
+		}
+	}
+	merged := make([]models.Revision, 0, len(byGuid))
+	for _, revision := range byGuid {
+		merged = append(merged, revision)
+	}
+	sort.Sort(models.Revisions(merged))
+	return merged
+}
+
+// mergeTrashed keeps most recently trashed copy of each incident.
+func mergeTrashed(trashedList [][]models.TrashedIncident) []models.TrashedIncident {
+	byGuid := make(map[string]models.TrashedIncident)
+	for _, trashed := range trashedList {
+		for _, t := range trashed {
+			if current, ok := byGuid[t.Incident.GUID]; ok && current.TrashedAt.After(t.TrashedAt) {
+				continue
+			}
+			byGuid[t.Incident.GUID] = t
+		}
+	}
+	merged := make([]models.TrashedIncident, 0, len(byGuid))
+	for _, t := range byGuid {
+		merged = append(merged, t)
+	}
+	sort.Sort(models.TrashedIncidents(merged))
+	return merged
+}
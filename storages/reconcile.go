@@ -0,0 +1,301 @@
+package storages
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/common"
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+)
+
+var (
+	reconcileDivergences = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "statusetat_replicate_divergences_total",
+		Help: "Number of divergences between replicated targets found by reconciliation.",
+	}, []string{"kind"})
+	reconcileErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "statusetat_replicate_reconcile_errors_total",
+		Help: "Number of errors encountered during reconciliation of replicated targets.",
+	})
+)
+
+func (m *Replicate) reconcileLoop() {
+	for {
+		if !m.sleep(m.reconcileInterval) {
+			return
+		}
+		err := m.Reconcile()
+		if err != nil {
+			log.Warningf("Reconciliation between targets finished with errors: %s", err.Error())
+		}
+	}
+}
+
+// Reconcile compares incidents and subscribers of all stores and pushes the freshest copy of
+// an incident (by Version then UpdatedAt) or missing subscribers to stale stores.
+// Incidents deleted and emails unsubscribed are removed from stores still having them instead of being copied back,
+// incidents deleted by other instances are known from trash of stores.
+// Data having records waiting to be replayed are skipped, replay will take care of them.
+func (m *Replicate) Reconcile() error {
+	pending := m.pendingKeys()
+	var result error
+	divergences := 0
+
+	nb, err := m.reconcileIncidents(pending)
+	divergences += nb
+	if err != nil {
+		result = multierror.Append(result, err)
+	}
+
+	nb, err = m.reconcileSubscribers(pending)
+	divergences += nb
+	if err != nil {
+		result = multierror.Append(result, err)
+	}
+
+	if divergences > 0 {
+		log.Infof("Reconciliation between targets done, %d divergence(s) found", divergences)
+	} else {
+		log.Debug("Reconciliation between targets done, no divergence found")
+	}
+	return result
+}
+
+func (m *Replicate) reconcileIncidents(pending map[string]bool) (int, error) {
+	var result error
+	now := time.Now()
+	from := now.Add(-m.reconcileWindow)
+
+	stores := make(map[string]namedStore)
+	byStore := make(map[string]map[string]models.Incident)
+	freshest := make(map[string]models.Incident)
+	trashedAt := make(map[string]time.Time)
+	for _, ns := range m.orderedStores() {
+		storeKey, storeUrl, s := ns.key, ns.url, ns.store
+		stores[storeKey] = ns
+		trashed, err := s.Trashed()
+		if err != nil {
+			reconcileErrors.Inc()
+			result = multierror.Append(result, fmt.Errorf("%s: %s", storeUrl, err.Error()))
+			continue
+		}
+		for _, t := range trashed {
+			if t.TrashedAt.After(trashedAt[t.Incident.GUID]) {
+				trashedAt[t.Incident.GUID] = t.TrashedAt
+			}
+		}
+		incidents, err := s.ByDate(from, now)
+		if err != nil {
+			reconcileErrors.Inc()
+			result = multierror.Append(result, fmt.Errorf("%s: %s", storeUrl, err.Error()))
+			continue
+		}
+		persistents, err := s.Persistents()
+		if err != nil {
+			reconcileErrors.Inc()
+			result = multierror.Append(result, fmt.Errorf("%s: %s", storeUrl, err.Error()))
+			continue
+		}
+		storeIncidents := make(map[string]models.Incident)
+		for _, incident := range append(incidents, persistents...) {
+			storeIncidents[incident.GUID] = incident
+			current, ok := freshest[incident.GUID]
+			if !ok || isFresher(incident, current) {
+				freshest[incident.GUID] = incident
+			}
+		}
+		byStore[storeKey] = storeIncidents
+	}
+
+	divergences := 0
+	for guid, incident := range freshest {
+		if pending[guid] {
+			continue
+		}
+		if m.incidentDeleted(incident) || trashedAfter(incident, trashedAt) {
+			divergences += m.removeDeleted(guid, stores, byStore, &result)
+			continue
+		}
+		for storeKey, storeIncidents := range byStore {
+			storeUrl, s := stores[storeKey].url, stores[storeKey].store
+			stored, ok := storeIncidents[guid]
+			if ok && !isFresher(incident, stored) {
+				continue
+			}
+			if !ok {
+				// incident may exist outside of window in this store
+				var err error
+				stored, err = s.Read(guid)
+				if err != nil && !os.IsNotExist(err) {
+					reconcileErrors.Inc()
+					result = multierror.Append(result, fmt.Errorf("%s: %s", storeUrl, err.Error()))
+					continue
+				}
+				ok = err == nil && stored.GUID == guid
+				if ok && !isFresher(incident, stored) {
+					continue
+				}
+			}
+
+			divergences++
+			reconcileDivergences.WithLabelValues("incident").Inc()
+			entry := log.WithField("guid", guid).WithField("url", storeUrl)
+			var err error
+			if ok {
+				entry.Warningf("Incident is stale in target (updated at %s instead of %s), pushing freshest copy", stored.UpdatedAt, incident.UpdatedAt)
+				_, err = s.Update(guid, incident)
+			} else {
+				entry.Warning("Incident is missing in target, pushing freshest copy")
+				_, err = s.Create(incident)
+			}
+			if err != nil {
+				reconcileErrors.Inc()
+				result = multierror.Append(result, fmt.Errorf("%s: %s", storeUrl, err.Error()))
+			}
+		}
+	}
+	return divergences, result
+}
+
+func (m *Replicate) reconcileSubscribers(pending map[string]bool) (int, error) {
+	var result error
+	stores := make(map[string]namedStore)
+	byStore := make(map[string][]string)
+	all := make([]string, 0)
+	for _, ns := range m.orderedStores() {
+		storeKey, storeUrl, s := ns.key, ns.url, ns.store
+		stores[storeKey] = ns
+		subs, err := s.Subscribers()
+		if err != nil {
+			reconcileErrors.Inc()
+			result = multierror.Append(result, fmt.Errorf("%s: %s", storeUrl, err.Error()))
+			continue
+		}
+		byStore[storeKey] = subs
+		for _, sub := range subs {
+			if !common.InStrSlice(sub, all) {
+				all = append(all, sub)
+			}
+		}
+	}
+
+	divergences := 0
+	for _, sub := range all {
+		if pending[sub] {
+			continue
+		}
+		if m.unsubscribed(sub) {
+			divergences += m.removeUnsubscribed(sub, stores, byStore, &result)
+			continue
+		}
+		for storeKey, subs := range byStore {
+			storeUrl, s := stores[storeKey].url, stores[storeKey].store
+			if common.InStrSlice(sub, subs) {
+				continue
+			}
+			divergences++
+			reconcileDivergences.WithLabelValues("subscriber").Inc()
+			log.WithField("url", storeUrl).Warning("Subscriber is missing in target, adding it")
+			err := s.Subscribe(sub)
+			if err != nil {
+				reconcileErrors.Inc()
+				result = multierror.Append(result, fmt.Errorf("%s: %s", storeUrl, err.Error()))
+			}
+		}
+	}
+	return divergences, result
+}
+
+// trashedAfter tells if incident has been moved to trash after this copy of it has been written,
+// trash is written in stores by the instance deleting incident so it is known by all instances.
+func trashedAfter(incident models.Incident, trashedAt map[string]time.Time) bool {
+	at, ok := trashedAt[incident.GUID]
+	return ok && !incident.UpdatedAt.After(at)
+}
+
+// removeDeleted deletes incident from stores still having a copy of it, it gives number of divergences found.
+func (m *Replicate) removeDeleted(guid string, stores map[string]namedStore, byStore map[string]map[string]models.Incident, result *error) int {
+	divergences := 0
+	for storeKey, storeIncidents := range byStore {
+		if _, ok := storeIncidents[guid]; !ok {
+			continue
+		}
+		divergences++
+		reconcileDivergences.WithLabelValues("deleted_incident").Inc()
+		ns := stores[storeKey]
+		log.WithField("guid", guid).WithField("url", ns.url).Warning("Incident has been deleted but is still in target, deleting it")
+		err := ns.store.Delete(guid)
+		if err != nil && !os.IsNotExist(err) {
+			reconcileErrors.Inc()
+			*result = multierror.Append(*result, fmt.Errorf("%s: %s", ns.url, err.Error()))
+		}
+	}
+	return divergences
+}
+
+// removeUnsubscribed unsubscribes email from stores still having it, it gives number of divergences found.
+func (m *Replicate) removeUnsubscribed(email string, stores map[string]namedStore, byStore map[string][]string, result *error) int {
+	divergences := 0
+	for storeKey, subs := range byStore {
+		if !common.InStrSlice(email, subs) {
+			continue
+		}
+		divergences++
+		reconcileDivergences.WithLabelValues("unsubscribed").Inc()
+		ns := stores[storeKey]
+		log.WithField("url", ns.url).Warning("Subscriber has been removed but is still in target, removing it")
+		err := ns.store.Unsubscribe(email)
+		if err != nil {
+			reconcileErrors.Inc()
+			*result = multierror.Append(*result, fmt.Errorf("%s: %s", ns.url, err.Error()))
+		}
+	}
+	return divergences
+}
+
+// pendingKeys gives incident guids and subscriber emails which have records waiting to be replayed.
+func (m *Replicate) pendingKeys() map[string]bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make(map[string]bool)
+	for _, record := range *m.records {
+		if record.deleted {
+			continue
+		}
+		if record.data != "" {
+			keys[record.data] = true
+		}
+		if record.incident.GUID != "" {
+			keys[record.incident.GUID] = true
+		}
+	}
+	return keys
+}
+
+// isFresher tells if incident is a newer copy than other, version is compared first as copies only differing
+// by a change made within the same second, or which did not change update date, have the same update date.
+// Update dates are then compared at full precision, except when one of them has been truncated to the second
+// by a database (e.g. mysql) and is the same second as the other, copies are then considered as equal.
+func isFresher(incident, other models.Incident) bool {
+	if incident.Version != other.Version {
+		return incident.Version > other.Version
+	}
+	if truncatedEqual(incident.UpdatedAt, other.UpdatedAt) {
+		return false
+	}
+	return incident.UpdatedAt.After(other.UpdatedAt)
+}
+
+// truncatedEqual tells if a or b has no fraction of second and both are in the same second.
+func truncatedEqual(a, b time.Time) bool {
+	if !a.Truncate(time.Second).Equal(b.Truncate(time.Second)) {
+		return false
+	}
+	return a.Nanosecond() == 0 || b.Nanosecond() == 0
+}
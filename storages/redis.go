@@ -0,0 +1,505 @@
+package storages
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+)
+
+const (
+	// redisPrefixParam is the prefix of all keys written, default to statusetat
+	redisPrefixParam = "prefix"
+	// redisResolvedTTLParam is the time after which resolved incidents expire, they never expire when not set
+	redisResolvedTTLParam = "resolved_ttl"
+
+	defaultRedisPrefix = "statusetat"
+)
+
+// Redis stores each incident in a hash, incidents are indexed by creation date in a sorted set
+// to serve ByDate, persistent incidents and subscribers are kept in sets.
+// Url is in form of redis://[user:password@]host:port[/db][?prefix=statusetat&resolved_ttl=720h],
+// use rediss:// for tls.
+type Redis struct {
+	client *redis.Client
+	prefix string
+	// resolvedTTL is the time after their last change after which resolved incidents expire, 0 to never expire
+	resolvedTTL time.Duration
+}
+
+func (r *Redis) Creator() func(u *url.URL) (Store, error) {
+	return func(u *url.URL) (Store, error) {
+		query := u.Query()
+		prefix := query.Get(redisPrefixParam)
+		if prefix == "" {
+			prefix = defaultRedisPrefix
+		}
+		var resolvedTTL time.Duration
+		if v := query.Get(redisResolvedTTLParam); v != "" {
+			var err error
+			resolvedTTL, err = time.ParseDuration(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %s", redisResolvedTTLParam, err.Error())
+			}
+		}
+		// remaining parameters are options of redis client (e.g. dial_timeout)
+		clientUrl := *u
+		query.Del(redisPrefixParam)
+		query.Del(redisResolvedTTLParam)
+		clientUrl.RawQuery = query.Encode()
+		opts, err := redis.ParseURL(clientUrl.String())
+		if err != nil {
+			return nil, err
+		}
+		return &Redis{
+			client:      redis.NewClient(opts),
+			prefix:      prefix,
+			resolvedTTL: resolvedTTL,
+		}, nil
+	}
+}
+
+func (r *Redis) Detect(u *url.URL) bool {
+	return u.Scheme == "redis" || u.Scheme == "rediss"
+}
+
+func (r *Redis) incidentKey(guid string) string {
+	return r.prefix + ":incident:" + guid
+}
+
+func (r *Redis) createdAtKey() string {
+	return r.prefix + ":incidents"
+}
+
+func (r *Redis) persistentsKey() string {
+	return r.prefix + ":persistents"
+}
+
+func (r *Redis) subscribersKey() string {
+	return r.prefix + ":subscribers"
+}
+
+func (r *Redis) revisionsKey(incidentGuid string) string {
+	return r.prefix + ":revisions:" + incidentGuid
+}
+
+func (r *Redis) trashKey() string {
+	return r.prefix + ":trash"
+}
+
+// redisScore gives score of a date in creation date index, microseconds are exact in a float64 score.
+func redisScore(t time.Time) float64 {
+	return float64(t.UnixMicro())
+}
+
+// redisRange gives bounds of creation date index for dates between from and to, zero dates are unbounded.
+func redisRange(from, to time.Time) *redis.ZRangeBy {
+	rangeBy := &redis.ZRangeBy{Min: "-inf", Max: "+inf"}
+	if !from.IsZero() {
+		rangeBy.Min = strconv.FormatFloat(math.Floor(redisScore(from)), 'f', -1, 64)
+	}
+	if !to.IsZero() {
+		rangeBy.Max = strconv.FormatFloat(redisScore(to), 'f', -1, 64)
+	}
+	return rangeBy
+}
+
+// isResolved tells if incident is finished and can expire,
+// idle is not a finished state: it is the state of a maintenance which has not started yet.
+func isResolved(incident models.Incident) bool {
+	return !incident.Persistent && (incident.State == models.Resolved || incident.State == models.Cancelled)
+}
+
+func incidentToHash(incident models.Incident) (map[string]interface{}, error) {
+	messages, err := json.Marshal(incident.Messages)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := json.Marshal(incident.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	components, err := json.Marshal(incident.Components)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"guid":            incident.GUID,
+		"created_at":      incident.CreatedAt.Format(time.RFC3339Nano),
+		"updated_at":      incident.UpdatedAt.Format(time.RFC3339Nano),
+		"state":           int(incident.State),
+		"component_state": int(incident.ComponentState),
+		"components":      components,
+		"messages":        messages,
+		"metadata":        metadata,
+		"is_scheduled":    incident.IsScheduled,
+		"scheduled_end":   incident.ScheduledEnd.Format(time.RFC3339Nano),
+		"origin":          incident.Origin,
+		"persistent":      incident.Persistent,
+		"version":         incident.Version,
+	}, nil
+}
+
+func hashToIncident(hash map[string]string) (models.Incident, error) {
+	incident := models.Incident{
+		GUID:   hash["guid"],
+		Origin: hash["origin"],
+	}
+	var err error
+	for field, dest := range map[string]*time.Time{
+		"created_at":    &incident.CreatedAt,
+		"updated_at":    &incident.UpdatedAt,
+		"scheduled_end": &incident.ScheduledEnd,
+	} {
+		*dest, err = time.Parse(time.RFC3339Nano, hash[field])
+		if err != nil {
+			return incident, fmt.Errorf("invalid %s of incident %s: %s", field, incident.GUID, err.Error())
+		}
+	}
+	for field, dest := range map[string]*int{
+		"state":           (*int)(&incident.State),
+		"component_state": (*int)(&incident.ComponentState),
+		"version":         &incident.Version,
+	} {
+		*dest, err = strconv.Atoi(hash[field])
+		if err != nil {
+			return incident, fmt.Errorf("invalid %s of incident %s: %s", field, incident.GUID, err.Error())
+		}
+	}
+	// booleans are written by redis client as 1 or 0
+	incident.IsScheduled = hash["is_scheduled"] == "1"
+	incident.Persistent = hash["persistent"] == "1"
+	for field, dest := range map[string]interface{}{
+		"components": &incident.Components,
+		"messages":   &incident.Messages,
+		"metadata":   &incident.Metadata,
+	} {
+		err = json.Unmarshal([]byte(hash[field]), dest)
+		if err != nil {
+			return incident, fmt.Errorf("invalid %s of incident %s: %s", field, incident.GUID, err.Error())
+		}
+	}
+	sort.Sort(models.Messages(incident.Messages))
+	return incident, nil
+}
+
+// removeIncident queues removal of incident and its index entries in pipe.
+func (r *Redis) removeIncident(ctx context.Context, pipe redis.Pipeliner, guid string) *redis.IntCmd {
+	pipe.ZRem(ctx, r.createdAtKey(), guid)
+	pipe.SRem(ctx, r.persistentsKey(), guid)
+	return pipe.Del(ctx, r.incidentKey(guid))
+}
+
+// putIncident writes incident in place of incident oldGuid.
+func (r *Redis) putIncident(oldGuid string, incident models.Incident) error {
+	hash, err := incidentToHash(incident)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		r.queuePutIncident(ctx, pipe, oldGuid, incident, hash)
+		return nil
+	})
+	return err
+}
+
+// queuePutIncident queues write of incident, as hash, in place of incident oldGuid in pipe.
+func (r *Redis) queuePutIncident(ctx context.Context, pipe redis.Pipeliner, oldGuid string, incident models.Incident, hash map[string]interface{}) {
+	// incident may move between persistents and incidents or change of creation date,
+	// hash is recreated to never keep an expiration set before
+	if oldGuid != incident.GUID {
+		r.removeIncident(ctx, pipe, oldGuid)
+	}
+	r.removeIncident(ctx, pipe, incident.GUID)
+	pipe.HSet(ctx, r.incidentKey(incident.GUID), hash)
+	if incident.Persistent {
+		pipe.SAdd(ctx, r.persistentsKey(), incident.GUID)
+	} else {
+		pipe.ZAdd(ctx, r.createdAtKey(), redis.Z{Score: redisScore(incident.CreatedAt), Member: incident.GUID})
+	}
+	if r.resolvedTTL > 0 && isResolved(incident) {
+		pipe.Expire(ctx, r.incidentKey(incident.GUID), r.resolvedTTL)
+		pipe.Expire(ctx, r.revisionsKey(incident.GUID), r.resolvedTTL)
+	} else {
+		pipe.Persist(ctx, r.revisionsKey(incident.GUID))
+	}
+}
+
+// readIncidents gives incidents of guids in the same order, incidents which expired are
+// removed from indexes and not given.
+func (r *Redis) readIncidents(guids []string) ([]models.Incident, error) {
+	ctx := context.Background()
+	cmds := make([]*redis.MapStringStringCmd, len(guids))
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, guid := range guids {
+			cmds[i] = pipe.HGetAll(ctx, r.incidentKey(guid))
+		}
+		return nil
+	})
+	if err != nil {
+		return []models.Incident{}, err
+	}
+	incidents := make([]models.Incident, 0, len(guids))
+	expired := make([]interface{}, 0)
+	for i, cmd := range cmds {
+		if len(cmd.Val()) == 0 {
+			expired = append(expired, guids[i])
+			continue
+		}
+		incident, err := hashToIncident(cmd.Val())
+		if err != nil {
+			return []models.Incident{}, err
+		}
+		incidents = append(incidents, incident)
+	}
+	if len(expired) > 0 {
+		_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.ZRem(ctx, r.createdAtKey(), expired...)
+			pipe.SRem(ctx, r.persistentsKey(), expired...)
+			return nil
+		})
+		if err != nil {
+			return []models.Incident{}, err
+		}
+	}
+	return incidents, nil
+}
+
+// between gives incidents created between from and to, zero dates are unbounded.
+func (r *Redis) between(from, to time.Time) ([]models.Incident, error) {
+	guids, err := r.client.ZRangeByScore(context.Background(), r.createdAtKey(), redisRange(from, to)).Result()
+	if err != nil {
+		return []models.Incident{}, err
+	}
+	incidents, err := r.readIncidents(guids)
+	if err != nil {
+		return []models.Incident{}, err
+	}
+	// scores are rounded to microseconds, exact dates are checked
+	finalIncidents := make([]models.Incident, 0, len(incidents))
+	for _, incident := range incidents {
+		if (!from.IsZero() && incident.CreatedAt.Before(from)) || (!to.IsZero() && incident.CreatedAt.After(to)) {
+			continue
+		}
+		finalIncidents = append(finalIncidents, incident)
+	}
+	return finalIncidents, nil
+}
+
+func (r *Redis) Create(incident models.Incident) (models.Incident, error) {
+	return incident, r.putIncident(incident.GUID, incident)
+}
+
+func (r *Redis) Update(guid string, incident models.Incident) (models.Incident, error) {
+	return incident, r.putIncident(guid, incident)
+}
+
+// UpdateIfVersion watches incident while checking its version, transaction fails if it is changed before write.
+func (r *Redis) UpdateIfVersion(guid string, version int, incident models.Incident) (models.Incident, error) {
+	hash, err := incidentToHash(incident)
+	if err != nil {
+		return incident, err
+	}
+	ctx := context.Background()
+	err = r.client.Watch(ctx, func(tx *redis.Tx) error {
+		current, err := tx.HGet(ctx, r.incidentKey(guid), "version").Result()
+		if errors.Is(err, redis.Nil) {
+			return os.ErrNotExist
+		}
+		if err != nil {
+			return err
+		}
+		if current != strconv.Itoa(version) {
+			return ErrVersionConflict
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			r.queuePutIncident(ctx, pipe, guid, incident, hash)
+			return nil
+		})
+		return err
+	}, r.incidentKey(guid))
+	if errors.Is(err, redis.TxFailedErr) {
+		err = ErrVersionConflict
+	}
+	return incident, err
+}
+
+func (r *Redis) Delete(guid string) error {
+	ctx := context.Background()
+	var del *redis.IntCmd
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		del = r.removeIncident(ctx, pipe, guid)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if del.Val() == 0 {
+		return os.ErrNotExist
+	}
+	return nil
+}
+
+func (r *Redis) Read(guid string) (models.Incident, error) {
+	hash, err := r.client.HGetAll(context.Background(), r.incidentKey(guid)).Result()
+	if err != nil {
+		return models.Incident{}, err
+	}
+	if len(hash) == 0 {
+		return models.Incident{}, os.ErrNotExist
+	}
+	return hashToIncident(hash)
+}
+
+func (r *Redis) ByDate(from, to time.Time) ([]models.Incident, error) {
+	return r.between(from, to)
+}
+
+func (r *Redis) Persistents() ([]models.Incident, error) {
+	guids, err := r.client.SMembers(context.Background(), r.persistentsKey()).Result()
+	if err != nil {
+		return []models.Incident{}, err
+	}
+	incidents, err := r.readIncidents(guids)
+	if err != nil {
+		return []models.Incident{}, err
+	}
+	sort.Sort(models.Incidents(incidents))
+	return incidents, nil
+}
+
+// Query only reads incidents in date range of query from creation date index.
+func (r *Redis) Query(query IncidentQuery) (IncidentPage, error) {
+	if err := query.Validate(); err != nil {
+		return IncidentPage{}, err
+	}
+	incidents, err := r.between(query.From, query.To)
+	if err != nil {
+		return IncidentPage{}, err
+	}
+	return queryIncidents(incidents, query)
+}
+
+func (r *Redis) AddRevision(revision models.Revision) error {
+	content, err := json.Marshal(revision)
+	if err != nil {
+		return err
+	}
+	return r.client.RPush(context.Background(), r.revisionsKey(revision.IncidentGUID), content).Err()
+}
+
+func (r *Redis) Revisions(incidentGuid string) ([]models.Revision, error) {
+	contents, err := r.client.LRange(context.Background(), r.revisionsKey(incidentGuid), 0, -1).Result()
+	if err != nil {
+		return []models.Revision{}, err
+	}
+	revisions := make([]models.Revision, len(contents))
+	for i, content := range contents {
+		err := json.Unmarshal([]byte(content), &revisions[i])
+		if err != nil {
+			return []models.Revision{}, err
+		}
+	}
+	sort.Sort(models.Revisions(revisions))
+	return revisions, nil
+}
+
+func (r *Redis) ReplaceRevisions(change func(revision models.Revision) (models.Revision, error)) error {
+	ctx := context.Background()
+	iter := r.client.Scan(ctx, 0, r.revisionsKey("*"), 0).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		contents, err := r.client.LRange(ctx, key, 0, -1).Result()
+		if err != nil {
+			return err
+		}
+		// revisions are only appended, indexes of revisions read can't change
+		for i, content := range contents {
+			var revision models.Revision
+			err := json.Unmarshal([]byte(content), &revision)
+			if err != nil {
+				return err
+			}
+			revision, err = change(revision)
+			if err != nil {
+				return err
+			}
+			b, err := json.Marshal(revision)
+			if err != nil {
+				return err
+			}
+			err = r.client.LSet(ctx, key, int64(i), b).Err()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return iter.Err()
+}
+
+func (r *Redis) AddTrashed(trashed models.TrashedIncident) error {
+	content, err := json.Marshal(trashed)
+	if err != nil {
+		return err
+	}
+	return r.client.HSet(context.Background(), r.trashKey(), trashed.Incident.GUID, content).Err()
+}
+
+func (r *Redis) Trashed() ([]models.TrashedIncident, error) {
+	contents, err := r.client.HVals(context.Background(), r.trashKey()).Result()
+	if err != nil {
+		return []models.TrashedIncident{}, err
+	}
+	trashed := make([]models.TrashedIncident, len(contents))
+	for i, content := range contents {
+		err := json.Unmarshal([]byte(content), &trashed[i])
+		if err != nil {
+			return []models.TrashedIncident{}, err
+		}
+	}
+	sort.Sort(models.TrashedIncidents(trashed))
+	return trashed, nil
+}
+
+func (r *Redis) DeleteTrashed(guid string) error {
+	nb, err := r.client.HDel(context.Background(), r.trashKey(), guid).Result()
+	if err != nil {
+		return err
+	}
+	if nb == 0 {
+		return os.ErrNotExist
+	}
+	return nil
+}
+
+func (r *Redis) Subscribe(email string) error {
+	return r.client.SAdd(context.Background(), r.subscribersKey(), email).Err()
+}
+
+func (r *Redis) Unsubscribe(email string) error {
+	return r.client.SRem(context.Background(), r.subscribersKey(), email).Err()
+}
+
+func (r *Redis) Subscribers() ([]string, error) {
+	subs, err := r.client.SMembers(context.Background(), r.subscribersKey()).Result()
+	if err != nil {
+		return []string{}, err
+	}
+	sort.Strings(subs)
+	return subs, nil
+}
+
+func (r *Redis) Ping() error {
+	return r.client.Ping(context.Background()).Err()
+}
@@ -0,0 +1,141 @@
+package storages_test
+
+import (
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+	"github.com/orange-cloudfoundry/statusetat/v2/storages"
+)
+
+// startMiniredis gives a redis server running in process until end of spec.
+func startMiniredis() *miniredis.Miniredis {
+	server, err := miniredis.Run()
+	Expect(err).ToNot(HaveOccurred())
+	DeferCleanup(server.Close)
+	return server
+}
+
+func redisBuilder(params string) func() storages.Store {
+	return func() storages.Store {
+		return factoryBuilder("redis://" + startMiniredis().Addr() + params)()
+	}
+}
+
+var _ = Describe("Redis", func() {
+	var server *miniredis.Miniredis
+	var store storages.Store
+	now := time.Now().UTC().Truncate(time.Second)
+
+	newStore := func(params string) (storages.Store, error) {
+		u, err := url.Parse("redis://" + server.Addr() + params)
+		Expect(err).ToNot(HaveOccurred())
+		return storages.Factory([]*url.URL{u})
+	}
+
+	BeforeEach(func() {
+		server = startMiniredis()
+		var err error
+		store, err = newStore("?prefix=test&resolved_ttl=1h")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should store incidents in hashes indexed by creation date", func() {
+		_, err := store.Create(models.Incident{GUID: "inc1", CreatedAt: now, Origin: "test"})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = store.Create(models.Incident{GUID: "persistent", CreatedAt: now, Persistent: true})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(store.Subscribe("user@local.com")).To(Succeed())
+
+		Expect(server.HGet("test:incident:inc1", "origin")).To(Equal("test"))
+		members, err := server.ZMembers("test:incidents")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(members).To(ConsistOf("inc1"))
+		members, err = server.Members("test:persistents")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(members).To(ConsistOf("persistent"))
+		members, err = server.Members("test:subscribers")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(members).To(ConsistOf("user@local.com"))
+	})
+
+	It("should expire resolved incidents only", func() {
+		_, err := store.Create(models.Incident{GUID: "resolved", CreatedAt: now, State: models.Resolved})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = store.Create(models.Incident{GUID: "unresolved", CreatedAt: now, State: models.Unresolved})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = store.Create(models.Incident{GUID: "persistent", CreatedAt: now, State: models.Resolved, Persistent: true})
+		Expect(err).ToNot(HaveOccurred())
+
+		server.FastForward(2 * time.Hour)
+
+		_, err = store.Read("resolved")
+		Expect(os.IsNotExist(err)).To(BeTrue())
+		incidents, err := store.ByDate(now.Add(-time.Hour), now)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(incidents).To(HaveLen(1))
+		Expect(incidents[0].GUID).To(Equal("unresolved"))
+		persistents, err := store.Persistents()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(persistents).To(HaveLen(1))
+
+		// expired incidents are removed from index when seen
+		members, err := server.ZMembers("test:incidents")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(members).To(ConsistOf("unresolved"))
+	})
+
+	It("should not expire an upcoming maintenance", func() {
+		_, err := store.Create(models.Incident{
+			GUID:         "maintenance",
+			CreatedAt:    now,
+			State:        models.Idle,
+			IsScheduled:  true,
+			ScheduledEnd: now.Add(72 * time.Hour),
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(server.TTL("test:incident:maintenance")).To(BeZero())
+
+		server.FastForward(2 * time.Hour)
+
+		_, err = store.Read("maintenance")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should expire cancelled incidents", func() {
+		_, err := store.Create(models.Incident{GUID: "cancelled", CreatedAt: now, State: models.Cancelled, IsScheduled: true})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(server.TTL("test:incident:cancelled")).To(Equal(time.Hour))
+	})
+
+	It("should not expire an incident reopened", func() {
+		_, err := store.Create(models.Incident{GUID: "inc1", CreatedAt: now, State: models.Resolved})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = store.Update("inc1", models.Incident{GUID: "inc1", CreatedAt: now, State: models.Unresolved})
+		Expect(err).ToNot(HaveOccurred())
+
+		server.FastForward(2 * time.Hour)
+
+		_, err = store.Read("inc1")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should refuse invalid resolved ttl", func() {
+		_, err := newStore("?resolved_ttl=notaduration")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should not answer ping when server is down", func() {
+		// remaining parameters are options of redis client
+		store, err := newStore("?max_retries=-1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(store.Ping()).To(Succeed())
+		server.Close()
+		Expect(store.Ping()).ToNot(Succeed())
+	})
+})
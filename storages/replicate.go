@@ -1,11 +1,19 @@
 package storages
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/url"
+	"os"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/hashicorp/go-multierror"
+	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/orange-cloudfoundry/statusetat/v2/models"
@@ -17,25 +25,98 @@ const (
 	deleted
 	subscribe
 	unsubscribe
+	revisionAdded
+	trashAdded
+	trashDeleted
 )
 
 type recordAction int
 
 type record struct {
+	id string
+	// storeKey identifies the store where record must be replayed, see storeKey
+	storeKey string
+	// storeUrl is the redacted url of store, only used to describe it
 	storeUrl string
 	action   recordAction
 	data     string
 	incident models.Incident
-	deleted  bool
+	// actor is who made the change, record is replayed on behalf of this actor
+	actor   string
+	deleted bool
+}
+
+// ReplicateOptions holds tuning of a Replicate store, zero values are replaced by defaults.
+type ReplicateOptions struct {
+	// JournalPath is the path to the write-ahead journal where records to replay are persisted,
+	// records are only kept in memory when empty
+	JournalPath string
+	// JournalEncryptionKeys are base64 encoded 256 bits keys sealing records and tombstones in journal,
+	// first one is the current key, journal is not encrypted when neither keys nor key file are set
+	JournalEncryptionKeys []string
+	// JournalEncryptionKeyFile is the path to a file with one base64 encoded 256 bits key per line
+	JournalEncryptionKeyFile string
+	// ReconcileInterval is the time between two reconciliations of all stores, reconciliation is disabled when 0
+	ReconcileInterval time.Duration
+	// ReconcileWindow is how far in the past incidents are compared during reconciliation,
+	// this is also how long deletions of incidents and subscribers are remembered
+	ReconcileWindow time.Duration
+	// ReadStrategy defines how stores are read, default to ReadFirstSuccess
+	ReadStrategy ReadStrategy
+	// ReadTimeout is the maximum time to wait for a store to answer a read, no timeout when 0
+	ReadTimeout time.Duration
+	// ParallelWrites sends writes to all stores concurrently instead of one after another
+	ParallelWrites bool
+	// WriteTimeout is the maximum time to wait for stores to acknowledge a parallel write, no timeout when 0
+	WriteTimeout time.Duration
+	// WriteAcks is the number of stores acknowledgements to wait before returning from a parallel write,
+	// remaining writes finish in background, all stores are waited when 0
+	WriteAcks  int
+	WaitReplay time.Duration
+	WaitClean  time.Duration
+}
+
+type namedStore struct {
+	key   string
+	url   string
+	store Store
+}
+
+// storeKey gives the key identifying a store created from u, a hash of the full url is used as
+// targets may differ only by their credentials which must never be persisted in replay journal.
+func storeKey(u *url.URL) string {
+	sum := sha256.Sum256([]byte(u.String()))
+	return hex.EncodeToString(sum[:])
 }
 
 type Replicate struct {
 	storesInit []Store
-	stores     map[string]Store
+	stores     map[string]namedStore
+	order      []string
+	storesMu   *sync.RWMutex
 	records    *[]*record
+	tombstones *tombstones
+	journal    *journal
+	targets    *targetsState
 	mu         *sync.Mutex
 	waitReplay time.Duration
 	waitClean  time.Duration
+	stop       chan struct{}
+	stopOnce   *sync.Once
+	running    *sync.WaitGroup
+
+	reconcileInterval time.Duration
+	reconcileWindow   time.Duration
+
+	readStrategy ReadStrategy
+	readTimeout  time.Duration
+
+	parallelWrites bool
+	writeTimeout   time.Duration
+	writeAcks      int
+
+	// actor is who makes changes, see WithActor
+	actor string
 }
 
 func NewReplicate(storesInit []Store) *Replicate {
@@ -43,19 +124,130 @@ func NewReplicate(storesInit []Store) *Replicate {
 }
 
 func NewReplicateWithWaits(storesInit []Store, waitReplay, waitClean time.Duration) *Replicate {
+	// can't fail without journal
+	repl, _ := NewReplicateWithOptions(storesInit, ReplicateOptions{
+		WaitReplay: waitReplay,
+		WaitClean:  waitClean,
+	})
+	return repl
+}
+
+func NewReplicateWithOptions(storesInit []Store, opts ReplicateOptions) (*Replicate, error) {
+	if err := opts.ReadStrategy.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.ReadStrategy == "" {
+		opts.ReadStrategy = ReadFirstSuccess
+	}
+	if opts.WaitReplay == 0 {
+		opts.WaitReplay = 90 * time.Second
+	}
+	if opts.WaitClean == 0 {
+		opts.WaitClean = 1 * time.Hour
+	}
+	if opts.ReconcileWindow == 0 {
+		opts.ReconcileWindow = 30 * 24 * time.Hour
+	}
 	records := make([]*record, 0)
+	tombs := newTombstones(opts.ReconcileWindow)
+	var j *journal
+	if opts.JournalPath != "" {
+		var keys keyring
+		if len(opts.JournalEncryptionKeys) > 0 || opts.JournalEncryptionKeyFile != "" {
+			var err error
+			keys, err = loadEncryptionKeys(url.Values{
+				encryptionKeyParam:     opts.JournalEncryptionKeys,
+				encryptionKeyFileParam: []string{opts.JournalEncryptionKeyFile},
+			})
+			if err != nil {
+				return nil, fmt.Errorf("could not load replay journal encryption keys: %s", err.Error())
+			}
+		}
+		var err error
+		j, records, tombs, err = openJournal(opts.JournalPath, opts.ReconcileWindow, keys)
+		if err != nil {
+			return nil, fmt.Errorf("could not open replay journal %s: %s", opts.JournalPath, err.Error())
+		}
+		if len(records) > 0 {
+			log.WithField("journal", opts.JournalPath).Infof("Loaded %d record(s) to replay", len(records))
+		}
+		for _, rec := range records {
+			pendingRecords(rec.storeUrl).Inc()
+		}
+	}
 	repl := &Replicate{
 		storesInit: storesInit,
-		stores:     make(map[string]Store),
+		stores:     make(map[string]namedStore),
+		order:      make([]string, 0),
+		storesMu:   &sync.RWMutex{},
 		records:    &records,
+		tombstones: tombs,
+		journal:    j,
+		targets:    newTargetsState(),
 		mu:         &sync.Mutex{},
-		waitReplay: waitReplay,
-		waitClean:  waitClean,
+		waitReplay: opts.WaitReplay,
+		waitClean:  opts.WaitClean,
+		stop:       make(chan struct{}),
+		stopOnce:   &sync.Once{},
+		running:    &sync.WaitGroup{},
+
+		reconcileInterval: opts.ReconcileInterval,
+		reconcileWindow:   opts.ReconcileWindow,
+
+		readStrategy: opts.ReadStrategy,
+		readTimeout:  opts.ReadTimeout,
+
+		parallelWrites: opts.ParallelWrites,
+		writeTimeout:   opts.WriteTimeout,
+		writeAcks:      opts.WriteAcks,
 	}
 
-	go repl.clean()
-	go repl.replay()
-	return repl
+	repl.background(repl.clean)
+	repl.background(repl.replay)
+	if repl.reconcileInterval > 0 {
+		repl.background(repl.reconcileLoop)
+	}
+	return repl, nil
+}
+
+// background runs fn in a goroutine waited by Stop.
+func (m *Replicate) background(fn func()) {
+	m.running.Add(1)
+	go func() {
+		defer m.running.Done()
+		fn()
+	}()
+}
+
+// sleep waits for d and gives false if replicate was stopped in the meantime.
+func (m *Replicate) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-m.stop:
+		return false
+	}
+}
+
+func (m *Replicate) stopped() bool {
+	select {
+	case <-m.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// Stop ends replay, compaction and reconciliation of stores and waits for them as well as writes
+// still running in background, records not replayed yet are kept in journal for next run.
+// Replicate must not be used after being stopped.
+func (m *Replicate) Stop() {
+	m.stopOnce.Do(func() {
+		close(m.stop)
+	})
+	m.running.Wait()
 }
 
 func (m *Replicate) Creator() func(u *url.URL) (Store, error) {
@@ -68,58 +260,78 @@ func (m *Replicate) Creator() func(u *url.URL) (Store, error) {
 			if err != nil {
 				return nil, err
 			}
-			m.stores[u.String()] = store
+			// url is redacted to never persist credentials in replay journal or show them in health
+			ns := namedStore{key: storeKey(u), url: RedactURL(u), store: store}
+			m.storesMu.Lock()
+			if _, ok := m.stores[ns.key]; !ok {
+				m.order = append(m.order, ns.key)
+			}
+			m.stores[ns.key] = ns
+			m.storesMu.Unlock()
 			return m, nil
 		}
 		return nil, fmt.Errorf("no valid store can be found")
 	}
 }
 
-func (m *Replicate) Subscribe(email string) error {
-	var err error
-	allInError := true
-	for storeUrl, s := range m.stores {
-		err = s.Subscribe(email)
-		if err != nil {
-			m.addRecord(storeUrl, subscribe, email, models.Incident{})
-			continue
-		}
-		allInError = false
+// WithActor gives a Replicate making changes on behalf of actor on all stores and in records to replay,
+// it shares stores, records and background jobs with m.
+func (m *Replicate) WithActor(actor string) Store {
+	m.storesMu.RLock()
+	defer m.storesMu.RUnlock()
+	repl := *m
+	repl.actor = actor
+	return &repl
+}
+
+// orderedStores gives registered stores in the order of their registration (i.e. targets order).
+func (m *Replicate) orderedStores() []namedStore {
+	m.storesMu.RLock()
+	defer m.storesMu.RUnlock()
+	stores := make([]namedStore, len(m.order))
+	for i, key := range m.order {
+		ns := m.stores[key]
+		ns.store = AsActor(ns.store, m.actor)
+		stores[i] = ns
 	}
-	if allInError {
-		return err
+	return stores
+}
+
+func (m *Replicate) storeByKey(key string) (Store, bool) {
+	m.storesMu.RLock()
+	defer m.storesMu.RUnlock()
+	ns, ok := m.stores[key]
+	return ns.store, ok
+}
+
+func (m *Replicate) Subscribe(email string) error {
+	_, err := replicateWrite(m, subscribe, email, models.Incident{}, func(s Store, _ models.Incident) (struct{}, error) {
+		return struct{}{}, s.Subscribe(email)
+	})
+	if writeAccepted(err) {
+		m.tombstone(subscribe, email)
 	}
-	return nil
+	return err
 }
 
 func (m *Replicate) Unsubscribe(email string) error {
-	var err error
-	allInError := true
-	for storeUrl, s := range m.stores {
-		err = s.Unsubscribe(email)
-		if err != nil {
-			m.addRecord(storeUrl, unsubscribe, email, models.Incident{})
-			continue
-		}
-		allInError = false
-	}
-	if allInError {
-		return err
+	_, err := replicateWrite(m, unsubscribe, email, models.Incident{}, func(s Store, _ models.Incident) (struct{}, error) {
+		return struct{}{}, s.Unsubscribe(email)
+	})
+	if writeAccepted(err) {
+		m.tombstone(unsubscribe, email)
 	}
-	return nil
+	return err
 }
 
 func (m *Replicate) Subscribers() ([]string, error) {
-	var subs []string
-	var err error
-	for _, s := range m.stores {
-		subs, err = s.Subscribers()
-		if err != nil {
-			continue
-		}
-		return subs, nil
+	subs, err := replicateRead(m, func(s Store) ([]string, error) {
+		return s.Subscribers()
+	}, mergeSubscribers)
+	if err != nil {
+		return subs, err
 	}
-	return subs, err
+	return m.withoutUnsubscribed(subs), nil
 }
 
 func (m *Replicate) Detect(u *url.URL) bool {
@@ -127,76 +339,234 @@ func (m *Replicate) Detect(u *url.URL) bool {
 }
 
 func (m *Replicate) Create(incident models.Incident) (models.Incident, error) {
-	var err error
-	allInError := true
-	for storeUrl, s := range m.stores {
-		incident, err = s.Create(incident)
-		if err != nil {
-			m.addRecord(storeUrl, created, "", incident)
-			continue
-		}
-		allInError = false
-	}
-	if allInError {
-		return incident, err
+	ret, err := replicateWrite(m, created, "", incident, func(s Store, incident models.Incident) (models.Incident, error) {
+		return s.Create(incident)
+	})
+	if writeAccepted(err) && ret.GUID != "" {
+		m.tombstone(created, ret.GUID)
 	}
-	return incident, nil
+	return ret, err
 }
 
 func (m *Replicate) Update(guid string, incident models.Incident) (models.Incident, error) {
+	ret, err := replicateWrite(m, updated, guid, incident, func(s Store, incident models.Incident) (models.Incident, error) {
+		return s.Update(guid, incident)
+	})
+	if writeAccepted(err) {
+		m.tombstone(updated, guid)
+	}
+	return ret, err
+}
+
+// UpdateIfVersion checks version on the first store answering, stores are tried in targets order.
+// The incident it wrote is then given to the other stores as a plain update, failed ones get it replayed.
+// Conflict is never recorded for replay, a store lagging behind can't so override a change made meanwhile.
+func (m *Replicate) UpdateIfVersion(guid string, version int, incident models.Incident) (models.Incident, error) {
+	stores := m.orderedStores()
+	if len(stores) == 0 {
+		return incident, fmt.Errorf("no store available")
+	}
 	var err error
-	allInError := true
-	for storeUrl, s := range m.stores {
-		incident, err = s.Update(guid, incident)
+	for i, s := range stores {
+		var ret models.Incident
+		ret, err = s.store.UpdateIfVersion(guid, version, incident)
+		if err != nil && (os.IsNotExist(err) || errors.Is(err, ErrVersionConflict)) {
+			m.targets.write(s.key, nil)
+			return incident, err
+		}
+		m.targets.write(s.key, err)
 		if err != nil {
-			m.addRecord(storeUrl, updated, guid, incident)
+			log.WithField("url", s.url).Debugf("Could not check version of incident on store: %s", err.Error())
 			continue
 		}
-		allInError = false
-	}
-	if allInError {
-		return incident, err
+		others := append(append([]namedStore{}, stores[:i]...), stores[i+1:]...)
+		if len(others) > 0 {
+			_, _ = replicateWriteOn(m, others, updated, guid, ret, func(s Store, incident models.Incident) (models.Incident, error) {
+				return s.Update(guid, incident)
+			})
+		}
+		m.tombstone(updated, guid)
+		return ret, nil
 	}
-	return incident, nil
+	return incident, err
 }
 
 func (m *Replicate) Delete(guid string) error {
-	var err error
-	allInError := true
-	for storeUrl, s := range m.stores {
-		err = s.Delete(guid)
+	_, err := replicateWrite(m, deleted, guid, models.Incident{}, func(s Store, _ models.Incident) (struct{}, error) {
+		return struct{}{}, s.Delete(guid)
+	})
+	if writeAccepted(err) {
+		m.tombstone(deleted, guid)
+	}
+	return err
+}
+
+func (m *Replicate) AddRevision(revision models.Revision) error {
+	// revision is kept as json in record data to be replayed as any other record
+	data, err := json.Marshal(revision)
+	if err != nil {
+		return err
+	}
+	_, err = replicateWrite(m, revisionAdded, string(data), models.Incident{}, func(s Store, _ models.Incident) (struct{}, error) {
+		return struct{}{}, s.AddRevision(revision)
+	})
+	return err
+}
+
+func (m *Replicate) Revisions(incidentGuid string) ([]models.Revision, error) {
+	revisions, err := replicateRead(m, func(s Store) ([]models.Revision, error) {
+		return s.Revisions(incidentGuid)
+	}, mergeRevisions)
+	if err != nil {
+		return []models.Revision{}, err
+	}
+	return revisions, nil
+}
+
+// ReplaceRevisions replaces revisions on each store, it is not recorded for replay as change can't be stored,
+// it must be run again when a store fails.
+func (m *Replicate) ReplaceRevisions(change func(revision models.Revision) (models.Revision, error)) error {
+	stores := m.orderedStores()
+	if len(stores) == 0 {
+		return fmt.Errorf("no store available")
+	}
+	var result error
+	for _, s := range stores {
+		err := s.store.ReplaceRevisions(change)
+		m.targets.write(s.key, err)
 		if err != nil {
-			m.addRecord(storeUrl, deleted, guid, models.Incident{})
-			continue
+			result = multierror.Append(result, fmt.Errorf("%s: %s", s.url, err.Error()))
 		}
-		allInError = false
 	}
-	if allInError {
+	return result
+}
+
+func (m *Replicate) AddTrashed(trashed models.TrashedIncident) error {
+	data, err := json.Marshal(trashed)
+	if err != nil {
 		return err
 	}
-	return nil
+	_, err = replicateWrite(m, trashAdded, string(data), models.Incident{}, func(s Store, _ models.Incident) (struct{}, error) {
+		return struct{}{}, s.AddTrashed(trashed)
+	})
+	return err
+}
+
+func (m *Replicate) Trashed() ([]models.TrashedIncident, error) {
+	trashed, err := replicateRead(m, func(s Store) ([]models.TrashedIncident, error) {
+		return s.Trashed()
+	}, mergeTrashed)
+	if err != nil {
+		return []models.TrashedIncident{}, err
+	}
+	return trashed, nil
+}
+
+func (m *Replicate) DeleteTrashed(guid string) error {
+	_, err := replicateWrite(m, trashDeleted, guid, models.Incident{}, func(s Store, _ models.Incident) (struct{}, error) {
+		return struct{}{}, s.DeleteTrashed(guid)
+	})
+	return err
 }
 
-func (m *Replicate) addRecord(storeUrl string, action recordAction, data string, incident models.Incident) {
+func (m *Replicate) addRecord(ns namedStore, action recordAction, data string, incident models.Incident) {
 	log.
 		WithField("action", action).
-		WithField("url", storeUrl).
+		WithField("url", ns.url).
 		Debug("Add record to replay")
-	records := *m.records
-	records = append(records, &record{
-		storeUrl: storeUrl,
+	rec := &record{
+		id:       uuid.NewString(),
+		storeKey: ns.key,
+		storeUrl: ns.url,
 		action:   action,
 		data:     data,
 		incident: incident,
+		actor:    m.actor,
 		deleted:  false,
-	})
+	}
+	// lock is held while writing in journal to not lose the record if a compaction occurs in between
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	*m.records = records
+	if m.journal != nil {
+		err := m.journal.add(rec)
+		if err != nil {
+			log.WithField("url", ns.url).Errorf("Could not write record to replay journal: %s", err.Error())
+		}
+	}
+	*m.records = append(*m.records, rec)
+	pendingRecords(ns.url).Inc()
+}
+
+// writeAccepted tells if a write was done or is pending in background and so will be done.
+func writeAccepted(err error) bool {
+	return err == nil || errors.Is(err, ErrWritePending)
+}
+
+// tombstone records in tombstones, and in journal, deletion of key by action or forgets it when key is written again.
+func (m *Replicate) tombstone(action recordAction, key string) {
+	at := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.tombstones.set(action, key, at) || m.journal == nil {
+		return
+	}
+	err := m.journal.tombstone(action, key, at)
+	if err != nil {
+		log.Errorf("Could not write tombstone in replay journal: %s", err.Error())
+	}
+}
+
+// incidentDeleted tells if incident is a copy of an incident deleted afterward.
+func (m *Replicate) incidentDeleted(incident models.Incident) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.tombstones.incidentDeleted(incident)
+}
+
+// unsubscribed tells if email was unsubscribed and not subscribed again since.
+func (m *Replicate) unsubscribed(email string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.tombstones.unsubscribed(email)
+}
+
+// withoutDeleted removes from incidents copies of incidents deleted afterward, they can be given by a lagging store.
+func (m *Replicate) withoutDeleted(incidents []models.Incident) []models.Incident {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := make([]models.Incident, 0, len(incidents))
+	for _, incident := range incidents {
+		if !m.tombstones.incidentDeleted(incident) {
+			kept = append(kept, incident)
+		}
+	}
+	return kept
+}
+
+// withoutUnsubscribed removes from emails those unsubscribed, they can be given by a lagging store.
+func (m *Replicate) withoutUnsubscribed(emails []string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := make([]string, 0, len(emails))
+	for _, email := range emails {
+		if !m.tombstones.unsubscribed(email) {
+			kept = append(kept, email)
+		}
+	}
+	return kept
+}
+
+// pendingRecords gives gauge of records waiting to be replayed on store.
+func pendingRecords(storeUrl string) prometheus.Gauge {
+	return replicatePendingRecords.WithLabelValues(targetLabel(storeUrl))
 }
 
 func (m *Replicate) clean() {
 	for {
+		// journal is already compacted when opened
+		if !m.sleep(m.waitClean) {
+			return
+		}
 		m.mu.Lock()
 		finalRecord := make([]*record, 0)
 		for _, record := range *m.records {
@@ -206,8 +576,14 @@ func (m *Replicate) clean() {
 			finalRecord = append(finalRecord, record)
 		}
 		*m.records = finalRecord
+		m.tombstones.expire(time.Now())
+		if m.journal != nil {
+			err := m.journal.compact(finalRecord, m.tombstones)
+			if err != nil {
+				log.Errorf("Could not compact replay journal: %s", err.Error())
+			}
+		}
 		m.mu.Unlock()
-		time.Sleep(m.waitClean)
 	}
 }
 
@@ -224,85 +600,171 @@ func (m *Replicate) replay() {
 		m.mu.Unlock()
 
 		for _, record := range todo {
+			if m.stopped() {
+				return
+			}
 			log.
 				WithField("action", record.action).
 				WithField("url", record.storeUrl).
 				Debug("Playing record ...")
-			store := m.stores[record.storeUrl]
+			store, ok := m.storeByKey(record.storeKey)
+			if !ok {
+				// store may not be registered yet or was removed from targets
+				continue
+			}
+			store = AsActor(store, record.actor)
+			var err error
 			switch record.action {
 			case created:
-				_, err := store.Create(record.incident)
-				if err != nil {
-					continue
-				}
+				_, err = store.Create(record.incident)
 			case updated:
-				_, err := store.Update(record.data, record.incident)
-				if err != nil {
-					continue
-				}
+				_, err = store.Update(record.data, record.incident)
 			case deleted:
-				err := store.Delete(record.data)
-				if err != nil {
-					continue
-				}
+				err = store.Delete(record.data)
 			case subscribe:
-				err := store.Subscribe(record.data)
-				if err != nil {
-					continue
-				}
+				err = store.Subscribe(record.data)
 			case unsubscribe:
-				err := store.Unsubscribe(record.data)
-				if err != nil {
-					continue
+				err = store.Unsubscribe(record.data)
+			case revisionAdded:
+				var revision models.Revision
+				if err = json.Unmarshal([]byte(record.data), &revision); err == nil {
+					err = store.AddRevision(revision)
 				}
+			case trashAdded:
+				var trashed models.TrashedIncident
+				if err = json.Unmarshal([]byte(record.data), &trashed); err == nil {
+					err = store.AddTrashed(trashed)
+				}
+			case trashDeleted:
+				err = store.DeleteTrashed(record.data)
+			}
+			if alreadyApplied(record.action, err) {
+				err = nil
+			}
+			m.targets.write(record.storeKey, err)
+			if err != nil {
+				continue
 			}
 
+			m.mu.Lock()
 			record.deleted = true
+			m.mu.Unlock()
+			pendingRecords(record.storeUrl).Dec()
+			if m.journal != nil {
+				err = m.journal.done(record)
+				if err != nil {
+					log.WithField("url", record.storeUrl).Errorf("Could not mark record as done in replay journal: %s", err.Error())
+				}
+			}
 		}
 
-		time.Sleep(m.waitReplay)
+		if !m.sleep(m.waitReplay) {
+			return
+		}
 	}
 }
 
 func (m *Replicate) Read(guid string) (models.Incident, error) {
-	var incident models.Incident
-	var err error
-	for _, s := range m.stores {
-		incident, err = s.Read(guid)
-		if err != nil {
-			continue
-		}
-		return incident, nil
+	incident, err := replicateRead(m, func(s Store) (models.Incident, error) {
+		return s.Read(guid)
+	}, mergeFreshestIncident)
+	if err != nil {
+		return incident, err
 	}
-	return incident, err
+	if m.incidentDeleted(incident) {
+		return models.Incident{}, os.ErrNotExist
+	}
+	return incident, nil
 }
 
 func (m *Replicate) ByDate(from, to time.Time) ([]models.Incident, error) {
-	incidents := make([]models.Incident, 0)
-	var err error
-	for _, s := range m.stores {
-		incidents, err = s.ByDate(from, to)
-		if err != nil {
-			continue
-		}
-		return incidents, nil
+	incidents, err := replicateRead(m, func(s Store) ([]models.Incident, error) {
+		return s.ByDate(from, to)
+	}, mergeFreshestIncidents)
+	if err != nil {
+		return []models.Incident{}, err
 	}
-	return incidents, err
+	return m.withoutDeleted(incidents), nil
 }
 
 func (m *Replicate) Persistents() ([]models.Incident, error) {
-	incidents := make([]models.Incident, 0)
-	var err error
-	for _, s := range m.stores {
-		incidents, err = s.Persistents()
-		if err != nil {
-			continue
-		}
-		return incidents, nil
+	incidents, err := replicateRead(m, func(s Store) ([]models.Incident, error) {
+		return s.Persistents()
+	}, mergeFreshestIncidents)
+	if err != nil {
+		return []models.Incident{}, err
 	}
-	return incidents, err
+	return m.withoutDeleted(incidents), nil
 }
 
+func (m *Replicate) Query(query IncidentQuery) (IncidentPage, error) {
+	if err := query.Validate(); err != nil {
+		return IncidentPage{}, err
+	}
+	page, err := replicateRead(m, func(s Store) (IncidentPage, error) {
+		return s.Query(query)
+	}, mergeQueryPages(query))
+	if err != nil {
+		return IncidentPage{Incidents: []models.Incident{}}, err
+	}
+	page.Incidents = m.withoutDeleted(page.Incidents)
+	return page, nil
+}
+
+// Ping pings all stores concurrently, it only fails when no store answers
+// as Replicate can still serve and write data with remaining stores.
 func (m *Replicate) Ping() error {
+	stores := m.orderedStores()
+	if len(stores) == 0 {
+		return fmt.Errorf("no store available")
+	}
+	results := make(chan readResult[struct{}], len(stores))
+	for _, s := range stores {
+		go func(s namedStore) {
+			start := time.Now()
+			_, err := callWithTimeout(m.readTimeout, func() (struct{}, error) {
+				return struct{}{}, s.store.Ping()
+			})
+			m.targets.ping(s.key, time.Since(start), err)
+			results <- readResult[struct{}]{storeUrl: s.url, err: err}
+		}(s)
+	}
+
+	var result error
+	healthy := 0
+	for range stores {
+		res := <-results
+		if res.err != nil {
+			result = multierror.Append(result, fmt.Errorf("%s: %s", res.storeUrl, res.err.Error()))
+			continue
+		}
+		healthy++
+	}
+	if healthy == 0 {
+		return result
+	}
+	if result != nil {
+		log.Warningf("%d store(s) on %d are not healthy: %s", len(stores)-healthy, len(stores), result.Error())
+	}
 	return nil
 }
+
+// Health gives health of each store as seen by last ping, writes and reads made.
+func (m *Replicate) Health() []TargetHealth {
+	pending := make(map[string]int)
+	m.mu.Lock()
+	for _, record := range *m.records {
+		if record.deleted {
+			continue
+		}
+		pending[record.storeKey]++
+	}
+	m.mu.Unlock()
+
+	stores := m.orderedStores()
+	healths := make([]TargetHealth, len(stores))
+	for i, s := range stores {
+		healths[i] = m.targets.health(s.key, s.url, pending[s.key])
+	}
+	return healths
+}
@@ -0,0 +1,263 @@
+package storages
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+	"github.com/orange-cloudfoundry/statusetat/v2/utils"
+)
+
+var (
+	retentionIncidents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "statusetat_retention_incidents_total",
+		Help: "Number of expired incidents handled by retention job.",
+	}, []string{"action"})
+	retentionErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "statusetat_retention_errors_total",
+		Help: "Number of errors encountered by retention job.",
+	})
+	retentionLastRun = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "statusetat_retention_last_run_timestamp_seconds",
+		Help: "Time of last run of retention job.",
+	})
+)
+
+type RetentionAction string
+
+const (
+	// RetentionArchive writes expired incidents in monthly archives before deleting them
+	RetentionArchive RetentionAction = "archive"
+	// RetentionDelete deletes expired incidents
+	RetentionDelete RetentionAction = "delete"
+)
+
+// RetentionPolicy defines which incidents are expired and what to do with them.
+// Only resolved incidents (and finished maintenances) created and last updated more than MaxAge ago are expired,
+// persistent and unresolved incidents are never touched.
+type RetentionPolicy struct {
+	MaxAge time.Duration
+	Action RetentionAction
+	// ArchiveStore is the store where incidents are copied with RetentionArchive action, it must be durable
+	// and shared by all instances, e.g. a s3 bucket, it is used instead of ArchiveDir when set
+	ArchiveStore Store
+	// ArchiveDir is the folder where monthly archives are written with RetentionArchive action
+	ArchiveDir string
+	// DryRun only reports what would be done
+	DryRun bool
+}
+
+// RetentionReport sums up what has been (or would be in dry run) done by a retention run.
+type RetentionReport struct {
+	Expired  int `json:"expired"`
+	Archived int `json:"archived"`
+	Deleted  int `json:"deleted"`
+	Errors   int `json:"errors"`
+}
+
+func (r RetentionReport) String() string {
+	return fmt.Sprintf("%d expired incident(s): %d archived, %d deleted; %d error(s)", r.Expired, r.Archived, r.Deleted, r.Errors)
+}
+
+// RetentionLoop applies policy on store every interval, it never returns.
+func RetentionLoop(store Store, policy RetentionPolicy, interval time.Duration) {
+	for {
+		report, err := ApplyRetention(store, policy)
+		if err != nil {
+			log.Warningf("Retention finished with errors: %s", err.Error())
+		}
+		if report.Expired > 0 {
+			log.Infof("Retention done, %s", report)
+		} else {
+			log.Debug("Retention done, no expired incident")
+		}
+		time.Sleep(interval)
+	}
+}
+
+// ApplyRetention archives or deletes expired incidents of store.
+// With archive action, incidents are copied in archive store or written in archives named incidents-<year>-<month>.json.gz
+// by month of creation, archives can be loaded back with Import. Incidents are only deleted from store once
+// they have been read back from archive.
+func ApplyRetention(store Store, policy RetentionPolicy) (RetentionReport, error) {
+	var report RetentionReport
+	if !policy.DryRun {
+		defer func() {
+			retentionIncidents.WithLabelValues("archived").Add(float64(report.Archived))
+			retentionIncidents.WithLabelValues("deleted").Add(float64(report.Deleted))
+			retentionErrors.Add(float64(report.Errors))
+			retentionLastRun.SetToCurrentTime()
+		}()
+	}
+
+	expired, err := expiredIncidents(store, policy.MaxAge)
+	if err != nil {
+		report.Errors++
+		return report, fmt.Errorf("could not read incidents: %s", err.Error())
+	}
+	report.Expired = len(expired)
+	if len(expired) == 0 {
+		return report, nil
+	}
+
+	toDelete := expired
+	var result error
+	if policy.Action != RetentionDelete && policy.ArchiveStore != nil {
+		toDelete = make([]models.Incident, 0, len(expired))
+		for _, incident := range expired {
+			if !policy.DryRun {
+				err := archiveIncident(policy.ArchiveStore, incident)
+				if err != nil {
+					report.Errors++
+					result = multierror.Append(result, fmt.Errorf("archive incident %s: %s", incident.GUID, err.Error()))
+					continue
+				}
+			}
+			report.Archived++
+			toDelete = append(toDelete, incident)
+		}
+	} else if policy.Action != RetentionDelete {
+		toDelete = make([]models.Incident, 0, len(expired))
+		for month, incidents := range byMonth(expired) {
+			if !policy.DryRun {
+				err := writeMonthArchive(policy.ArchiveDir, month, incidents)
+				if err != nil {
+					report.Errors++
+					result = multierror.Append(result, fmt.Errorf("archive %s: %s", month, err.Error()))
+					continue
+				}
+				log.WithField("month", month).Infof("Archived %d expired incident(s)", len(incidents))
+			}
+			report.Archived += len(incidents)
+			toDelete = append(toDelete, incidents...)
+		}
+	}
+
+	for _, incident := range toDelete {
+		if !policy.DryRun {
+			err := store.Delete(incident.GUID)
+			if err != nil && !os.IsNotExist(err) {
+				report.Errors++
+				result = multierror.Append(result, fmt.Errorf("incident %s: %s", incident.GUID, err.Error()))
+				continue
+			}
+		}
+		log.WithField("guid", incident.GUID).Debug("Expired incident deleted")
+		report.Deleted++
+	}
+	return report, result
+}
+
+// expiredIncidents gives resolved incidents created and last updated more than maxAge ago.
+func expiredIncidents(store Store, maxAge time.Duration) ([]models.Incident, error) {
+	before := time.Now().Add(-maxAge)
+	incidents, err := store.ByDate(time.Unix(0, 0), before)
+	if err != nil {
+		return nil, err
+	}
+	expired := make([]models.Incident, 0)
+	for _, incident := range incidents {
+		if incident.Persistent || incident.State != models.Resolved || incident.UpdatedAt.After(before) {
+			continue
+		}
+		expired = append(expired, incident)
+	}
+	return expired, nil
+}
+
+func byMonth(incidents []models.Incident) map[string][]models.Incident {
+	months := make(map[string][]models.Incident)
+	for _, incident := range incidents {
+		month := incident.CreatedAt.UTC().Format("2006-01")
+		months[month] = append(months[month], incident)
+	}
+	return months
+}
+
+// archiveIncident copies incident in archive store, incident is read back to confirm it has been archived.
+func archiveIncident(archive Store, incident models.Incident) error {
+	_, err := archive.Read(incident.GUID)
+	switch {
+	case err == nil:
+		_, err = archive.Update(incident.GUID, incident)
+	case os.IsNotExist(err):
+		_, err = archive.Create(incident)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = archive.Read(incident.GUID)
+	if err != nil {
+		return fmt.Errorf("could not read back archived incident: %s", err.Error())
+	}
+	return nil
+}
+
+// writeMonthArchive adds incidents to archive of month, incidents already archived are replaced.
+// Archive is read back once written to confirm all incidents are in it.
+func writeMonthArchive(dir, month string, incidents []models.Incident) error {
+	if err := os.MkdirAll(dir, 0775); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("incidents-%s.json.gz", month))
+	lock := newFileLock(filepath.Join(dir, lockFileName(filepath.Base(path))))
+	return lock.withLock(func() error {
+		archived, err := readArchiveFile(path)
+		if err != nil {
+			return err
+		}
+		byGuid := make(map[string]models.Incident)
+		for _, incident := range append(archived, incidents...) {
+			byGuid[incident.GUID] = incident
+		}
+		merged := make([]models.Incident, 0, len(byGuid))
+		for _, incident := range byGuid {
+			merged = append(merged, incident)
+		}
+		sort.Sort(models.Incidents(merged))
+
+		buf := &bytes.Buffer{}
+		err = writeArchive(buf, merged, []string{})
+		if err != nil {
+			return err
+		}
+		err = writeFileAtomic(path, buf.Bytes(), 0644)
+		if err != nil {
+			return err
+		}
+		written, err := readArchiveFile(path)
+		if err != nil {
+			return fmt.Errorf("could not read back archive: %s", err.Error())
+		}
+		if len(written) != len(merged) {
+			return fmt.Errorf("archive read back has %d incident(s) instead of %d", len(written), len(merged))
+		}
+		return nil
+	})
+}
+
+// readArchiveFile gives incidents of archive at path, no incidents are given when archive does not exist.
+func readArchiveFile(path string) ([]models.Incident, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []models.Incident{}, nil
+		}
+		return nil, err
+	}
+	defer utils.CloseAndLogError(f)
+	archive, err := ReadArchive(f)
+	if err != nil {
+		return nil, err
+	}
+	return archive.Incidents, nil
+}
@@ -0,0 +1,158 @@
+package storages_test
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+	"github.com/orange-cloudfoundry/statusetat/v2/storages"
+	"github.com/orange-cloudfoundry/statusetat/v2/storages/storagesfakes"
+	"github.com/orange-cloudfoundry/statusetat/v2/utils"
+)
+
+var _ = Describe("Retention", func() {
+	var store storages.Store
+	var policy storages.RetentionPolicy
+	tmpDirRetention := filepath.Join(os.TempDir(), "statusetat-test-retention")
+	archiveDir := filepath.Join(tmpDirRetention, "archives")
+	now := time.Now().UTC()
+	old := time.Date(now.Year()-3, time.March, 10, 10, 0, 0, 0, time.UTC)
+
+	readArchive := func(month string) []models.Incident {
+		f, err := os.Open(filepath.Join(archiveDir, "incidents-"+month+".json.gz"))
+		Expect(err).ToNot(HaveOccurred())
+		defer f.Close()
+		archive, err := storages.ReadArchive(f)
+		Expect(err).ToNot(HaveOccurred())
+		return archive.Incidents
+	}
+	guids := func(incidents []models.Incident) []string {
+		guids := make([]string, len(incidents))
+		for i, incident := range incidents {
+			guids[i] = incident.GUID
+		}
+		return guids
+	}
+
+	BeforeEach(func() {
+		u, _ := url.Parse("file://" + filepath.Join(tmpDirRetention, "store"))
+		var err error
+		store, err = (&storages.Local{}).Creator()(u)
+		Expect(err).ToNot(HaveOccurred())
+		for _, incident := range []models.Incident{
+			{GUID: "old-resolved-1", CreatedAt: old, UpdatedAt: old, State: models.Resolved},
+			{GUID: "old-resolved-2", CreatedAt: old.AddDate(0, 0, 5), UpdatedAt: old.AddDate(0, 0, 5), State: models.Resolved},
+			{GUID: "old-resolved-3", CreatedAt: old.AddDate(0, 1, 0), UpdatedAt: old.AddDate(0, 1, 0), State: models.Resolved},
+			{GUID: "old-unresolved", CreatedAt: old, UpdatedAt: old, State: models.Unresolved},
+			{GUID: "old-recently-updated", CreatedAt: old, UpdatedAt: now, State: models.Resolved},
+			{GUID: "old-persistent", CreatedAt: old, UpdatedAt: old, State: models.Resolved, Persistent: true},
+			{GUID: "recent-resolved", CreatedAt: now, UpdatedAt: now, State: models.Resolved},
+		} {
+			_, err := store.Create(incident)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		policy = storages.RetentionPolicy{
+			MaxAge:     2 * 365 * 24 * time.Hour,
+			Action:     storages.RetentionArchive,
+			ArchiveDir: archiveDir,
+		}
+	})
+	AfterEach(func() {
+		utils.RemoveDir(tmpDirRetention)
+	})
+	remaining := func() []string {
+		incidents, err := store.ByDate(time.Unix(0, 0), now.Add(time.Hour))
+		Expect(err).ToNot(HaveOccurred())
+		persistents, err := store.Persistents()
+		Expect(err).ToNot(HaveOccurred())
+		return guids(append(incidents, persistents...))
+	}
+
+	It("should archive expired incidents by month of creation and delete them", func() {
+		report, err := storages.ApplyRetention(store, policy)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report).To(Equal(storages.RetentionReport{Expired: 3, Archived: 3, Deleted: 3}))
+
+		Expect(remaining()).To(ConsistOf("old-unresolved", "old-recently-updated", "old-persistent", "recent-resolved"))
+		month := old.Format("2006-01")
+		Expect(guids(readArchive(month))).To(ConsistOf("old-resolved-1", "old-resolved-2"))
+		Expect(guids(readArchive(old.AddDate(0, 1, 0).Format("2006-01")))).To(ConsistOf("old-resolved-3"))
+	})
+	It("should add incidents expired later to existing archive", func() {
+		_, err := storages.ApplyRetention(store, policy)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = store.Update("old-unresolved", models.Incident{GUID: "old-unresolved", CreatedAt: old, UpdatedAt: old, State: models.Resolved})
+		Expect(err).ToNot(HaveOccurred())
+		report, err := storages.ApplyRetention(store, policy)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Archived).To(Equal(1))
+
+		Expect(guids(readArchive(old.Format("2006-01")))).To(ConsistOf("old-resolved-1", "old-resolved-2", "old-unresolved"))
+	})
+	It("should give archives which can be restored", func() {
+		_, err := storages.ApplyRetention(store, policy)
+		Expect(err).ToNot(HaveOccurred())
+
+		f, err := os.Open(filepath.Join(archiveDir, "incidents-"+old.Format("2006-01")+".json.gz"))
+		Expect(err).ToNot(HaveOccurred())
+		defer f.Close()
+		report, err := storages.Import(store, f)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Created).To(Equal(2))
+		incident, err := store.Read("old-resolved-1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(incident.State).To(Equal(models.Resolved))
+	})
+	It("should copy expired incidents in archive store before deleting them", func() {
+		u, _ := url.Parse("file://" + filepath.Join(tmpDirRetention, "archive-store"))
+		archiveStore, err := (&storages.Local{}).Creator()(u)
+		Expect(err).ToNot(HaveOccurred())
+		policy.ArchiveStore = archiveStore
+		report, err := storages.ApplyRetention(store, policy)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report).To(Equal(storages.RetentionReport{Expired: 3, Archived: 3, Deleted: 3}))
+
+		Expect(remaining()).To(ConsistOf("old-unresolved", "old-recently-updated", "old-persistent", "recent-resolved"))
+		archived, err := archiveStore.ByDate(time.Unix(0, 0), now)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(guids(archived)).To(ConsistOf("old-resolved-1", "old-resolved-2", "old-resolved-3"))
+		_, err = os.Stat(archiveDir)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+	It("should not delete incidents which could not be archived", func() {
+		archiveStore := &storagesfakes.FakeStore{}
+		archiveStore.ReadReturns(models.Incident{}, os.ErrNotExist)
+		policy.ArchiveStore = archiveStore
+		report, err := storages.ApplyRetention(store, policy)
+		Expect(err).To(HaveOccurred())
+		Expect(report).To(Equal(storages.RetentionReport{Expired: 3, Errors: 3}))
+
+		Expect(remaining()).To(HaveLen(7))
+	})
+	It("should only delete expired incidents with delete action", func() {
+		policy.Action = storages.RetentionDelete
+		report, err := storages.ApplyRetention(store, policy)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report).To(Equal(storages.RetentionReport{Expired: 3, Deleted: 3}))
+
+		Expect(remaining()).To(ConsistOf("old-unresolved", "old-recently-updated", "old-persistent", "recent-resolved"))
+		_, err = os.Stat(archiveDir)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+	It("should not change anything on dry run", func() {
+		policy.DryRun = true
+		report, err := storages.ApplyRetention(store, policy)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report).To(Equal(storages.RetentionReport{Expired: 3, Archived: 3, Deleted: 3}))
+
+		Expect(remaining()).To(HaveLen(7))
+		_, err = os.Stat(archiveDir)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+})
@@ -1,6 +1,7 @@
 package storages
 
 import (
+	"errors"
 	"net/url"
 	"os"
 	"time"
@@ -12,6 +13,8 @@ type Retry struct {
 	next      Store
 	nbRetry   int
 	sleepTime time.Duration
+	// target is the label of the store in metrics
+	target string
 }
 
 func NewRetry(next Store, nbRetry int) *Retry {
@@ -31,18 +34,34 @@ func (m *Retry) Creator() func(u *url.URL) (Store, error) {
 		}
 		newM.next = store
 		newM.nbRetry = m.nbRetry
+		newM.target = targetLabel(RedactURL(u))
 		return newM, nil
 	}
 }
 
+func (m *Retry) WithActor(actor string) Store {
+	store := *m
+	store.next = AsActor(m.next, actor)
+	return &store
+}
+
 func (m *Retry) Detect(u *url.URL) bool {
 	return m.next.Detect(u)
 }
 
+// countRetry counts attempt in metrics when it is a retry of operation op.
+func (m *Retry) countRetry(attempt int, op string) {
+	if attempt == 0 {
+		return
+	}
+	storeRetries.WithLabelValues(m.target, op).Inc()
+}
+
 func (m *Retry) Create(incident models.Incident) (models.Incident, error) {
 	var err error
 	var ret models.Incident
 	for i := 0; i < m.nbRetry; i++ {
+		m.countRetry(i, OpCreate)
 		ret, err = m.next.Create(incident)
 		if err != nil {
 			if os.IsNotExist(err) {
@@ -59,6 +78,7 @@ func (m *Retry) Create(incident models.Incident) (models.Incident, error) {
 func (m *Retry) Subscribe(email string) error {
 	var err error
 	for i := 0; i < m.nbRetry; i++ {
+		m.countRetry(i, OpSubscribe)
 		err = m.next.Subscribe(email)
 		if err != nil {
 			if os.IsNotExist(err) {
@@ -75,6 +95,7 @@ func (m *Retry) Subscribe(email string) error {
 func (m *Retry) Unsubscribe(email string) error {
 	var err error
 	for i := 0; i < m.nbRetry; i++ {
+		m.countRetry(i, OpUnsubscribe)
 		err = m.next.Unsubscribe(email)
 		if err != nil {
 			if os.IsNotExist(err) {
@@ -92,6 +113,7 @@ func (m *Retry) Subscribers() ([]string, error) {
 	var err error
 	var ret []string
 	for i := 0; i < m.nbRetry; i++ {
+		m.countRetry(i, OpSubscribers)
 		ret, err = m.next.Subscribers()
 		if err != nil {
 			if os.IsNotExist(err) {
@@ -109,6 +131,7 @@ func (m *Retry) Update(guid string, incident models.Incident) (models.Incident,
 	var err error
 	var ret models.Incident
 	for i := 0; i < m.nbRetry; i++ {
+		m.countRetry(i, OpUpdate)
 		ret, err = m.next.Update(guid, incident)
 		if err != nil {
 			if os.IsNotExist(err) {
@@ -122,9 +145,30 @@ func (m *Retry) Update(guid string, incident models.Incident) (models.Incident,
 	return incident, err
 }
 
+// UpdateIfVersion is not retried on conflict, a retry after a write done but not acknowledged
+// gives a conflict as well as version has changed.
+func (m *Retry) UpdateIfVersion(guid string, version int, incident models.Incident) (models.Incident, error) {
+	var err error
+	var ret models.Incident
+	for i := 0; i < m.nbRetry; i++ {
+		m.countRetry(i, OpUpdateIfVersion)
+		ret, err = m.next.UpdateIfVersion(guid, version, incident)
+		if err != nil {
+			if os.IsNotExist(err) || errors.Is(err, ErrVersionConflict) {
+				return incident, err
+			}
+			time.Sleep(m.sleepTime)
+			continue
+		}
+		return ret, err
+	}
+	return incident, err
+}
+
 func (m *Retry) Delete(guid string) error {
 	var err error
 	for i := 0; i < m.nbRetry; i++ {
+		m.countRetry(i, OpDelete)
 		err = m.next.Delete(guid)
 		if err != nil {
 			if os.IsNotExist(err) {
@@ -142,6 +186,7 @@ func (m *Retry) Read(guid string) (models.Incident, error) {
 	var err error
 	var ret models.Incident
 	for i := 0; i < m.nbRetry; i++ {
+		m.countRetry(i, OpRead)
 		ret, err = m.next.Read(guid)
 		if err != nil {
 			if os.IsNotExist(err) {
@@ -159,6 +204,7 @@ func (m *Retry) ByDate(from, to time.Time) ([]models.Incident, error) {
 	var err error
 	var ret []models.Incident
 	for i := 0; i < m.nbRetry; i++ {
+		m.countRetry(i, OpByDate)
 		ret, err = m.next.ByDate(from, to)
 		if err != nil {
 			if os.IsNotExist(err) {
@@ -176,6 +222,7 @@ func (m *Retry) Persistents() ([]models.Incident, error) {
 	var err error
 	var ret []models.Incident
 	for i := 0; i < m.nbRetry; i++ {
+		m.countRetry(i, OpPersistents)
 		ret, err = m.next.Persistents()
 		if err != nil {
 			if os.IsNotExist(err) {
@@ -189,9 +236,132 @@ func (m *Retry) Persistents() ([]models.Incident, error) {
 	return []models.Incident{}, err
 }
 
+func (m *Retry) Query(query IncidentQuery) (IncidentPage, error) {
+	var err error
+	var ret IncidentPage
+	for i := 0; i < m.nbRetry; i++ {
+		m.countRetry(i, OpQuery)
+		ret, err = m.next.Query(query)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return IncidentPage{}, err
+			}
+			time.Sleep(m.sleepTime)
+			continue
+		}
+		return ret, err
+	}
+	return IncidentPage{}, err
+}
+
+func (m *Retry) AddRevision(revision models.Revision) error {
+	var err error
+	for i := 0; i < m.nbRetry; i++ {
+		m.countRetry(i, OpAddRevision)
+		err = m.next.AddRevision(revision)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return err
+			}
+			time.Sleep(m.sleepTime)
+			continue
+		}
+		return err
+	}
+	return err
+}
+
+func (m *Retry) Revisions(incidentGuid string) ([]models.Revision, error) {
+	var err error
+	var ret []models.Revision
+	for i := 0; i < m.nbRetry; i++ {
+		m.countRetry(i, OpRevisions)
+		ret, err = m.next.Revisions(incidentGuid)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return []models.Revision{}, err
+			}
+			time.Sleep(m.sleepTime)
+			continue
+		}
+		return ret, err
+	}
+	return []models.Revision{}, err
+}
+
+func (m *Retry) ReplaceRevisions(change func(revision models.Revision) (models.Revision, error)) error {
+	var err error
+	for i := 0; i < m.nbRetry; i++ {
+		m.countRetry(i, OpReplaceRevisions)
+		err = m.next.ReplaceRevisions(change)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return err
+			}
+			time.Sleep(m.sleepTime)
+			continue
+		}
+		return err
+	}
+	return err
+}
+
+func (m *Retry) AddTrashed(trashed models.TrashedIncident) error {
+	var err error
+	for i := 0; i < m.nbRetry; i++ {
+		m.countRetry(i, OpAddTrashed)
+		err = m.next.AddTrashed(trashed)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return err
+			}
+			time.Sleep(m.sleepTime)
+			continue
+		}
+		return err
+	}
+	return err
+}
+
+func (m *Retry) Trashed() ([]models.TrashedIncident, error) {
+	var err error
+	var ret []models.TrashedIncident
+	for i := 0; i < m.nbRetry; i++ {
+		m.countRetry(i, OpTrashed)
+		ret, err = m.next.Trashed()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return []models.TrashedIncident{}, err
+			}
+			time.Sleep(m.sleepTime)
+			continue
+		}
+		return ret, err
+	}
+	return []models.TrashedIncident{}, err
+}
+
+func (m *Retry) DeleteTrashed(guid string) error {
+	var err error
+	for i := 0; i < m.nbRetry; i++ {
+		m.countRetry(i, OpDeleteTrashed)
+		err = m.next.DeleteTrashed(guid)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return err
+			}
+			time.Sleep(m.sleepTime)
+			continue
+		}
+		return err
+	}
+	return err
+}
+
 func (m *Retry) Ping() error {
 	var err error
 	for i := 0; i < m.nbRetry; i++ {
+		m.countRetry(i, OpPing)
 		err = m.next.Ping()
 		if err != nil {
 			time.Sleep(m.sleepTime)
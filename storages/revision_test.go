@@ -0,0 +1,120 @@
+package storages_test
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+	"github.com/orange-cloudfoundry/statusetat/v2/storages"
+	"github.com/orange-cloudfoundry/statusetat/v2/utils"
+)
+
+var _ = Describe("Revisions", func() {
+	tmpDirRevisions := filepath.Join(os.TempDir(), "statusetat-test-revisions")
+	base := time.Date(2024, time.March, 10, 10, 0, 0, 0, time.UTC)
+	nbDb := 0
+
+	storeBuilders := map[string]func() storages.Store{
+		"sqlite": func() storages.Store {
+			u, _ := url.Parse("sqlite://:memory:")
+			store, err := (&storages.DB{}).Creator()(u)
+			Expect(err).ToNot(HaveOccurred())
+			return store
+		},
+		"local": func() storages.Store {
+			u, _ := url.Parse("file://" + filepath.Join(tmpDirRevisions, "local"))
+			store, err := (&storages.Local{}).Creator()(u)
+			Expect(err).ToNot(HaveOccurred())
+			return store
+		},
+		"bolt": func() storages.Store {
+			nbDb++
+			u, _ := url.Parse(fmt.Sprintf("bolt://%s/store-%d.db", tmpDirRevisions, nbDb))
+			store, err := (&storages.Bolt{}).Creator()(u)
+			Expect(err).ToNot(HaveOccurred())
+			return store
+		},
+		"s3": func() storages.Store {
+			if caBundle, ok := os.LookupEnv("AWS_CA_BUNDLE"); ok {
+				Expect(os.Unsetenv("AWS_CA_BUNDLE")).To(Succeed())
+				DeferCleanup(os.Setenv, "AWS_CA_BUNDLE", caBundle)
+			}
+			backend := s3mem.New()
+			Expect(backend.CreateBucket("statusetat")).To(Succeed())
+			server := httptest.NewTLSServer(gofakes3.New(backend).Server())
+			DeferCleanup(server.Close)
+			store, err := newS3Store("s3://key:secret@" + strings.TrimPrefix(server.URL, "https://") + "/statusetat?insecure-skip-verify=true")
+			Expect(err).ToNot(HaveOccurred())
+			return store
+		},
+	}
+
+	for name, builder := range storeBuilders {
+		name, builder := name, builder
+		Context(fmt.Sprintf("with %s store", name), func() {
+			var store storages.Store
+			BeforeEach(func() {
+				store = builder()
+				_, err := store.Create(models.Incident{GUID: "inc1", CreatedAt: base, UpdatedAt: base})
+				Expect(err).ToNot(HaveOccurred())
+			})
+			AfterEach(func() {
+				utils.RemoveDir(tmpDirRevisions)
+			})
+			It("should give revisions of an incident oldest first", func() {
+				second := models.Revision{
+					GUID: "rev2", IncidentGUID: "inc1", CreatedAt: base.Add(time.Hour), Actor: "admin", Action: models.RevisionUpdated,
+					Changes: []models.FieldChange{{Field: "state", Previous: []byte("0"), Current: []byte("1")}},
+				}
+				first := models.Revision{
+					GUID: "rev1", IncidentGUID: "inc1", CreatedAt: base, Actor: "admin", Action: models.RevisionCreated,
+					Changes: []models.FieldChange{{Field: "messages.msg1.title", Current: []byte(`"Api is down"`)}},
+				}
+				Expect(store.AddRevision(second)).To(Succeed())
+				Expect(store.AddRevision(first)).To(Succeed())
+				Expect(store.AddRevision(models.Revision{GUID: "other", IncidentGUID: "inc2", CreatedAt: base})).To(Succeed())
+
+				revisions, err := store.Revisions("inc1")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(revisions).To(HaveLen(2))
+				Expect(revisions[0].GUID).To(Equal("rev1"))
+				Expect(revisions[0].CreatedAt.Equal(base)).To(BeTrue())
+				Expect(revisions[0].Action).To(Equal(models.RevisionCreated))
+				Expect(revisions[0].Changes).To(HaveLen(1))
+				Expect(revisions[0].Changes[0].Previous).To(BeEmpty())
+				Expect(revisions[0].Changes[0].CurrentText()).To(Equal("Api is down"))
+				Expect(revisions[1].GUID).To(Equal("rev2"))
+				Expect(revisions[1].Actor).To(Equal("admin"))
+				Expect(revisions[1].Changes[0].Previous).To(BeEquivalentTo("0"))
+				Expect(revisions[1].Changes[0].Current).To(BeEquivalentTo("1"))
+			})
+			It("should give no revisions for an incident without revisions", func() {
+				revisions, err := store.Revisions("inc1")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(revisions).To(BeEmpty())
+			})
+			It("should keep revisions when incident is deleted and not take them as incidents", func() {
+				Expect(store.AddRevision(models.Revision{GUID: "rev1", IncidentGUID: "inc1", CreatedAt: base})).To(Succeed())
+
+				incidents, err := store.ByDate(base.Add(-time.Hour), base.Add(time.Hour))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(incidents).To(HaveLen(1))
+
+				Expect(store.Delete("inc1")).To(Succeed())
+				revisions, err := store.Revisions("inc1")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(revisions).To(HaveLen(1))
+			})
+		})
+	}
+})
@@ -4,21 +4,38 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	log "github.com/sirupsen/logrus"
+
 	"github.com/orange-cloudfoundry/statusetat/v2/common"
 	"github.com/orange-cloudfoundry/statusetat/v2/models"
 	"github.com/orange-cloudfoundry/statusetat/v2/utils"
 )
 
+const (
+	s3IndexFilename   = "index.json"
+	s3IncidentsPrefix = "incidents/"
+	// s3IndexAttempts is how many times index is changed again when another instance wrote it meanwhile
+	s3IndexAttempts = 10
+	// s3SearchCacheTTL is how long an incident not found in partitions is not searched again
+	s3SearchCacheTTL = 5 * time.Minute
+)
+
 type s3Session struct {
 	bucket string
 	path   string
@@ -26,8 +43,20 @@ type s3Session struct {
 	cfg    aws.Config
 }
 
+// S3 stores incidents under keys partitioned by creation date (incidents/<year>/<month>/<guid>),
+// an index object maps each incident to its key to find it without knowing its creation date.
+// Index is shared by all instances using the bucket, it is changed with conditional writes to never lose
+// entries written by another instance, in memory index is only a cache of it.
 type S3 struct {
-	sess *s3Session
+	sess    *s3Session
+	index   map[string]string
+	indexMu *sync.Mutex
+	// searched keeps when incidents not found in index were searched in vain in partitions
+	searched map[string]time.Time
+}
+
+type s3Index struct {
+	Incidents map[string]string `json:"incidents"`
 }
 
 func (s *S3) Create(incident models.Incident) (models.Incident, error) {
@@ -35,13 +64,26 @@ func (s *S3) Create(incident models.Incident) (models.Incident, error) {
 		err := s.addPersistent(incident)
 		return incident, err
 	}
-	b, _ := json.Marshal(incident)
-	_, err := s.sess.client.PutObject(context.TODO(), &s3.PutObjectInput{
-		Bucket: aws.String(s.sess.bucket),
-		Key:    aws.String(incident.GUID),
-		Body:   bytes.NewBuffer(b),
-	})
+	key := incidentKey(incident)
+	err := s.putJSON(key, incident)
+	if err != nil {
+		return incident, err
+	}
 
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+	var previousKey string
+	err = s.updateIndex(func(index map[string]string) {
+		previousKey = index[incident.GUID]
+		index[incident.GUID] = key
+	})
+	if err != nil {
+		return incident, err
+	}
+	if previousKey != "" && previousKey != key {
+		// creation date changed to another month
+		err = s.deleteObject(previousKey)
+	}
 	return incident, err
 }
 
@@ -52,7 +94,7 @@ func (s *S3) retrieveSubscribers() ([]string, error) {
 	})
 	if err != nil {
 		if strings.Contains(err.Error(), "NoSuchKey") || strings.Contains(err.Error(), "404") {
-			return []string{}, os.ErrNotExist
+			return []string{}, nil
 		}
 		return []string{}, err
 	}
@@ -85,13 +127,17 @@ func (s *S3) addPersistent(incident models.Incident) error {
 	return s.storePersistents(incidents)
 }
 
-func (s *S3) removePersistent(guid string) error {
+// removePersistent removes persistent incident, it gives false if incident was not a persistent one.
+func (s *S3) removePersistent(guid string) (bool, error) {
 	incidents, err := s.Persistents()
 	if err != nil {
-		return err
+		return false, err
 	}
-	incidents = models.Incidents(incidents).Filter(guid)
-	return s.storePersistents(incidents)
+	filtered := models.Incidents(incidents).Filter(guid)
+	if len(filtered) == len(incidents) {
+		return false, nil
+	}
+	return true, s.storePersistents(filtered)
 }
 
 func (s *S3) readPersistent(guid string) (models.Incident, error) {
@@ -103,7 +149,10 @@ func (s *S3) readPersistent(guid string) (models.Incident, error) {
 }
 
 func (s *S3) Subscribe(email string) error {
-	subs, _ := s.retrieveSubscribers()
+	subs, err := s.retrieveSubscribers()
+	if err != nil {
+		return err
+	}
 	if common.InStrSlice(email, subs) {
 		return nil
 	}
@@ -141,31 +190,96 @@ func (s *S3) Update(guid string, incident models.Incident) (models.Incident, err
 		err := s.addPersistent(incident)
 		return incident, err
 	}
-	_ = s.removePersistent(guid) // nolint
+	_, _ = s.removePersistent(guid) // nolint
 	incident.GUID = guid
 	return s.Create(incident)
 }
 
+// UpdateIfVersion writes incident in place of the object read to check its version with a conditional put
+// on entity tag of this object, it fails when another instance wrote it meanwhile.
+// Incident is moved afterward when it changes of partition or between persistent and not persistent incidents.
+func (s *S3) UpdateIfVersion(guid string, version int, incident models.Incident) (models.Incident, error) {
+	incident.GUID = guid
+	s.indexMu.Lock()
+	key, found := s.keyOf(guid)
+	s.indexMu.Unlock()
+	if !found {
+		return s.updatePersistentIfVersion(guid, version, incident)
+	}
+	var current models.Incident
+	etag, err := s.getJSONWithETag(key, &current)
+	if os.IsNotExist(err) {
+		return s.updatePersistentIfVersion(guid, version, incident)
+	}
+	if err != nil {
+		return incident, err
+	}
+	if err := checkVersion(current, version); err != nil {
+		return incident, err
+	}
+	err = s.putJSONIfMatch(key, incident, etag)
+	if err != nil || (!incident.Persistent && incidentKey(incident) == key) {
+		return incident, err
+	}
+	return s.Update(guid, incident)
+}
+
+func (s *S3) updatePersistentIfVersion(guid string, version int, incident models.Incident) (models.Incident, error) {
+	var incidents []models.Incident
+	etag, err := s.getJSONWithETag(persistentFilename, &incidents)
+	if err != nil {
+		return incident, err
+	}
+	current := models.Incidents(incidents).Find(guid)
+	if current.GUID != guid {
+		return incident, os.ErrNotExist
+	}
+	if err := checkVersion(current, version); err != nil {
+		return incident, err
+	}
+	incidents = append(models.Incidents(incidents).Filter(guid), incident)
+	sort.Sort(models.Incidents(incidents))
+	err = s.putJSONIfMatch(persistentFilename, incidents, etag)
+	if err != nil || incident.Persistent {
+		return incident, err
+	}
+	return s.Update(guid, incident)
+}
+
 func (s *S3) Delete(guid string) error {
-	err := s.removePersistent(guid)
+	persistent, err := s.removePersistent(guid)
 	if err != nil {
 		return err
 	}
-	_, err = s.sess.client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
-		Bucket: aws.String(s.sess.bucket),
-		Key:    aws.String(guid),
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+	key, found := s.keyOf(guid)
+	if !found {
+		if persistent {
+			return nil
+		}
+		return os.ErrNotExist
+	}
+	err = s.deleteObject(key)
+	if err != nil {
+		return err
+	}
+	return s.updateIndex(func(index map[string]string) {
+		delete(index, guid)
 	})
-	return err
 }
 
 func (s *S3) Read(guid string) (models.Incident, error) {
 	var incident models.Incident
-	obj, err := s.sess.client.GetObject(context.TODO(), &s3.GetObjectInput{
-		Bucket: aws.String(s.sess.bucket),
-		Key:    aws.String(guid),
-	})
+	s.indexMu.Lock()
+	key, found := s.keyOf(guid)
+	s.indexMu.Unlock()
+	err := os.ErrNotExist
+	if found {
+		err = s.getJSON(key, &incident)
+	}
 	if err != nil {
-		if strings.Contains(err.Error(), "NoSuchKey") || strings.Contains(err.Error(), "404") {
+		if os.IsNotExist(err) {
 			incident, err := s.readPersistent(guid)
 			if err != nil {
 				return models.Incident{}, os.ErrNotExist
@@ -177,42 +291,172 @@ func (s *S3) Read(guid string) (models.Incident, error) {
 		}
 		return models.Incident{}, err
 	}
-	defer utils.CloseAndLogError(obj.Body)
-	err = json.NewDecoder(obj.Body).Decode(&incident)
-	if err != nil {
-		return models.Incident{}, err
-	}
 	sort.Sort(models.Messages(incident.Messages))
 	return incident, nil
 }
 
 func (s *S3) ByDate(from, to time.Time) ([]models.Incident, error) {
-	objs, err := s.sess.client.ListObjects(context.TODO(), &s3.ListObjectsInput{
-		Bucket: aws.String(s.sess.bucket),
-	})
+	incidents, err := s.incidentsInRange(from, to)
 	if err != nil {
-		return []models.Incident{}, err
+		return make([]models.Incident, 0), err
+	}
+	return incidents, nil
+}
+
+// Query only reads partitions in range of query dates and cursor.
+func (s *S3) Query(query IncidentQuery) (IncidentPage, error) {
+	if err := query.Validate(); err != nil {
+		return IncidentPage{}, err
+	}
+	cursor, _ := decodeCursor(query.Cursor)
+	from, to := query.From, query.To
+	if from.IsZero() {
+		from = time.Unix(0, 0)
+	}
+	if to.IsZero() {
+		to = time.Now().AddDate(100, 0, 0)
 	}
+	if cursor != nil && cursor.createdAt.Before(to) {
+		to = cursor.createdAt
+	}
+	incidents, err := s.incidentsInRange(from, to)
+	if err != nil {
+		return IncidentPage{}, err
+	}
+	return queryIncidents(incidents, query)
+}
+
+// incidentsInRange only lists partitions (years then months) which are in the requested range.
+func (s *S3) incidentsInRange(from, to time.Time) ([]models.Incident, error) {
 	incidents := make([]models.Incident, 0)
-	for _, obj := range objs.Contents {
-		if *obj.Key == subscriberFilename ||
-			*obj.Key == persistentFilename {
+	fromMonth := monthNumber(from)
+	toMonth := monthNumber(to)
+
+	yearPrefixes, err := s.listPrefixes(s3IncidentsPrefix)
+	if err != nil {
+		return incidents, err
+	}
+	for _, yearPrefix := range yearPrefixes {
+		year, err := strconv.Atoi(path.Base(yearPrefix))
+		if err != nil || year < from.UTC().Year() || year > to.UTC().Year() {
 			continue
 		}
-
-		incident, err := s.Read(*obj.Key)
+		monthPrefixes, err := s.listPrefixes(yearPrefix)
 		if err != nil {
 			return incidents, err
 		}
-		if incident.CreatedAt.Before(from) || incident.CreatedAt.After(to) {
-			continue
+		for _, monthPrefix := range monthPrefixes {
+			month, err := strconv.Atoi(path.Base(monthPrefix))
+			if err != nil || year*12+month < fromMonth || year*12+month > toMonth {
+				continue
+			}
+			keys, err := s.listKeys(monthPrefix, "")
+			if err != nil {
+				return incidents, err
+			}
+			for _, key := range keys {
+				var incident models.Incident
+				err := s.getJSON(key, &incident)
+				if err != nil {
+					return incidents, err
+				}
+				if incident.CreatedAt.Before(from) || incident.CreatedAt.After(to) {
+					continue
+				}
+				sort.Sort(models.Messages(incident.Messages))
+				incidents = append(incidents, incident)
+			}
 		}
-		sort.Sort(models.Messages(incident.Messages))
-		incidents = append(incidents, incident)
 	}
 	return incidents, nil
 }
 
+// revisionKey gives key of a revision, keys of revisions of an incident sort by creation date of revisions.
+func revisionKey(revision models.Revision) string {
+	return fmt.Sprintf("%s/%s/%020d-%s", revisionsFolder, revision.IncidentGUID, revision.CreatedAt.UnixNano(), revision.GUID)
+}
+
+func (s *S3) AddRevision(revision models.Revision) error {
+	return s.putJSON(revisionKey(revision), revision)
+}
+
+func (s *S3) Revisions(incidentGuid string) ([]models.Revision, error) {
+	revisions := make([]models.Revision, 0)
+	keys, err := s.listKeys(revisionsFolder+"/"+incidentGuid+"/", "")
+	if err != nil {
+		return revisions, err
+	}
+	for _, key := range keys {
+		var revision models.Revision
+		err := s.getJSON(key, &revision)
+		if err != nil {
+			return []models.Revision{}, err
+		}
+		revisions = append(revisions, revision)
+	}
+	sort.Sort(models.Revisions(revisions))
+	return revisions, nil
+}
+
+func (s *S3) ReplaceRevisions(change func(revision models.Revision) (models.Revision, error)) error {
+	keys, err := s.listKeys(revisionsFolder+"/", "")
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		var revision models.Revision
+		err := s.getJSON(key, &revision)
+		if err != nil {
+			return err
+		}
+		revision, err = change(revision)
+		if err != nil {
+			return err
+		}
+		err = s.putJSON(key, revision)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func trashKey(guid string) string {
+	return trashFolder + "/" + guid
+}
+
+func (s *S3) AddTrashed(trashed models.TrashedIncident) error {
+	return s.putJSON(trashKey(trashed.Incident.GUID), trashed)
+}
+
+func (s *S3) Trashed() ([]models.TrashedIncident, error) {
+	trashed := make([]models.TrashedIncident, 0)
+	keys, err := s.listKeys(trashFolder+"/", "")
+	if err != nil {
+		return trashed, err
+	}
+	for _, key := range keys {
+		var t models.TrashedIncident
+		err := s.getJSON(key, &t)
+		if err != nil {
+			return []models.TrashedIncident{}, err
+		}
+		trashed = append(trashed, t)
+	}
+	sort.Sort(models.TrashedIncidents(trashed))
+	return trashed, nil
+}
+
+func (s *S3) DeleteTrashed(guid string) error {
+	// deleting a missing object is not an error in s3
+	var t models.TrashedIncident
+	err := s.getJSON(trashKey(guid), &t)
+	if err != nil {
+		return err
+	}
+	return s.deleteObject(trashKey(guid))
+}
+
 func (s *S3) Ping() error {
 	_, err := s.sess.client.HeadBucket(context.TODO(), &s3.HeadBucketInput{
 		Bucket: aws.String(s.sess.bucket),
@@ -222,12 +466,26 @@ func (s *S3) Ping() error {
 
 func (s *S3) Creator() func(u *url.URL) (Store, error) {
 	return func(u *url.URL) (Store, error) {
-		s := &S3{}
+		s := &S3{
+			index:    make(map[string]string),
+			indexMu:  &sync.Mutex{},
+			searched: make(map[string]time.Time),
+		}
 		sess, err := s.urlToSession(u)
 		if err != nil {
 			return nil, err
 		}
 		s.sess = sess
+		err = s.loadIndex()
+		indexMissing := os.IsNotExist(err)
+		if err != nil && !indexMissing {
+			return nil, err
+		}
+		// instances of a previous version may still write at bucket root during a rolling deployment
+		err = s.migrateLayout(indexMissing)
+		if err != nil {
+			return nil, err
+		}
 		return s, nil
 	}
 }
@@ -335,3 +593,366 @@ func (s *S3) extractBucketPath(u *url.URL) (bucket string, path string) {
 	split := strings.Split(u.Path, "/")
 	return split[1], strings.Join(split[2:], "/")
 }
+
+// incidentKey gives key of incident partitioned by its creation year and month.
+func incidentKey(incident models.Incident) string {
+	createdAt := incident.CreatedAt.UTC()
+	return fmt.Sprintf("%s%04d/%02d/%s", s3IncidentsPrefix, createdAt.Year(), createdAt.Month(), incident.GUID)
+}
+
+func monthNumber(t time.Time) int {
+	t = t.UTC()
+	return t.Year()*12 + int(t.Month())
+}
+
+// keyOf gives key of incident, index is reloaded when guid is unknown as it may have been created by another instance.
+// Partitions are searched when incident can't be found in index, e.g. when another instance failed to write index
+// after writing incident, index is then repaired. An incident searched in vain is not searched again before
+// s3SearchCacheTTL to not send requests on each partition for every unknown guid.
+// It gives false when incident does not exist or is persistent. Must be called with index lock held.
+func (s *S3) keyOf(guid string) (string, bool) {
+	if key, ok := s.index[guid]; ok {
+		return key, true
+	}
+	err := s.loadIndex()
+	if err != nil {
+		log.Warningf("Could not reload s3 index: %s", err.Error())
+	}
+	if key, ok := s.index[guid]; ok {
+		return key, true
+	}
+	if searchedAt, ok := s.searched[guid]; ok && time.Since(searchedAt) < s3SearchCacheTTL {
+		return "", false
+	}
+	// persistent incidents are not in partitions
+	if incident, err := s.readPersistent(guid); err == nil && incident.GUID == guid {
+		return "", false
+	}
+	key, err := s.findKey(guid)
+	if err != nil {
+		if os.IsNotExist(err) {
+			s.searchedInVain(guid)
+		} else {
+			log.Warningf("Could not search incident %s in s3 partitions: %s", guid, err.Error())
+		}
+		return "", false
+	}
+	err = s.updateIndex(func(index map[string]string) {
+		if _, ok := index[guid]; !ok {
+			index[guid] = key
+		}
+	})
+	if err != nil {
+		log.Warningf("Could not add incident %s to s3 index: %s", guid, err.Error())
+	}
+	return key, true
+}
+
+// searchedInVain records that incident has been searched in vain, expired records are removed meanwhile.
+func (s *S3) searchedInVain(guid string) {
+	now := time.Now()
+	for searchedGuid, searchedAt := range s.searched {
+		if now.Sub(searchedAt) >= s3SearchCacheTTL {
+			delete(s.searched, searchedGuid)
+		}
+	}
+	s.searched[guid] = now
+}
+
+// findKey searches incident at bucket root, where a previous version stores it, and then in each month partition,
+// an incident found at bucket root is moved to its partition. os.ErrNotExist is given when it is in none of them.
+func (s *S3) findKey(guid string) (string, error) {
+	if isLegacyIncidentKey(guid) {
+		exists, err := s.objectExists(guid)
+		if err != nil {
+			return "", err
+		}
+		if exists {
+			key, err := s.migrateIncident(guid)
+			if !os.IsNotExist(err) {
+				return key, err
+			}
+		}
+	}
+	yearPrefixes, err := s.listPrefixes(s3IncidentsPrefix)
+	if err != nil {
+		return "", err
+	}
+	for _, yearPrefix := range yearPrefixes {
+		monthPrefixes, err := s.listPrefixes(yearPrefix)
+		if err != nil {
+			return "", err
+		}
+		for _, monthPrefix := range monthPrefixes {
+			key := monthPrefix + guid
+			exists, err := s.objectExists(key)
+			if err != nil {
+				return "", err
+			}
+			if exists {
+				return key, nil
+			}
+		}
+	}
+	return "", os.ErrNotExist
+}
+
+func (s *S3) loadIndex() error {
+	var index s3Index
+	err := s.getJSON(s3IndexFilename, &index)
+	if err != nil {
+		return err
+	}
+	if index.Incidents == nil {
+		index.Incidents = make(map[string]string)
+	}
+	s.index = index.Incidents
+	return nil
+}
+
+// updateIndex applies change on index as currently stored and writes it only if no other instance wrote it meanwhile,
+// index is read and change is applied again otherwise. In memory index is replaced by index written.
+// Must be called with index lock held.
+func (s *S3) updateIndex(change func(index map[string]string)) error {
+	for attempt := 0; attempt < s3IndexAttempts; attempt++ {
+		var index s3Index
+		etag, err := s.getJSONWithETag(s3IndexFilename, &index)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if index.Incidents == nil {
+			index.Incidents = make(map[string]string)
+		}
+		change(index.Incidents)
+		err = s.putJSONIfMatch(s3IndexFilename, index, etag)
+		if errors.Is(err, ErrVersionConflict) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		s.index = index.Incidents
+		return nil
+	}
+	return fmt.Errorf("could not write s3 index, it has been changed by other instances %d times in a row", s3IndexAttempts)
+}
+
+// isLegacyIncidentKey tells if key is the one of an incident stored at bucket root (layout before partitioning).
+func isLegacyIncidentKey(key string) bool {
+	return key != "" && key != subscriberFilename && key != persistentFilename && key != s3IndexFilename &&
+		!strings.Contains(key, "/")
+}
+
+// migrateLayout moves incidents stored at bucket root (layout before partitioning) to their partitioned key,
+// it is run on each start as instances of a previous version may still write there during a rolling deployment.
+// Incidents already in partitions are added to index when indexPartitions is set, i.e. when there is no index yet.
+// Instances started together can run it concurrently: incidents already moved by another instance are skipped
+// and each step can be run again if an instance stops in between.
+func (s *S3) migrateLayout(indexPartitions bool) error {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+	keys, err := s.listKeys("", "/")
+	if err != nil {
+		return err
+	}
+	moved := 0
+	for _, key := range keys {
+		if !isLegacyIncidentKey(key) {
+			continue
+		}
+		_, err := s.migrateIncident(key)
+		if os.IsNotExist(err) {
+			// moved by another instance meanwhile
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		moved++
+	}
+	if moved > 0 {
+		log.WithField("bucket", s.sess.bucket).Infof("Migrated %d incident(s) to date partitioned layout", moved)
+	}
+	if !indexPartitions {
+		return nil
+	}
+	keys, err = s.listKeys(s3IncidentsPrefix, "")
+	if err != nil {
+		return err
+	}
+	return s.updateIndex(func(index map[string]string) {
+		for _, key := range keys {
+			guid := path.Base(key)
+			if _, ok := index[guid]; !ok {
+				index[guid] = key
+			}
+		}
+	})
+}
+
+// migrateIncident moves incident stored at key at bucket root to its partitioned key and gives this key,
+// os.ErrNotExist is given when incident has been moved by another instance meanwhile.
+// Must be called with index lock held.
+func (s *S3) migrateIncident(key string) (string, error) {
+	var incident models.Incident
+	err := s.getJSON(key, &incident)
+	if os.IsNotExist(err) {
+		return "", err
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not read incident %s to migrate: %s", key, err.Error())
+	}
+	newKey := incidentKey(incident)
+	var current models.Incident
+	etag, err := s.getJSONWithETag(newKey, &current)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	// incident already moved is only overwritten by a change made since at bucket root by an instance
+	// of a previous version, which does not know versions
+	if etag == "" || incident.UpdatedAt.After(current.UpdatedAt) {
+		if etag != "" && incident.Version <= current.Version {
+			incident.Version = current.Version + 1
+		}
+		err = s.putJSONIfMatch(newKey, incident, etag)
+		// written meanwhile by another instance, which is then fresher
+		if err != nil && !errors.Is(err, ErrVersionConflict) {
+			return "", err
+		}
+	}
+	// index is stored before removing old object to never lose an incident
+	err = s.updateIndex(func(index map[string]string) {
+		index[incident.GUID] = newKey
+	})
+	if err != nil {
+		return "", err
+	}
+	return newKey, s.deleteObject(key)
+}
+
+func (s *S3) putJSON(key string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = s.sess.client.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket: aws.String(s.sess.bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewBuffer(b),
+	})
+	return err
+}
+
+// putJSONIfMatch writes v at key only if object still has entity tag etag, or if object does not exist when etag
+// is empty, ErrVersionConflict is given otherwise.
+func (s *S3) putJSONIfMatch(key string, v interface{}, etag string) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(s.sess.bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewBuffer(b),
+	}
+	if etag == "" {
+		input.IfNoneMatch = aws.String("*")
+	} else {
+		input.IfMatch = aws.String(etag)
+	}
+	_, err = s.sess.client.PutObject(context.TODO(), input)
+	var respErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &respErr) &&
+		(respErr.HTTPStatusCode() == http.StatusPreconditionFailed || respErr.HTTPStatusCode() == http.StatusConflict) {
+		// conflict is given by s3 when a concurrent conditional write is in progress
+		return ErrVersionConflict
+	}
+	return err
+}
+
+// getJSON decodes object at key in v, os.ErrNotExist is given when object does not exist.
+func (s *S3) getJSON(key string, v interface{}) error {
+	_, err := s.getJSONWithETag(key, v)
+	return err
+}
+
+// getJSONWithETag works as getJSON and gives entity tag of object read.
+func (s *S3) getJSONWithETag(key string, v interface{}) (string, error) {
+	obj, err := s.sess.client.GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: aws.String(s.sess.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "NoSuchKey") || strings.Contains(err.Error(), "404") {
+			return "", os.ErrNotExist
+		}
+		return "", err
+	}
+	defer utils.CloseAndLogError(obj.Body)
+	return aws.ToString(obj.ETag), json.NewDecoder(obj.Body).Decode(v)
+}
+
+// objectExists tells if there is an object at key.
+func (s *S3) objectExists(key string) (bool, error) {
+	_, err := s.sess.client.HeadObject(context.TODO(), &s3.HeadObjectInput{
+		Bucket: aws.String(s.sess.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "NotFound") || strings.Contains(err.Error(), "404") {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *S3) deleteObject(key string) error {
+	_, err := s.sess.client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
+		Bucket: aws.String(s.sess.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+func (s *S3) listKeys(prefix, delimiter string) ([]string, error) {
+	keys := make([]string, 0)
+	err := s.list(prefix, delimiter, func(output *s3.ListObjectsV2Output) {
+		for _, obj := range output.Contents {
+			keys = append(keys, aws.ToString(obj.Key))
+		}
+	})
+	return keys, err
+}
+
+// listPrefixes gives "folders" directly under prefix.
+func (s *S3) listPrefixes(prefix string) ([]string, error) {
+	prefixes := make([]string, 0)
+	err := s.list(prefix, "/", func(output *s3.ListObjectsV2Output) {
+		for _, commonPrefix := range output.CommonPrefixes {
+			prefixes = append(prefixes, aws.ToString(commonPrefix.Prefix))
+		}
+	})
+	return prefixes, err
+}
+
+func (s *S3) list(prefix, delimiter string, page func(output *s3.ListObjectsV2Output)) error {
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.sess.bucket),
+	}
+	if prefix != "" {
+		input.Prefix = aws.String(prefix)
+	}
+	if delimiter != "" {
+		input.Delimiter = aws.String(delimiter)
+	}
+	paginator := s3.NewListObjectsV2Paginator(s.sess.client, input)
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return err
+		}
+		page(output)
+	}
+	return nil
+}
@@ -0,0 +1,321 @@
+package storages_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+	"github.com/orange-cloudfoundry/statusetat/v2/storages"
+)
+
+func newS3Store(s3Url string) (storages.Store, error) {
+	u, _ := url.Parse(s3Url)
+	return (&storages.S3{}).Creator()(u)
+}
+
+var _ = Describe("S3", func() {
+	var s3Storage storages.Store
+	var backend *s3mem.Backend
+	var server *httptest.Server
+	var s3Url string
+	BeforeEach(func() {
+		// a ca bundle from environment can't be set on the http client used by s3 store
+		if caBundle, ok := os.LookupEnv("AWS_CA_BUNDLE"); ok {
+			Expect(os.Unsetenv("AWS_CA_BUNDLE")).To(Succeed())
+			DeferCleanup(os.Setenv, "AWS_CA_BUNDLE", caBundle)
+		}
+		backend = s3mem.New()
+		Expect(backend.CreateBucket("statusetat")).To(Succeed())
+		server = httptest.NewTLSServer(gofakes3.New(backend).Server())
+		s3Url = "s3://key:secret@" + strings.TrimPrefix(server.URL, "https://") + "/statusetat?insecure-skip-verify=true"
+		var err error
+		s3Storage, err = newS3Store(s3Url)
+		Expect(err).ToNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+	objectKeys := func() []string {
+		result, err := backend.ListBucket("statusetat", nil, gofakes3.ListBucketPage{})
+		Expect(err).ToNot(HaveOccurred())
+		keys := make([]string, 0)
+		for _, obj := range result.Contents {
+			keys = append(keys, obj.Key)
+		}
+		return keys
+	}
+	indexedGuids := func() []string {
+		obj, err := backend.GetObject("statusetat", "index.json", nil)
+		Expect(err).ToNot(HaveOccurred())
+		defer obj.Contents.Close()
+		var index struct {
+			Incidents map[string]string `json:"incidents"`
+		}
+		Expect(json.NewDecoder(obj.Contents).Decode(&index)).To(Succeed())
+		guids := make([]string, 0)
+		for guid := range index.Incidents {
+			guids = append(guids, guid)
+		}
+		return guids
+	}
+	Context("Create", func() {
+		It("should store incident under a key partitioned by creation year and month", func() {
+			inc := models.Incident{
+				GUID:      "aguid",
+				CreatedAt: time.Date(2024, time.March, 2, 10, 0, 0, 0, time.UTC),
+			}
+			_, err := s3Storage.Create(inc)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(objectKeys()).To(ContainElements("incidents/2024/03/aguid", "index.json"))
+
+			newInc, err := s3Storage.Read(inc.GUID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(newInc.GUID).To(Equal(inc.GUID))
+		})
+	})
+	Context("Update", func() {
+		It("should move incident when creation date changes of month", func() {
+			inc := models.Incident{
+				GUID:      "aguid",
+				CreatedAt: time.Date(2024, time.March, 2, 10, 0, 0, 0, time.UTC),
+			}
+			_, err := s3Storage.Create(inc)
+			Expect(err).ToNot(HaveOccurred())
+
+			inc.CreatedAt = time.Date(2024, time.April, 2, 10, 0, 0, 0, time.UTC)
+			_, err = s3Storage.Update(inc.GUID, inc)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(objectKeys()).To(ContainElement("incidents/2024/04/aguid"))
+			Expect(objectKeys()).ToNot(ContainElement("incidents/2024/03/aguid"))
+
+			newInc, err := s3Storage.Read(inc.GUID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(newInc.CreatedAt).To(BeTemporally("==", inc.CreatedAt))
+		})
+	})
+	Context("Delete", func() {
+		It("should remove incident and its index entry", func() {
+			inc := models.Incident{
+				GUID:      "aguid",
+				CreatedAt: time.Date(2024, time.March, 2, 10, 0, 0, 0, time.UTC),
+			}
+			_, err := s3Storage.Create(inc)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(s3Storage.Delete(inc.GUID)).To(Succeed())
+			Expect(objectKeys()).ToNot(ContainElement("incidents/2024/03/aguid"))
+
+			_, err = s3Storage.Read(inc.GUID)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Context("ByDate", func() {
+		It("should only give incidents in range", func() {
+			for i, createdAt := range []time.Time{
+				time.Date(2023, time.December, 31, 10, 0, 0, 0, time.UTC),
+				time.Date(2024, time.January, 15, 10, 0, 0, 0, time.UTC),
+				time.Date(2024, time.February, 1, 10, 0, 0, 0, time.UTC),
+				time.Date(2024, time.March, 1, 10, 0, 0, 0, time.UTC),
+			} {
+				_, err := s3Storage.Create(models.Incident{
+					GUID:      []string{"dec", "jan", "feb", "mar"}[i],
+					CreatedAt: createdAt,
+				})
+				Expect(err).ToNot(HaveOccurred())
+			}
+
+			incidents, err := s3Storage.ByDate(
+				time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, time.February, 15, 0, 0, 0, 0, time.UTC),
+			)
+			Expect(err).ToNot(HaveOccurred())
+			guids := make([]string, 0)
+			for _, incident := range incidents {
+				guids = append(guids, incident.GUID)
+			}
+			Expect(guids).To(ConsistOf("jan", "feb"))
+		})
+	})
+	Context("Creator", func() {
+		It("should migrate incidents stored at bucket root", func() {
+			backend = s3mem.New()
+			Expect(backend.CreateBucket("statusetat")).To(Succeed())
+			server.Config.Handler = gofakes3.New(backend).Server()
+
+			for _, inc := range []models.Incident{
+				{GUID: "old1", CreatedAt: time.Date(2023, time.May, 2, 10, 0, 0, 0, time.UTC)},
+				{GUID: "old2", CreatedAt: time.Date(2024, time.June, 2, 10, 0, 0, 0, time.UTC)},
+			} {
+				b, _ := json.Marshal(inc)
+				_, err := backend.PutObject("statusetat", inc.GUID, map[string]string{}, bytes.NewReader(b), int64(len(b)), nil)
+				Expect(err).ToNot(HaveOccurred())
+			}
+			b, _ := json.Marshal([]string{"email@local"})
+			_, err := backend.PutObject("statusetat", "subscribers.json", map[string]string{}, bytes.NewReader(b), int64(len(b)), nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			store, err := newS3Store(s3Url)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(objectKeys()).To(ConsistOf(
+				"incidents/2023/05/old1",
+				"incidents/2024/06/old2",
+				"index.json",
+				"subscribers.json",
+			))
+
+			inc, err := store.Read("old1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(inc.GUID).To(Equal("old1"))
+
+			incidents, err := store.ByDate(
+				time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, time.December, 31, 0, 0, 0, 0, time.UTC),
+			)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(incidents).To(HaveLen(1))
+			Expect(incidents[0].GUID).To(Equal("old2"))
+
+			subs, err := store.Subscribers()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(subs).To(ConsistOf("email@local"))
+		})
+		It("should keep index entries written by another instance", func() {
+			other, err := newS3Store(s3Url)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = s3Storage.Create(models.Incident{GUID: "first", CreatedAt: time.Now()})
+			Expect(err).ToNot(HaveOccurred())
+			_, err = other.Create(models.Incident{GUID: "second", CreatedAt: time.Now()})
+			Expect(err).ToNot(HaveOccurred())
+			_, err = s3Storage.Create(models.Incident{GUID: "third", CreatedAt: time.Now()})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(indexedGuids()).To(ConsistOf("first", "second", "third"))
+
+			Expect(s3Storage.Delete("second")).To(Succeed())
+			Expect(indexedGuids()).To(ConsistOf("first", "third"))
+		})
+		It("should find incidents missing from index in partitions", func() {
+			inc := models.Incident{GUID: "unindexed", CreatedAt: time.Date(2024, time.March, 2, 10, 0, 0, 0, time.UTC)}
+			b, _ := json.Marshal(inc)
+			_, err := backend.PutObject("statusetat", "incidents/2024/03/unindexed", map[string]string{}, bytes.NewReader(b), int64(len(b)), nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			read, err := s3Storage.Read("unindexed")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(read.GUID).To(Equal("unindexed"))
+			Expect(indexedGuids()).To(ConsistOf("unindexed"))
+
+			Expect(s3Storage.Delete("unindexed")).To(Succeed())
+			Expect(objectKeys()).ToNot(ContainElement("incidents/2024/03/unindexed"))
+			Expect(s3Storage.Delete("unindexed")).To(MatchError(os.ErrNotExist))
+		})
+		It("should migrate incidents stored at bucket root with instances started together", func() {
+			backend = s3mem.New()
+			Expect(backend.CreateBucket("statusetat")).To(Succeed())
+			server.Config.Handler = gofakes3.New(backend).Server()
+			guids := make([]string, 20)
+			for i := range guids {
+				guids[i] = fmt.Sprintf("old%d", i)
+				b, _ := json.Marshal(models.Incident{GUID: guids[i], CreatedAt: time.Date(2023, time.May, 2, 10, 0, 0, 0, time.UTC)})
+				_, err := backend.PutObject("statusetat", guids[i], map[string]string{}, bytes.NewReader(b), int64(len(b)), nil)
+				Expect(err).ToNot(HaveOccurred())
+			}
+
+			errs := make(chan error, 3)
+			for i := 0; i < cap(errs); i++ {
+				go func() {
+					defer GinkgoRecover()
+					_, err := newS3Store(s3Url)
+					errs <- err
+				}()
+			}
+			for i := 0; i < cap(errs); i++ {
+				Expect(<-errs).ToNot(HaveOccurred())
+			}
+
+			Expect(indexedGuids()).To(ConsistOf(guids))
+			for _, key := range objectKeys() {
+				Expect(key).To(Or(HavePrefix("incidents/2023/05/"), Equal("index.json")))
+			}
+		})
+		It("should migrate incidents written at bucket root by a previous version after index exists", func() {
+			putRoot := func(inc models.Incident) {
+				b, _ := json.Marshal(inc)
+				_, err := backend.PutObject("statusetat", inc.GUID, map[string]string{}, bytes.NewReader(b), int64(len(b)), nil)
+				Expect(err).ToNot(HaveOccurred())
+			}
+			putRoot(models.Incident{GUID: "late1", CreatedAt: time.Date(2023, time.May, 2, 10, 0, 0, 0, time.UTC)})
+
+			_, err := newS3Store(s3Url)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(objectKeys()).To(ConsistOf("incidents/2023/05/late1", "index.json"))
+
+			putRoot(models.Incident{GUID: "late2", CreatedAt: time.Date(2023, time.June, 2, 10, 0, 0, 0, time.UTC)})
+			inc, err := s3Storage.Read("late2")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(inc.GUID).To(Equal("late2"))
+			Expect(objectKeys()).To(ConsistOf("incidents/2023/05/late1", "incidents/2023/06/late2", "index.json"))
+			Expect(indexedGuids()).To(ConsistOf("late1", "late2"))
+		})
+		It("should keep change made at bucket root by a previous version after incident has been moved", func() {
+			createdAt := time.Date(2023, time.May, 2, 10, 0, 0, 0, time.UTC)
+			_, err := s3Storage.Create(models.Incident{GUID: "aguid", CreatedAt: createdAt, UpdatedAt: createdAt, Version: 2})
+			Expect(err).ToNot(HaveOccurred())
+			b, _ := json.Marshal(models.Incident{GUID: "aguid", CreatedAt: createdAt, UpdatedAt: createdAt.Add(time.Hour), Origin: "previous"})
+			_, err = backend.PutObject("statusetat", "aguid", map[string]string{}, bytes.NewReader(b), int64(len(b)), nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			store, err := newS3Store(s3Url)
+			Expect(err).ToNot(HaveOccurred())
+			inc, err := store.Read("aguid")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(inc.Origin).To(Equal("previous"))
+			Expect(inc.Version).To(Equal(3))
+			Expect(objectKeys()).To(ConsistOf("incidents/2023/05/aguid", "index.json"))
+		})
+		It("should not search partitions again for an incident searched in vain", func() {
+			for month := time.January; month <= time.June; month++ {
+				_, err := s3Storage.Create(models.Incident{GUID: fmt.Sprintf("inc%d", month), CreatedAt: time.Date(2023, month, 2, 10, 0, 0, 0, time.UTC)})
+				Expect(err).ToNot(HaveOccurred())
+			}
+			heads := 0
+			handler := server.Config.Handler
+			server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if req.Method == http.MethodHead {
+					heads++
+				}
+				handler.ServeHTTP(w, req)
+			})
+
+			_, err := s3Storage.Read("unknown")
+			Expect(err).To(MatchError(os.ErrNotExist))
+			Expect(heads).To(BeNumerically(">=", 6))
+
+			heads = 0
+			_, err = s3Storage.Read("unknown")
+			Expect(err).To(MatchError(os.ErrNotExist))
+			Expect(heads).To(Equal(0))
+		})
+		It("should find incidents created by another instance", func() {
+			other, err := newS3Store(s3Url)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = other.Create(models.Incident{GUID: "aguid", CreatedAt: time.Now()})
+			Expect(err).ToNot(HaveOccurred())
+
+			inc, err := s3Storage.Read("aguid")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(inc.GUID).To(Equal("aguid"))
+		})
+	})
+})
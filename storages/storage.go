@@ -3,6 +3,7 @@ package storages
 //go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 . Store
 
 import (
+	"errors"
 	"fmt"
 	"net/url"
 	"time"
@@ -15,11 +16,32 @@ type Store interface {
 	Detect(u *url.URL) bool
 
 	Create(incident models.Incident) (models.Incident, error)
+	// Update replaces incident with guid, it is created when it does not exist
 	Update(guid string, incident models.Incident) (models.Incident, error)
+	// UpdateIfVersion updates incident only when its stored version is still version, check and write are atomic
+	// even between instances sharing the store. ErrVersionConflict is given when incident was changed meanwhile
+	// and os.ErrNotExist when it does not exist. Version of incident given must be greater than version.
+	UpdateIfVersion(guid string, version int, incident models.Incident) (models.Incident, error)
 	Delete(guid string) error
 	Read(guid string) (models.Incident, error)
 	ByDate(from, to time.Time) ([]models.Incident, error)
 	Persistents() ([]models.Incident, error)
+	Query(query IncidentQuery) (IncidentPage, error)
+
+	// AddRevision records a revision of an incident, revisions are kept when incident is deleted
+	AddRevision(revision models.Revision) error
+	// Revisions gives revisions of an incident, oldest first
+	Revisions(incidentGuid string) ([]models.Revision, error)
+	// ReplaceRevisions writes again every revision recorded, of all incidents, as given back by change,
+	// it is used to seal them again after a key rotation. Change must keep guid, incident guid and creation date.
+	ReplaceRevisions(change func(revision models.Revision) (models.Revision, error)) error
+
+	// AddTrashed puts a deleted incident in trash, incident itself must be deleted separately
+	AddTrashed(trashed models.TrashedIncident) error
+	// Trashed gives incidents in trash, most recently trashed first
+	Trashed() ([]models.TrashedIncident, error)
+	// DeleteTrashed removes an incident from trash, it gives os.ErrNotExist when incident is not in trash
+	DeleteTrashed(guid string) error
 
 	Subscribe(email string) error
 	Unsubscribe(email string) error
@@ -28,13 +50,61 @@ type Store interface {
 	Ping() error
 }
 
+// Operations of a store, they are used to name operations in metrics and to select operations where faults are injected.
+const (
+	OpCreate           = "create"
+	OpUpdate           = "update"
+	OpUpdateIfVersion  = "update_if_version"
+	OpDelete           = "delete"
+	OpRead             = "read"
+	OpByDate           = "by_date"
+	OpPersistents      = "persistents"
+	OpQuery            = "query"
+	OpAddRevision      = "add_revision"
+	OpRevisions        = "revisions"
+	OpReplaceRevisions = "replace_revisions"
+	OpAddTrashed       = "add_trashed"
+	OpTrashed          = "trashed"
+	OpDeleteTrashed    = "delete_trashed"
+	OpSubscribe        = "subscribe"
+	OpUnsubscribe      = "unsubscribe"
+	OpSubscribers      = "subscribers"
+	OpPing             = "ping"
+)
+
+var storeOperations = []string{
+	OpCreate, OpUpdate, OpUpdateIfVersion, OpDelete, OpRead, OpByDate, OpPersistents, OpQuery,
+	OpAddRevision, OpRevisions, OpReplaceRevisions, OpAddTrashed, OpTrashed, OpDeleteTrashed,
+	OpSubscribe, OpUnsubscribe, OpSubscribers, OpPing,
+}
+
+// ErrVersionConflict is given by UpdateIfVersion when incident has been changed since version expected.
+var ErrVersionConflict = errors.New("incident has been modified by someone else")
+
+// checkVersion gives ErrVersionConflict when current incident is not at version.
+func checkVersion(current models.Incident, version int) error {
+	if current.Version != version {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
 var initStores = []Store{
-	NewRetry(&DB{}, 3),
-	NewRetry(&S3{}, 3),
-	NewRetry(&Local{}, 3),
+	NewMetrics(NewChaos(NewEncrypt(NewRetry(NewChaosUnderRetry(&DB{}), 3)))),
+	NewMetrics(NewChaos(NewEncrypt(NewRetry(NewChaosUnderRetry(&S3{}), 3)))),
+	NewMetrics(NewChaos(NewEncrypt(NewRetry(NewChaosUnderRetry(&Local{}), 3)))),
+	NewMetrics(NewChaos(NewEncrypt(NewRetry(NewChaosUnderRetry(&Bolt{}), 3)))),
+	NewMetrics(NewChaos(NewEncrypt(NewRetry(NewChaosUnderRetry(&Git{}), 3)))),
+	NewMetrics(NewChaos(NewEncrypt(NewRetry(NewChaosUnderRetry(&Redis{}), 3)))),
+	NewMetrics(NewChaos(NewChaosUnderRetry(&Memory{}))),
 }
 
 func Factory(urls []*url.URL) (Store, error) {
+	return FactoryWithOptions(urls, ReplicateOptions{})
+}
+
+// FactoryWithOptions works as Factory but allow tuning the Replicate store used when multiple urls are given.
+func FactoryWithOptions(urls []*url.URL, opts ReplicateOptions) (Store, error) {
 	if len(urls) == 0 {
 		return nil, fmt.Errorf("url store must be set")
 	}
@@ -49,7 +119,10 @@ func Factory(urls []*url.URL) (Store, error) {
 		return nil, fmt.Errorf("no valid store can be found")
 	}
 
-	repl := NewReplicate(initStores)
+	repl, err := NewReplicateWithOptions(initStores, opts)
+	if err != nil {
+		return nil, err
+	}
 	for _, u := range urls {
 		_, err := repl.Creator()(u)
 		if err != nil {
@@ -11,6 +11,28 @@ import (
 )
 
 type FakeStore struct {
+	AddRevisionStub        func(models.Revision) error
+	addRevisionMutex       sync.RWMutex
+	addRevisionArgsForCall []struct {
+		arg1 models.Revision
+	}
+	addRevisionReturns struct {
+		result1 error
+	}
+	addRevisionReturnsOnCall map[int]struct {
+		result1 error
+	}
+	AddTrashedStub        func(models.TrashedIncident) error
+	addTrashedMutex       sync.RWMutex
+	addTrashedArgsForCall []struct {
+		arg1 models.TrashedIncident
+	}
+	addTrashedReturns struct {
+		result1 error
+	}
+	addTrashedReturnsOnCall map[int]struct {
+		result1 error
+	}
 	ByDateStub        func(time.Time, time.Time) ([]models.Incident, error)
 	byDateMutex       sync.RWMutex
 	byDateArgsForCall []struct {
@@ -59,6 +81,17 @@ type FakeStore struct {
 	deleteReturnsOnCall map[int]struct {
 		result1 error
 	}
+	DeleteTrashedStub        func(string) error
+	deleteTrashedMutex       sync.RWMutex
+	deleteTrashedArgsForCall []struct {
+		arg1 string
+	}
+	deleteTrashedReturns struct {
+		result1 error
+	}
+	deleteTrashedReturnsOnCall map[int]struct {
+		result1 error
+	}
 	DetectStub        func(*url.URL) bool
 	detectMutex       sync.RWMutex
 	detectArgsForCall []struct {
@@ -92,6 +125,19 @@ type FakeStore struct {
 	pingReturnsOnCall map[int]struct {
 		result1 error
 	}
+	QueryStub        func(storages.IncidentQuery) (storages.IncidentPage, error)
+	queryMutex       sync.RWMutex
+	queryArgsForCall []struct {
+		arg1 storages.IncidentQuery
+	}
+	queryReturns struct {
+		result1 storages.IncidentPage
+		result2 error
+	}
+	queryReturnsOnCall map[int]struct {
+		result1 storages.IncidentPage
+		result2 error
+	}
 	ReadStub        func(string) (models.Incident, error)
 	readMutex       sync.RWMutex
 	readArgsForCall []struct {
@@ -105,6 +151,30 @@ type FakeStore struct {
 		result1 models.Incident
 		result2 error
 	}
+	ReplaceRevisionsStub        func(func(revision models.Revision) (models.Revision, error)) error
+	replaceRevisionsMutex       sync.RWMutex
+	replaceRevisionsArgsForCall []struct {
+		arg1 func(revision models.Revision) (models.Revision, error)
+	}
+	replaceRevisionsReturns struct {
+		result1 error
+	}
+	replaceRevisionsReturnsOnCall map[int]struct {
+		result1 error
+	}
+	RevisionsStub        func(string) ([]models.Revision, error)
+	revisionsMutex       sync.RWMutex
+	revisionsArgsForCall []struct {
+		arg1 string
+	}
+	revisionsReturns struct {
+		result1 []models.Revision
+		result2 error
+	}
+	revisionsReturnsOnCall map[int]struct {
+		result1 []models.Revision
+		result2 error
+	}
 	SubscribeStub        func(string) error
 	subscribeMutex       sync.RWMutex
 	subscribeArgsForCall []struct {
@@ -128,6 +198,18 @@ type FakeStore struct {
 		result1 []string
 		result2 error
 	}
+	TrashedStub        func() ([]models.TrashedIncident, error)
+	trashedMutex       sync.RWMutex
+	trashedArgsForCall []struct {
+	}
+	trashedReturns struct {
+		result1 []models.TrashedIncident
+		result2 error
+	}
+	trashedReturnsOnCall map[int]struct {
+		result1 []models.TrashedIncident
+		result2 error
+	}
 	UnsubscribeStub        func(string) error
 	unsubscribeMutex       sync.RWMutex
 	unsubscribeArgsForCall []struct {
@@ -153,10 +235,147 @@ type FakeStore struct {
 		result1 models.Incident
 		result2 error
 	}
+	UpdateIfVersionStub        func(string, int, models.Incident) (models.Incident, error)
+	updateIfVersionMutex       sync.RWMutex
+	updateIfVersionArgsForCall []struct {
+		arg1 string
+		arg2 int
+		arg3 models.Incident
+	}
+	updateIfVersionReturns struct {
+		result1 models.Incident
+		result2 error
+	}
+	updateIfVersionReturnsOnCall map[int]struct {
+		result1 models.Incident
+		result2 error
+	}
 	invocations      map[string][][]interface{}
 	invocationsMutex sync.RWMutex
 }
 
+func (fake *FakeStore) AddRevision(arg1 models.Revision) error {
+	fake.addRevisionMutex.Lock()
+	ret, specificReturn := fake.addRevisionReturnsOnCall[len(fake.addRevisionArgsForCall)]
+	fake.addRevisionArgsForCall = append(fake.addRevisionArgsForCall, struct {
+		arg1 models.Revision
+	}{arg1})
+	stub := fake.AddRevisionStub
+	fakeReturns := fake.addRevisionReturns
+	fake.recordInvocation("AddRevision", []interface{}{arg1})
+	fake.addRevisionMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeStore) AddRevisionCallCount() int {
+	fake.addRevisionMutex.RLock()
+	defer fake.addRevisionMutex.RUnlock()
+	return len(fake.addRevisionArgsForCall)
+}
+
+func (fake *FakeStore) AddRevisionCalls(stub func(models.Revision) error) {
+	fake.addRevisionMutex.Lock()
+	defer fake.addRevisionMutex.Unlock()
+	fake.AddRevisionStub = stub
+}
+
+func (fake *FakeStore) AddRevisionArgsForCall(i int) models.Revision {
+	fake.addRevisionMutex.RLock()
+	defer fake.addRevisionMutex.RUnlock()
+	argsForCall := fake.addRevisionArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeStore) AddRevisionReturns(result1 error) {
+	fake.addRevisionMutex.Lock()
+	defer fake.addRevisionMutex.Unlock()
+	fake.AddRevisionStub = nil
+	fake.addRevisionReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeStore) AddRevisionReturnsOnCall(i int, result1 error) {
+	fake.addRevisionMutex.Lock()
+	defer fake.addRevisionMutex.Unlock()
+	fake.AddRevisionStub = nil
+	if fake.addRevisionReturnsOnCall == nil {
+		fake.addRevisionReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.addRevisionReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeStore) AddTrashed(arg1 models.TrashedIncident) error {
+	fake.addTrashedMutex.Lock()
+	ret, specificReturn := fake.addTrashedReturnsOnCall[len(fake.addTrashedArgsForCall)]
+	fake.addTrashedArgsForCall = append(fake.addTrashedArgsForCall, struct {
+		arg1 models.TrashedIncident
+	}{arg1})
+	stub := fake.AddTrashedStub
+	fakeReturns := fake.addTrashedReturns
+	fake.recordInvocation("AddTrashed", []interface{}{arg1})
+	fake.addTrashedMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeStore) AddTrashedCallCount() int {
+	fake.addTrashedMutex.RLock()
+	defer fake.addTrashedMutex.RUnlock()
+	return len(fake.addTrashedArgsForCall)
+}
+
+func (fake *FakeStore) AddTrashedCalls(stub func(models.TrashedIncident) error) {
+	fake.addTrashedMutex.Lock()
+	defer fake.addTrashedMutex.Unlock()
+	fake.AddTrashedStub = stub
+}
+
+func (fake *FakeStore) AddTrashedArgsForCall(i int) models.TrashedIncident {
+	fake.addTrashedMutex.RLock()
+	defer fake.addTrashedMutex.RUnlock()
+	argsForCall := fake.addTrashedArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeStore) AddTrashedReturns(result1 error) {
+	fake.addTrashedMutex.Lock()
+	defer fake.addTrashedMutex.Unlock()
+	fake.AddTrashedStub = nil
+	fake.addTrashedReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeStore) AddTrashedReturnsOnCall(i int, result1 error) {
+	fake.addTrashedMutex.Lock()
+	defer fake.addTrashedMutex.Unlock()
+	fake.AddTrashedStub = nil
+	if fake.addTrashedReturnsOnCall == nil {
+		fake.addTrashedReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.addTrashedReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
 func (fake *FakeStore) ByDate(arg1 time.Time, arg2 time.Time) ([]models.Incident, error) {
 	fake.byDateMutex.Lock()
 	ret, specificReturn := fake.byDateReturnsOnCall[len(fake.byDateArgsForCall)]
@@ -164,15 +383,16 @@ func (fake *FakeStore) ByDate(arg1 time.Time, arg2 time.Time) ([]models.Incident
 		arg1 time.Time
 		arg2 time.Time
 	}{arg1, arg2})
+	stub := fake.ByDateStub
+	fakeReturns := fake.byDateReturns
 	fake.recordInvocation("ByDate", []interface{}{arg1, arg2})
 	fake.byDateMutex.Unlock()
-	if fake.ByDateStub != nil {
-		return fake.ByDateStub(arg1, arg2)
+	if stub != nil {
+		return stub(arg1, arg2)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
 	}
-	fakeReturns := fake.byDateReturns
 	return fakeReturns.result1, fakeReturns.result2
 }
 
@@ -227,15 +447,16 @@ func (fake *FakeStore) Create(arg1 models.Incident) (models.Incident, error) {
 	fake.createArgsForCall = append(fake.createArgsForCall, struct {
 		arg1 models.Incident
 	}{arg1})
+	stub := fake.CreateStub
+	fakeReturns := fake.createReturns
 	fake.recordInvocation("Create", []interface{}{arg1})
 	fake.createMutex.Unlock()
-	if fake.CreateStub != nil {
-		return fake.CreateStub(arg1)
+	if stub != nil {
+		return stub(arg1)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
 	}
-	fakeReturns := fake.createReturns
 	return fakeReturns.result1, fakeReturns.result2
 }
 
@@ -289,15 +510,16 @@ func (fake *FakeStore) Creator() func(u *url.URL) (storages.Store, error) {
 	ret, specificReturn := fake.creatorReturnsOnCall[len(fake.creatorArgsForCall)]
 	fake.creatorArgsForCall = append(fake.creatorArgsForCall, struct {
 	}{})
+	stub := fake.CreatorStub
+	fakeReturns := fake.creatorReturns
 	fake.recordInvocation("Creator", []interface{}{})
 	fake.creatorMutex.Unlock()
-	if fake.CreatorStub != nil {
-		return fake.CreatorStub()
+	if stub != nil {
+		return stub()
 	}
 	if specificReturn {
 		return ret.result1
 	}
-	fakeReturns := fake.creatorReturns
 	return fakeReturns.result1
 }
 
@@ -342,15 +564,16 @@ func (fake *FakeStore) Delete(arg1 string) error {
 	fake.deleteArgsForCall = append(fake.deleteArgsForCall, struct {
 		arg1 string
 	}{arg1})
+	stub := fake.DeleteStub
+	fakeReturns := fake.deleteReturns
 	fake.recordInvocation("Delete", []interface{}{arg1})
 	fake.deleteMutex.Unlock()
-	if fake.DeleteStub != nil {
-		return fake.DeleteStub(arg1)
+	if stub != nil {
+		return stub(arg1)
 	}
 	if specificReturn {
 		return ret.result1
 	}
-	fakeReturns := fake.deleteReturns
 	return fakeReturns.result1
 }
 
@@ -396,21 +619,83 @@ func (fake *FakeStore) DeleteReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
+func (fake *FakeStore) DeleteTrashed(arg1 string) error {
+	fake.deleteTrashedMutex.Lock()
+	ret, specificReturn := fake.deleteTrashedReturnsOnCall[len(fake.deleteTrashedArgsForCall)]
+	fake.deleteTrashedArgsForCall = append(fake.deleteTrashedArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.DeleteTrashedStub
+	fakeReturns := fake.deleteTrashedReturns
+	fake.recordInvocation("DeleteTrashed", []interface{}{arg1})
+	fake.deleteTrashedMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeStore) DeleteTrashedCallCount() int {
+	fake.deleteTrashedMutex.RLock()
+	defer fake.deleteTrashedMutex.RUnlock()
+	return len(fake.deleteTrashedArgsForCall)
+}
+
+func (fake *FakeStore) DeleteTrashedCalls(stub func(string) error) {
+	fake.deleteTrashedMutex.Lock()
+	defer fake.deleteTrashedMutex.Unlock()
+	fake.DeleteTrashedStub = stub
+}
+
+func (fake *FakeStore) DeleteTrashedArgsForCall(i int) string {
+	fake.deleteTrashedMutex.RLock()
+	defer fake.deleteTrashedMutex.RUnlock()
+	argsForCall := fake.deleteTrashedArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeStore) DeleteTrashedReturns(result1 error) {
+	fake.deleteTrashedMutex.Lock()
+	defer fake.deleteTrashedMutex.Unlock()
+	fake.DeleteTrashedStub = nil
+	fake.deleteTrashedReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeStore) DeleteTrashedReturnsOnCall(i int, result1 error) {
+	fake.deleteTrashedMutex.Lock()
+	defer fake.deleteTrashedMutex.Unlock()
+	fake.DeleteTrashedStub = nil
+	if fake.deleteTrashedReturnsOnCall == nil {
+		fake.deleteTrashedReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.deleteTrashedReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
 func (fake *FakeStore) Detect(arg1 *url.URL) bool {
 	fake.detectMutex.Lock()
 	ret, specificReturn := fake.detectReturnsOnCall[len(fake.detectArgsForCall)]
 	fake.detectArgsForCall = append(fake.detectArgsForCall, struct {
 		arg1 *url.URL
 	}{arg1})
+	stub := fake.DetectStub
+	fakeReturns := fake.detectReturns
 	fake.recordInvocation("Detect", []interface{}{arg1})
 	fake.detectMutex.Unlock()
-	if fake.DetectStub != nil {
-		return fake.DetectStub(arg1)
+	if stub != nil {
+		return stub(arg1)
 	}
 	if specificReturn {
 		return ret.result1
 	}
-	fakeReturns := fake.detectReturns
 	return fakeReturns.result1
 }
 
@@ -461,15 +746,16 @@ func (fake *FakeStore) Persistents() ([]models.Incident, error) {
 	ret, specificReturn := fake.persistentsReturnsOnCall[len(fake.persistentsArgsForCall)]
 	fake.persistentsArgsForCall = append(fake.persistentsArgsForCall, struct {
 	}{})
+	stub := fake.PersistentsStub
+	fakeReturns := fake.persistentsReturns
 	fake.recordInvocation("Persistents", []interface{}{})
 	fake.persistentsMutex.Unlock()
-	if fake.PersistentsStub != nil {
-		return fake.PersistentsStub()
+	if stub != nil {
+		return stub()
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
 	}
-	fakeReturns := fake.persistentsReturns
 	return fakeReturns.result1, fakeReturns.result2
 }
 
@@ -516,15 +802,16 @@ func (fake *FakeStore) Ping() error {
 	ret, specificReturn := fake.pingReturnsOnCall[len(fake.pingArgsForCall)]
 	fake.pingArgsForCall = append(fake.pingArgsForCall, struct {
 	}{})
+	stub := fake.PingStub
+	fakeReturns := fake.pingReturns
 	fake.recordInvocation("Ping", []interface{}{})
 	fake.pingMutex.Unlock()
-	if fake.PingStub != nil {
-		return fake.PingStub()
+	if stub != nil {
+		return stub()
 	}
 	if specificReturn {
 		return ret.result1
 	}
-	fakeReturns := fake.pingReturns
 	return fakeReturns.result1
 }
 
@@ -563,21 +850,86 @@ func (fake *FakeStore) PingReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
+func (fake *FakeStore) Query(arg1 storages.IncidentQuery) (storages.IncidentPage, error) {
+	fake.queryMutex.Lock()
+	ret, specificReturn := fake.queryReturnsOnCall[len(fake.queryArgsForCall)]
+	fake.queryArgsForCall = append(fake.queryArgsForCall, struct {
+		arg1 storages.IncidentQuery
+	}{arg1})
+	stub := fake.QueryStub
+	fakeReturns := fake.queryReturns
+	fake.recordInvocation("Query", []interface{}{arg1})
+	fake.queryMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeStore) QueryCallCount() int {
+	fake.queryMutex.RLock()
+	defer fake.queryMutex.RUnlock()
+	return len(fake.queryArgsForCall)
+}
+
+func (fake *FakeStore) QueryCalls(stub func(storages.IncidentQuery) (storages.IncidentPage, error)) {
+	fake.queryMutex.Lock()
+	defer fake.queryMutex.Unlock()
+	fake.QueryStub = stub
+}
+
+func (fake *FakeStore) QueryArgsForCall(i int) storages.IncidentQuery {
+	fake.queryMutex.RLock()
+	defer fake.queryMutex.RUnlock()
+	argsForCall := fake.queryArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeStore) QueryReturns(result1 storages.IncidentPage, result2 error) {
+	fake.queryMutex.Lock()
+	defer fake.queryMutex.Unlock()
+	fake.QueryStub = nil
+	fake.queryReturns = struct {
+		result1 storages.IncidentPage
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeStore) QueryReturnsOnCall(i int, result1 storages.IncidentPage, result2 error) {
+	fake.queryMutex.Lock()
+	defer fake.queryMutex.Unlock()
+	fake.QueryStub = nil
+	if fake.queryReturnsOnCall == nil {
+		fake.queryReturnsOnCall = make(map[int]struct {
+			result1 storages.IncidentPage
+			result2 error
+		})
+	}
+	fake.queryReturnsOnCall[i] = struct {
+		result1 storages.IncidentPage
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeStore) Read(arg1 string) (models.Incident, error) {
 	fake.readMutex.Lock()
 	ret, specificReturn := fake.readReturnsOnCall[len(fake.readArgsForCall)]
 	fake.readArgsForCall = append(fake.readArgsForCall, struct {
 		arg1 string
 	}{arg1})
+	stub := fake.ReadStub
+	fakeReturns := fake.readReturns
 	fake.recordInvocation("Read", []interface{}{arg1})
 	fake.readMutex.Unlock()
-	if fake.ReadStub != nil {
-		return fake.ReadStub(arg1)
+	if stub != nil {
+		return stub(arg1)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
 	}
-	fakeReturns := fake.readReturns
 	return fakeReturns.result1, fakeReturns.result2
 }
 
@@ -626,21 +978,147 @@ func (fake *FakeStore) ReadReturnsOnCall(i int, result1 models.Incident, result2
 	}{result1, result2}
 }
 
+func (fake *FakeStore) ReplaceRevisions(arg1 func(revision models.Revision) (models.Revision, error)) error {
+	fake.replaceRevisionsMutex.Lock()
+	ret, specificReturn := fake.replaceRevisionsReturnsOnCall[len(fake.replaceRevisionsArgsForCall)]
+	fake.replaceRevisionsArgsForCall = append(fake.replaceRevisionsArgsForCall, struct {
+		arg1 func(revision models.Revision) (models.Revision, error)
+	}{arg1})
+	stub := fake.ReplaceRevisionsStub
+	fakeReturns := fake.replaceRevisionsReturns
+	fake.recordInvocation("ReplaceRevisions", []interface{}{arg1})
+	fake.replaceRevisionsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeStore) ReplaceRevisionsCallCount() int {
+	fake.replaceRevisionsMutex.RLock()
+	defer fake.replaceRevisionsMutex.RUnlock()
+	return len(fake.replaceRevisionsArgsForCall)
+}
+
+func (fake *FakeStore) ReplaceRevisionsCalls(stub func(func(revision models.Revision) (models.Revision, error)) error) {
+	fake.replaceRevisionsMutex.Lock()
+	defer fake.replaceRevisionsMutex.Unlock()
+	fake.ReplaceRevisionsStub = stub
+}
+
+func (fake *FakeStore) ReplaceRevisionsArgsForCall(i int) func(revision models.Revision) (models.Revision, error) {
+	fake.replaceRevisionsMutex.RLock()
+	defer fake.replaceRevisionsMutex.RUnlock()
+	argsForCall := fake.replaceRevisionsArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeStore) ReplaceRevisionsReturns(result1 error) {
+	fake.replaceRevisionsMutex.Lock()
+	defer fake.replaceRevisionsMutex.Unlock()
+	fake.ReplaceRevisionsStub = nil
+	fake.replaceRevisionsReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeStore) ReplaceRevisionsReturnsOnCall(i int, result1 error) {
+	fake.replaceRevisionsMutex.Lock()
+	defer fake.replaceRevisionsMutex.Unlock()
+	fake.ReplaceRevisionsStub = nil
+	if fake.replaceRevisionsReturnsOnCall == nil {
+		fake.replaceRevisionsReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.replaceRevisionsReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeStore) Revisions(arg1 string) ([]models.Revision, error) {
+	fake.revisionsMutex.Lock()
+	ret, specificReturn := fake.revisionsReturnsOnCall[len(fake.revisionsArgsForCall)]
+	fake.revisionsArgsForCall = append(fake.revisionsArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.RevisionsStub
+	fakeReturns := fake.revisionsReturns
+	fake.recordInvocation("Revisions", []interface{}{arg1})
+	fake.revisionsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeStore) RevisionsCallCount() int {
+	fake.revisionsMutex.RLock()
+	defer fake.revisionsMutex.RUnlock()
+	return len(fake.revisionsArgsForCall)
+}
+
+func (fake *FakeStore) RevisionsCalls(stub func(string) ([]models.Revision, error)) {
+	fake.revisionsMutex.Lock()
+	defer fake.revisionsMutex.Unlock()
+	fake.RevisionsStub = stub
+}
+
+func (fake *FakeStore) RevisionsArgsForCall(i int) string {
+	fake.revisionsMutex.RLock()
+	defer fake.revisionsMutex.RUnlock()
+	argsForCall := fake.revisionsArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeStore) RevisionsReturns(result1 []models.Revision, result2 error) {
+	fake.revisionsMutex.Lock()
+	defer fake.revisionsMutex.Unlock()
+	fake.RevisionsStub = nil
+	fake.revisionsReturns = struct {
+		result1 []models.Revision
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeStore) RevisionsReturnsOnCall(i int, result1 []models.Revision, result2 error) {
+	fake.revisionsMutex.Lock()
+	defer fake.revisionsMutex.Unlock()
+	fake.RevisionsStub = nil
+	if fake.revisionsReturnsOnCall == nil {
+		fake.revisionsReturnsOnCall = make(map[int]struct {
+			result1 []models.Revision
+			result2 error
+		})
+	}
+	fake.revisionsReturnsOnCall[i] = struct {
+		result1 []models.Revision
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeStore) Subscribe(arg1 string) error {
 	fake.subscribeMutex.Lock()
 	ret, specificReturn := fake.subscribeReturnsOnCall[len(fake.subscribeArgsForCall)]
 	fake.subscribeArgsForCall = append(fake.subscribeArgsForCall, struct {
 		arg1 string
 	}{arg1})
+	stub := fake.SubscribeStub
+	fakeReturns := fake.subscribeReturns
 	fake.recordInvocation("Subscribe", []interface{}{arg1})
 	fake.subscribeMutex.Unlock()
-	if fake.SubscribeStub != nil {
-		return fake.SubscribeStub(arg1)
+	if stub != nil {
+		return stub(arg1)
 	}
 	if specificReturn {
 		return ret.result1
 	}
-	fakeReturns := fake.subscribeReturns
 	return fakeReturns.result1
 }
 
@@ -691,15 +1169,16 @@ func (fake *FakeStore) Subscribers() ([]string, error) {
 	ret, specificReturn := fake.subscribersReturnsOnCall[len(fake.subscribersArgsForCall)]
 	fake.subscribersArgsForCall = append(fake.subscribersArgsForCall, struct {
 	}{})
+	stub := fake.SubscribersStub
+	fakeReturns := fake.subscribersReturns
 	fake.recordInvocation("Subscribers", []interface{}{})
 	fake.subscribersMutex.Unlock()
-	if fake.SubscribersStub != nil {
-		return fake.SubscribersStub()
+	if stub != nil {
+		return stub()
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
 	}
-	fakeReturns := fake.subscribersReturns
 	return fakeReturns.result1, fakeReturns.result2
 }
 
@@ -741,21 +1220,78 @@ func (fake *FakeStore) SubscribersReturnsOnCall(i int, result1 []string, result2
 	}{result1, result2}
 }
 
+func (fake *FakeStore) Trashed() ([]models.TrashedIncident, error) {
+	fake.trashedMutex.Lock()
+	ret, specificReturn := fake.trashedReturnsOnCall[len(fake.trashedArgsForCall)]
+	fake.trashedArgsForCall = append(fake.trashedArgsForCall, struct {
+	}{})
+	stub := fake.TrashedStub
+	fakeReturns := fake.trashedReturns
+	fake.recordInvocation("Trashed", []interface{}{})
+	fake.trashedMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeStore) TrashedCallCount() int {
+	fake.trashedMutex.RLock()
+	defer fake.trashedMutex.RUnlock()
+	return len(fake.trashedArgsForCall)
+}
+
+func (fake *FakeStore) TrashedCalls(stub func() ([]models.TrashedIncident, error)) {
+	fake.trashedMutex.Lock()
+	defer fake.trashedMutex.Unlock()
+	fake.TrashedStub = stub
+}
+
+func (fake *FakeStore) TrashedReturns(result1 []models.TrashedIncident, result2 error) {
+	fake.trashedMutex.Lock()
+	defer fake.trashedMutex.Unlock()
+	fake.TrashedStub = nil
+	fake.trashedReturns = struct {
+		result1 []models.TrashedIncident
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeStore) TrashedReturnsOnCall(i int, result1 []models.TrashedIncident, result2 error) {
+	fake.trashedMutex.Lock()
+	defer fake.trashedMutex.Unlock()
+	fake.TrashedStub = nil
+	if fake.trashedReturnsOnCall == nil {
+		fake.trashedReturnsOnCall = make(map[int]struct {
+			result1 []models.TrashedIncident
+			result2 error
+		})
+	}
+	fake.trashedReturnsOnCall[i] = struct {
+		result1 []models.TrashedIncident
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeStore) Unsubscribe(arg1 string) error {
 	fake.unsubscribeMutex.Lock()
 	ret, specificReturn := fake.unsubscribeReturnsOnCall[len(fake.unsubscribeArgsForCall)]
 	fake.unsubscribeArgsForCall = append(fake.unsubscribeArgsForCall, struct {
 		arg1 string
 	}{arg1})
+	stub := fake.UnsubscribeStub
+	fakeReturns := fake.unsubscribeReturns
 	fake.recordInvocation("Unsubscribe", []interface{}{arg1})
 	fake.unsubscribeMutex.Unlock()
-	if fake.UnsubscribeStub != nil {
-		return fake.UnsubscribeStub(arg1)
+	if stub != nil {
+		return stub(arg1)
 	}
 	if specificReturn {
 		return ret.result1
 	}
-	fakeReturns := fake.unsubscribeReturns
 	return fakeReturns.result1
 }
 
@@ -808,15 +1344,16 @@ func (fake *FakeStore) Update(arg1 string, arg2 models.Incident) (models.Inciden
 		arg1 string
 		arg2 models.Incident
 	}{arg1, arg2})
+	stub := fake.UpdateStub
+	fakeReturns := fake.updateReturns
 	fake.recordInvocation("Update", []interface{}{arg1, arg2})
 	fake.updateMutex.Unlock()
-	if fake.UpdateStub != nil {
-		return fake.UpdateStub(arg1, arg2)
+	if stub != nil {
+		return stub(arg1, arg2)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
 	}
-	fakeReturns := fake.updateReturns
 	return fakeReturns.result1, fakeReturns.result2
 }
 
@@ -865,33 +1402,75 @@ func (fake *FakeStore) UpdateReturnsOnCall(i int, result1 models.Incident, resul
 	}{result1, result2}
 }
 
+func (fake *FakeStore) UpdateIfVersion(arg1 string, arg2 int, arg3 models.Incident) (models.Incident, error) {
+	fake.updateIfVersionMutex.Lock()
+	ret, specificReturn := fake.updateIfVersionReturnsOnCall[len(fake.updateIfVersionArgsForCall)]
+	fake.updateIfVersionArgsForCall = append(fake.updateIfVersionArgsForCall, struct {
+		arg1 string
+		arg2 int
+		arg3 models.Incident
+	}{arg1, arg2, arg3})
+	stub := fake.UpdateIfVersionStub
+	fakeReturns := fake.updateIfVersionReturns
+	fake.recordInvocation("UpdateIfVersion", []interface{}{arg1, arg2, arg3})
+	fake.updateIfVersionMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeStore) UpdateIfVersionCallCount() int {
+	fake.updateIfVersionMutex.RLock()
+	defer fake.updateIfVersionMutex.RUnlock()
+	return len(fake.updateIfVersionArgsForCall)
+}
+
+func (fake *FakeStore) UpdateIfVersionCalls(stub func(string, int, models.Incident) (models.Incident, error)) {
+	fake.updateIfVersionMutex.Lock()
+	defer fake.updateIfVersionMutex.Unlock()
+	fake.UpdateIfVersionStub = stub
+}
+
+func (fake *FakeStore) UpdateIfVersionArgsForCall(i int) (string, int, models.Incident) {
+	fake.updateIfVersionMutex.RLock()
+	defer fake.updateIfVersionMutex.RUnlock()
+	argsForCall := fake.updateIfVersionArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeStore) UpdateIfVersionReturns(result1 models.Incident, result2 error) {
+	fake.updateIfVersionMutex.Lock()
+	defer fake.updateIfVersionMutex.Unlock()
+	fake.UpdateIfVersionStub = nil
+	fake.updateIfVersionReturns = struct {
+		result1 models.Incident
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeStore) UpdateIfVersionReturnsOnCall(i int, result1 models.Incident, result2 error) {
+	fake.updateIfVersionMutex.Lock()
+	defer fake.updateIfVersionMutex.Unlock()
+	fake.UpdateIfVersionStub = nil
+	if fake.updateIfVersionReturnsOnCall == nil {
+		fake.updateIfVersionReturnsOnCall = make(map[int]struct {
+			result1 models.Incident
+			result2 error
+		})
+	}
+	fake.updateIfVersionReturnsOnCall[i] = struct {
+		result1 models.Incident
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeStore) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
-	fake.byDateMutex.RLock()
-	defer fake.byDateMutex.RUnlock()
-	fake.createMutex.RLock()
-	defer fake.createMutex.RUnlock()
-	fake.creatorMutex.RLock()
-	defer fake.creatorMutex.RUnlock()
-	fake.deleteMutex.RLock()
-	defer fake.deleteMutex.RUnlock()
-	fake.detectMutex.RLock()
-	defer fake.detectMutex.RUnlock()
-	fake.persistentsMutex.RLock()
-	defer fake.persistentsMutex.RUnlock()
-	fake.pingMutex.RLock()
-	defer fake.pingMutex.RUnlock()
-	fake.readMutex.RLock()
-	defer fake.readMutex.RUnlock()
-	fake.subscribeMutex.RLock()
-	defer fake.subscribeMutex.RUnlock()
-	fake.subscribersMutex.RLock()
-	defer fake.subscribersMutex.RUnlock()
-	fake.unsubscribeMutex.RLock()
-	defer fake.unsubscribeMutex.RUnlock()
-	fake.updateMutex.RLock()
-	defer fake.updateMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
 	for key, value := range fake.invocations {
 		copiedInvocations[key] = value
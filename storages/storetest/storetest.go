@@ -0,0 +1,449 @@
+package storetest
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+	"github.com/orange-cloudfoundry/statusetat/v2/storages"
+)
+
+// Builder gives a new and empty store, it is called before each spec.
+// Resources used by store can be released with ginkgo DeferCleanup.
+type Builder func() storages.Store
+
+// Describe registers specs checking that stores made by build behave as every storages.Store must behave,
+// it must be called in a ginkgo suite, e.g. var _ = storetest.Describe("my store", builder).
+func Describe(name string, build Builder) bool {
+	return ginkgo.Describe(name+" conformance", func() {
+		var store storages.Store
+		// dates are truncated as some stores do not keep sub-second precision
+		now := time.Now().UTC().Truncate(time.Second)
+
+		ginkgo.BeforeEach(func() {
+			store = build()
+		})
+
+		create := func(incident models.Incident) {
+			_, err := store.Create(incident)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		read := func(guid string) models.Incident {
+			incident, err := store.Read(guid)
+			Expect(err).ToNot(HaveOccurred())
+			return incident
+		}
+		guids := func(incidents []models.Incident) []string {
+			result := make([]string, len(incidents))
+			for i, incident := range incidents {
+				result[i] = incident.GUID
+			}
+			return result
+		}
+
+		ginkgo.Context("Create and Read", func() {
+			ginkgo.It("should give back created incident", func() {
+				create(fullIncident("inc1", now))
+				expectSameIncident(read("inc1"), fullIncident("inc1", now))
+			})
+			ginkgo.It("should give back created persistent incident", func() {
+				incident := fullIncident("persistent", now)
+				incident.Persistent = true
+				create(incident)
+				expectSameIncident(read("persistent"), incident)
+			})
+			ginkgo.It("should give a not exist error when incident does not exist", func() {
+				_, err := store.Read("unknown")
+				Expect(err).To(HaveOccurred())
+				Expect(os.IsNotExist(err)).To(BeTrue(), "error must match os.IsNotExist, got: %v", err)
+			})
+		})
+
+		ginkgo.Context("Update", func() {
+			ginkgo.It("should replace content of incident", func() {
+				create(fullIncident("inc1", now))
+
+				updated := fullIncident("inc1", now)
+				updated.UpdatedAt = now.Add(time.Minute)
+				updated.State = models.Resolved
+				updated.ComponentState = models.Operational
+				updated.Messages = append([]models.Message{{
+					GUID:         "inc1-msg2",
+					IncidentGUID: "inc1",
+					CreatedAt:    now.Add(time.Minute),
+					Title:        "resolved",
+					Content:      "it works again",
+				}}, updated.Messages...)
+				updated.Metadata = []models.Metadata{{IncidentGUID: "inc1", Key: "key", Value: "new value"}}
+				updated.Version = 2
+				_, err := store.Update("inc1", updated)
+				Expect(err).ToNot(HaveOccurred())
+
+				expectSameIncident(read("inc1"), updated)
+			})
+			ginkgo.It("should set back fields to their zero value", func() {
+				incident := fullIncident("inc1", now)
+				incident.State = models.Resolved
+				incident.IsScheduled = true
+				incident.ScheduledEnd = now.Add(time.Hour)
+				create(incident)
+
+				updated := fullIncident("inc1", now)
+				updated.State = models.Unresolved
+				updated.ComponentState = models.Operational
+				updated.Origin = ""
+				_, err := store.Update("inc1", updated)
+				Expect(err).ToNot(HaveOccurred())
+
+				expectSameIncident(read("inc1"), updated)
+			})
+			ginkgo.It("should move incident to persistent incidents and back", func() {
+				create(fullIncident("inc1", now))
+
+				persistent := fullIncident("inc1", now)
+				persistent.Persistent = true
+				_, err := store.Update("inc1", persistent)
+				Expect(err).ToNot(HaveOccurred())
+				expectSameIncident(read("inc1"), persistent)
+				incidents, err := store.ByDate(now.Add(-time.Hour), now.Add(time.Hour))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(guids(incidents)).To(BeEmpty())
+				persistents, err := store.Persistents()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(guids(persistents)).To(ConsistOf("inc1"))
+
+				_, err = store.Update("inc1", fullIncident("inc1", now))
+				Expect(err).ToNot(HaveOccurred())
+				expectSameIncident(read("inc1"), fullIncident("inc1", now))
+				incidents, err = store.ByDate(now.Add(-time.Hour), now.Add(time.Hour))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(guids(incidents)).To(ConsistOf("inc1"))
+				persistents, err = store.Persistents()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(guids(persistents)).To(BeEmpty())
+			})
+			ginkgo.It("should create incident when it does not exist", func() {
+				_, err := store.Update("inc1", fullIncident("inc1", now))
+				Expect(err).ToNot(HaveOccurred())
+
+				expectSameIncident(read("inc1"), fullIncident("inc1", now))
+				incidents, err := store.ByDate(now.Add(-time.Hour), now.Add(time.Hour))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(guids(incidents)).To(ConsistOf("inc1"))
+			})
+			ginkgo.It("should create persistent incident when it does not exist", func() {
+				persistent := fullIncident("persistent", now)
+				persistent.Persistent = true
+				_, err := store.Update("persistent", persistent)
+				Expect(err).ToNot(HaveOccurred())
+
+				expectSameIncident(read("persistent"), persistent)
+				persistents, err := store.Persistents()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(guids(persistents)).To(ConsistOf("persistent"))
+			})
+		})
+
+		ginkgo.Context("UpdateIfVersion", func() {
+			ginkgo.It("should update incident still at version", func() {
+				create(fullIncident("inc1", now))
+
+				updated := fullIncident("inc1", now)
+				updated.State = models.Resolved
+				updated.Version = 2
+				_, err := store.UpdateIfVersion("inc1", 1, updated)
+				Expect(err).ToNot(HaveOccurred())
+				expectSameIncident(read("inc1"), updated)
+			})
+			ginkgo.It("should give a version conflict and keep incident when it is at another version", func() {
+				create(fullIncident("inc1", now))
+
+				updated := fullIncident("inc1", now)
+				updated.State = models.Resolved
+				updated.Version = 3
+				_, err := store.UpdateIfVersion("inc1", 2, updated)
+				Expect(errors.Is(err, storages.ErrVersionConflict)).To(BeTrue(), "error must be storages.ErrVersionConflict, got: %v", err)
+				expectSameIncident(read("inc1"), fullIncident("inc1", now))
+			})
+			ginkgo.It("should check version of persistent incident", func() {
+				incident := fullIncident("persistent", now)
+				incident.Persistent = true
+				create(incident)
+
+				updated := incident
+				updated.Version = 3
+				_, err := store.UpdateIfVersion("persistent", 2, updated)
+				Expect(errors.Is(err, storages.ErrVersionConflict)).To(BeTrue(), "error must be storages.ErrVersionConflict, got: %v", err)
+
+				updated.Persistent = false
+				updated.Version = 2
+				_, err = store.UpdateIfVersion("persistent", 1, updated)
+				Expect(err).ToNot(HaveOccurred())
+				expectSameIncident(read("persistent"), updated)
+				persistents, err := store.Persistents()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(guids(persistents)).To(BeEmpty())
+			})
+			ginkgo.It("should give a not exist error when incident does not exist", func() {
+				_, err := store.UpdateIfVersion("unknown", 1, fullIncident("unknown", now))
+				Expect(os.IsNotExist(err)).To(BeTrue(), "error must match os.IsNotExist, got: %v", err)
+			})
+		})
+
+		ginkgo.Context("Delete", func() {
+			ginkgo.It("should remove incident", func() {
+				create(fullIncident("inc1", now))
+				create(fullIncident("inc2", now))
+
+				Expect(store.Delete("inc1")).To(Succeed())
+				_, err := store.Read("inc1")
+				Expect(os.IsNotExist(err)).To(BeTrue(), "error must match os.IsNotExist, got: %v", err)
+				incidents, err := store.ByDate(now.Add(-time.Hour), now.Add(time.Hour))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(guids(incidents)).To(ConsistOf("inc2"))
+			})
+			ginkgo.It("should remove persistent incident", func() {
+				incident := fullIncident("persistent", now)
+				incident.Persistent = true
+				create(incident)
+
+				Expect(store.Delete("persistent")).To(Succeed())
+				_, err := store.Read("persistent")
+				Expect(os.IsNotExist(err)).To(BeTrue(), "error must match os.IsNotExist, got: %v", err)
+				persistents, err := store.Persistents()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(persistents).To(BeEmpty())
+			})
+			ginkgo.It("should give a not exist error when incident does not exist", func() {
+				err := store.Delete("unknown")
+				Expect(err).To(HaveOccurred())
+				Expect(os.IsNotExist(err)).To(BeTrue(), "error must match os.IsNotExist, got: %v", err)
+			})
+		})
+
+		ginkgo.Context("ByDate", func() {
+			ginkgo.It("should give incidents created between dates included", func() {
+				from := now.Add(-time.Hour)
+				to := now.Add(time.Hour)
+				create(fullIncident("before", from.Add(-time.Second)))
+				create(fullIncident("at-from", from))
+				create(fullIncident("between", now))
+				create(fullIncident("at-to", to))
+				create(fullIncident("after", to.Add(time.Second)))
+				persistent := fullIncident("persistent", now)
+				persistent.Persistent = true
+				create(persistent)
+
+				incidents, err := store.ByDate(from, to)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(guids(incidents)).To(ConsistOf("at-from", "between", "at-to"))
+			})
+			ginkgo.It("should give an empty list when there is no incident", func() {
+				incidents, err := store.ByDate(now.Add(-time.Hour), now.Add(time.Hour))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(incidents).To(BeEmpty())
+				persistents, err := store.Persistents()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(persistents).To(BeEmpty())
+			})
+		})
+
+		ginkgo.Context("Query", func() {
+			ginkgo.It("should filter and paginate incidents, most recent first", func() {
+				for i, guid := range []string{"inc1", "inc2", "inc3"} {
+					create(fullIncident(guid, now.Add(time.Duration(i)*time.Minute)))
+				}
+				resolved := fullIncident("resolved", now)
+				resolved.State = models.Resolved
+				create(resolved)
+
+				page, err := store.Query(storages.IncidentQuery{
+					States: []models.IncidentState{models.Monitoring},
+					Limit:  2,
+				})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(guids(page.Incidents)).To(Equal([]string{"inc3", "inc2"}))
+				Expect(page.NextCursor).ToNot(BeEmpty())
+
+				page, err = store.Query(storages.IncidentQuery{
+					States: []models.IncidentState{models.Monitoring},
+					Limit:  2,
+					Cursor: page.NextCursor,
+				})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(guids(page.Incidents)).To(Equal([]string{"inc1"}))
+				Expect(page.NextCursor).To(BeEmpty())
+			})
+		})
+
+		ginkgo.Context("Revisions", func() {
+			ginkgo.It("should give revisions of an incident oldest first", func() {
+				for i, guid := range []string{"rev2", "rev1"} {
+					err := store.AddRevision(models.Revision{
+						GUID:         guid,
+						IncidentGUID: "inc1",
+						CreatedAt:    now.Add(-time.Duration(i) * time.Minute),
+						Actor:        "admin",
+						Action:       models.RevisionUpdated,
+					})
+					Expect(err).ToNot(HaveOccurred())
+				}
+				Expect(store.AddRevision(models.Revision{GUID: "other", IncidentGUID: "inc2", CreatedAt: now})).To(Succeed())
+
+				revisions, err := store.Revisions("inc1")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(revisions).To(HaveLen(2))
+				Expect(revisions[0].GUID).To(Equal("rev1"))
+				Expect(revisions[1].GUID).To(Equal("rev2"))
+				Expect(revisions[1].Actor).To(Equal("admin"))
+			})
+			ginkgo.It("should give an empty list for incident without revision", func() {
+				revisions, err := store.Revisions("unknown")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(revisions).To(BeEmpty())
+			})
+			ginkgo.It("should replace revisions of all incidents", func() {
+				for _, incidentGuid := range []string{"inc1", "inc2"} {
+					err := store.AddRevision(models.Revision{
+						GUID:         "rev-" + incidentGuid,
+						IncidentGUID: incidentGuid,
+						CreatedAt:    now,
+						Actor:        "admin",
+						Action:       models.RevisionUpdated,
+					})
+					Expect(err).ToNot(HaveOccurred())
+				}
+
+				err := store.ReplaceRevisions(func(revision models.Revision) (models.Revision, error) {
+					revision.Actor = "replaced " + revision.IncidentGUID
+					return revision, nil
+				})
+				Expect(err).ToNot(HaveOccurred())
+
+				for _, incidentGuid := range []string{"inc1", "inc2"} {
+					revisions, err := store.Revisions(incidentGuid)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(revisions).To(HaveLen(1))
+					Expect(revisions[0].GUID).To(Equal("rev-" + incidentGuid))
+					Expect(revisions[0].Actor).To(Equal("replaced " + incidentGuid))
+				}
+			})
+		})
+
+		ginkgo.Context("Trash", func() {
+			ginkgo.It("should keep trashed incidents until removed from trash", func() {
+				Expect(store.AddTrashed(models.TrashedIncident{Incident: fullIncident("old", now), TrashedAt: now.Add(-time.Hour), TrashedBy: "admin"})).To(Succeed())
+				Expect(store.AddTrashed(models.TrashedIncident{Incident: fullIncident("recent", now), TrashedAt: now, TrashedBy: "admin"})).To(Succeed())
+
+				trashed, err := store.Trashed()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(trashed).To(HaveLen(2))
+				Expect(trashed[0].Incident.GUID).To(Equal("recent"))
+				Expect(trashed[1].Incident.GUID).To(Equal("old"))
+				expectSameIncident(trashed[1].Incident, fullIncident("old", now))
+
+				Expect(store.DeleteTrashed("old")).To(Succeed())
+				trashed, err = store.Trashed()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(trashed).To(HaveLen(1))
+			})
+			ginkgo.It("should give a not exist error when incident is not in trash", func() {
+				err := store.DeleteTrashed("unknown")
+				Expect(err).To(HaveOccurred())
+				Expect(os.IsNotExist(err)).To(BeTrue(), "error must match os.IsNotExist, got: %v", err)
+			})
+		})
+
+		ginkgo.Context("Subscribers", func() {
+			ginkgo.It("should give an empty list when there is no subscriber", func() {
+				subs, err := store.Subscribers()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(subs).To(BeEmpty())
+			})
+			ginkgo.It("should add and remove subscribers", func() {
+				Expect(store.Subscribe("user1@local.com")).To(Succeed())
+				Expect(store.Subscribe("user2@local.com")).To(Succeed())
+				subs, err := store.Subscribers()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(subs).To(ConsistOf("user1@local.com", "user2@local.com"))
+
+				Expect(store.Unsubscribe("user1@local.com")).To(Succeed())
+				subs, err = store.Subscribers()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(subs).To(ConsistOf("user2@local.com"))
+			})
+			ginkgo.It("should ignore subscription of an already subscribed email", func() {
+				Expect(store.Subscribe("user@local.com")).To(Succeed())
+				Expect(store.Subscribe("user@local.com")).To(Succeed())
+				subs, err := store.Subscribers()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(subs).To(ConsistOf("user@local.com"))
+			})
+			ginkgo.It("should ignore unsubscription of an unknown email", func() {
+				Expect(store.Unsubscribe("unknown@local.com")).To(Succeed())
+			})
+		})
+
+		ginkgo.It("should be reachable", func() {
+			Expect(store.Ping()).To(Succeed())
+		})
+	})
+}
+
+// fullIncident gives an incident with every field set.
+func fullIncident(guid string, createdAt time.Time) models.Incident {
+	components := models.Components{{Name: "api", Group: "platform"}, {Name: "web"}}
+	return models.Incident{
+		GUID:           guid,
+		CreatedAt:      createdAt,
+		UpdatedAt:      createdAt,
+		State:          models.Monitoring,
+		ComponentState: models.MajorOutage,
+		Components:     &components,
+		Messages: []models.Message{{
+			GUID:         guid + "-msg",
+			IncidentGUID: guid,
+			CreatedAt:    createdAt,
+			Title:        "database is down",
+			Content:      "we are investigating",
+		}},
+		Metadata: []models.Metadata{{IncidentGUID: guid, Key: "key", Value: "value"}},
+		Origin:   "storetest",
+		Version:  1,
+	}
+}
+
+// expectSameIncident compares incidents field by field, dates are compared as instants as stores may change their location.
+func expectSameIncident(actual, expected models.Incident) {
+	ginkgo.GinkgoHelper()
+	Expect(actual.GUID).To(Equal(expected.GUID))
+	Expect(actual.CreatedAt).To(BeTemporally("==", expected.CreatedAt), "created_at")
+	Expect(actual.UpdatedAt).To(BeTemporally("==", expected.UpdatedAt), "updated_at")
+	Expect(actual.State).To(Equal(expected.State), "state")
+	Expect(actual.ComponentState).To(Equal(expected.ComponentState), "component_state")
+	Expect(actual.IsScheduled).To(Equal(expected.IsScheduled), "is_scheduled")
+	Expect(actual.ScheduledEnd).To(BeTemporally("==", expected.ScheduledEnd), "scheduled_end")
+	Expect(actual.Origin).To(Equal(expected.Origin), "origin")
+	Expect(actual.Persistent).To(Equal(expected.Persistent), "persistent")
+	Expect(actual.Version).To(Equal(expected.Version), "version")
+
+	Expect(actual.Components).ToNot(BeNil(), "components")
+	Expect(*actual.Components).To(Equal(*expected.Components), "components")
+
+	Expect(actual.Messages).To(HaveLen(len(expected.Messages)), "messages")
+	for i, msg := range expected.Messages {
+		Expect(actual.Messages[i].GUID).To(Equal(msg.GUID), "messages must be sorted most recent first")
+		Expect(actual.Messages[i].Title).To(Equal(msg.Title))
+		Expect(actual.Messages[i].Content).To(Equal(msg.Content))
+		Expect(actual.Messages[i].CreatedAt).To(BeTemporally("==", msg.CreatedAt))
+	}
+	Expect(actual.Metadata).To(HaveLen(len(expected.Metadata)), "metadata")
+	for i, meta := range expected.Metadata {
+		Expect(actual.Metadata[i].Key).To(Equal(meta.Key))
+		Expect(actual.Metadata[i].Value).To(Equal(meta.Value))
+	}
+}
@@ -0,0 +1,93 @@
+package storages
+
+import (
+	"time"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+)
+
+// tombstones keeps when incidents were deleted and emails unsubscribed through Replicate, they prevent
+// a store lagging behind to bring them back during reconciliation or reads.
+// They are kept in replay journal, if any, and forgotten after ttl.
+type tombstones struct {
+	incidents   map[string]time.Time
+	subscribers map[string]time.Time
+	ttl         time.Duration
+}
+
+func newTombstones(ttl time.Duration) *tombstones {
+	return &tombstones{
+		incidents:   make(map[string]time.Time),
+		subscribers: make(map[string]time.Time),
+		ttl:         ttl,
+	}
+}
+
+// set records a deletion (deleted or unsubscribe) of key done at given time or forgets it when key
+// is written again (created, updated or subscribe), it gives false when there was nothing to change.
+func (t *tombstones) set(action recordAction, key string, at time.Time) bool {
+	switch action {
+	case deleted:
+		t.incidents[key] = at
+		return true
+	case unsubscribe:
+		t.subscribers[key] = at
+		return true
+	case created, updated:
+		_, ok := t.incidents[key]
+		delete(t.incidents, key)
+		return ok
+	case subscribe:
+		_, ok := t.subscribers[key]
+		delete(t.subscribers, key)
+		return ok
+	}
+	return false
+}
+
+// expire forgets deletions older than ttl.
+func (t *tombstones) expire(now time.Time) {
+	for key, at := range t.incidents {
+		if now.Sub(at) > t.ttl {
+			delete(t.incidents, key)
+		}
+	}
+	for key, at := range t.subscribers {
+		if now.Sub(at) > t.ttl {
+			delete(t.subscribers, key)
+		}
+	}
+}
+
+// incidentDeleted tells if incident is a copy which was deleted afterward,
+// an incident created again after its deletion (e.g. restored from trash) is newer than its tombstone.
+func (t *tombstones) incidentDeleted(incident models.Incident) bool {
+	at, ok := t.incidents[incident.GUID]
+	return ok && !incident.UpdatedAt.After(at)
+}
+
+func (t *tombstones) unsubscribed(email string) bool {
+	_, ok := t.subscribers[email]
+	return ok
+}
+
+// entries gives journal entries to rebuild tombstones.
+func (t *tombstones) entries() []journalEntry {
+	entries := make([]journalEntry, 0, len(t.incidents)+len(t.subscribers))
+	for guid, at := range t.incidents {
+		entries = append(entries, tombstoneEntry(deleted, guid, at))
+	}
+	for email, at := range t.subscribers {
+		entries = append(entries, tombstoneEntry(unsubscribe, email, at))
+	}
+	return entries
+}
+
+func tombstoneEntry(action recordAction, key string, at time.Time) journalEntry {
+	return journalEntry{
+		Tombstone: true,
+		Action:    action,
+		Data:      key,
+		At:        &at,
+	}
+}
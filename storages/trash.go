@@ -0,0 +1,56 @@
+package storages
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+)
+
+var trashPurged = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "statusetat_trash_purged_total",
+	Help: "Number of incidents definitively removed from trash after retention.",
+})
+
+// PurgeTrashLoop purges trash of store every interval, it never returns.
+func PurgeTrashLoop(store Store, retention, interval time.Duration) {
+	for {
+		_, err := PurgeTrash(store, retention)
+		if err != nil {
+			log.Warningf("Purge of trash finished with errors: %s", err.Error())
+		}
+		time.Sleep(interval)
+	}
+}
+
+// PurgeTrash definitively removes incidents trashed for more than retention, it gives number of incidents purged.
+func PurgeTrash(store Store, retention time.Duration) (int, error) {
+	trashed, err := store.Trashed()
+	if err != nil {
+		return 0, fmt.Errorf("could not read trash: %s", err.Error())
+	}
+	var result error
+	purged := 0
+	now := time.Now()
+	for _, t := range trashed {
+		if t.ExpiresAt(retention).After(now) {
+			continue
+		}
+		err := store.DeleteTrashed(t.Incident.GUID)
+		if err != nil && !os.IsNotExist(err) {
+			result = multierror.Append(result, fmt.Errorf("incident %s: %s", t.Incident.GUID, err.Error()))
+			continue
+		}
+		log.WithField("guid", t.Incident.GUID).Info("Incident purged from trash")
+		purged++
+	}
+	trashPurged.Add(float64(purged))
+	if purged > 0 {
+		log.Infof("Purge of trash done, %d incident(s) purged", purged)
+	}
+	return purged, result
+}
@@ -0,0 +1,124 @@
+package storages_test
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+	"github.com/orange-cloudfoundry/statusetat/v2/storages"
+	"github.com/orange-cloudfoundry/statusetat/v2/utils"
+)
+
+var _ = Describe("Trash", func() {
+	tmpDirTrash := filepath.Join(os.TempDir(), "statusetat-test-trash")
+	now := time.Now().UTC().Truncate(time.Second)
+	nbDb := 0
+
+	storeBuilders := map[string]func() storages.Store{
+		"sqlite": func() storages.Store {
+			u, _ := url.Parse("sqlite://:memory:")
+			store, err := (&storages.DB{}).Creator()(u)
+			Expect(err).ToNot(HaveOccurred())
+			return store
+		},
+		"local": func() storages.Store {
+			u, _ := url.Parse("file://" + filepath.Join(tmpDirTrash, "local"))
+			store, err := (&storages.Local{}).Creator()(u)
+			Expect(err).ToNot(HaveOccurred())
+			return store
+		},
+		"bolt": func() storages.Store {
+			nbDb++
+			u, _ := url.Parse(fmt.Sprintf("bolt://%s/store-%d.db", tmpDirTrash, nbDb))
+			store, err := (&storages.Bolt{}).Creator()(u)
+			Expect(err).ToNot(HaveOccurred())
+			return store
+		},
+		"s3": func() storages.Store {
+			if caBundle, ok := os.LookupEnv("AWS_CA_BUNDLE"); ok {
+				Expect(os.Unsetenv("AWS_CA_BUNDLE")).To(Succeed())
+				DeferCleanup(os.Setenv, "AWS_CA_BUNDLE", caBundle)
+			}
+			backend := s3mem.New()
+			Expect(backend.CreateBucket("statusetat")).To(Succeed())
+			server := httptest.NewTLSServer(gofakes3.New(backend).Server())
+			DeferCleanup(server.Close)
+			store, err := newS3Store("s3://key:secret@" + strings.TrimPrefix(server.URL, "https://") + "/statusetat?insecure-skip-verify=true")
+			Expect(err).ToNot(HaveOccurred())
+			return store
+		},
+	}
+
+	for name, builder := range storeBuilders {
+		name, builder := name, builder
+		Context(fmt.Sprintf("with %s store", name), func() {
+			var store storages.Store
+			BeforeEach(func() {
+				store = builder()
+				Expect(store.AddTrashed(models.TrashedIncident{
+					Incident:  models.Incident{GUID: "old", CreatedAt: now.Add(-48 * time.Hour), UpdatedAt: now},
+					TrashedAt: now.Add(-24 * time.Hour),
+					TrashedBy: "admin",
+				})).To(Succeed())
+				Expect(store.AddTrashed(models.TrashedIncident{
+					Incident: models.Incident{
+						GUID: "recent", CreatedAt: now.Add(-time.Hour), UpdatedAt: now,
+						Messages: models.Messages{{GUID: "msg", IncidentGUID: "recent", CreatedAt: now, Title: "a title"}},
+					},
+					TrashedAt: now,
+					TrashedBy: "operator",
+				})).To(Succeed())
+			})
+			AfterEach(func() {
+				utils.RemoveDir(tmpDirTrash)
+			})
+			It("should give trashed incidents most recent first", func() {
+				trashed, err := store.Trashed()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(trashed).To(HaveLen(2))
+				Expect(trashed[0].Incident.GUID).To(Equal("recent"))
+				Expect(trashed[0].TrashedAt).To(BeTemporally("==", now))
+				Expect(trashed[0].TrashedBy).To(Equal("operator"))
+				Expect(trashed[0].Incident.MainMessage().Title).To(Equal("a title"))
+				Expect(trashed[1].Incident.GUID).To(Equal("old"))
+			})
+			It("should not give trashed incidents as incidents", func() {
+				incidents, err := store.ByDate(now.Add(-72*time.Hour), now)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(incidents).To(BeEmpty())
+				_, err = store.Read("recent")
+				Expect(os.IsNotExist(err)).To(BeTrue())
+			})
+			It("should remove incident from trash", func() {
+				Expect(store.DeleteTrashed("recent")).To(Succeed())
+				trashed, err := store.Trashed()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(trashed).To(HaveLen(1))
+				Expect(trashed[0].Incident.GUID).To(Equal("old"))
+			})
+			It("should give not exist error when removing an incident not in trash", func() {
+				err := store.DeleteTrashed("unknown")
+				Expect(os.IsNotExist(err)).To(BeTrue())
+			})
+			It("should only purge incidents trashed for more than retention", func() {
+				purged, err := storages.PurgeTrash(store, 12*time.Hour)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(purged).To(Equal(1))
+				trashed, err := store.Trashed()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(trashed).To(HaveLen(1))
+				Expect(trashed[0].Incident.GUID).To(Equal("recent"))
+			})
+		})
+	}
+})
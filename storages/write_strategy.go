@@ -0,0 +1,195 @@
+package storages
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/orange-cloudfoundry/statusetat/v2/models"
+)
+
+// ErrWritePending is given by parallel writes when fewer stores than required acknowledged a write,
+// write is not lost: it continues in background or is recorded to be replayed on stores which failed it.
+var ErrWritePending = errors.New("write has not been acknowledged by enough stores, it continues in background")
+
+// replicateWrite sends a write to all stores of m, a store failing to write gets a record to replay.
+// Write is considered successful if at least one store acknowledged it.
+// For incident writes, the incident returned by the first store acknowledging is the one given to the
+// next stores and to records, this way generated data (e.g. timestamps set by a database) are the same everywhere.
+func replicateWrite[T any](m *Replicate, action recordAction, data string, incident models.Incident, write func(s Store, incident models.Incident) (T, error)) (T, error) {
+	return replicateWriteOn(m, m.orderedStores(), action, data, incident, write)
+}
+
+// replicateWriteOn works as replicateWrite on given stores only.
+func replicateWriteOn[T any](m *Replicate, stores []namedStore, action recordAction, data string, incident models.Incident, write func(s Store, incident models.Incident) (T, error)) (T, error) {
+	var zero T
+	if len(stores) == 0 {
+		return zero, fmt.Errorf("no store available")
+	}
+	if m.parallelWrites {
+		return parallelWrite(m, stores, action, data, incident, write)
+	}
+
+	acked := false
+	var value T
+	var err error
+	failed := make([]namedStore, 0)
+	for _, s := range stores {
+		var ret T
+		ret, err = write(s.store, incident)
+		if alreadyApplied(action, err) {
+			m.targets.write(s.key, nil)
+			continue
+		}
+		m.targets.write(s.key, err)
+		if err != nil {
+			failed = append(failed, s)
+			continue
+		}
+		if !acked {
+			value = ret
+			acked = true
+			incident = writtenIncident(action, ret, incident)
+		}
+	}
+	for _, s := range failed {
+		m.addRecord(s, action, data, incident)
+	}
+	if !acked {
+		return zero, err
+	}
+	return value, nil
+}
+
+// parallelWrite sends a write to all stores concurrently, it returns as soon as the number of
+// acknowledgements wanted is reached or when write timeout is exceeded,
+// writes still running continue in background and are recorded for replay if they fail.
+// Incident writes are first made on stores one after another until one acknowledges, the incident
+// it returns is then sent concurrently to remaining stores.
+// A write is successful when at least one store acknowledged it, or the number of acknowledgements wanted
+// when set. ErrWritePending is given otherwise if some stores did not answer in time or failed and will have
+// the write replayed, value given is then the one of the store which acknowledged it, if any.
+func parallelWrite[T any](m *Replicate, stores []namedStore, action recordAction, data string, incident models.Incident, write func(s Store, incident models.Incident) (T, error)) (T, error) {
+	var zero T
+
+	need := len(stores)
+	if m.writeAcks > 0 && m.writeAcks < need {
+		need = m.writeAcks
+	}
+	required := 1
+	if m.writeAcks > 0 {
+		required = need
+	}
+
+	// buffered to let writes finishing after we returned to not block
+	results := make(chan readResult[T], len(stores))
+	writeOn := func(s namedStore, incident models.Incident) (T, error) {
+		value, err := write(s.store, incident)
+		if alreadyApplied(action, err) {
+			m.targets.write(s.key, nil)
+		} else {
+			m.targets.write(s.key, err)
+		}
+		results <- readResult[T]{storeUrl: s.url, value: value, err: err}
+		return value, err
+	}
+	fanOut := func(stores []namedStore, incident models.Incident) {
+		for _, s := range stores {
+			m.running.Add(1)
+			go func(s namedStore) {
+				defer m.running.Done()
+				_, err := writeOn(s, incident)
+				if err != nil && !alreadyApplied(action, err) {
+					log.WithField("url", s.url).Debugf("Could not write on store: %s", err.Error())
+					m.addRecord(s, action, data, incident)
+				}
+			}(s)
+		}
+	}
+
+	if action != created && action != updated {
+		fanOut(stores, incident)
+	} else {
+		m.running.Add(1)
+		go func(incident models.Incident) {
+			defer m.running.Done()
+			failed := make([]namedStore, 0)
+			defer func() {
+				for _, s := range failed {
+					m.addRecord(s, action, data, incident)
+				}
+			}()
+			for i, s := range stores {
+				value, err := writeOn(s, incident)
+				if err != nil {
+					log.WithField("url", s.url).Debugf("Could not write on store: %s", err.Error())
+					failed = append(failed, s)
+					continue
+				}
+				incident = writtenIncident(action, value, incident)
+				fanOut(stores[i+1:], incident)
+				return
+			}
+		}(incident)
+	}
+
+	var deadline <-chan time.Time
+	if m.writeTimeout > 0 {
+		timer := time.NewTimer(m.writeTimeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	acks := 0
+	var value T
+	var err error
+	for range stores {
+		select {
+		case result := <-results:
+			if result.err != nil {
+				err = result.err
+				continue
+			}
+			if acks == 0 {
+				value = result.value
+			}
+			acks++
+			if acks >= need {
+				return value, nil
+			}
+		case <-deadline:
+			if acks >= required {
+				return value, nil
+			}
+			log.Warningf("Only %d store(s) acknowledged write after %s on %d required, it continues in background", acks, m.writeTimeout, required)
+			return value, fmt.Errorf("%w: %d acknowledgement(s) on %d required after %s", ErrWritePending, acks, required, m.writeTimeout)
+		}
+	}
+	if acks >= required {
+		return value, nil
+	}
+	if acks > 0 {
+		return value, fmt.Errorf("%w: %d acknowledgement(s) on %d required, last error: %s", ErrWritePending, acks, required, err.Error())
+	}
+	return zero, err
+}
+
+// writtenIncident gives the incident returned by a store for an incident write, incident is kept otherwise.
+func writtenIncident[T any](action recordAction, value T, incident models.Incident) models.Incident {
+	if action != created && action != updated {
+		return incident
+	}
+	if written, ok := any(value).(models.Incident); ok {
+		return written
+	}
+	return incident
+}
+
+// alreadyApplied tells if write failed only because there was nothing to do on store,
+// i.e. removing something which does not exist there, such write must not be replayed.
+func alreadyApplied(action recordAction, err error) bool {
+	return (action == deleted || action == trashDeleted) && os.IsNotExist(err)
+}